@@ -1,23 +1,41 @@
 package main
 
 import (
+	_ "HelaList/drivers/alias"
+	_ "HelaList/drivers/chunker"
+	_ "HelaList/drivers/crypt"
+	_ "HelaList/drivers/ftp"
+	_ "HelaList/drivers/http_index"
+	_ "HelaList/drivers/local"
+	_ "HelaList/drivers/memory"
+	_ "HelaList/drivers/rclone"
+	_ "HelaList/drivers/s3"
+	_ "HelaList/drivers/sftp"
+	_ "HelaList/drivers/url_tree"
 	_ "HelaList/drivers/webdav"
 	"HelaList/internal/bootstrap"
 	"HelaList/internal/model"
 	"HelaList/internal/op"
 	"HelaList/internal/server"
+	"HelaList/internal/task"
 	"context"
 	"log"
 )
 
 func main() {
 	bootstrap.InitDB()
+	if store := bootstrap.InitListCache(); store != nil {
+		op.SetListCache(op.NewRedisListCache(context.Background(), store))
+	}
 	op.LoadAllStorages(context.Background())
-	err := bootstrap.Db.AutoMigrate(&model.User{}, &model.Storage{})
+	op.StartHealthCheck(context.Background())
+	err := bootstrap.Db.AutoMigrate(&model.User{}, &model.Storage{}, &model.DeadProp{}, &model.Task{})
 	if err != nil {
-		log.Fatal("数据库迁移失败: %v", err)
+		log.Fatalf("数据库迁移失败: %v", err)
 	}
 	log.Println("数据库迁移成功！")
+	// 任务表迁移完之后才能恢复上次没跑完的任务
+	task.Init()
 	r := server.Init()
 	if err := r.Run(); err != nil {
 		log.Fatalf("启动服务器失败: %v", err)
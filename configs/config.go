@@ -25,7 +25,10 @@ type Config struct {
 	Database       Database     `json:"database" envPrefix:"DB_"`
 	Redis          redis.Config `json:"redis" envPrefix:"REDIS_"`
 	Tasks          TasksConfig  `json:"tasks" envPrefix:"TASKS_"`
+	Webdav         WebdavConfig `json:"webdav" envPrefix:"WEBDAV_"`
 	RAG            RAGConfig    `json:"rag" envPrefix:"RAG_"`
+	Health         HealthConfig `json:"health" envPrefix:"HEALTH_"`
+	Cache          CacheConfig  `json:"cache" envPrefix:"CACHE_"`
 }
 
 func DefaultConfig(dataDir string) *Config {
@@ -41,6 +44,19 @@ func DefaultConfig(dataDir string) *Config {
 			DSN:      "host=localhost user=suzuki password=suzuki dbname=hela port=5432 sslmode=disable TimeZone=Asia/Shanghai client_encoding=UTF8",
 		},
 		Redis: *redis.DefaultConfig(),
+		Tasks: TasksConfig{
+			Download:         TaskConfig{Workers: 5, MaxRetry: 1, TaskPersistant: true},
+			Transfer:         TaskConfig{Workers: 5, MaxRetry: 2, TaskPersistant: true},
+			Upload:           TaskConfig{Workers: 5, MaxRetry: 2, TaskPersistant: true},
+			Copy:             TaskConfig{Workers: 5, MaxRetry: 2, TaskPersistant: true},
+			Move:             TaskConfig{Workers: 5, MaxRetry: 2, TaskPersistant: true},
+			Decompress:       TaskConfig{Workers: 5, MaxRetry: 2, TaskPersistant: true},
+			DecompressUpload: TaskConfig{Workers: 5, MaxRetry: 2, TaskPersistant: true},
+			Compress:         TaskConfig{Workers: 5, MaxRetry: 2, TaskPersistant: true},
+		},
+		Webdav: WebdavConfig{
+			LockSystem: WebdavLockMemory,
+		},
 		RAG: RAGConfig{
 			Enabled:           true,
 			EmbeddingProvider: "qwen",
@@ -52,6 +68,16 @@ func DefaultConfig(dataDir string) *Config {
 			TopK:              5,
 			MinScore:          0.7,
 		},
+		Health: HealthConfig{
+			Enabled:    true,
+			Interval:   60,
+			Timeout:    10,
+			MinBackoff: 30,
+			MaxBackoff: 1800,
+		},
+		Cache: CacheConfig{
+			ListCache: ListCacheMemory,
+		},
 	}
 }
 
@@ -69,9 +95,42 @@ type TasksConfig struct {
 	Move               TaskConfig `json:"move" envPrefix:"MOVE_"`
 	Decompress         TaskConfig `json:"decompress" envPrefix:"DECOMPRESS_"`
 	DecompressUpload   TaskConfig `json:"decompress_upload" envPrefix:"DECOMPRESS_UPLOAD_"`
+	Compress           TaskConfig `json:"compress" envPrefix:"COMPRESS_"`
 	AllowRetryCanceled bool       `json:"allow_retry_canceled" env:"ALLOW_RETRY_CANCELED"`
 }
 
+const (
+	WebdavLockMemory = "memory"
+	WebdavLockRedis  = "redis"
+)
+
+type WebdavConfig struct {
+	// LockSystem 选择WebDAV锁的存放位置：memory只在本进程内有效，
+	// redis在多个实例之间共享，部署在负载均衡后面时需要用redis
+	LockSystem string `json:"lock_system" env:"LOCK_SYSTEM" envDefault:"memory"`
+}
+
+const (
+	ListCacheMemory = "memory"
+	ListCacheRedis  = "redis"
+)
+
+type CacheConfig struct {
+	// ListCache 目录列表缓存放在哪：memory每个实例各自缓存，
+	// redis所有实例共享，一个节点改了目录别的节点也能马上看到
+	ListCache string `json:"list_cache" env:"LIST_CACHE" envDefault:"memory"`
+}
+
+// HealthConfig 存储健康检查，时间都是秒。
+// 检查失败的存储按MinBackoff、2*MinBackoff...重新初始化，最长间隔MaxBackoff
+type HealthConfig struct {
+	Enabled    bool `json:"enabled" env:"ENABLED" envDefault:"true"`
+	Interval   int  `json:"interval" env:"INTERVAL" envDefault:"60"`
+	Timeout    int  `json:"timeout" env:"TIMEOUT" envDefault:"10"`
+	MinBackoff int  `json:"min_backoff" env:"MIN_BACKOFF" envDefault:"30"`
+	MaxBackoff int  `json:"max_backoff" env:"MAX_BACKOFF" envDefault:"1800"`
+}
+
 type RAGConfig struct {
 	Enabled           bool    `json:"enabled" env:"ENABLED" envDefault:"true"`
 	EmbeddingProvider string  `json:"embedding_provider" env:"EMBEDDING_PROVIDER" envDefault:"qwen"`
@@ -18,6 +18,7 @@ const (
 	UserKey
 	NoTaskKey
 	ApiUrlKey
+	UserAgentKey
 )
 
 const (
@@ -9,4 +9,6 @@ var (
 	MaxBufferLimit = 16 * 1024 * 1024
 	// 超过该阈值的Buffer将使用 mmap 分配，可主动释放内存
 	MmapThreshold = 4 * 1024 * 1024
+	// 一个压缩包解压出来的总大小上限，防止压缩炸弹把磁盘写满
+	MaxExtractSize int64 = 64 * 1024 * 1024 * 1024
 )
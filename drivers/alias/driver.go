@@ -0,0 +1,266 @@
+package alias
+
+import (
+	"HelaList/configs"
+	"HelaList/internal/driver"
+	"HelaList/internal/fs"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	stdpath "path"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// 别名存储：把几个挂载路径合并成一棵虚拟的目录树。
+// 同名目录会合并，同名文件按冲突策略处理。新建目录、上传、复制等写入新内容的操作都落到主路径上，
+// 改名、删除作用在实际存在的对象上。对象的Path是别名存储内的虚拟路径
+
+type Alias struct {
+	model.Storage
+	Addition
+	roots   []string
+	primary string
+}
+
+// 同名文件的冲突策略
+const (
+	ConflictFirst  = "first"  // 按Paths的顺序，排在前面的路径优先
+	ConflictNewest = "newest" // 修改时间最新的优先
+	ConflictSuffix = "suffix" // 都显示，后面路径里的文件名加上" (n)"
+)
+
+type Addition struct {
+	Paths          string `json:"paths" type:"text" required:"true" help:"mount paths to merge, one per line"`
+	ConflictPolicy string `json:"conflict_policy" type:"select" options:"first,newest,suffix" default:"first" help:"which file to show when several paths have the same name"`
+	Primary        string `json:"primary" help:"mount path that receives writes, defaults to the first path"`
+}
+
+var config = driver.Config{
+	Name:        "alias",
+	LocalSort:   true,
+	NoCache:     true, // 被合并的存储自己有缓存
+	DefaultRoot: "/",
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &Alias{}
+	})
+}
+
+func (d *Alias) Config() driver.Config {
+	return config
+}
+
+func (d *Alias) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+// InitReference 备注里写"ref:/别名挂载路径"时，沿用那个别名存储里没有单独填写的配置
+func (d *Alias) InitReference(storage driver.Driver) error {
+	ref, ok := storage.(*Alias)
+	if !ok {
+		return errors.New("referenced storage is not an alias")
+	}
+	if strings.TrimSpace(d.Paths) == "" {
+		d.Paths = ref.Paths
+	}
+	if d.ConflictPolicy == "" {
+		d.ConflictPolicy = ref.ConflictPolicy
+	}
+	if d.Primary == "" {
+		d.Primary = ref.Primary
+	}
+	return nil
+}
+
+func (d *Alias) Init(ctx context.Context) error {
+	d.roots = nil
+	for _, line := range strings.Split(d.Paths, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		root := utils.FixAndCleanPath(line)
+		// 合并自己会无限递归。挂在"/"时所有路径都在别名下面，只能在用到时检查，见realPath
+		if root == d.MountPath || (d.MountPath != "/" && isSubPath(d.MountPath, root)) {
+			return errors.Errorf("path %s is inside the alias itself", root)
+		}
+		d.roots = append(d.roots, root)
+	}
+	if len(d.roots) == 0 {
+		return errors.New("paths is required")
+	}
+	switch d.ConflictPolicy {
+	case ConflictFirst, ConflictNewest, ConflictSuffix:
+	case "":
+		d.ConflictPolicy = ConflictFirst
+	default:
+		return errors.Errorf("unknown conflict policy: %s", d.ConflictPolicy)
+	}
+	d.primary = d.roots[0]
+	if d.Primary != "" {
+		d.primary = utils.FixAndCleanPath(d.Primary)
+		if !utils.SliceContains(d.roots, d.primary) {
+			return errors.Errorf("primary %s is not one of the paths", d.primary)
+		}
+	}
+	return nil
+}
+
+func (d *Alias) Drop(ctx context.Context) error {
+	return nil
+}
+
+func (d *Alias) GetRoot(ctx context.Context) (model.Obj, error) {
+	return &Object{
+		Object: model.Object{
+			Path:     "/",
+			Name:     "root",
+			IsFolder: true,
+		},
+		reals: d.roots,
+	}, nil
+}
+
+func (d *Alias) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	var found bool
+	var entries []entry
+	for i, root := range d.roots {
+		real, err := d.realPath(root, dir.GetPath())
+		if err != nil {
+			continue
+		}
+		objs, err := fs.List(ctx, real, &fs.ListArgs{
+			Refresh: args.Refresh,
+			NoLog:   true,
+		})
+		if err != nil {
+			// 这个目录不一定每个路径下都有
+			continue
+		}
+		found = true
+		for _, obj := range objs {
+			entries = append(entries, entry{root: i, obj: obj})
+		}
+	}
+	if !found {
+		return nil, errors.Errorf("object not found: %s", dir.GetPath())
+	}
+	return d.merge(dir.GetPath(), entries), nil
+}
+
+func (d *Alias) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	obj, err := d.resolve(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	link, _, err := fs.Link(ctx, obj.reals[0], args)
+	return link, err
+}
+
+func (d *Alias) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) error {
+	real, err := d.realPath(d.primary, stdpath.Join(parentDir.GetPath(), dirName))
+	if err != nil {
+		return err
+	}
+	return fs.MakeDir(ctx, real)
+}
+
+// Move 目标目录在源对象所在的路径下也存在时就地移动，否则移到主路径上
+func (d *Alias) Move(ctx context.Context, srcObj, dstDir model.Obj) error {
+	obj, err := d.resolve(ctx, srcObj)
+	if err != nil {
+		return err
+	}
+	ctx = context.WithValue(ctx, configs.NoTaskKey, struct{}{})
+	primaryDst, err := d.realPath(d.primary, dstDir.GetPath())
+	if err != nil {
+		return err
+	}
+	for _, real := range obj.reals {
+		dst := primaryDst
+		for _, root := range d.roots {
+			if isSubPath(root, real) {
+				if sameRoot := stdpath.Join(root, dstDir.GetPath()); exists(ctx, sameRoot) {
+					dst = sameRoot
+				}
+				break
+			}
+		}
+		if _, err = fs.Move(ctx, real, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Alias) Rename(ctx context.Context, srcObj model.Obj, newName string) error {
+	obj, err := d.resolve(ctx, srcObj)
+	if err != nil {
+		return err
+	}
+	for _, real := range obj.reals {
+		if err = fs.Rename(ctx, real, newName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copy 复制出来的新内容都写到主路径上
+func (d *Alias) Copy(ctx context.Context, srcObj, dstDir model.Obj) error {
+	obj, err := d.resolve(ctx, srcObj)
+	if err != nil {
+		return err
+	}
+	ctx = context.WithValue(ctx, configs.NoTaskKey, struct{}{})
+	dst, err := d.realPath(d.primary, dstDir.GetPath())
+	if err != nil {
+		return err
+	}
+	for _, real := range obj.reals {
+		if _, err = fs.Copy(ctx, real, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove 合并目录会把每个路径下的同名目录都删掉
+func (d *Alias) Remove(ctx context.Context, obj model.Obj) error {
+	o, err := d.resolve(ctx, obj)
+	if err != nil {
+		return err
+	}
+	if o.GetPath() == "/" {
+		return errors.New("cannot remove the root folder")
+	}
+	for _, real := range o.reals {
+		if err = fs.Remove(ctx, real); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Alias) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) error {
+	dst, err := d.realPath(d.primary, dstDir.GetPath())
+	if err != nil {
+		return err
+	}
+	return fs.PutDirectly(ctx, dst, file)
+}
+
+var _ driver.Driver = (*Alias)(nil)
+var _ driver.Reference = (*Alias)(nil)
+var _ driver.GetRooter = (*Alias)(nil)
+var _ driver.Mkdir = (*Alias)(nil)
+var _ driver.Move = (*Alias)(nil)
+var _ driver.Rename = (*Alias)(nil)
+var _ driver.Copy = (*Alias)(nil)
+var _ driver.Remove = (*Alias)(nil)
+var _ driver.Put = (*Alias)(nil)
@@ -0,0 +1,205 @@
+package alias
+
+import (
+	_ "HelaList/drivers/memory"
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/fs"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"HelaList/internal/stream"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+)
+
+func storage(t *testing.T, mountPath string, addition Addition) model.Storage {
+	t.Helper()
+	data, err := json.Marshal(addition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model.Storage{MountPath: mountPath, Driver: "alias", Addition: string(data)}
+}
+
+func mount(t *testing.T, mountPath string, addition Addition) *Alias {
+	t.Helper()
+	return drivertest.Mount(t, storage(t, mountPath, addition)).(*Alias)
+}
+
+// put 按给定的修改时间写到被合并的存储里
+func put(t *testing.T, dir, name, content string, modified time.Time) {
+	t.Helper()
+	err := fs.PutDirectly(context.Background(), dir, &stream.FileStream{
+		Obj:    &model.Object{Name: name, Size: int64(len(content)), ModifiedTime: modified},
+		Reader: strings.NewReader(content),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func names(t *testing.T, path string) string {
+	t.Helper()
+	objs, err := fs.List(context.Background(), path, &fs.ListArgs{NoLog: true, Refresh: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for _, obj := range objs {
+		name := obj.GetName()
+		if obj.IsDir() {
+			name += "/"
+		}
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	l, _, err := fs.Link(context.Background(), path, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	rc, err := stream.RangeReadLink(context.Background(), l, http_range.Range{Length: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// mountSources 挂两个内存存储，都有dir目录和同名文件same.txt，第二个里的更新
+func mountSources(t *testing.T, name string) (string, string) {
+	t.Helper()
+	one, two := "/"+name+"-one", "/"+name+"-two"
+	for _, p := range []string{one, two} {
+		drivertest.Mount(t, model.Storage{MountPath: p, CacheExpiration: 30})
+		if err := fs.MakeDir(context.Background(), p+"/dir"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	put(t, one, "same.txt", "one", now.Add(-time.Hour))
+	put(t, two, "same.txt", "two", now)
+	put(t, one+"/dir", "a.txt", "a", now)
+	put(t, two+"/dir", "b.txt", "b", now)
+	return one, two
+}
+
+func TestConformance(t *testing.T) {
+	drivertest.Mount(t, model.Storage{MountPath: "/conformance-src", CacheExpiration: 30})
+	drivertest.Run(t, mount(t, "/conformance", Addition{Paths: "/conformance-src"}))
+}
+
+func TestMerge(t *testing.T) {
+	one, two := mountSources(t, "merge")
+	mount(t, "/merge", Addition{Paths: one + "\n" + two, Primary: two})
+	if got := names(t, "/merge"); got != "dir/,same.txt" {
+		t.Fatalf("root = %s", got)
+	}
+	// 同名目录合并
+	if got := names(t, "/merge/dir"); got != "a.txt,b.txt" {
+		t.Fatalf("dir = %s", got)
+	}
+	if got := read(t, "/merge/dir/a.txt"); got != "a" {
+		t.Fatalf("a.txt = %q", got)
+	}
+
+	// 新内容写到主路径上
+	put(t, "/merge/dir", "new.txt", "new", time.Now())
+	if got := names(t, two+"/dir"); got != "b.txt,new.txt" {
+		t.Fatalf("primary = %s", got)
+	}
+	// 删除合并目录会删掉每个路径下的同名目录
+	if err := fs.Remove(context.Background(), "/merge/dir"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{one, two} {
+		if got := names(t, p); got != "same.txt" {
+			t.Fatalf("%s = %s", p, got)
+		}
+	}
+}
+
+func TestConflictPolicies(t *testing.T) {
+	one, two := mountSources(t, "conflict")
+	paths := one + "\n" + two
+	for _, tc := range []struct {
+		policy string
+		names  string
+		same   string
+	}{
+		{ConflictFirst, "dir/,same.txt", "one"},
+		{ConflictNewest, "dir/,same.txt", "two"},
+		{ConflictSuffix, "dir/,same (2).txt,same.txt", "one"},
+	} {
+		mountPath := "/conflict-" + tc.policy
+		mount(t, mountPath, Addition{Paths: paths, ConflictPolicy: tc.policy})
+		if got := names(t, mountPath); got != tc.names {
+			t.Fatalf("%s: root = %s", tc.policy, got)
+		}
+		if got := read(t, mountPath+"/same.txt"); got != tc.same {
+			t.Fatalf("%s: same.txt = %q", tc.policy, got)
+		}
+	}
+	if got := read(t, "/conflict-suffix/same (2).txt"); got != "two" {
+		t.Fatalf("same (2).txt = %q", got)
+	}
+	if got := suffixName(".bashrc", 3); got != ".bashrc (3)" {
+		t.Fatalf("suffix = %s", got)
+	}
+}
+
+func TestRejectsItself(t *testing.T) {
+	for _, tc := range [][2]string{{"/self", "/self"}, {"/self", "/self/sub"}, {"/self", "/other\n/self/sub"}, {"/", "/"}} {
+		d := &Alias{Addition: Addition{Paths: tc[1]}}
+		d.SetStorage(model.Storage{MountPath: tc[0]})
+		if err := d.Init(context.Background()); err == nil {
+			t.Fatalf("paths %q in an alias at %s should be rejected", tc[1], tc[0])
+		}
+	}
+	d := &Alias{Addition: Addition{Paths: "/a\n/b", Primary: "/c"}}
+	d.SetStorage(model.Storage{MountPath: "/self"})
+	if err := d.Init(context.Background()); err == nil {
+		t.Fatal("primary outside the paths should be rejected")
+	}
+}
+
+// 挂在"/"时被合并的路径只能由别的存储提供，没有的话不能落回别名自己无限递归
+func TestMountedAtRoot(t *testing.T) {
+	one, _ := mountSources(t, "root")
+	ctx := context.Background()
+	id, err := op.CreateStorage(ctx, storage(t, "/", Addition{Paths: "/missing\n" + one, Primary: "/missing"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = op.DeleteStorage(ctx, id.String()) })
+	d, err := op.GetStorageByMountPath("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := &model.Object{Path: "/", IsFolder: true}
+	objs, err := d.List(ctx, root, model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("root has %d objs", len(objs))
+	}
+	if err = d.(*Alias).MakeDir(ctx, root, "new"); err == nil {
+		t.Fatal("writing to a primary served by the alias itself should fail")
+	}
+}
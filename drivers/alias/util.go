@@ -0,0 +1,161 @@
+package alias
+
+import (
+	"HelaList/internal/fs"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	"fmt"
+	stdpath "path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Object 别名存储里的对象，记住它实际对应的路径。合并目录会对应多个路径
+type Object struct {
+	model.Object
+	reals []string
+}
+
+// entry 某个被合并路径下列出来的对象，root是它在roots里的下标
+type entry struct {
+	root int
+	obj  model.Obj
+}
+
+// merge 合并各路径下同一目录的内容，同名目录合并成一个，同名文件按冲突策略处理
+func (d *Alias) merge(dirPath string, entries []entry) []model.Obj {
+	var names []string
+	groups := make(map[string][]entry)
+	for _, e := range entries {
+		name := e.obj.GetName()
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], e)
+	}
+	objs := make([]model.Obj, 0, len(names))
+	for _, name := range names {
+		group := groups[name]
+		var dirs, files []entry
+		for _, e := range group {
+			if e.obj.IsDir() {
+				dirs = append(dirs, e)
+			} else {
+				files = append(files, e)
+			}
+		}
+		switch d.ConflictPolicy {
+		case ConflictSuffix:
+			if len(dirs) > 0 {
+				objs = append(objs, d.newObj(dirPath, name, dirs))
+			}
+			for i, e := range files {
+				shown := name
+				if i > 0 || len(dirs) > 0 {
+					shown = suffixName(name, e.root+1)
+				}
+				objs = append(objs, d.newObj(dirPath, shown, []entry{e}))
+			}
+		case ConflictNewest:
+			winner := group[0]
+			for _, e := range group[1:] {
+				if e.obj.GetModifiedTime().After(winner.obj.GetModifiedTime()) {
+					winner = e
+				}
+			}
+			objs = append(objs, d.pick(dirPath, name, winner, dirs))
+		default:
+			// 列表本来就是按roots的顺序拼起来的，第一个就是排在最前面的路径
+			objs = append(objs, d.pick(dirPath, name, group[0], dirs))
+		}
+	}
+	return objs
+}
+
+// pick 胜出的是目录时把所有同名目录合并，是文件时只保留它
+func (d *Alias) pick(dirPath, name string, winner entry, dirs []entry) model.Obj {
+	if winner.obj.IsDir() {
+		return d.newObj(dirPath, name, dirs)
+	}
+	return d.newObj(dirPath, name, []entry{winner})
+}
+
+func (d *Alias) newObj(dirPath, name string, entries []entry) *Object {
+	first := entries[0].obj
+	obj := &Object{
+		Object: model.Object{
+			Path:         stdpath.Join(dirPath, name),
+			Name:         name,
+			Size:         first.GetSize(),
+			ModifiedTime: first.GetModifiedTime(),
+			CreatedTime:  first.GetCreatedTime(),
+			IsFolder:     first.IsDir(),
+			HashInfo:     first.GetHash(),
+		},
+	}
+	for _, e := range entries {
+		obj.reals = append(obj.reals, stdpath.Join(d.roots[e.root], dirPath, e.obj.GetName()))
+		if e.obj.GetModifiedTime().After(obj.ModifiedTime) {
+			obj.ModifiedTime = e.obj.GetModifiedTime()
+		}
+	}
+	return obj
+}
+
+// resolve 找到对象实际对应的路径。op传进来的一般就是List返回的Object，不是的话按路径重新找一遍
+func (d *Alias) resolve(ctx context.Context, obj model.Obj) (*Object, error) {
+	if o, ok := model.UnwrapObj(obj).(*Object); ok {
+		return o, nil
+	}
+	path := obj.GetPath()
+	if path == "/" || path == "" {
+		root, _ := d.GetRoot(ctx)
+		return root.(*Object), nil
+	}
+	parent, name := stdpath.Split(path)
+	objs, err := d.List(ctx, &model.Object{Path: parent, IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range objs {
+		if o.GetName() == name {
+			return o.(*Object), nil
+		}
+	}
+	return nil, errors.Errorf("object not found: %s", path)
+}
+
+// realPath 别名里的路径在某个被合并路径下的实际路径。
+// 别名挂在"/"时所有路径都在它下面，被合并的路径必须由别的存储提供，落回别名自己就是无限递归
+func (d *Alias) realPath(root, path string) (string, error) {
+	real := stdpath.Join(root, path)
+	if d.MountPath == "/" {
+		if s := op.GetBalancedStorage(real); s == nil || op.SameMount(s, d) {
+			return "", errors.Errorf("path %s is inside the alias itself", root)
+		}
+	}
+	return real, nil
+}
+
+func exists(ctx context.Context, path string) bool {
+	_, err := fs.Get(ctx, path)
+	return err == nil
+}
+
+// suffixName 在扩展名前加上" (n)"，a.txt变成a (2).txt
+func suffixName(name string, n int) string {
+	ext := stdpath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		// .bashrc这种没有主名的
+		base, ext = name, ""
+	}
+	return fmt.Sprintf("%s (%d)%s", base, n, ext)
+}
+
+// isSubPath 判断p是否是root本身或在root之下
+func isSubPath(root, p string) bool {
+	return root == "/" || p == root || strings.HasPrefix(p, root+"/")
+}
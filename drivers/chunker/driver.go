@@ -0,0 +1,374 @@
+package chunker
+
+import (
+	"HelaList/configs"
+	"HelaList/internal/driver"
+	"HelaList/internal/fs"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"HelaList/internal/stream"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	stdpath "path"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// 分块存储：包装另一个挂载路径，给单文件大小有限制的后端（比如只收4G以内文件的WebDAV）用。
+// 超过ChunkSize的文件拆成<文件名>.chunk.<上传id>.<编号>这样的分块，再写一个和文件同名的小清单，
+// 列目录时分块被藏起来，清单显示成完整的文件；不超过ChunkSize的文件原样存放。
+// 在备注里写"ref:/挂载路径"时包装那个存储，RemotePath是它里面的目录；否则RemotePath本身就是挂载路径
+
+type Chunker struct {
+	model.Storage
+	Addition
+	ref    string
+	remote string
+}
+
+type Addition struct {
+	RemotePath string `json:"remote_path" help:"mount path of the folder that holds the parts, or a folder inside the referenced storage"`
+	ChunkSize  int64  `json:"chunk_size" type:"number" default:"2048" help:"size of each part in MB, files not larger than this are stored as they are"`
+}
+
+var config = driver.Config{
+	Name:        "chunker",
+	LocalSort:   true,
+	NoCache:     true, // 底层存储自己有缓存
+	OnlyProxy:   true, // 分块要在服务器上拼起来
+	DefaultRoot: "/",
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &Chunker{}
+	})
+}
+
+func (d *Chunker) Config() driver.Config {
+	return config
+}
+
+func (d *Chunker) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+// InitReference 记下被包装的存储的挂载路径
+func (d *Chunker) InitReference(storage driver.Driver) error {
+	d.ref = utils.GetActualMountPath(storage.GetStorage().MountPath)
+	return nil
+}
+
+func (d *Chunker) Init(ctx context.Context) error {
+	if d.ref != "" {
+		d.remote = stdpath.Join(d.ref, utils.FixAndCleanPath(d.RemotePath))
+	} else {
+		if strings.TrimSpace(d.RemotePath) == "" {
+			return errors.New("remote path is required")
+		}
+		d.remote = utils.FixAndCleanPath(d.RemotePath)
+	}
+	if d.remote == d.MountPath || (d.MountPath != "/" && strings.HasPrefix(d.remote, d.MountPath+"/")) {
+		// 包装自己会无限递归
+		return errors.Errorf("remote path %s is inside the chunker storage itself", d.remote)
+	}
+	if d.ChunkSize <= 0 {
+		return errors.New("chunk size must be positive")
+	}
+	return nil
+}
+
+func (d *Chunker) Drop(ctx context.Context) error {
+	return nil
+}
+
+func (d *Chunker) GetRoot(ctx context.Context) (model.Obj, error) {
+	return &model.Object{
+		Path:     "/",
+		Name:     "root",
+		IsFolder: true,
+	}, nil
+}
+
+func (d *Chunker) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	real := d.realPath(dir.GetPath())
+	objs, err := fs.List(ctx, real, &fs.ListArgs{
+		Refresh: args.Refresh,
+		NoLog:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	groups := groupParts(objs)
+	files := make(map[string]bool, len(objs))
+	for _, obj := range objs {
+		if !obj.IsDir() {
+			files[obj.GetName()] = true
+		}
+	}
+	res := make([]model.Obj, 0, len(objs))
+	for _, obj := range objs {
+		name := obj.GetName()
+		// 有清单的分块不显示，没有清单的（上传中途失败留下的）照常显示，方便清理
+		if m := partRe.FindStringSubmatch(name); m != nil && !obj.IsDir() && files[m[1]] {
+			continue
+		}
+		size := obj.GetSize()
+		hash := obj.GetHash()
+		if !obj.IsDir() && groups[name] != nil {
+			// 有分块的话底层这个文件可能是清单，它的哈希不是文件内容的
+			hash = utils.HashInfo{}
+			m, _, err := resolve(ctx, stdpath.Join(real, name), obj, groups[name])
+			if err != nil {
+				log.Printf("chunker: %v", err)
+			} else if m != nil {
+				size = m.Size
+			}
+		}
+		res = append(res, &model.Object{
+			Path:         stdpath.Join(dir.GetPath(), name),
+			Name:         name,
+			Size:         size,
+			ModifiedTime: obj.GetModifiedTime(),
+			CreatedTime:  obj.GetCreatedTime(),
+			IsFolder:     obj.IsDir(),
+			HashInfo:     hash,
+		})
+	}
+	return res, nil
+}
+
+// Link 没分块的文件直接用底层的link，分块的文件把各个分块拼成一个ReaderAt
+func (d *Chunker) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	real := d.realPath(file.GetPath())
+	m, parts, err := d.chunks(ctx, real)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		l, _, err := fs.Link(ctx, real, args)
+		return l, err
+	}
+	// link可能被后面的请求接着用，范围读取不能跟着这次请求的ctx一起取消
+	streamCtx := context.WithoutCancel(ctx)
+	link := &model.Link{ContentLength: m.Size}
+	ss := make([]*stream.SeekableStream, 0, len(parts))
+	for _, p := range parts {
+		l, _, err := fs.Link(ctx, stdpath.Join(stdpath.Dir(real), p.obj.GetName()), args)
+		if err != nil {
+			_ = link.Close()
+			return nil, err
+		}
+		s, err := stream.NewSeekableStream(&stream.FileStream{Ctx: streamCtx, Obj: p.obj}, l)
+		if err != nil {
+			_ = l.Close()
+			_ = link.Close()
+			return nil, err
+		}
+		link.Add(s)
+		ss = append(ss, s)
+	}
+	ra, err := stream.NewMultiReaderAt(ss)
+	if err != nil {
+		_ = link.Close()
+		return nil, err
+	}
+	link.RangeReader = &rangeReader{ra: ra}
+	return link, nil
+}
+
+func (d *Chunker) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) error {
+	return fs.MakeDir(ctx, d.realPath(stdpath.Join(parentDir.GetPath(), dirName)))
+}
+
+func (d *Chunker) Move(ctx context.Context, srcObj, dstDir model.Obj) error {
+	ctx = context.WithValue(ctx, configs.NoTaskKey, struct{}{})
+	dst := d.realPath(dstDir.GetPath())
+	return d.each(ctx, srcObj, func(path string) error {
+		_, err := fs.Move(ctx, path, dst)
+		return err
+	})
+}
+
+func (d *Chunker) Rename(ctx context.Context, srcObj model.Obj, newName string) error {
+	if isPartName(newName) {
+		return errors.Errorf("name %s is reserved for parts", newName)
+	}
+	oldName := srcObj.GetName()
+	return d.each(ctx, srcObj, func(path string) error {
+		return fs.Rename(ctx, path, renamePart(stdpath.Base(path), oldName, newName))
+	})
+}
+
+func (d *Chunker) Copy(ctx context.Context, srcObj, dstDir model.Obj) error {
+	ctx = context.WithValue(ctx, configs.NoTaskKey, struct{}{})
+	dst := d.realPath(dstDir.GetPath())
+	return d.each(ctx, srcObj, func(path string) error {
+		_, err := fs.Copy(ctx, path, dst)
+		return err
+	})
+}
+
+func (d *Chunker) Remove(ctx context.Context, obj model.Obj) error {
+	if obj.GetPath() == "/" {
+		return errors.New("cannot remove the root folder")
+	}
+	return d.each(ctx, obj, func(path string) error {
+		return fs.Remove(ctx, path)
+	})
+}
+
+// Put 不超过ChunkSize的文件原样上传；更大的按顺序切成分块逐个上传，最后写清单。
+// 成功后删掉同名文件以前的分块，失败时删掉这次传上去的分块，旧文件保持原样
+func (d *Chunker) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) error {
+	name := file.GetName()
+	if isPartName(name) {
+		return errors.Errorf("name %s is reserved for parts", name)
+	}
+	dst := d.realPath(dstDir.GetPath())
+	reader := &driver.ReaderUpdatingProgress{
+		Reader:         file,
+		UpdateProgress: up,
+	}
+	chunkSize := d.ChunkSize * utils.MB
+	if file.GetSize() <= chunkSize {
+		err := fs.PutDirectly(ctx, dst, &stream.FileStream{
+			Ctx:      ctx,
+			Obj:      partObj(file, name, file.GetSize()),
+			Reader:   reader,
+			Mimetype: file.GetMimetype(),
+		})
+		if err != nil {
+			return err
+		}
+		// 以前是分块存的，分块要删掉，不然新文件会被当成清单
+		d.removeParts(ctx, dst, name, func(string) bool { return true })
+		return nil
+	}
+
+	id, err := newUploadID()
+	if err != nil {
+		return err
+	}
+	m := manifest{
+		Version:   1,
+		Size:      file.GetSize(),
+		ChunkSize: chunkSize,
+		Chunks:    int((file.GetSize() + chunkSize - 1) / chunkSize),
+		ID:        id,
+	}
+	for i := 0; i < m.Chunks; i++ {
+		size := min(chunkSize, m.Size-int64(i)*chunkSize)
+		err = fs.PutDirectly(ctx, dst, &stream.FileStream{
+			Ctx:      ctx,
+			Obj:      partObj(file, partName(name, id, i), size),
+			Reader:   io.LimitReader(reader, size),
+			Mimetype: "application/octet-stream",
+		})
+		if err != nil {
+			d.removeParts(ctx, dst, name, isID(id))
+			return errors.WithMessagef(err, "failed upload part %d", i)
+		}
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = fs.PutDirectly(ctx, dst, &stream.FileStream{
+		Ctx:      ctx,
+		Obj:      partObj(file, name, int64(len(data))),
+		Reader:   bytes.NewReader(data),
+		Mimetype: "application/json",
+	})
+	if err != nil {
+		d.removeParts(ctx, dst, name, isID(id))
+		return errors.WithMessage(err, "failed upload manifest")
+	}
+	d.removeParts(ctx, dst, name, func(other string) bool { return other != id })
+	return nil
+}
+
+func (d *Chunker) realPath(path string) string {
+	return stdpath.Join(d.remote, path)
+}
+
+// chunks 文件分块时返回清单和分块，没分块时都是nil
+func (d *Chunker) chunks(ctx context.Context, real string) (*manifest, []part, error) {
+	objs, err := listReal(ctx, stdpath.Dir(real))
+	if err != nil {
+		return nil, nil, err
+	}
+	name := stdpath.Base(real)
+	for _, obj := range objs {
+		if obj.GetName() == name && !obj.IsDir() {
+			return resolve(ctx, real, obj, groupParts(objs)[name])
+		}
+	}
+	return nil, nil, errors.Errorf("object not found: %s", real)
+}
+
+// each 对一个对象的所有实际文件执行fn：先是分块，最后是清单本身
+func (d *Chunker) each(ctx context.Context, obj model.Obj, fn func(path string) error) error {
+	real := d.realPath(obj.GetPath())
+	if !obj.IsDir() {
+		objs, err := listReal(ctx, stdpath.Dir(real))
+		if err != nil {
+			return err
+		}
+		for _, path := range joinParts(stdpath.Dir(real), allParts(groupParts(objs)[obj.GetName()])) {
+			if err = fn(path); err != nil {
+				return err
+			}
+		}
+	}
+	return fn(real)
+}
+
+// removeParts 删除name的上传id满足match的分块，删不掉只记日志
+func (d *Chunker) removeParts(ctx context.Context, dir, name string, match func(id string) bool) {
+	objs, err := listReal(ctx, dir)
+	if err != nil {
+		log.Printf("chunker: failed list %s for removing parts: %v", dir, err)
+		return
+	}
+	for id, parts := range groupParts(objs)[name] {
+		if !match(id) {
+			continue
+		}
+		for _, p := range parts {
+			if err = fs.Remove(ctx, stdpath.Join(dir, p.obj.GetName())); err != nil {
+				log.Printf("chunker: failed remove part %s: %v", p.obj.GetName(), err)
+			}
+		}
+	}
+}
+
+func isID(id string) func(string) bool {
+	return func(other string) bool {
+		return other == id
+	}
+}
+
+func partObj(file model.Obj, name string, size int64) *model.Object {
+	return &model.Object{
+		Name:         name,
+		Size:         size,
+		ModifiedTime: file.GetModifiedTime(),
+		CreatedTime:  file.GetCreatedTime(),
+	}
+}
+
+var _ driver.Driver = (*Chunker)(nil)
+var _ driver.Reference = (*Chunker)(nil)
+var _ driver.GetRooter = (*Chunker)(nil)
+var _ driver.Mkdir = (*Chunker)(nil)
+var _ driver.Move = (*Chunker)(nil)
+var _ driver.Rename = (*Chunker)(nil)
+var _ driver.Copy = (*Chunker)(nil)
+var _ driver.Remove = (*Chunker)(nil)
+var _ driver.Put = (*Chunker)(nil)
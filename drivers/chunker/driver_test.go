@@ -0,0 +1,265 @@
+package chunker
+
+import (
+	"HelaList/drivers/memory"
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/fs"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"HelaList/internal/stream"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+)
+
+func create(t *testing.T, mountPath, driverName string, addition any) {
+	t.Helper()
+	data, err := json.Marshal(addition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drivertest.Mount(t, model.Storage{
+		MountPath:       mountPath,
+		Driver:          driverName,
+		CacheExpiration: 30,
+		Addition:        string(data),
+	})
+}
+
+// mount 在一个内存存储上挂分块存储，分块大小1MB
+func mount(t *testing.T, name string) (*Chunker, *memory.Memory) {
+	t.Helper()
+	create(t, "/"+name+"-remote", "memory", memory.Addition{})
+	create(t, "/"+name, "chunker", Addition{RemotePath: "/" + name + "-remote", ChunkSize: 1})
+	remote, err := op.GetStorageByMountPath("/" + name + "-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := op.GetStorageByMountPath("/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.(*Chunker), remote.(*memory.Memory)
+}
+
+func put(t *testing.T, dir, name string, data []byte) error {
+	t.Helper()
+	return fs.PutDirectly(context.Background(), dir, &stream.FileStream{
+		Obj:    &model.Object{Name: name, Size: int64(len(data))},
+		Reader: bytes.NewReader(data),
+	})
+}
+
+func names(t *testing.T, path string) []string {
+	t.Helper()
+	objs, err := fs.List(context.Background(), path, &fs.ListArgs{NoLog: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for _, obj := range objs {
+		res = append(res, obj.GetName())
+	}
+	return res
+}
+
+func read(t *testing.T, path string, start, length int64) []byte {
+	t.Helper()
+	l, _, err := fs.Link(context.Background(), path, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	rc, err := stream.RangeReadLink(context.Background(), l, http_range.Range{Start: start, Length: length})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func random(n int) []byte {
+	data := make([]byte, n)
+	_, _ = rand.Read(data)
+	return data
+}
+
+func TestConformance(t *testing.T) {
+	d, _ := mount(t, "conformance")
+	drivertest.Run(t, d)
+}
+
+func TestSplitAndStitch(t *testing.T) {
+	mount(t, "split")
+	data := random(5<<19 + 7) // 2.5MB多一点，切成3块
+	if err := put(t, "/split", "big.bin", data); err != nil {
+		t.Fatal(err)
+	}
+
+	remote := names(t, "/split-remote")
+	if len(remote) != 4 {
+		t.Fatalf("remote = %v", remote)
+	}
+	for _, name := range remote {
+		if name != "big.bin" && !strings.HasPrefix(name, "big.bin.chunk.") {
+			t.Fatalf("unexpected remote file %s", name)
+		}
+	}
+	if got := names(t, "/split"); len(got) != 1 || got[0] != "big.bin" {
+		t.Fatalf("list = %v", got)
+	}
+	obj, err := fs.Get(context.Background(), "/split/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetSize() != int64(len(data)) {
+		t.Fatalf("size = %d, want %d", obj.GetSize(), len(data))
+	}
+
+	if got := read(t, "/split/big.bin", 0, -1); !bytes.Equal(got, data) {
+		t.Fatalf("content differs, got %d bytes", len(got))
+	}
+	// 跨过两个分块边界
+	start, length := int64(1<<20-5), int64(1<<20+10)
+	if got := read(t, "/split/big.bin", start, length); !bytes.Equal(got, data[start:start+length]) {
+		t.Fatal("range across parts differs")
+	}
+	if got := read(t, "/split/big.bin", int64(len(data)-3), -1); !bytes.Equal(got, data[len(data)-3:]) {
+		t.Fatal("tail differs")
+	}
+}
+
+func TestSmallFilesStayAsIs(t *testing.T) {
+	mount(t, "small")
+	if err := put(t, "/small", "a.txt", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, "/small-remote"); len(got) != 1 || got[0] != "a.txt" {
+		t.Fatalf("remote = %v", got)
+	}
+	if got := read(t, "/small/a.txt", 1, 3); string(got) != "ell" {
+		t.Fatalf("content = %q", got)
+	}
+}
+
+// 普通小文件旁边的孤儿分块不能顶替文件内容，清单指向的分块不在时也不能拿别的凑数
+func TestOrphanParts(t *testing.T) {
+	mount(t, "orphan")
+	for _, name := range []string{"f.txt", "m.json"} {
+		for i, data := range []string{"orphan ", "parts"} {
+			if err := put(t, "/orphan-remote", partName(name, "0123abcd", i), []byte(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := put(t, "/orphan-remote", "f.txt", []byte("plain")); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, "/orphan/f.txt", 0, -1); string(got) != "plain" {
+		t.Fatalf("content = %q", got)
+	}
+	obj, err := fs.Get(context.Background(), "/orphan/f.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetSize() != 5 {
+		t.Fatalf("size = %d", obj.GetSize())
+	}
+
+	manifest, _ := json.Marshal(manifest{Version: 1, Size: 12, Chunks: 2, ID: "deadbeef"})
+	if err = put(t, "/orphan-remote", "m.json", manifest); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = fs.Link(context.Background(), "/orphan/m.json", model.LinkArgs{}); err == nil {
+		t.Fatal("link should fail when the chunks of the manifest are missing")
+	}
+}
+
+func TestOverwrite(t *testing.T) {
+	mount(t, "overwrite")
+	if err := put(t, "/overwrite", "f.bin", random(3<<20)); err != nil {
+		t.Fatal(err)
+	}
+	// 换成另一个分块文件，旧的分块要被删掉
+	data := random(1<<20 + 1)
+	if err := put(t, "/overwrite", "f.bin", data); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, "/overwrite-remote"); len(got) != 3 {
+		t.Fatalf("remote = %v", got)
+	}
+	if got := read(t, "/overwrite/f.bin", 0, -1); !bytes.Equal(got, data) {
+		t.Fatal("content differs after overwrite")
+	}
+	// 换成小文件，分块全删掉，不然小文件会被当成清单
+	if err := put(t, "/overwrite", "f.bin", []byte("small")); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, "/overwrite-remote"); len(got) != 1 {
+		t.Fatalf("remote = %v", got)
+	}
+	if got := read(t, "/overwrite/f.bin", 0, -1); string(got) != "small" {
+		t.Fatalf("content = %q", got)
+	}
+}
+
+func TestFailedUploadKeepsOldFile(t *testing.T) {
+	_, remote := mount(t, "failed")
+	data := random(2<<20 + 1)
+	if err := put(t, "/failed", "f.bin", data); err != nil {
+		t.Fatal(err)
+	}
+	remote.InjectFault(memory.OpPut, errors.New("disk full"))
+	if err := put(t, "/failed", "f.bin", random(2<<20+1)); err == nil {
+		t.Fatal("upload should fail")
+	}
+	remote.InjectFault(memory.OpPut, nil)
+	if got := read(t, "/failed/f.bin", 0, -1); !bytes.Equal(got, data) {
+		t.Fatal("old file was damaged by the failed upload")
+	}
+}
+
+func TestRenameMoveRemove(t *testing.T) {
+	mount(t, "rmr")
+	data := random(2<<20 + 1)
+	if err := put(t, "/rmr", "f.bin", data); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename(context.Background(), "/rmr/f.bin", "g.bin"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names(t, "/rmr-remote") {
+		if !strings.HasPrefix(name, "g.bin") {
+			t.Fatalf("remote file %s was not renamed", name)
+		}
+	}
+	if err := fs.MakeDir(context.Background(), "/rmr/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Move(context.Background(), "/rmr/g.bin", "/rmr/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, "/rmr"); len(got) != 1 || got[0] != "dir" {
+		t.Fatalf("list after move = %v", got)
+	}
+	if got := read(t, "/rmr/dir/g.bin", 0, -1); !bytes.Equal(got, data) {
+		t.Fatal("content differs after move")
+	}
+	if err := fs.Remove(context.Background(), "/rmr/dir/g.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, "/rmr-remote/dir"); len(got) != 0 {
+		t.Fatalf("remote after remove = %v", got)
+	}
+}
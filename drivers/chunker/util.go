@@ -0,0 +1,196 @@
+package chunker
+
+import (
+	"HelaList/internal/fs"
+	"HelaList/internal/model"
+	"HelaList/internal/stream"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	stdpath "path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/pkg/errors"
+	"go4.org/readerutil"
+)
+
+// 分块的名字：<文件名>.chunk.<上传id>.<编号>，编号从000开始。
+// 每次上传用新的id，覆盖上传中途失败时旧文件的分块还在，清单也还指向它们
+var partRe = regexp.MustCompile(`^(.+)\.chunk\.([0-9a-f]{8})\.(\d{3,})$`)
+
+func partName(name, id string, index int) string {
+	return fmt.Sprintf("%s.chunk.%s.%03d", name, id, index)
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// manifest 分块文件的清单，存成和原文件同名的小文件
+type manifest struct {
+	Version   int    `json:"version"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunk_size"`
+	Chunks    int    `json:"chunks"`
+	ID        string `json:"id"`
+}
+
+// 清单不会超过这个大小，更大的同名文件肯定不是清单
+const maxManifestSize = 4096
+
+type part struct {
+	obj   model.Obj
+	index int
+}
+
+// groupParts 把目录里的分块按文件名、上传id分组，组内按编号排好
+func groupParts(objs []model.Obj) map[string]map[string][]part {
+	res := make(map[string]map[string][]part)
+	for _, obj := range objs {
+		if obj.IsDir() {
+			continue
+		}
+		m := partRe.FindStringSubmatch(obj.GetName())
+		if m == nil {
+			continue
+		}
+		index, err := strconv.Atoi(m[3])
+		if err != nil {
+			continue
+		}
+		if res[m[1]] == nil {
+			res[m[1]] = make(map[string][]part)
+		}
+		res[m[1]][m[2]] = append(res[m[1]][m[2]], part{obj: obj, index: index})
+	}
+	for _, sets := range res {
+		for _, parts := range sets {
+			slices.SortFunc(parts, func(a, b part) int {
+				return a.index - b.index
+			})
+		}
+	}
+	return res
+}
+
+// complete 编号从0开始连续时返回分块的总大小
+func complete(parts []part) (int64, bool) {
+	var size int64
+	for i, p := range parts {
+		if p.index != i {
+			return 0, false
+		}
+		size += p.obj.GetSize()
+	}
+	return size, len(parts) > 0
+}
+
+// listReal 列出实际目录，按名字找对象时用
+func listReal(ctx context.Context, dir string) ([]model.Obj, error) {
+	return fs.List(ctx, dir, &fs.ListArgs{NoLog: true})
+}
+
+// readManifest 读清单，内容不是清单时返回nil，说明这是个普通的小文件
+func readManifest(ctx context.Context, path string) (*manifest, error) {
+	l, _, err := fs.Link(ctx, path, model.LinkArgs{})
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	rc, err := stream.RangeReadLink(ctx, l, http_range.Range{Length: maxManifestSize})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxManifestSize))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var m manifest
+	if err = json.Unmarshal(data, &m); err != nil || m.Version != 1 || m.ID == "" {
+		return nil, nil
+	}
+	return &m, nil
+}
+
+// resolve 找出清单当前指向的分块。同名文件不是清单时分块都是孤儿，不算数；
+// 哪怕只有一组完整的分块也要核对清单的id和块数，不然会把孤儿分块当成文件内容
+func resolve(ctx context.Context, real string, obj model.Obj, sets map[string][]part) (*manifest, []part, error) {
+	if obj.GetSize() > maxManifestSize || len(sets) == 0 {
+		return nil, nil, nil
+	}
+	m, err := readManifest(ctx, real)
+	if err != nil || m == nil {
+		return nil, nil, err
+	}
+	parts := sets[m.ID]
+	if size, ok := complete(parts); !ok || size != m.Size || len(parts) != m.Chunks {
+		return nil, nil, errors.Errorf("chunks of %s are incomplete", real)
+	}
+	return m, parts, nil
+}
+
+// allParts 某个文件名下所有的分块，包括没被清单引用的
+func allParts(sets map[string][]part) []model.Obj {
+	var res []model.Obj
+	for _, parts := range sets {
+		for _, p := range parts {
+			res = append(res, p.obj)
+		}
+	}
+	return res
+}
+
+// rangeReader 在拼接起来的分块上做范围读取。
+// 同一个link可能被几个请求同时用，底层的ReaderAt不是线程安全的，所以加锁
+type rangeReader struct {
+	mu sync.Mutex
+	ra readerutil.SizeReaderAt
+}
+
+func (r *rangeReader) RangeRead(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+	size := r.ra.Size()
+	if httpRange.Start > size {
+		return nil, errors.Errorf("range start %d is beyond the file size %d", httpRange.Start, size)
+	}
+	length := httpRange.Length
+	if length < 0 || httpRange.Start+length > size {
+		length = size - httpRange.Start
+	}
+	return io.NopCloser(io.NewSectionReader(r, httpRange.Start, length)), nil
+}
+
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ra.ReadAt(p, off)
+}
+
+// isPartName 用户的文件名不能和分块撞上
+func isPartName(name string) bool {
+	return partRe.MatchString(name)
+}
+
+func joinParts(dir string, objs []model.Obj) []string {
+	paths := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		paths = append(paths, stdpath.Join(dir, obj.GetName()))
+	}
+	return paths
+}
+
+func renamePart(name, oldBase, newBase string) string {
+	return newBase + strings.TrimPrefix(name, oldBase)
+}
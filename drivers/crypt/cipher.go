@@ -0,0 +1,247 @@
+package crypt
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// 加密文件的格式：8字节的魔数 + 24字节的随机nonce，后面是一个个加密块。
+// 每块是64KiB明文加密后再带上16字节的认证标签，最后一块可以不满但至少有1字节，空文件只有一个空块。
+// 第i块的nonce是文件nonce的前8字节按小端加上i，所以可以只解密读取范围覆盖到的那几块。
+// 块号和"是不是最后一块"放在附加数据里一起认证，整块截掉末尾或者挪动块都会解密失败
+
+const (
+	magic           = "HLCRYPT\x02"
+	headerSize      = len(magic) + chacha20poly1305.NonceSizeX
+	blockSize       = 64 * 1024
+	tagSize         = chacha20poly1305.Overhead
+	sealedBlockSize = blockSize + tagSize
+	maxNameLength   = 255
+)
+
+var nameEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+var errBadHeader = errors.New("not an encrypted file or wrong password")
+
+// Cipher 由口令和盐派生出的密钥，分别用于文件内容和文件名
+type Cipher struct {
+	data    cipher.AEAD
+	name    cipher.AEAD
+	nameMac []byte
+}
+
+func newCipher(password, salt string) (*Cipher, error) {
+	key, err := scrypt.Key([]byte(password), []byte(salt), 1<<15, 8, 1, 96)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	data, err := chacha20poly1305.NewX(key[:32])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	name, err := chacha20poly1305.NewX(key[32:64])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &Cipher{data: data, name: name, nameMac: key[64:]}, nil
+}
+
+// encryptName 同一个名字总是加密成同一个结果，这样不用列目录就能算出实际路径。
+// nonce取名字的HMAC，和SIV一样，既确定又能校验
+func (c *Cipher) encryptName(name string) (string, error) {
+	mac := hmac.New(sha256.New, c.nameMac)
+	mac.Write([]byte(name))
+	nonce := mac.Sum(nil)[:chacha20poly1305.NonceSizeX]
+	sealed := c.name.Seal(nonce, nonce, []byte(name), nil)
+	// 有的网盘不区分大小写，统一用小写
+	encrypted := strings.ToLower(nameEncoding.EncodeToString(sealed))
+	if len(encrypted) > maxNameLength {
+		return "", errors.Errorf("name is too long to encrypt: %s", name)
+	}
+	return encrypted, nil
+}
+
+func (c *Cipher) decryptName(encrypted string) (string, error) {
+	sealed, err := nameEncoding.DecodeString(strings.ToUpper(encrypted))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if len(sealed) < chacha20poly1305.NonceSizeX+tagSize {
+		return "", errors.New("encrypted name is too short")
+	}
+	nonce := sealed[:chacha20poly1305.NonceSizeX]
+	name, err := c.name.Open(nil, nonce, sealed[len(nonce):], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt name")
+	}
+	return string(name), nil
+}
+
+// blockNonce 第index块用的nonce
+func blockNonce(base []byte, index uint64) []byte {
+	nonce := make([]byte, len(base))
+	copy(nonce, base)
+	binary.LittleEndian.PutUint64(nonce, binary.LittleEndian.Uint64(nonce)+index)
+	return nonce
+}
+
+// blockAAD 第index块的附加数据：小端的块号加上是不是最后一块
+func blockAAD(index uint64, last bool) []byte {
+	aad := make([]byte, 9)
+	binary.LittleEndian.PutUint64(aad, index)
+	if last {
+		aad[8] = 1
+	}
+	return aad
+}
+
+// blockCount 明文大小对应的块数，空文件也有一块
+func blockCount(size int64) int64 {
+	return max(1, (size+blockSize-1)/blockSize)
+}
+
+// encryptedSize 明文大小对应的加密文件大小
+func encryptedSize(size int64) int64 {
+	return int64(headerSize) + size + blockCount(size)*tagSize
+}
+
+// decryptedSize 加密文件大小对应的明文大小，大小不可能是加密文件时返回false
+func decryptedSize(size int64) (int64, bool) {
+	size -= int64(headerSize)
+	if size < tagSize {
+		return 0, false
+	}
+	full, rest := size/sealedBlockSize, size%sealedBlockSize
+	switch {
+	case rest == 0:
+		return full * blockSize, true
+	case rest > tagSize:
+		return full*blockSize + rest - tagSize, true
+	case rest == tagSize && full == 0:
+		return 0, true
+	}
+	return 0, false
+}
+
+// encryptReader 把明文流加密成上面的格式。
+// 每次多读一个字节，读到的不满blockSize+1就说明这是最后一块
+type encryptReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	nonce  []byte
+	index  uint64
+	buf    []byte
+	n      int
+	sealed []byte
+	out    []byte
+	err    error
+}
+
+func (c *Cipher) newEncryptReader(r io.Reader, nonce []byte) *encryptReader {
+	return &encryptReader{
+		r:      r,
+		aead:   c.data,
+		nonce:  nonce,
+		buf:    make([]byte, blockSize+1),
+		sealed: make([]byte, 0, sealedBlockSize),
+		out:    append([]byte(magic), nonce...),
+	}
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		n, err := io.ReadFull(e.r, e.buf[e.n:])
+		e.n += n
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			e.err = err
+			continue
+		}
+		last := err != nil
+		plain := e.buf[:min(e.n, blockSize)]
+		e.out = e.aead.Seal(e.sealed[:0], blockNonce(e.nonce, e.index), plain, blockAAD(e.index, last))
+		e.index++
+		if last {
+			e.err = io.EOF
+		} else {
+			// 多读的那个字节留到下一块
+			e.buf[0] = e.buf[blockSize]
+			e.n = 1
+		}
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// decryptReader 从第index块开始解密，丢掉第一块开头的skip个字节，最多输出remain个字节。
+// last是按明文大小算出的最后一块的块号
+type decryptReader struct {
+	rc     io.ReadCloser
+	aead   cipher.AEAD
+	nonce  []byte
+	index  uint64
+	last   uint64
+	skip   int64
+	remain int64
+	buf    []byte
+	out    []byte
+	err    error
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	if d.remain <= 0 {
+		return 0, io.EOF
+	}
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		n, err := io.ReadFull(d.rc, d.buf)
+		if n > 0 {
+			if n < tagSize {
+				d.err = errors.New("encrypted file is truncated")
+				return 0, d.err
+			}
+			aad := blockAAD(d.index, d.index == d.last)
+			plain, openErr := d.aead.Open(d.buf[:0], blockNonce(d.nonce, d.index), d.buf[:n], aad)
+			if openErr != nil {
+				d.err = errors.Errorf("failed to authenticate block %d", d.index)
+				return 0, d.err
+			}
+			d.index++
+			if d.skip > 0 {
+				plain = plain[min(d.skip, int64(len(plain))):]
+				d.skip = 0
+			}
+			d.out = plain
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			d.err = io.ErrUnexpectedEOF
+		} else if err != nil {
+			d.err = err
+		}
+	}
+	if int64(len(p)) > d.remain {
+		p = p[:d.remain]
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	d.remain -= int64(n)
+	return n, nil
+}
+
+func (d *decryptReader) Close() error {
+	return d.rc.Close()
+}
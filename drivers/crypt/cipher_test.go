@@ -0,0 +1,169 @@
+package crypt
+
+import (
+	"HelaList/internal/model"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func testCipher(t *testing.T) *Cipher {
+	t.Helper()
+	c, err := newCipher("password", "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func random(n int) []byte {
+	data := make([]byte, n)
+	_, _ = rand.Read(data)
+	return data
+}
+
+func encrypt(t *testing.T, c *Cipher, data []byte) []byte {
+	t.Helper()
+	nonce := random(chacha20poly1305.NonceSizeX)
+	enc, err := io.ReadAll(c.newEncryptReader(bytes.NewReader(data), nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
+
+// decrypt 按明文大小size从加密数据里读[start, start+length)
+func decrypt(c *Cipher, enc []byte, size, start, length int64) ([]byte, error) {
+	r := &rangeReader{cipher: c, link: &model.Link{MFile: bytes.NewReader(enc)}, size: size}
+	rc, err := r.RangeRead(context.Background(), http_range.Range{Start: start, Length: length})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := testCipher(t)
+	for _, size := range []int{0, 1, blockSize - 1, blockSize, blockSize + 1, 3*blockSize + 100} {
+		data := random(size)
+		enc := encrypt(t, c, data)
+		if int64(len(enc)) != encryptedSize(int64(size)) {
+			t.Fatalf("size %d: encrypted %d bytes, want %d", size, len(enc), encryptedSize(int64(size)))
+		}
+		if got, ok := decryptedSize(int64(len(enc))); !ok || got != int64(size) {
+			t.Fatalf("size %d: decryptedSize = %d, %v", size, got, ok)
+		}
+		got, err := decrypt(c, enc, int64(size), 0, -1)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("size %d: content mismatch", size)
+		}
+	}
+}
+
+func TestDecryptedSizeRejectsImpossibleSizes(t *testing.T) {
+	for _, size := range []int64{0, int64(headerSize), int64(headerSize) + tagSize - 1, int64(headerSize) + sealedBlockSize + tagSize} {
+		if _, ok := decryptedSize(size); ok {
+			t.Fatalf("decryptedSize(%d) should fail", size)
+		}
+	}
+}
+
+func TestRangeRead(t *testing.T) {
+	c := testCipher(t)
+	data := random(3*blockSize + 100)
+	enc := encrypt(t, c, data)
+	size := int64(len(data))
+	for _, r := range [][2]int64{
+		{0, 10},
+		{blockSize - 5, 10},            // 跨块
+		{blockSize, blockSize},         // 正好一整块
+		{2*blockSize + 7, -1},          // 读到结尾
+		{size - 1, 1},                  // 最后一个字节
+		{blockSize / 2, 2 * blockSize}, // 跨三块
+	} {
+		got, err := decrypt(c, enc, size, r[0], r[1])
+		if err != nil {
+			t.Fatalf("range %v: %v", r, err)
+		}
+		end := size
+		if r[1] >= 0 {
+			end = r[0] + r[1]
+		}
+		if !bytes.Equal(got, data[r[0]:end]) {
+			t.Fatalf("range %v: content mismatch", r)
+		}
+	}
+}
+
+// 整块截掉末尾后大小依然合法，必须靠最后一块的标记发现
+func TestTruncation(t *testing.T) {
+	c := testCipher(t)
+	data := random(3*blockSize + 100)
+	enc := encrypt(t, c, data)
+
+	for _, blocks := range []int{1, 2} {
+		truncated := enc[:headerSize+blocks*sealedBlockSize]
+		size, ok := decryptedSize(int64(len(truncated)))
+		if !ok {
+			t.Fatalf("%d blocks: size should look valid", blocks)
+		}
+		if _, err := decrypt(c, truncated, size, 0, -1); err == nil {
+			t.Fatalf("%d blocks: truncation not detected", blocks)
+		}
+		// 只读最后剩下的那一块也要发现
+		if _, err := decrypt(c, truncated, size, size-1, 1); err == nil {
+			t.Fatalf("%d blocks: truncation not detected reading the tail", blocks)
+		}
+	}
+}
+
+func TestTamper(t *testing.T) {
+	c := testCipher(t)
+	data := random(2*blockSize + 100)
+	enc := encrypt(t, c, data)
+	size := int64(len(data))
+
+	// 改一个字节
+	flipped := bytes.Clone(enc)
+	flipped[headerSize+sealedBlockSize+3] ^= 1
+	if _, err := decrypt(c, flipped, size, 0, -1); err == nil {
+		t.Fatal("flipped byte not detected")
+	}
+	if got, err := decrypt(c, flipped, size, 0, 10); err != nil || !bytes.Equal(got, data[:10]) {
+		t.Fatalf("untouched block should still decrypt: %v", err)
+	}
+
+	// 交换前两块
+	swapped := bytes.Clone(enc)
+	first := swapped[headerSize : headerSize+sealedBlockSize]
+	second := swapped[headerSize+sealedBlockSize : headerSize+2*sealedBlockSize]
+	tmp := bytes.Clone(first)
+	copy(first, second)
+	copy(second, tmp)
+	if _, err := decrypt(c, swapped, size, 0, -1); err == nil {
+		t.Fatal("swapped blocks not detected")
+	}
+
+	// 换了口令
+	other, err := newCipher("other", "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decrypt(other, enc, size, 0, -1); err == nil {
+		t.Fatal("wrong password not detected")
+	}
+
+	// 不是加密文件
+	if _, err := decrypt(c, random(len(enc)), size, 0, -1); err != errBadHeader {
+		t.Fatalf("err = %v, want errBadHeader", err)
+	}
+}
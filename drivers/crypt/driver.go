@@ -0,0 +1,293 @@
+package crypt
+
+import (
+	"HelaList/configs"
+	"HelaList/internal/driver"
+	"HelaList/internal/fs"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"HelaList/internal/stream"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	stdpath "path"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// 加密存储：把另一个挂载路径下的某个目录当作密文仓库，文件内容按块加密，文件名可选加密。
+// 在备注里写"ref:/挂载路径"时包装那个存储，RemotePath是它里面的目录；否则RemotePath本身就是挂载路径。
+// 对象的Path是解密后的虚拟路径，实际路径每次按确定的加密算出来
+
+type Crypt struct {
+	model.Storage
+	Addition
+	ref    string
+	remote string
+	cipher *Cipher
+}
+
+type Addition struct {
+	RemotePath   string `json:"remote_path" help:"mount path of the folder that holds the encrypted data, or a folder inside the referenced storage"`
+	Password     string `json:"password" required:"true"`
+	Salt         string `json:"salt" help:"generated on first start if empty, keep it together with the password"`
+	EncryptNames bool   `json:"encrypt_names" default:"true" help:"encrypt file and folder names as well"`
+}
+
+// 不加密文件名时，加密过的文件加上这个后缀，和目录里别的文件区分开
+const fileSuffix = ".bin"
+
+var config = driver.Config{
+	Name:        "crypt",
+	LocalSort:   true,
+	NoCache:     true, // 底层存储自己有缓存
+	OnlyProxy:   true, // 内容要在服务器上解密
+	DefaultRoot: "/",
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &Crypt{}
+	})
+}
+
+func (d *Crypt) Config() driver.Config {
+	return config
+}
+
+func (d *Crypt) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+// InitReference 记下被包装的存储的挂载路径
+func (d *Crypt) InitReference(storage driver.Driver) error {
+	d.ref = utils.GetActualMountPath(storage.GetStorage().MountPath)
+	return nil
+}
+
+func (d *Crypt) Init(ctx context.Context) error {
+	if d.ref != "" {
+		d.remote = stdpath.Join(d.ref, utils.FixAndCleanPath(d.RemotePath))
+	} else {
+		if strings.TrimSpace(d.RemotePath) == "" {
+			return errors.New("remote path is required")
+		}
+		d.remote = utils.FixAndCleanPath(d.RemotePath)
+	}
+	if d.remote == d.MountPath || (d.MountPath != "/" && isSubPath(d.MountPath, d.remote)) {
+		// 包装自己会无限递归
+		return errors.Errorf("remote path %s is inside the crypt storage itself", d.remote)
+	}
+	if d.Password == "" {
+		return errors.New("password is required")
+	}
+	if d.Salt == "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return errors.WithStack(err)
+		}
+		d.Salt = hex.EncodeToString(salt)
+		op.MustSaveDriverStorage(d)
+	}
+	c, err := newCipher(d.Password, d.Salt)
+	if err != nil {
+		return err
+	}
+	d.cipher = c
+	return nil
+}
+
+func (d *Crypt) Drop(ctx context.Context) error {
+	return nil
+}
+
+func (d *Crypt) GetRoot(ctx context.Context) (model.Obj, error) {
+	return &model.Object{
+		Path:     "/",
+		Name:     "root",
+		IsFolder: true,
+	}, nil
+}
+
+// List 解不开的名字和大小对不上的文件不是这个存储写的，不显示
+func (d *Crypt) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	real, err := d.realPath(dir.GetPath(), true)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := fs.List(ctx, real, &fs.ListArgs{
+		Refresh: args.Refresh,
+		NoLog:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]model.Obj, 0, len(objs))
+	for _, obj := range objs {
+		name, ok := d.decodeName(obj.GetName(), obj.IsDir())
+		if !ok {
+			continue
+		}
+		var size int64
+		if !obj.IsDir() {
+			if size, ok = decryptedSize(obj.GetSize()); !ok {
+				continue
+			}
+		}
+		res = append(res, &model.Object{
+			Path:         stdpath.Join(dir.GetPath(), name),
+			Name:         name,
+			Size:         size,
+			ModifiedTime: obj.GetModifiedTime(),
+			CreatedTime:  obj.GetCreatedTime(),
+			IsFolder:     obj.IsDir(),
+		})
+	}
+	return res, nil
+}
+
+func (d *Crypt) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	real, err := d.realPath(file.GetPath(), false)
+	if err != nil {
+		return nil, err
+	}
+	l, _, err := fs.Link(ctx, real, args)
+	if err != nil {
+		return nil, err
+	}
+	link := &model.Link{
+		RangeReader: &rangeReader{
+			cipher: d.cipher,
+			link:   l,
+			size:   file.GetSize(),
+		},
+		ContentLength: file.GetSize(),
+	}
+	link.Add(l)
+	return link, nil
+}
+
+func (d *Crypt) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) error {
+	real, err := d.realPath(stdpath.Join(parentDir.GetPath(), dirName), true)
+	if err != nil {
+		return err
+	}
+	return fs.MakeDir(ctx, real)
+}
+
+func (d *Crypt) Move(ctx context.Context, srcObj, dstDir model.Obj) error {
+	src, err := d.realPath(srcObj.GetPath(), srcObj.IsDir())
+	if err != nil {
+		return err
+	}
+	dst, err := d.realPath(dstDir.GetPath(), true)
+	if err != nil {
+		return err
+	}
+	_, err = fs.Move(context.WithValue(ctx, configs.NoTaskKey, struct{}{}), src, dst)
+	return err
+}
+
+func (d *Crypt) Rename(ctx context.Context, srcObj model.Obj, newName string) error {
+	src, err := d.realPath(srcObj.GetPath(), srcObj.IsDir())
+	if err != nil {
+		return err
+	}
+	name, err := d.encodeName(newName, srcObj.IsDir())
+	if err != nil {
+		return err
+	}
+	return fs.Rename(ctx, src, name)
+}
+
+// Copy 密文原样复制，nonce不变也能用同一个密钥解开
+func (d *Crypt) Copy(ctx context.Context, srcObj, dstDir model.Obj) error {
+	src, err := d.realPath(srcObj.GetPath(), srcObj.IsDir())
+	if err != nil {
+		return err
+	}
+	dst, err := d.realPath(dstDir.GetPath(), true)
+	if err != nil {
+		return err
+	}
+	_, err = fs.Copy(context.WithValue(ctx, configs.NoTaskKey, struct{}{}), src, dst)
+	return err
+}
+
+func (d *Crypt) Remove(ctx context.Context, obj model.Obj) error {
+	if obj.GetPath() == "/" {
+		return errors.New("cannot remove the root folder")
+	}
+	real, err := d.realPath(obj.GetPath(), obj.IsDir())
+	if err != nil {
+		return err
+	}
+	return fs.Remove(ctx, real)
+}
+
+// Put 边读边加密，交给底层存储上传，底层看到的大小是加密后的大小
+func (d *Crypt) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) error {
+	dst, err := d.realPath(dstDir.GetPath(), true)
+	if err != nil {
+		return err
+	}
+	name, err := d.encodeName(file.GetName(), false)
+	if err != nil {
+		return err
+	}
+	size := file.GetSize()
+	var reader stream.ReaderWithSize = file
+	if size < 0 {
+		// 不知道大小就算不出加密后的大小，先落到临时文件里
+		tmpF, err := os.CreateTemp("", "crypt-put-*")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer func() {
+			_ = tmpF.Close()
+			_ = os.Remove(tmpF.Name())
+		}()
+		size, err = utils.CopyWithBuffer(tmpF, file)
+		if err == nil {
+			_, err = tmpF.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		reader = &stream.SimpleReaderWithSize{Reader: tmpF, Size: size}
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err = rand.Read(nonce); err != nil {
+		return errors.WithStack(err)
+	}
+	encrypted := &stream.FileStream{
+		Ctx: ctx,
+		Obj: &model.Object{
+			Name:         name,
+			Size:         encryptedSize(size),
+			ModifiedTime: file.GetModifiedTime(),
+			CreatedTime:  file.GetCreatedTime(),
+		},
+		Reader: d.cipher.newEncryptReader(&driver.ReaderUpdatingProgress{
+			Reader:         reader,
+			UpdateProgress: up,
+		}, nonce),
+		Mimetype: "application/octet-stream",
+	}
+	return fs.PutDirectly(ctx, dst, encrypted)
+}
+
+var _ driver.Driver = (*Crypt)(nil)
+var _ driver.Reference = (*Crypt)(nil)
+var _ driver.GetRooter = (*Crypt)(nil)
+var _ driver.Mkdir = (*Crypt)(nil)
+var _ driver.Move = (*Crypt)(nil)
+var _ driver.Rename = (*Crypt)(nil)
+var _ driver.Copy = (*Crypt)(nil)
+var _ driver.Remove = (*Crypt)(nil)
+var _ driver.Put = (*Crypt)(nil)
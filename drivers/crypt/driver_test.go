@@ -0,0 +1,120 @@
+package crypt
+
+import (
+	_ "HelaList/drivers/memory"
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/fs"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"HelaList/internal/stream"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+)
+
+// mount 在一个内存存储上挂加密存储
+func mount(t *testing.T, name string, encryptNames bool) *Crypt {
+	t.Helper()
+	drivertest.Mount(t, model.Storage{MountPath: "/" + name + "-remote", CacheExpiration: 30})
+	data, err := json.Marshal(Addition{
+		RemotePath:   "/" + name + "-remote",
+		Password:     "password",
+		Salt:         "salt",
+		EncryptNames: encryptNames,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := drivertest.Mount(t, model.Storage{
+		MountPath:       "/" + name,
+		Driver:          "crypt",
+		CacheExpiration: 30,
+		Addition:        string(data),
+	})
+	return d.(*Crypt)
+}
+
+func read(t *testing.T, path string, start, length int64) []byte {
+	t.Helper()
+	l, _, err := fs.Link(context.Background(), path, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	rc, err := stream.RangeReadLink(context.Background(), l, http_range.Range{Start: start, Length: length})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestConformance(t *testing.T) {
+	drivertest.Run(t, mount(t, "conformance", true))
+}
+
+func TestConformancePlainNames(t *testing.T) {
+	drivertest.Run(t, mount(t, "plain-names", false))
+}
+
+func TestPutAndRead(t *testing.T) {
+	mount(t, "put", true)
+	data := random(2*blockSize + 100)
+	err := fs.PutDirectly(context.Background(), "/put", &stream.FileStream{
+		Obj:    &model.Object{Name: "file.bin", Size: int64(len(data))},
+		Reader: bytes.NewReader(data),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := fs.Get(context.Background(), "/put/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetSize() != int64(len(data)) {
+		t.Fatalf("size = %d", obj.GetSize())
+	}
+	if got := read(t, "/put/file.bin", 0, -1); !bytes.Equal(got, data) {
+		t.Fatal("content mismatch")
+	}
+	if got := read(t, "/put/file.bin", blockSize-1, 2); !bytes.Equal(got, data[blockSize-1:blockSize+1]) {
+		t.Fatal("range content mismatch")
+	}
+
+	// 底层只能看到加密后的名字和大小
+	remote, err := fs.List(context.Background(), "/put-remote", &fs.ListArgs{NoLog: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remote) != 1 || remote[0].GetName() == "file.bin" || remote[0].GetSize() != encryptedSize(int64(len(data))) {
+		t.Fatalf("remote = %v", remote)
+	}
+}
+
+func TestPutUnknownSize(t *testing.T) {
+	d := mount(t, "unknown-size", false)
+	data := random(blockSize + 10)
+	root, err := d.GetRoot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Put(context.Background(), root, &stream.FileStream{
+		Obj:    &model.Object{Name: "file", Size: -1},
+		Reader: bytes.NewReader(data),
+	}, func(float64) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	op.ClearCache(d, "/")
+	if got := read(t, "/unknown-size/file", 0, -1); !bytes.Equal(got, data) {
+		t.Fatal("content mismatch")
+	}
+}
@@ -0,0 +1,127 @@
+package crypt
+
+import (
+	"HelaList/internal/model"
+	"HelaList/internal/stream"
+	"bytes"
+	"context"
+	"io"
+	stdpath "path"
+	"strings"
+	"sync"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/pkg/errors"
+)
+
+// realPath 虚拟路径对应的实际路径，isDir表示最后一段是不是目录
+func (d *Crypt) realPath(path string, isDir bool) (string, error) {
+	real := d.remote
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		name, err := d.encodeName(part, isDir || i < len(parts)-1)
+		if err != nil {
+			return "", err
+		}
+		real = stdpath.Join(real, name)
+	}
+	return real, nil
+}
+
+func (d *Crypt) encodeName(name string, isDir bool) (string, error) {
+	if d.EncryptNames {
+		return d.cipher.encryptName(name)
+	}
+	if isDir {
+		return name, nil
+	}
+	return name + fileSuffix, nil
+}
+
+// decodeName 名字不是这个存储加密出来的时候返回false
+func (d *Crypt) decodeName(name string, isDir bool) (string, bool) {
+	if d.EncryptNames {
+		decrypted, err := d.cipher.decryptName(name)
+		return decrypted, err == nil
+	}
+	if isDir {
+		return name, true
+	}
+	if !strings.HasSuffix(name, fileSuffix) || name == fileSuffix {
+		return "", false
+	}
+	return strings.TrimSuffix(name, fileSuffix), true
+}
+
+// isSubPath 判断p是否是root本身或在root之下
+func isSubPath(root, p string) bool {
+	return root == "/" || p == root || strings.HasPrefix(p, root+"/")
+}
+
+// rangeReader 把明文的范围换算成覆盖它的加密块，从底层的link读出来再解密
+type rangeReader struct {
+	cipher *Cipher
+	link   *model.Link
+	size   int64
+
+	mu    sync.Mutex
+	nonce []byte
+}
+
+func (r *rangeReader) RangeRead(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+	length := httpRange.Length
+	if length < 0 || httpRange.Start+length > r.size {
+		length = r.size - httpRange.Start
+	}
+	nonce, err := r.getNonce(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if length <= 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	first := httpRange.Start / blockSize
+	last := (httpRange.Start + length - 1) / blockSize
+	offset := int64(headerSize) + first*sealedBlockSize
+	end := min(int64(headerSize)+(last+1)*sealedBlockSize, encryptedSize(r.size))
+	rc, err := stream.RangeReadLink(ctx, r.link, http_range.Range{Start: offset, Length: end - offset})
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		rc:     rc,
+		aead:   r.cipher.data,
+		nonce:  nonce,
+		index:  uint64(first),
+		last:   uint64(blockCount(r.size) - 1),
+		skip:   httpRange.Start - first*blockSize,
+		remain: length,
+		buf:    make([]byte, sealedBlockSize),
+	}, nil
+}
+
+// getNonce 第一次读取时从文件头里取出nonce，顺便检查是不是加密文件
+func (r *rangeReader) getNonce(ctx context.Context) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.nonce != nil {
+		return r.nonce, nil
+	}
+	rc, err := stream.RangeReadLink(ctx, r.link, http_range.Range{Length: int64(headerSize)})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	header := make([]byte, headerSize)
+	if _, err = io.ReadFull(rc, header); err != nil {
+		return nil, errors.Wrap(err, "failed to read header")
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, errBadHeader
+	}
+	r.nonce = header[len(magic):]
+	return r.nonce, nil
+}
@@ -0,0 +1,230 @@
+package ftp
+
+import (
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	"io"
+	stdpath "path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FTP/FTPS存储，只使用被动模式。
+// 每个存储维护一个连接池，FTP连接同一时间只能做一件事，所以每个操作都要从池里借一个连接。
+// 对象的Path是FTP服务器上的绝对路径
+
+type FTP struct {
+	model.Storage
+	Addition
+
+	mu     sync.Mutex
+	idle   chan *conn
+	closed bool
+	noMLSD atomic.Bool // 服务器声称支持MLSD但实际用不了时置位，之后的连接都用LIST
+}
+
+type Addition struct {
+	driver.RootPath
+	Address       string `json:"address" required:"true" help:"host:port, port defaults to 21"`
+	Username      string `json:"username" default:"anonymous"`
+	Password      string `json:"password"`
+	ExplicitTLS   bool   `json:"explicit_tls" default:"false" help:"upgrade the connection with AUTH TLS (FTPS)"`
+	SkipTLSVerify bool   `json:"skip_tls_verify" default:"false"`
+	DisableEPSV   bool   `json:"disable_epsv" default:"false" help:"use PASV instead of EPSV, some servers behind NAT need this"`
+	PoolSize      int    `json:"pool_size" type:"number" default:"4" help:"max idle connections kept for reuse"`
+}
+
+var config = driver.Config{
+	Name:        "ftp",
+	LocalSort:   true,
+	OnlyProxy:   true, // 没有能给浏览器直接访问的地址
+	DefaultRoot: "/",
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &FTP{}
+	})
+}
+
+func (d *FTP) Config() driver.Config {
+	return config
+}
+
+func (d *FTP) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *FTP) Init(ctx context.Context) error {
+	if d.RootFolderPath == "" {
+		d.RootFolderPath = "/"
+	}
+	d.RootFolderPath = stdpath.Clean("/" + d.RootFolderPath)
+	if d.Username == "" {
+		d.Username = "anonymous"
+	}
+	if d.PoolSize <= 0 {
+		d.PoolSize = 4
+	}
+	d.mu.Lock()
+	d.idle = make(chan *conn, d.PoolSize)
+	d.closed = false
+	d.mu.Unlock()
+	// 连一次，顺便检查根目录
+	return d.withConn(func(c *conn) error {
+		return errors.Wrapf(c.ChangeDir(d.RootFolderPath), "failed open root folder %s", d.RootFolderPath)
+	})
+}
+
+// Drop 关闭池里所有空闲连接，正在使用的连接归还时会被直接关闭
+func (d *FTP) Drop(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	if d.idle == nil {
+		return nil
+	}
+	for {
+		select {
+		case c := <-d.idle:
+			_ = c.Quit()
+		default:
+			return nil
+		}
+	}
+}
+
+func (d *FTP) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	c, err := d.getConn()
+	if err != nil {
+		return nil, err
+	}
+	objs, err := d.list(c, dir.GetPath())
+	if isCommandUnsupported(err) && !c.noMLSD {
+		// 有的服务器在FEAT里声明了MLST，但MLSD用不了，退回LIST再试一次。
+		// 这个连接是按MLSD建的，状态也不一定可信，关掉换一个新连接
+		d.noMLSD.Store(true)
+		_ = c.Quit()
+		if c, err = d.dial(); err != nil {
+			return nil, err
+		}
+		objs, err = d.list(c, dir.GetPath())
+	}
+	d.putConn(c, err)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return objs, nil
+}
+
+// Link 返回按范围读取的reader，每次读取用REST从指定位置开始RETR，支持断点续传
+func (d *FTP) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	return &model.Link{
+		RangeReader: &rangeReader{
+			d:    d,
+			path: file.GetPath(),
+			size: file.GetSize(),
+		},
+		ContentLength: file.GetSize(),
+	}, nil
+}
+
+func (d *FTP) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) (model.Obj, error) {
+	dirPath, err := childPath(parentDir, dirName)
+	if err != nil {
+		return nil, err
+	}
+	err = d.withConn(func(c *conn) error {
+		return c.MakeDir(dirPath)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &model.Object{
+		Path:         dirPath,
+		Name:         dirName,
+		ModifiedTime: time.Now(),
+		IsFolder:     true,
+	}, nil
+}
+
+func (d *FTP) Move(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	dstPath, err := childPath(dstDir, srcObj.GetName())
+	if err != nil {
+		return nil, err
+	}
+	err = d.withConn(func(c *conn) error {
+		return c.Rename(srcObj.GetPath(), dstPath)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return movedObj(srcObj, dstPath), nil
+}
+
+func (d *FTP) Rename(ctx context.Context, srcObj model.Obj, newName string) (model.Obj, error) {
+	if err := checkName(newName); err != nil {
+		return nil, err
+	}
+	dstPath := stdpath.Join(stdpath.Dir(srcObj.GetPath()), newName)
+	err := d.withConn(func(c *conn) error {
+		return c.Rename(srcObj.GetPath(), dstPath)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return movedObj(srcObj, dstPath), nil
+}
+
+func (d *FTP) Remove(ctx context.Context, obj model.Obj) error {
+	if stdpath.Clean(obj.GetPath()) == d.RootFolderPath {
+		return errors.New("cannot remove the root folder")
+	}
+	return errors.WithStack(d.withConn(func(c *conn) error {
+		if obj.IsDir() {
+			return c.RemoveDirRecur(obj.GetPath())
+		}
+		return c.Delete(obj.GetPath())
+	}))
+}
+
+// Put 用STOR直接写到目标位置，失败时删掉写了一半的文件
+func (d *FTP) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
+	dstPath, err := childPath(dstDir, file.GetName())
+	if err != nil {
+		return nil, err
+	}
+	reader := io.TeeReader(driver.NewLimitedUploadStream(ctx, file), driver.NewProgress(file.GetSize(), up))
+	err = d.withConn(func(c *conn) error {
+		if err := c.Stor(dstPath, reader); err != nil {
+			_ = c.Delete(dstPath)
+			return err
+		}
+		if mtime := file.GetModifiedTime(); !mtime.IsZero() && c.IsSetTimeSupported() {
+			// 保留源文件的修改时间，失败了也不影响上传结果
+			_ = c.SetTime(dstPath, mtime)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &model.Object{
+		Path:         dstPath,
+		Name:         file.GetName(),
+		Size:         file.GetSize(),
+		ModifiedTime: time.Now(),
+	}, nil
+}
+
+var _ driver.Driver = (*FTP)(nil)
+var _ driver.MkdirResult = (*FTP)(nil)
+var _ driver.MoveResult = (*FTP)(nil)
+var _ driver.RenameResult = (*FTP)(nil)
+var _ driver.Remove = (*FTP)(nil)
+var _ driver.PutResult = (*FTP)(nil)
@@ -0,0 +1,101 @@
+package ftp
+
+import (
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/model"
+	"context"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func newFTP(t *testing.T, s *fakeServer, root string) *FTP {
+	t.Helper()
+	d := &FTP{Addition: Addition{Address: s.addr, PoolSize: 4}}
+	d.RootFolderPath = root
+	d.SetStorage(model.Storage{MountPath: "/ftp"})
+	if err := d.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = d.Drop(context.Background()) })
+	return d
+}
+
+func names(t *testing.T, d *FTP, path string) string {
+	t.Helper()
+	objs, err := d.List(context.Background(), &model.Object{Path: path, IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for _, obj := range objs {
+		name := obj.GetName()
+		if obj.IsDir() {
+			name += "/"
+		}
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
+func TestConformance(t *testing.T) {
+	drivertest.Run(t, newFTP(t, newFakeServer(t, false), "/"))
+}
+
+func TestConformanceWithoutMLSD(t *testing.T) {
+	s := newFakeServer(t, true)
+	s.dirs["/root"] = true
+	drivertest.Run(t, newFTP(t, s, "/root"))
+}
+
+// 服务器声明了MLST但MLSD用不了：换新连接退回LIST，池里按MLSD建的连接都不再用
+func TestListFallsBackToLIST(t *testing.T) {
+	s := newFakeServer(t, true)
+	s.dirs["/dir"] = true
+	s.files["/a.txt"] = []byte("aaa")
+	d := newFTP(t, s, "/")
+
+	// 池里再放一个按MLSD建的连接
+	c, err := d.getConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := d.getConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.putConn(c, nil)
+	d.putConn(other, nil)
+
+	for range 3 {
+		if got := names(t, d, "/"); got != "a.txt,dir/" {
+			t.Fatalf("list = %s", got)
+		}
+	}
+	if n := s.mlsd.Load(); n != 1 {
+		t.Fatalf("MLSD sent %d times", n)
+	}
+	if n := s.conns.Load(); n != 3 {
+		t.Fatalf("%d connections, want 3", n)
+	}
+}
+
+func TestRemoveFolder(t *testing.T) {
+	s := newFakeServer(t, false)
+	d := newFTP(t, s, "/")
+	for _, dir := range []string{"/dir", "/dir/sub"} {
+		s.dirs[dir] = true
+	}
+	s.files["/dir/a.txt"] = []byte("a")
+	s.files["/dir/sub/b.txt"] = []byte("b")
+	if err := d.Remove(context.Background(), &model.Object{Path: "/dir", IsFolder: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, d, "/"); got != "" {
+		t.Fatalf("list = %s", got)
+	}
+	if err := d.Remove(context.Background(), &model.Object{Path: "/", IsFolder: true}); err == nil {
+		t.Fatal("removing the root folder should fail")
+	}
+}
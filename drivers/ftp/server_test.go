@@ -0,0 +1,357 @@
+package ftp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	stdpath "path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeServer 进程内的FTP服务器，文件都在内存里，只实现驱动和jlaffaye/ftp用到的命令。
+// 只支持被动模式；brokenMLSD时在FEAT里声明MLST，但MLSD一律回复500
+type fakeServer struct {
+	addr       string
+	brokenMLSD bool
+
+	mu    sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+
+	conns atomic.Int32 // 建立过的控制连接数
+	mlsd  atomic.Int32 // 收到的MLSD命令数
+}
+
+func newFakeServer(t *testing.T, brokenMLSD bool) *fakeServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		addr:       l.Addr().String(),
+		brokenMLSD: brokenMLSD,
+		files:      make(map[string][]byte),
+		dirs:       map[string]bool{"/": true},
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.conns.Add(1)
+			go (&session{s: s, c: c, r: bufio.NewReader(c), cwd: "/"}).serve()
+		}
+	}()
+	return s
+}
+
+// children 目录下的直接子项，名字排好序
+func (s *fakeServer) children(dir string) []string {
+	var res []string
+	for _, m := range []map[string]bool{s.dirs, s.fileSet()} {
+		for p := range m {
+			if p != "/" && stdpath.Dir(p) == dir {
+				res = append(res, stdpath.Base(p))
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (s *fakeServer) fileSet() map[string]bool {
+	res := make(map[string]bool, len(s.files))
+	for p := range s.files {
+		res[p] = true
+	}
+	return res
+}
+
+type session struct {
+	s    *fakeServer
+	c    net.Conn
+	r    *bufio.Reader
+	cwd  string
+	rest int64
+	pasv net.Listener
+	from string // RNFR的源路径
+}
+
+func (ss *session) reply(code int, format string, args ...any) {
+	_, _ = fmt.Fprintf(ss.c, "%d %s\r\n", code, fmt.Sprintf(format, args...))
+}
+
+func (ss *session) abs(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = stdpath.Join(ss.cwd, p)
+	}
+	return stdpath.Clean(p)
+}
+
+func (ss *session) serve() {
+	defer ss.c.Close()
+	ss.reply(220, "fake ftp ready")
+	for {
+		line, err := ss.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		if !ss.handle(strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+func (ss *session) handle(cmd, arg string) bool {
+	s := ss.s
+	switch cmd {
+	case "USER":
+		ss.reply(331, "password please")
+	case "PASS":
+		ss.reply(230, "logged in")
+	case "FEAT":
+		_, _ = fmt.Fprint(ss.c, "211-Features:\r\n MLST type*;size*;modify*;\r\n UTF8\r\n211 End\r\n")
+	case "TYPE", "OPTS", "NOOP":
+		ss.reply(200, "ok")
+	case "QUIT":
+		ss.reply(221, "bye")
+		return false
+	case "EPSV", "PASV":
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			ss.reply(425, "can't open data connection")
+			break
+		}
+		ss.closeData()
+		ss.pasv = l
+		port := l.Addr().(*net.TCPAddr).Port
+		if cmd == "EPSV" {
+			ss.reply(229, "Entering Extended Passive Mode (|||%d|)", port)
+		} else {
+			ss.reply(227, "Entering Passive Mode (127,0,0,1,%d,%d)", port>>8, port&0xff)
+		}
+	case "PWD":
+		ss.reply(257, "%q is the current directory", ss.cwd)
+	case "CWD", "CDUP":
+		p := ss.abs(arg)
+		if cmd == "CDUP" {
+			p = stdpath.Dir(ss.cwd)
+		}
+		s.mu.Lock()
+		ok := s.dirs[p]
+		s.mu.Unlock()
+		if !ok {
+			ss.reply(550, "no such directory")
+			break
+		}
+		ss.cwd = p
+		ss.reply(250, "ok")
+	case "MKD":
+		p := ss.abs(arg)
+		s.mu.Lock()
+		ok := s.dirs[stdpath.Dir(p)] && !s.dirs[p] && s.files[p] == nil
+		if ok {
+			s.dirs[p] = true
+		}
+		s.mu.Unlock()
+		if !ok {
+			ss.reply(550, "can't create directory")
+			break
+		}
+		ss.reply(257, "%q created", p)
+	case "RMD":
+		p := ss.abs(arg)
+		s.mu.Lock()
+		ok := p != "/" && s.dirs[p] && len(s.children(p)) == 0
+		if ok {
+			delete(s.dirs, p)
+		}
+		s.mu.Unlock()
+		if !ok {
+			ss.reply(550, "can't remove directory")
+			break
+		}
+		ss.reply(250, "ok")
+	case "DELE":
+		p := ss.abs(arg)
+		s.mu.Lock()
+		_, ok := s.files[p]
+		delete(s.files, p)
+		s.mu.Unlock()
+		if !ok {
+			ss.reply(550, "no such file")
+			break
+		}
+		ss.reply(250, "ok")
+	case "RNFR":
+		p := ss.abs(arg)
+		s.mu.Lock()
+		_, ok := s.files[p]
+		ok = ok || s.dirs[p]
+		s.mu.Unlock()
+		if !ok {
+			ss.reply(550, "no such file")
+			break
+		}
+		ss.from = p
+		ss.reply(350, "ready for RNTO")
+	case "RNTO":
+		ss.rename(ss.from, ss.abs(arg))
+	case "REST":
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			ss.reply(501, "bad offset")
+			break
+		}
+		ss.rest = n
+		ss.reply(350, "restarting at %d", n)
+	case "RETR":
+		p := ss.abs(arg)
+		s.mu.Lock()
+		data, ok := s.files[p]
+		s.mu.Unlock()
+		offset := ss.rest
+		ss.rest = 0
+		if !ok || offset > int64(len(data)) {
+			ss.closeData()
+			ss.reply(550, "no such file")
+			break
+		}
+		ss.transfer(func(c net.Conn) error {
+			_, err := c.Write(data[offset:])
+			return err
+		})
+	case "STOR":
+		p := ss.abs(arg)
+		s.mu.Lock()
+		ok := s.dirs[stdpath.Dir(p)] && !s.dirs[p]
+		s.mu.Unlock()
+		if !ok {
+			ss.closeData()
+			ss.reply(553, "can't store here")
+			break
+		}
+		ss.transfer(func(c net.Conn) error {
+			data, err := io.ReadAll(c)
+			if err == nil {
+				s.mu.Lock()
+				s.files[p] = data
+				s.mu.Unlock()
+			}
+			return err
+		})
+	case "MLSD", "LIST":
+		if cmd == "MLSD" {
+			s.mlsd.Add(1)
+			if s.brokenMLSD {
+				ss.closeData()
+				ss.reply(500, "MLSD not understood")
+				break
+			}
+		}
+		p := ss.abs(arg)
+		s.mu.Lock()
+		ok := s.dirs[p]
+		var lines []string
+		for _, name := range s.children(p) {
+			child := stdpath.Join(p, name)
+			data, isFile := s.files[child]
+			switch {
+			case cmd == "MLSD" && isFile:
+				lines = append(lines, fmt.Sprintf("type=file;size=%d;modify=20240102030405; %s", len(data), name))
+			case cmd == "MLSD":
+				lines = append(lines, fmt.Sprintf("type=dir;modify=20240102030405; %s", name))
+			case isFile:
+				lines = append(lines, fmt.Sprintf("-rw-r--r--   1 owner group %d Jan 02 03:04 %s", len(data), name))
+			default:
+				lines = append(lines, fmt.Sprintf("drwxr-xr-x   1 owner group 0 Jan 02 03:04 %s", name))
+			}
+		}
+		s.mu.Unlock()
+		if !ok {
+			ss.closeData()
+			ss.reply(550, "no such directory")
+			break
+		}
+		ss.transfer(func(c net.Conn) error {
+			for _, line := range lines {
+				if _, err := fmt.Fprintf(c, "%s\r\n", line); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	default:
+		ss.reply(502, "command not implemented")
+	}
+	return true
+}
+
+// transfer 接受客户端的数据连接，传完回复226，客户端提前断开时回复426
+func (ss *session) transfer(fn func(c net.Conn) error) {
+	if ss.pasv == nil {
+		ss.reply(425, "use EPSV first")
+		return
+	}
+	_ = ss.pasv.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+	c, err := ss.pasv.Accept()
+	ss.closeData()
+	if err != nil {
+		ss.reply(425, "can't open data connection")
+		return
+	}
+	ss.reply(150, "opening data connection")
+	err = fn(c)
+	_ = c.Close()
+	if err != nil {
+		ss.reply(426, "transfer aborted")
+		return
+	}
+	ss.reply(226, "transfer complete")
+}
+
+func (ss *session) closeData() {
+	if ss.pasv != nil {
+		_ = ss.pasv.Close()
+		ss.pasv = nil
+	}
+}
+
+// rename 文件直接改key，目录连同下面所有的东西一起改
+func (ss *session) rename(from, to string) {
+	s := ss.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if from == "" || !s.dirs[stdpath.Dir(to)] || s.dirs[to] || strings.HasPrefix(to+"/", from+"/") {
+		ss.reply(553, "can't rename")
+		return
+	}
+	ss.from = ""
+	move := func(p string) string {
+		return to + strings.TrimPrefix(p, from)
+	}
+	for p, data := range s.files {
+		if p == from || strings.HasPrefix(p, from+"/") {
+			delete(s.files, p)
+			s.files[move(p)] = data
+		}
+	}
+	for p := range s.dirs {
+		if p == from || strings.HasPrefix(p, from+"/") {
+			delete(s.dirs, p)
+			s.dirs[move(p)] = true
+		}
+	}
+	ss.reply(250, "ok")
+}
@@ -0,0 +1,239 @@
+package ftp
+
+import (
+	"HelaList/internal/model"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/textproto"
+	stdpath "path"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// conn 池里的连接，记录建立时是否禁用了MLSD
+type conn struct {
+	*ftp.ServerConn
+	noMLSD bool
+}
+
+func (d *FTP) dial() (*conn, error) {
+	addr := d.Address
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "21")
+	}
+	noMLSD := d.noMLSD.Load()
+	opts := []ftp.DialOption{
+		ftp.DialWithTimeout(10 * time.Second),
+		ftp.DialWithDisabledEPSV(d.DisableEPSV),
+		ftp.DialWithDisabledMLSD(noMLSD),
+	}
+	if d.ExplicitTLS {
+		host, _, _ := net.SplitHostPort(addr)
+		opts = append(opts, ftp.DialWithExplicitTLS(&tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: d.SkipTLSVerify,
+		}))
+	}
+	c, err := ftp.Dial(addr, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed connect to %s", addr)
+	}
+	if err = c.Login(d.Username, d.Password); err != nil {
+		_ = c.Quit()
+		return nil, errors.Wrap(err, "failed login")
+	}
+	return &conn{ServerConn: c, noMLSD: noMLSD}, nil
+}
+
+// getConn 优先复用空闲连接，空闲太久被服务器断开的连接会被丢掉，
+// 退回LIST之前按MLSD建的连接也丢掉
+func (d *FTP) getConn() (*conn, error) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil, errors.New("storage is dropped")
+	}
+	idle := d.idle
+	d.mu.Unlock()
+	for {
+		select {
+		case c := <-idle:
+			if c.noMLSD == d.noMLSD.Load() && c.NoOp() == nil {
+				return c, nil
+			}
+			_ = c.Quit()
+		default:
+			return d.dial()
+		}
+	}
+}
+
+// putConn 归还连接。操作出错且不是服务器正常的错误回复时，连接状态不可信，直接关闭
+func (d *FTP) putConn(c *conn, err error) {
+	var protoErr *textproto.Error
+	if err != nil && !errors.As(err, &protoErr) {
+		_ = c.Quit()
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed || c.noMLSD != d.noMLSD.Load() {
+		_ = c.Quit()
+		return
+	}
+	select {
+	case d.idle <- c:
+	default:
+		_ = c.Quit()
+	}
+}
+
+func (d *FTP) withConn(fn func(c *conn) error) error {
+	c, err := d.getConn()
+	if err != nil {
+		return err
+	}
+	err = fn(c)
+	d.putConn(c, err)
+	return err
+}
+
+// list 列出目录，符号链接用CWD试探它指向的是不是目录
+func (d *FTP) list(c *conn, dirPath string) ([]model.Obj, error) {
+	entries, err := c.List(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]model.Obj, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		entryPath := stdpath.Join(dirPath, entry.Name)
+		isDir := entry.Type == ftp.EntryTypeFolder
+		if entry.Type == ftp.EntryTypeLink {
+			isDir = c.ChangeDir(entryPath) == nil
+		}
+		obj := &model.Object{
+			Path:         entryPath,
+			Name:         entry.Name,
+			ModifiedTime: entry.Time,
+			IsFolder:     isDir,
+		}
+		if !isDir {
+			obj.Size = int64(entry.Size)
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// isCommandUnsupported 服务器回复500/501/502/504，表示不认识或没实现这个命令
+func isCommandUnsupported(err error) bool {
+	var protoErr *textproto.Error
+	if !errors.As(err, &protoErr) {
+		return false
+	}
+	switch protoErr.Code {
+	case ftp.StatusBadCommand, ftp.StatusBadArguments, ftp.StatusNotImplemented, ftp.StatusNotImplementedParameter:
+		return true
+	}
+	return false
+}
+
+type rangeReader struct {
+	d    *FTP
+	path string
+	size int64
+}
+
+// RangeRead 借一个连接，用REST跳到起始位置再RETR，读完或关闭时归还连接
+func (r *rangeReader) RangeRead(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+	length := httpRange.Length
+	if length < 0 || httpRange.Start+length > r.size {
+		length = r.size - httpRange.Start
+	}
+	c, err := r.d.getConn()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.RetrFrom(r.path, uint64(httpRange.Start))
+	if err != nil {
+		r.d.putConn(c, err)
+		return nil, errors.WithStack(err)
+	}
+	return &retrReader{
+		d:      r.d,
+		c:      c,
+		resp:   resp,
+		remain: length,
+	}, nil
+}
+
+type retrReader struct {
+	d      *FTP
+	c      *conn
+	resp   *ftp.Response
+	remain int64
+	closed bool
+}
+
+func (r *retrReader) Read(p []byte) (int, error) {
+	if r.remain <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remain {
+		p = p[:r.remain]
+	}
+	n, err := r.resp.Read(p)
+	r.remain -= int64(n)
+	return n, err
+}
+
+// Close 提前关闭时服务器会回复传输中止，这时连接状态不确定，不再放回池里
+func (r *retrReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	err := r.resp.Close()
+	if r.remain > 0 {
+		_ = r.c.Quit()
+		return nil
+	}
+	r.d.putConn(r.c, err)
+	return err
+}
+
+// movedObj 移动、改名后的对象，FTP的RNFR/RNTO不返回对象信息，直接按源对象构造
+func movedObj(src model.Obj, dstPath string) model.Obj {
+	return &model.Object{
+		Path:         dstPath,
+		Name:         stdpath.Base(dstPath),
+		Size:         src.GetSize(),
+		ModifiedTime: src.GetModifiedTime(),
+		IsFolder:     src.IsDir(),
+	}
+}
+
+// childPath 返回dir下名为name的对象的远程路径
+func childPath(dir model.Obj, name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	return stdpath.Join(dir.GetPath(), name), nil
+}
+
+// checkName 名字里不能带路径分隔符和换行，换行会被当成新的FTP命令
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\r\n\x00") {
+		return errors.Errorf("invalid name: %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package http_index
+
+import (
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	"crypto/tls"
+	"mime"
+	"net/http"
+	"net/url"
+	stdpath "path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HTTP目录索引存储：把nginx/Apache的autoindex页面、python -m http.server之类的简单文件服务器当成只读存储。
+// 列目录时请求目录地址，解析返回的HTML或JSON；下载直接给出文件的地址，重定向和Range请求都由那边的服务器处理。
+// 对象的Path是存储内的路径
+
+type HTTPIndex struct {
+	model.Storage
+	Addition
+	base   *url.URL
+	client *http.Client
+}
+
+// 目录页的格式
+const (
+	FormatAuto = "auto" // 按Content-Type判断
+	FormatHTML = "html"
+	FormatJSON = "json" // nginx的autoindex_format json、Caddy的browse等
+)
+
+type Addition struct {
+	URL           string `json:"url" required:"true" help:"address of the root index page, such as https://mirror.example.com/pub/"`
+	Format        string `json:"format" type:"select" options:"auto,html,json" default:"auto"`
+	Username      string `json:"username" help:"basic auth, downloads then need the web proxy because browsers are not given the password"`
+	Password      string `json:"password"`
+	SkipTLSVerify bool   `json:"skip_tls_verify" default:"false"`
+}
+
+var config = driver.Config{
+	Name:        "http_index",
+	LocalSort:   true,
+	NoUpload:    true,
+	DefaultRoot: "/",
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &HTTPIndex{}
+	})
+}
+
+func (d *HTTPIndex) Config() driver.Config {
+	return config
+}
+
+func (d *HTTPIndex) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *HTTPIndex) Init(ctx context.Context) error {
+	u, err := url.Parse(strings.TrimSpace(d.URL))
+	if err != nil {
+		return errors.Wrap(err, "invalid url")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	u.RawPath, u.RawQuery, u.Fragment = "", "", ""
+	d.base = u
+	switch d.Format {
+	case FormatAuto, FormatHTML, FormatJSON:
+	case "":
+		d.Format = FormatAuto
+	default:
+		return errors.Errorf("unknown format: %s", d.Format)
+	}
+	d.client = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: d.SkipTLSVerify},
+		},
+	}
+	// 先列一次根目录，地址填错了能马上发现
+	_, err = d.List(ctx, &model.Object{Path: "/", IsFolder: true}, model.ListArgs{})
+	return err
+}
+
+func (d *HTTPIndex) Drop(ctx context.Context) error {
+	if d.client != nil {
+		d.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (d *HTTPIndex) GetRoot(ctx context.Context) (model.Obj, error) {
+	return &model.Object{
+		Path:     "/",
+		Name:     "root",
+		IsFolder: true,
+	}, nil
+}
+
+func (d *HTTPIndex) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	dirURL := d.urlOf(dir.GetPath(), true)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, dirURL.String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	switch d.Format {
+	case FormatJSON:
+		req.Header.Set("Accept", "application/json")
+	case FormatHTML:
+		req.Header.Set("Accept", "text/html")
+	default:
+		req.Header.Set("Accept", "application/json;q=0.9, text/html")
+	}
+	d.setAuth(req.Header)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed request %s", dirURL)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errors.Errorf("object not found: %s", dir.GetPath())
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.Errorf("unexpected status from %s: %s", dirURL, resp.Status)
+	}
+
+	var entries []entry
+	if d.isJSON(resp.Header.Get("Content-Type")) {
+		entries, err = parseJSON(resp.Body)
+	} else {
+		// 重定向之后以最终的地址为准解析相对链接
+		entries, err = parseHTML(resp.Body, resp.Request.URL)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parse index of %s", dir.GetPath())
+	}
+	objs := make([]model.Obj, 0, len(entries))
+	for _, e := range entries {
+		objs = append(objs, &model.Object{
+			Path:         stdpath.Join(dir.GetPath(), e.name),
+			Name:         e.name,
+			Size:         e.size,
+			ModifiedTime: e.modified,
+			IsFolder:     e.isDir,
+		})
+	}
+	return objs, nil
+}
+
+// Link 直接给出文件地址，浏览器会自己跟随重定向、发送Range请求
+func (d *HTTPIndex) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	link := &model.Link{
+		URL:    d.urlOf(file.GetPath(), false).String(),
+		Header: http.Header{},
+	}
+	d.setAuth(link.Header)
+	return link, nil
+}
+
+// urlOf 存储内的路径对应的地址，目录以"/"结尾
+func (d *HTTPIndex) urlOf(path string, isDir bool) *url.URL {
+	u := *d.base
+	p := strings.Trim(stdpath.Clean("/"+path), "/")
+	if p != "" {
+		u.Path += p
+		if isDir {
+			u.Path += "/"
+		}
+	}
+	return &u
+}
+
+func (d *HTTPIndex) setAuth(header http.Header) {
+	if d.Username == "" && d.Password == "" {
+		return
+	}
+	req := http.Request{Header: header}
+	req.SetBasicAuth(d.Username, d.Password)
+}
+
+func (d *HTTPIndex) isJSON(contentType string) bool {
+	switch d.Format {
+	case FormatJSON:
+		return true
+	case FormatHTML:
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+var _ driver.Driver = (*HTTPIndex)(nil)
+var _ driver.GetRooter = (*HTTPIndex)(nil)
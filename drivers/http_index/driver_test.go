@@ -0,0 +1,232 @@
+package http_index
+
+import (
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/model"
+	"HelaList/internal/stream"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+)
+
+const nginxIndex = `<html>
+<head><title>Index of /pub/</title></head>
+<body>
+<h1>Index of /pub/</h1><hr><pre><a href="../">../</a>
+<a href="docs/">docs/</a>                                              01-Oct-2025 12:00                   -
+<a href="hello%20world.txt">hello world.txt</a>                                    02-Oct-2025 08:30                  11
+<a href="big.iso">big.iso</a>                                            03-Oct-2025 09:15                1.5M
+<a href="https://example.com/elsewhere">elsewhere</a>
+</pre><hr></body>
+</html>`
+
+const apacheIndex = `<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 3.2 Final//EN">
+<html><head><title>Index of /pub/docs</title></head><body>
+<h1>Index of /pub/docs</h1>
+<table>
+<tr><th><a href="?C=N;O=D">Name</a></th><th><a href="?C=M;O=A">Last modified</a></th><th><a href="?C=S;O=A">Size</a></th></tr>
+<tr><td><a href="/pub/"><img src="/icons/back.gif" alt="[PARENTDIR]"></a></td><td><a href="/pub/">Parent Directory</a></td><td>&nbsp;</td><td align="right">  - </td></tr>
+<tr><td><a href="guide.pdf"><img src="/icons/layout.gif" alt="[   ]"></a></td><td><a href="guide.pdf">guide.pdf</a></td><td align="right">2025-09-30 17:45  </td><td align="right">2.0K</td></tr>
+<tr><td><a href="old/"><img src="/icons/folder.gif" alt="[DIR]"></a></td><td><a href="old/">old/</a></td><td align="right">2025-09-29 10:00  </td><td align="right">  - </td></tr>
+</table></body></html>`
+
+const jsonIndex = `[
+{ "name":"a.bin", "type":"file", "mtime":"Sat, 04 Oct 2025 10:00:00 GMT", "size":5 },
+{ "name":"sub", "type":"directory", "mtime":"Sat, 04 Oct 2025 11:00:00 GMT" }
+]`
+
+const caddyIndex = `[
+{"name":"x.txt","size":3,"url":"./x.txt","mod_time":"2025-10-05T06:07:08Z","mode":420,"is_dir":false},
+{"name":"y/","size":4096,"url":"./y/","mod_time":"2025-10-05T06:07:09Z","mode":2147484141,"is_dir":true}
+]`
+
+// newServer 一个简单的目录服务器，/pub/下是各种格式的目录页，文件用ServeContent返回以支持Range
+func newServer(t *testing.T) *httptest.Server {
+	files := map[string]string{
+		"/pub/hello world.txt": "hello world",
+		"/pub/docs/guide.pdf":  "pdf",
+		"/pub/json/a.bin":      "abcde",
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pub/":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, nginxIndex)
+		case "/pub/docs/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, apacheIndex)
+		case "/pub/json/":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, jsonIndex)
+		case "/pub/caddy/":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			io.WriteString(w, caddyIndex)
+		case "/pub/moved.bin":
+			http.Redirect(w, r, "/pub/json/a.bin", http.StatusFound)
+		case "/private/":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "u" || pass != "p" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			io.WriteString(w, `<a href="secret.txt">secret.txt</a>`)
+		default:
+			content, ok := files[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader(content))
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newDriver(t *testing.T, addition Addition) *HTTPIndex {
+	t.Helper()
+	d := &HTTPIndex{Addition: addition}
+	if err := d.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Drop(context.Background()) })
+	return d
+}
+
+func list(t *testing.T, d *HTTPIndex, path string) map[string]model.Obj {
+	t.Helper()
+	objs, err := d.List(context.Background(), &model.Object{Path: path, IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := make(map[string]model.Obj, len(objs))
+	for _, obj := range objs {
+		res[obj.GetName()] = obj
+	}
+	return res
+}
+
+func check(t *testing.T, objs map[string]model.Obj, name string, isDir bool, size int64, modified string) {
+	t.Helper()
+	obj, ok := objs[name]
+	if !ok {
+		t.Fatalf("%s not listed", name)
+	}
+	if obj.IsDir() != isDir || obj.GetSize() != size {
+		t.Fatalf("%s: dir %v size %d, want dir %v size %d", name, obj.IsDir(), obj.GetSize(), isDir, size)
+	}
+	want, _ := time.Parse(time.RFC3339, modified)
+	if !obj.GetModifiedTime().Equal(want) {
+		t.Fatalf("%s: modified %v, want %v", name, obj.GetModifiedTime(), want)
+	}
+}
+
+func TestListHTML(t *testing.T) {
+	srv := newServer(t)
+	d := newDriver(t, Addition{URL: srv.URL + "/pub"})
+
+	root := list(t, d, "/")
+	if len(root) != 3 {
+		t.Fatalf("nginx index = %v", root)
+	}
+	check(t, root, "docs", true, 0, "2025-10-01T12:00:00Z")
+	check(t, root, "hello world.txt", false, 11, "2025-10-02T08:30:00Z")
+	check(t, root, "big.iso", false, 3<<19, "2025-10-03T09:15:00Z")
+	if got := root["hello world.txt"].GetPath(); got != "/hello world.txt" {
+		t.Fatalf("path = %q", got)
+	}
+
+	docs := list(t, d, "/docs")
+	if len(docs) != 2 {
+		t.Fatalf("apache index = %v", docs)
+	}
+	check(t, docs, "guide.pdf", false, 2048, "2025-09-30T17:45:00Z")
+	check(t, docs, "old", true, 0, "2025-09-29T10:00:00Z")
+}
+
+func TestListJSON(t *testing.T) {
+	srv := newServer(t)
+	d := newDriver(t, Addition{URL: srv.URL + "/pub/"})
+
+	objs := list(t, d, "/json")
+	check(t, objs, "a.bin", false, 5, "2025-10-04T10:00:00Z")
+	check(t, objs, "sub", true, 0, "2025-10-04T11:00:00Z")
+
+	objs = list(t, d, "/caddy")
+	check(t, objs, "x.txt", false, 3, "2025-10-05T06:07:08Z")
+	check(t, objs, "y", true, 0, "2025-10-05T06:07:09Z")
+}
+
+func TestListNotFound(t *testing.T) {
+	srv := newServer(t)
+	d := newDriver(t, Addition{URL: srv.URL + "/pub/"})
+	_, err := d.List(context.Background(), &model.Object{Path: "/missing", IsFolder: true}, model.ListArgs{})
+	if err == nil || !strings.Contains(err.Error(), "object not found") {
+		t.Fatalf("list missing: %v", err)
+	}
+}
+
+func TestLinkRange(t *testing.T) {
+	srv := newServer(t)
+	d := newDriver(t, Addition{URL: srv.URL + "/pub/"})
+
+	for path, c := range map[string]struct {
+		start int64
+		want  string
+	}{
+		"/hello world.txt": {6, "world"},
+		"/moved.bin":       {1, "bcde"}, // 302跳到/pub/json/a.bin
+	} {
+		l, err := d.Link(context.Background(), &model.Object{Path: path}, model.LinkArgs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(l.URL, srv.URL+"/pub/") {
+			t.Fatalf("link url = %s", l.URL)
+		}
+		rc, err := stream.RangeReadLink(context.Background(), l, http_range.Range{Start: c.start, Length: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, []byte(c.want)) {
+			t.Fatalf("%s range = %q, want %q", path, data, c.want)
+		}
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	srv := newServer(t)
+	d := &HTTPIndex{Addition: Addition{URL: srv.URL + "/private/"}}
+	if err := d.Init(context.Background()); err == nil {
+		t.Fatal("init should fail without credentials")
+	}
+	d = newDriver(t, Addition{URL: srv.URL + "/private/", Username: "u", Password: "p"})
+	if objs := list(t, d, "/"); objs["secret.txt"] == nil {
+		t.Fatalf("private index = %v", objs)
+	}
+	l, err := d.Link(context.Background(), &model.Object{Path: "/secret.txt"}, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := (&http.Request{Header: l.Header}).BasicAuth(); !ok {
+		t.Fatal("link does not carry the credentials")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	srv := newServer(t)
+	drivertest.Run(t, newDriver(t, Addition{URL: srv.URL + "/pub/"}))
+}
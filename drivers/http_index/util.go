@@ -0,0 +1,227 @@
+package http_index
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+// entry 目录页里解析出来的一项
+type entry struct {
+	name     string
+	isDir    bool
+	size     int64
+	modified time.Time
+}
+
+// 目录页最多读这么多，防止把一个大文件当成目录页读进内存
+const maxIndexSize = 32 << 20
+
+// parseJSON 解析nginx(autoindex_format json)和Caddy(browse)的JSON目录
+//
+//	nginx: [{"name":"a.txt","type":"file","mtime":"Wed, 01 Oct 2025 12:00:00 GMT","size":123}]
+//	caddy: [{"name":"dir/","is_dir":true,"mod_time":"2025-10-01T12:00:00Z","size":0}]
+func parseJSON(r io.Reader) ([]entry, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxIndexSize))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var items []struct {
+		Name     string          `json:"name"`
+		Type     string          `json:"type"`
+		IsDir    bool            `json:"is_dir"`
+		Size     json.Number     `json:"size"`
+		MTime    string          `json:"mtime"`
+		ModTime  string          `json:"mod_time"`
+		Modified json.RawMessage `json:"modified"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&items); err != nil {
+		return nil, errors.Wrap(err, "invalid json index")
+	}
+	entries := make([]entry, 0, len(items))
+	for _, item := range items {
+		e := entry{
+			name:  strings.TrimSuffix(item.Name, "/"),
+			isDir: item.IsDir || item.Type == "directory" || strings.HasSuffix(item.Name, "/"),
+		}
+		if !validName(e.name) {
+			continue
+		}
+		if !e.isDir {
+			e.size, _ = item.Size.Int64()
+		}
+		for _, s := range []string{item.MTime, item.ModTime, strings.Trim(string(item.Modified), `"`)} {
+			if t, ok := parseTime(s); ok {
+				e.modified = t
+				break
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseHTML 解析HTML目录页。dirURL的直接子项的链接都算，排序链接、上级目录、外链会被跳过；
+// 每个链接后面到下一个链接之前的文字里找日期和大小，nginx、Apache、lighttpd的默认页面都是这样排的
+func parseHTML(r io.Reader, dirURL *url.URL) ([]entry, error) {
+	z := html.NewTokenizer(io.LimitReader(r, maxIndexSize))
+	var (
+		entries  []*entry
+		seen     = make(map[string]*entry)
+		texts    = make(map[*entry]*strings.Builder)
+		cur      *entry
+		inAnchor bool
+	)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, errors.WithStack(err)
+			}
+			res := make([]entry, 0, len(entries))
+			for _, e := range entries {
+				e.size, e.modified = parseInfo(texts[e].String())
+				if e.isDir {
+					e.size = 0
+				}
+				res = append(res, *e)
+			}
+			return res, nil
+		case html.StartTagToken:
+			tag, hasAttr := z.TagName()
+			if string(tag) != "a" {
+				continue
+			}
+			inAnchor = true
+			cur = nil
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) != "href" {
+					continue
+				}
+				e := childOf(dirURL, string(val))
+				if e == nil {
+					break
+				}
+				// Apache的图标和文件名是两个指向同一地址的链接，合并成一项
+				if old, ok := seen[e.name]; ok {
+					cur = old
+					break
+				}
+				seen[e.name] = e
+				texts[e] = &strings.Builder{}
+				entries = append(entries, e)
+				cur = e
+			}
+		case html.EndTagToken:
+			if tag, _ := z.TagName(); string(tag) == "a" {
+				inAnchor = false
+			}
+		case html.TextToken:
+			if cur != nil && !inAnchor {
+				texts[cur].Write(z.Text())
+				texts[cur].WriteByte(' ')
+			}
+		}
+	}
+}
+
+// childOf 链接指向dirURL的直接子项时返回对应的entry
+func childOf(dirURL *url.URL, href string) *entry {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "?") {
+		return nil
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return nil
+	}
+	u := dirURL.ResolveReference(ref)
+	if u.Scheme != dirURL.Scheme || u.Host != dirURL.Host || u.RawQuery != "" {
+		return nil
+	}
+	dirPath := dirURL.Path
+	if !strings.HasSuffix(dirPath, "/") {
+		dirPath += "/"
+	}
+	rest, ok := strings.CutPrefix(u.Path, dirPath)
+	if !ok {
+		return nil
+	}
+	name, isDir := strings.CutSuffix(rest, "/")
+	if !validName(name) {
+		return nil
+	}
+	return &entry{name: name, isDir: isDir}
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+var (
+	// 02-Jan-2006 15:04 (nginx)、2006-01-02 15:04 (Apache)，秒可有可无
+	dateRe = regexp.MustCompile(`\d{1,2}-[A-Za-z]{3}-\d{4} \d{1,2}:\d{2}(?::\d{2})?|\d{4}-\d{2}-\d{2}[ T]\d{1,2}:\d{2}(?::\d{2})?`)
+	// 1234、1.2K、3 MB、4.0 GiB
+	sizeRe = regexp.MustCompile(`(?i)(?:^|\s)(\d+(?:\.\d+)?) ?([KMGTP])?(?:i?B)?(?:\s|$)`)
+)
+
+var timeLayouts = []string{
+	"02-Jan-2006 15:04",
+	"02-Jan-2006 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+}
+
+// parseInfo 从链接后面的文字里找修改时间和大小，找不到就是零值
+func parseInfo(text string) (int64, time.Time) {
+	var modified time.Time
+	if loc := dateRe.FindStringIndex(text); loc != nil {
+		modified, _ = parseTime(text[loc[0]:loc[1]])
+		text = text[:loc[0]] + " " + text[loc[1]:]
+	}
+	var size int64
+	if m := sizeRe.FindAllStringSubmatch(text, -1); m != nil {
+		last := m[len(m)-1]
+		n, _ := strconv.ParseFloat(last[1], 64)
+		if last[2] != "" {
+			n *= float64(int64(1) << (10 * (strings.Index("KMGTP", strings.ToUpper(last[2])) + 1)))
+		}
+		size = int64(n)
+	}
+	return size, modified
+}
+
+func parseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, true
+	}
+	// 目录页上的时间不带时区，按UTC算
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,299 @@
+package local
+
+import (
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// 本地存储：把服务器上的一个目录挂载进来。
+// 所有对象的Path都是宿主机上的绝对路径，每次操作前都会检查它没有跑出根目录
+
+type Local struct {
+	model.Storage
+	Addition
+	root      string // 根目录的绝对路径
+	realRoot  string // 根目录解析完符号链接后的真实路径
+	mkdirPerm os.FileMode
+}
+
+// 符号链接的处理方式
+const (
+	SymlinkInside = "inside" // 只跟随指向根目录内部的链接，指向外部的链接会被隐藏
+	SymlinkFollow = "follow" // 跟随所有链接，相当于信任宿主机上的链接
+	SymlinkSkip   = "skip"   // 隐藏所有链接
+)
+
+type Addition struct {
+	driver.RootPath
+	SymlinkPolicy string `json:"symlink_policy" type:"select" options:"inside,follow,skip" default:"inside" help:"inside: only follow symlinks that stay under the root; follow: follow all symlinks; skip: hide symlinks"`
+	ShowHidden    bool   `json:"show_hidden" default:"true" help:"show files and folders starting with '.'"`
+	MkdirPerm     string `json:"mkdir_perm" default:"777" help:"permission bits (octal) for new folders"`
+}
+
+var config = driver.Config{
+	Name:          "local",
+	LocalSort:     true,
+	OnlyLinkMFile: true, // 本地文件只能由服务器读出来再发给客户端
+	NoCache:       true, // 本地列目录很快，缓存反而会让外部的改动看不到
+	DefaultRoot:   "/",
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &Local{}
+	})
+}
+
+func (d *Local) Config() driver.Config {
+	return config
+}
+
+func (d *Local) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *Local) Init(ctx context.Context) error {
+	if d.RootFolderPath == "" {
+		return errors.New("root folder path is required")
+	}
+	root, err := filepath.Abs(d.RootFolderPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !info.IsDir() {
+		return errors.Errorf("root folder %s is not a directory", root)
+	}
+	d.root = root
+	d.realRoot, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	switch d.SymlinkPolicy {
+	case SymlinkInside, SymlinkFollow, SymlinkSkip:
+	case "":
+		d.SymlinkPolicy = SymlinkInside
+	default:
+		return errors.Errorf("unknown symlink policy: %s", d.SymlinkPolicy)
+	}
+
+	d.mkdirPerm = 0o777
+	if d.MkdirPerm != "" {
+		perm, err := strconv.ParseUint(d.MkdirPerm, 8, 32)
+		if err != nil {
+			return errors.Wrapf(err, "invalid mkdir perm %s", d.MkdirPerm)
+		}
+		d.mkdirPerm = os.FileMode(perm)
+	}
+	return nil
+}
+
+func (d *Local) Drop(ctx context.Context) error {
+	return nil
+}
+
+// Get 根目录也走这里，所以不需要GetRooter
+func (d *Local) Get(ctx context.Context, path string) (model.Obj, error) {
+	hostPath, err := d.hostPath(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(hostPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("object not found: %s", path)
+		}
+		return nil, errors.WithStack(err)
+	}
+	obj, ok := d.fileInfoToObj(hostPath, info)
+	if !ok {
+		return nil, errors.Errorf("object not found: %s", path)
+	}
+	return obj, nil
+}
+
+func (d *Local) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	dirPath, err := d.checkHostPath(dir.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	objs := make([]model.Obj, 0, len(entries))
+	for _, entry := range entries {
+		if !d.ShowHidden && isHidden(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// 列目录和取信息之间文件被删掉了
+			continue
+		}
+		if obj, ok := d.fileInfoToObj(filepath.Join(dirPath, entry.Name()), info); ok {
+			objs = append(objs, obj)
+		}
+	}
+	return objs, nil
+}
+
+func (d *Local) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	filePath, err := d.checkHostPath(file.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, errors.WithStack(err)
+	}
+	return &model.Link{
+		MFile:         f,
+		ContentLength: info.Size(),
+		SyncClosers:   utils.NewSyncClosers(f),
+	}, nil
+}
+
+func (d *Local) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) (model.Obj, error) {
+	dirPath, err := d.childPath(parentDir, dirName)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Mkdir(dirPath, d.mkdirPerm); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return d.statObj(dirPath)
+}
+
+func (d *Local) Move(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	srcPath, err := d.checkHostPath(srcObj.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	dstPath, err := d.childPath(dstDir, srcObj.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if srcObj.IsDir() && isSubPath(srcPath, dstPath) {
+		return nil, errors.New("cannot move a folder into itself")
+	}
+	if err = os.Rename(srcPath, dstPath); err != nil {
+		if !isCrossDevice(err) {
+			return nil, errors.WithStack(err)
+		}
+		// 根目录下挂了别的文件系统时rename会失败，退化成复制后删除
+		if err = d.copyAll(ctx, srcPath, dstPath); err != nil {
+			_ = os.RemoveAll(dstPath)
+			return nil, err
+		}
+		if err = os.RemoveAll(srcPath); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return d.statObj(dstPath)
+}
+
+func (d *Local) Rename(ctx context.Context, srcObj model.Obj, newName string) (model.Obj, error) {
+	srcPath, err := d.checkHostPath(srcObj.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	if err = checkName(newName); err != nil {
+		return nil, err
+	}
+	dstPath := filepath.Join(filepath.Dir(srcPath), newName)
+	if err = os.Rename(srcPath, dstPath); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return d.statObj(dstPath)
+}
+
+func (d *Local) Copy(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	srcPath, err := d.checkHostPath(srcObj.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	dstPath, err := d.childPath(dstDir, srcObj.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if srcObj.IsDir() && isSubPath(srcPath, dstPath) {
+		return nil, errors.New("cannot copy a folder into itself")
+	}
+	if err = d.copyAll(ctx, srcPath, dstPath); err != nil {
+		return nil, err
+	}
+	return d.statObj(dstPath)
+}
+
+func (d *Local) Remove(ctx context.Context, obj model.Obj) error {
+	objPath, err := d.checkHostPath(obj.GetPath())
+	if err != nil {
+		return err
+	}
+	if objPath == d.root {
+		return errors.New("cannot remove the root folder")
+	}
+	return errors.WithStack(os.RemoveAll(objPath))
+}
+
+// Put 先写到同目录下的临时文件，写完再改名，中途失败不会留下半个文件
+func (d *Local) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
+	dstPath, err := d.childPath(dstDir, file.GetName())
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dstPath), "."+file.GetName()+".uploading-*")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	tmpPath := tmp.Name()
+	reader := driver.NewLimitedUploadStream(ctx, &driver.ReaderUpdatingProgress{
+		Reader:         file,
+		UpdateProgress: up,
+	})
+	_, err = io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, dstPath)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, errors.WithStack(err)
+	}
+	if mtime := file.GetModifiedTime(); !mtime.IsZero() {
+		// 保留源文件的修改时间，失败了也不影响上传结果
+		_ = os.Chtimes(dstPath, time.Now(), mtime)
+	}
+	return d.statObj(dstPath)
+}
+
+var _ driver.Driver = (*Local)(nil)
+var _ driver.Getter = (*Local)(nil)
+var _ driver.MkdirResult = (*Local)(nil)
+var _ driver.MoveResult = (*Local)(nil)
+var _ driver.RenameResult = (*Local)(nil)
+var _ driver.CopyResult = (*Local)(nil)
+var _ driver.Remove = (*Local)(nil)
+var _ driver.PutResult = (*Local)(nil)
@@ -0,0 +1,245 @@
+package local
+
+import (
+	"HelaList/internal/driver"
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/model"
+	"HelaList/internal/stream"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	d := &Local{Addition: Addition{
+		RootPath:   driver.RootPath{RootFolderPath: t.TempDir()},
+		ShowHidden: true,
+	}}
+	if err := d.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	drivertest.Run(t, d)
+}
+
+// newLocal 根目录下有普通的文件和目录，以及指向内部、外部和不存在位置的链接：
+//
+//	root/a.txt, root/dir/b.txt
+//	root/in-dir -> dir, root/in-file -> a.txt
+//	root/out-dir -> outside, root/out-file -> outside/secret.txt
+//	root/broken -> missing
+func newLocal(t *testing.T, policy string) (d *Local, root, outside string) {
+	t.Helper()
+	base := t.TempDir()
+	root = filepath.Join(base, "root")
+	outside = filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "dir"), outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(root, "a.txt"), filepath.Join(root, "dir", "b.txt"), filepath.Join(outside, "secret.txt")} {
+		if err := os.WriteFile(file, []byte(filepath.Base(file)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, target := range map[string]string{
+		"in-dir":   "dir",
+		"in-file":  "a.txt",
+		"out-dir":  outside,
+		"out-file": filepath.Join(outside, "secret.txt"),
+		"broken":   "missing",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d = &Local{Addition: Addition{
+		RootPath:      driver.RootPath{RootFolderPath: root},
+		SymlinkPolicy: policy,
+		ShowHidden:    true,
+	}}
+	if err := d.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return d, root, outside
+}
+
+func dirObj(path string) model.Obj {
+	return &model.Object{Path: path, IsFolder: true}
+}
+
+func names(t *testing.T, d *Local, dir string) string {
+	t.Helper()
+	objs, err := d.List(context.Background(), dirObj(dir), model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for _, obj := range objs {
+		name := obj.GetName()
+		if obj.IsDir() {
+			name += "/"
+		}
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
+func put(d *Local, dir model.Obj, name, data string) (model.Obj, error) {
+	file := &stream.FileStream{
+		Ctx:    context.Background(),
+		Obj:    &model.Object{Name: name, Size: int64(len(data))},
+		Reader: strings.NewReader(data),
+	}
+	defer file.Close()
+	return d.Put(context.Background(), dir, file, func(float64) {})
+}
+
+func TestSymlinkPolicy(t *testing.T) {
+	for _, c := range []struct {
+		policy string
+		list   string
+		// 能通过Get读到的路径，和读不到的
+		found, notFound []string
+	}{
+		{
+			policy:   "",
+			list:     "a.txt,dir/,in-dir/,in-file",
+			found:    []string{"/in-dir", "/in-dir/b.txt", "/in-file"},
+			notFound: []string{"/out-dir", "/out-dir/secret.txt", "/out-file", "/broken"},
+		},
+		{
+			policy:   SymlinkInside,
+			list:     "a.txt,dir/,in-dir/,in-file",
+			found:    []string{"/in-dir", "/in-dir/b.txt", "/in-file"},
+			notFound: []string{"/out-dir", "/out-dir/secret.txt", "/out-file", "/broken"},
+		},
+		{
+			policy:   SymlinkFollow,
+			list:     "a.txt,dir/,in-dir/,in-file,out-dir/,out-file",
+			found:    []string{"/in-dir", "/in-dir/b.txt", "/in-file", "/out-dir", "/out-dir/secret.txt", "/out-file"},
+			notFound: []string{"/broken"},
+		},
+		{
+			policy:   SymlinkSkip,
+			list:     "a.txt,dir/",
+			notFound: []string{"/in-dir", "/in-dir/b.txt", "/in-file", "/out-dir", "/out-dir/secret.txt", "/out-file", "/broken"},
+		},
+	} {
+		t.Run("policy "+c.policy, func(t *testing.T) {
+			d, root, _ := newLocal(t, c.policy)
+			if got := names(t, d, root); got != c.list {
+				t.Fatalf("list = %s, want %s", got, c.list)
+			}
+			for _, p := range c.found {
+				if _, err := d.Get(context.Background(), p); err != nil {
+					t.Fatalf("get %s: %v", p, err)
+				}
+			}
+			for _, p := range c.notFound {
+				if obj, err := d.Get(context.Background(), p); err == nil {
+					t.Fatalf("get %s = %+v, want error", p, obj)
+				}
+			}
+		})
+	}
+
+	// 链接的名字用自己的，大小和类型用指向的对象的
+	d, _, _ := newLocal(t, SymlinkFollow)
+	obj, err := d.Get(context.Background(), "/out-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetName() != "out-file" || obj.GetSize() != int64(len("secret.txt")) || obj.IsDir() {
+		t.Fatalf("out-file = %+v", obj)
+	}
+
+	if err = (&Local{Addition: Addition{RootPath: driver.RootPath{RootFolderPath: t.TempDir()}, SymlinkPolicy: "bogus"}}).Init(context.Background()); err == nil {
+		t.Fatal("unknown policy should fail")
+	}
+}
+
+// 对象路径里的".."和指向根目录外的链接，各个操作都要拒绝，而且不能碰到外面的文件
+func TestEscapeRoot(t *testing.T) {
+	ctx := context.Background()
+	for _, policy := range []string{SymlinkInside, SymlinkSkip, SymlinkFollow} {
+		t.Run("policy "+policy, func(t *testing.T) {
+			d, root, outside := newLocal(t, policy)
+			dotDot := root + string(filepath.Separator) + ".."
+			escapes := map[string]bool{
+				// 不管什么策略".."都不行
+				dotDot + "/outside":            true,
+				dotDot + "/outside/secret.txt": true,
+				// 跟随所有链接时链接指向哪里都行
+				filepath.Join(root, "out-dir"):               policy != SymlinkFollow,
+				filepath.Join(root, "out-dir", "secret.txt"): policy != SymlinkFollow,
+				filepath.Join(root, "out-file"):              policy != SymlinkFollow,
+			}
+			check := func(op, p string, err error) {
+				t.Helper()
+				if escapes[p] && !errors.Is(err, errOutsideRoot) {
+					t.Fatalf("%s %s: err = %v, want %v", op, p, err, errOutsideRoot)
+				}
+				if !escapes[p] && errors.Is(err, errOutsideRoot) {
+					t.Fatalf("%s %s: %v", op, p, err)
+				}
+			}
+
+			for _, p := range []string{dotDot + "/outside", filepath.Join(root, "out-dir")} {
+				_, err := d.List(ctx, dirObj(p), model.ListArgs{})
+				check("list", p, err)
+
+				obj, err := put(d, dirObj(p), "new.txt", "new")
+				check("put", p, err)
+				if err == nil {
+					_ = d.Remove(ctx, obj)
+				}
+			}
+			for _, p := range []string{dotDot + "/outside/secret.txt", filepath.Join(root, "out-dir", "secret.txt"), filepath.Join(root, "out-file")} {
+				link, err := d.Link(ctx, &model.Object{Path: p}, model.LinkArgs{})
+				check("link", p, err)
+				if err == nil {
+					_ = link.Close()
+				}
+			}
+			for _, p := range []string{dotDot + "/outside/secret.txt", dotDot + "/outside"} {
+				check("remove", p, d.Remove(ctx, &model.Object{Path: p}))
+			}
+			if policy != SymlinkFollow {
+				for _, p := range []string{filepath.Join(root, "out-dir", "secret.txt"), filepath.Join(root, "out-dir")} {
+					check("remove", p, d.Remove(ctx, &model.Object{Path: p, IsFolder: true}))
+				}
+			}
+
+			// 存储内的路径里的".."只能退到根目录
+			if obj, err := d.Get(ctx, "/../outside/secret.txt"); err == nil {
+				t.Fatalf("get escaped the root: %+v", obj)
+			}
+			// 名字里带路径的上传直接拒绝
+			for _, name := range []string{"..", "../escape.txt", "a/../../escape.txt"} {
+				if _, err := put(d, dirObj(root), name, "x"); err == nil {
+					t.Fatalf("put %q should fail", name)
+				}
+			}
+			if err := d.Remove(ctx, dirObj(root)); err == nil {
+				t.Fatal("removing the root should fail")
+			}
+
+			entries, err := os.ReadDir(outside)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != "secret.txt" {
+				t.Fatalf("outside was touched: %v", entries)
+			}
+			if _, err = os.Stat(filepath.Join(filepath.Dir(root), "escape.txt")); !os.IsNotExist(err) {
+				t.Fatalf("escape.txt: %v", err)
+			}
+		})
+	}
+}
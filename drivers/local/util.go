@@ -0,0 +1,236 @@
+package local
+
+import (
+	"HelaList/internal/model"
+	"context"
+	"io"
+	"os"
+	stdpath "path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+var errOutsideRoot = errors.New("path is outside of the root folder")
+
+// Object 的Path是宿主机上的绝对路径。
+// op.List会用SetPath把对象的路径改成挂载后的虚拟路径，本地驱动依赖真实路径，所以这里什么都不做
+type Object struct {
+	model.Object
+}
+
+func (o *Object) SetPath(path string) {}
+
+// hostPath 把存储内的路径转换成宿主机路径。
+// 先按"/"清理掉所有".."再拼接，所以字面上不可能跑出根目录，剩下的只有符号链接的问题
+func (d *Local) hostPath(path string) (string, error) {
+	clean := stdpath.Clean("/" + path)
+	hostPath := filepath.Join(d.root, filepath.FromSlash(clean))
+	return d.checkHostPath(hostPath)
+}
+
+// checkHostPath 检查宿主机路径在根目录下，并按符号链接策略检查它实际指向的位置
+func (d *Local) checkHostPath(hostPath string) (string, error) {
+	hostPath = filepath.Clean(hostPath)
+	if !isSubPath(d.root, hostPath) {
+		return "", errOutsideRoot
+	}
+	if d.SymlinkPolicy == SymlinkFollow {
+		return hostPath, nil
+	}
+	// 找到最深的已存在的祖先，看它解析完链接后是否还在根目录下。
+	// 路径本身可能还不存在（比如即将创建的文件），所以要往上找
+	existing := hostPath
+	for {
+		real, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if !isSubPath(d.realRoot, real) {
+				return "", errOutsideRoot
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return "", errors.WithStack(err)
+		}
+		if existing == d.root {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	if d.SymlinkPolicy == SymlinkSkip && hostPath != d.root {
+		// 路径上任何一段是链接都当作不存在
+		rel, _ := filepath.Rel(d.root, hostPath)
+		cur := d.root
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			cur = filepath.Join(cur, part)
+			info, err := os.Lstat(cur)
+			if err != nil {
+				break
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				return "", errOutsideRoot
+			}
+		}
+	}
+	return hostPath, nil
+}
+
+// childPath 返回dir下名为name的对象的宿主机路径
+func (d *Local) childPath(dir model.Obj, name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	dirPath, err := d.checkHostPath(dir.GetPath())
+	if err != nil {
+		return "", err
+	}
+	return d.checkHostPath(filepath.Join(dirPath, name))
+}
+
+// checkName 名字里不能带路径分隔符，否则可以借着改名、上传跑到别的目录
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return errors.Errorf("invalid name: %q", name)
+	}
+	return nil
+}
+
+// fileInfoToObj 按符号链接策略把Lstat的结果转换成对象，返回false表示这个对象应当被隐藏
+func (d *Local) fileInfoToObj(hostPath string, info os.FileInfo) (model.Obj, bool) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		if d.SymlinkPolicy == SymlinkSkip {
+			return nil, false
+		}
+		real, err := filepath.EvalSymlinks(hostPath)
+		if err != nil {
+			// 断掉的链接
+			return nil, false
+		}
+		if d.SymlinkPolicy == SymlinkInside && !isSubPath(d.realRoot, real) {
+			return nil, false
+		}
+		target, err := os.Stat(real)
+		if err != nil {
+			return nil, false
+		}
+		// 名字用链接自己的，大小和类型用指向的对象的
+		info = renamedFileInfo{FileInfo: target, name: info.Name()}
+	}
+	name := info.Name()
+	if hostPath == d.root {
+		name = "root"
+	}
+	return &Object{Object: model.Object{
+		Path:         hostPath,
+		Name:         name,
+		Size:         sizeOf(info),
+		ModifiedTime: info.ModTime(),
+		IsFolder:     info.IsDir(),
+	}}, true
+}
+
+func (d *Local) statObj(hostPath string) (model.Obj, error) {
+	info, err := os.Lstat(hostPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	obj, ok := d.fileInfoToObj(hostPath, info)
+	if !ok {
+		return nil, errors.Errorf("object not found: %s", hostPath)
+	}
+	return obj, nil
+}
+
+type renamedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (r renamedFileInfo) Name() string {
+	return r.name
+}
+
+func sizeOf(info os.FileInfo) int64 {
+	if info.IsDir() {
+		return 0
+	}
+	return info.Size()
+}
+
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// isSubPath 判断p是否是root本身或在root之下
+func isSubPath(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+func isCrossDevice(err error) bool {
+	var linkErr *os.LinkError
+	return errors.As(err, &linkErr) && errors.Is(linkErr.Err, syscall.EXDEV)
+}
+
+// copyAll 递归复制文件或目录，保留修改时间。
+// 符号链接按指向的内容复制，按策略不可见的链接会被跳过，避免把根目录外的内容复制进来
+func (d *Local) copyAll(ctx context.Context, src, dst string) error {
+	if utils.IsCanceled(ctx) {
+		return ctx.Err()
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !info.IsDir() {
+		return copyFile(src, dst, info)
+	}
+	if err = os.Mkdir(dst, info.Mode().Perm()); err != nil {
+		return errors.WithStack(err)
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, entry := range entries {
+		child := filepath.Join(src, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if _, ok := d.fileInfoToObj(child, info); !ok {
+			continue
+		}
+		if err = d.copyAll(ctx, child, filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return errors.WithStack(os.Chtimes(dst, info.ModTime(), info.ModTime()))
+}
+
+func copyFile(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Chtimes(dst, info.ModTime(), info.ModTime()))
+}
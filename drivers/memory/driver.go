@@ -0,0 +1,420 @@
+package memory
+
+import (
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"bytes"
+	"context"
+	"io"
+	"math/rand/v2"
+	stdpath "path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 内存存储：文件都放在进程内存里，重启就没了。给单元测试和临时挂载用，
+// 可以配置每个操作的延迟和随机失败，用来模拟慢的、不稳定的网盘。
+// 在备注里写"ref:/另一个内存存储的挂载路径"时和那个存储共用同一份数据。
+// 对象的Path是存储内的路径
+
+type Memory struct {
+	model.Storage
+	Addition
+	tree *tree
+
+	faultMu  sync.Mutex
+	rand     *rand.Rand
+	faultOps map[string]bool
+	injected map[string]error
+}
+
+type Addition struct {
+	Latency   int     `json:"latency" type:"number" default:"0" help:"milliseconds to wait before every operation"`
+	FaultRate float64 `json:"fault_rate" type:"number" default:"0" help:"probability between 0 and 1 that an operation fails"`
+	FaultOps  string  `json:"fault_ops" help:"comma separated operations that may fail, such as put,link; empty means all"`
+	Seed      int64   `json:"seed" type:"number" default:"0" help:"random seed of fault injection, 0 means a random one"`
+}
+
+// 可以注入错误的操作
+const (
+	OpList    = "list"
+	OpGet     = "get"
+	OpLink    = "link"
+	OpMakeDir = "mkdir"
+	OpMove    = "move"
+	OpRename  = "rename"
+	OpCopy    = "copy"
+	OpRemove  = "remove"
+	OpPut     = "put"
+	OpPutURL  = "put_url"
+	OpOther   = "other"
+)
+
+var allOps = []string{OpList, OpGet, OpLink, OpMakeDir, OpMove, OpRename, OpCopy, OpRemove, OpPut, OpPutURL, OpOther}
+
+var config = driver.Config{
+	Name:          "memory",
+	LocalSort:     true,
+	OnlyLinkMFile: true,
+	DefaultRoot:   "/",
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &Memory{}
+	})
+}
+
+func (d *Memory) Config() driver.Config {
+	return config
+}
+
+func (d *Memory) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+// InitReference 共用被引用的内存存储的数据
+func (d *Memory) InitReference(storage driver.Driver) error {
+	ref, ok := storage.(*Memory)
+	if !ok || ref.tree == nil {
+		return errors.New("referenced storage is not a memory storage")
+	}
+	d.tree = ref.tree
+	return nil
+}
+
+func (d *Memory) Init(ctx context.Context) error {
+	if d.Latency < 0 {
+		return errors.New("latency must not be negative")
+	}
+	if d.FaultRate < 0 || d.FaultRate > 1 {
+		return errors.New("fault rate must be between 0 and 1")
+	}
+	faultOps := make(map[string]bool)
+	for _, o := range strings.Split(d.FaultOps, ",") {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			continue
+		}
+		if !isOp(o) {
+			return errors.Errorf("unknown operation: %s", o)
+		}
+		faultOps[o] = true
+	}
+	seed := uint64(d.Seed)
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	d.faultMu.Lock()
+	d.faultOps = faultOps
+	d.rand = rand.New(rand.NewPCG(seed, seed))
+	d.faultMu.Unlock()
+	if d.tree == nil {
+		d.tree = newTree()
+	}
+	return nil
+}
+
+func (d *Memory) Drop(ctx context.Context) error {
+	return nil
+}
+
+func (d *Memory) GetRoot(ctx context.Context) (model.Obj, error) {
+	d.tree.mu.RLock()
+	defer d.tree.mu.RUnlock()
+	obj := toObj("/", d.tree.root)
+	obj.Name = "root"
+	return obj, nil
+}
+
+func (d *Memory) Get(ctx context.Context, path string) (model.Obj, error) {
+	if err := d.before(ctx, OpGet); err != nil {
+		return nil, err
+	}
+	d.tree.mu.RLock()
+	defer d.tree.mu.RUnlock()
+	n, err := d.tree.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return toObj(path, n), nil
+}
+
+func (d *Memory) GetObjInfo(ctx context.Context, path string) (model.Obj, error) {
+	return d.Get(ctx, path)
+}
+
+func (d *Memory) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	if err := d.before(ctx, OpList); err != nil {
+		return nil, err
+	}
+	d.tree.mu.RLock()
+	defer d.tree.mu.RUnlock()
+	n, err := d.tree.lookup(dir.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	if !n.isDir {
+		return nil, errors.Errorf("not a folder: %s", dir.GetPath())
+	}
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	objs := make([]model.Obj, 0, len(names))
+	for _, name := range names {
+		objs = append(objs, toObj(stdpath.Join(dir.GetPath(), name), n.children[name]))
+	}
+	return objs, nil
+}
+
+// Link 文件内容写入后不会再被原地修改，直接把当前内容交出去就行
+func (d *Memory) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	if err := d.before(ctx, OpLink); err != nil {
+		return nil, err
+	}
+	d.tree.mu.RLock()
+	defer d.tree.mu.RUnlock()
+	n, err := d.tree.lookup(file.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	if n.isDir {
+		return nil, errors.Errorf("not a file: %s", file.GetPath())
+	}
+	if n.url != "" {
+		return &model.Link{URL: n.url}, nil
+	}
+	return &model.Link{
+		MFile:         bytes.NewReader(n.data),
+		ContentLength: int64(len(n.data)),
+	}, nil
+}
+
+func (d *Memory) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) (model.Obj, error) {
+	if err := d.before(ctx, OpMakeDir); err != nil {
+		return nil, err
+	}
+	d.tree.mu.Lock()
+	defer d.tree.mu.Unlock()
+	now := time.Now()
+	n, err := d.tree.add(parentDir.GetPath(), &node{
+		name:     dirName,
+		isDir:    true,
+		modified: now,
+		created:  now,
+		children: make(map[string]*node),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toObj(stdpath.Join(parentDir.GetPath(), dirName), n), nil
+}
+
+func (d *Memory) Move(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	if err := d.before(ctx, OpMove); err != nil {
+		return nil, err
+	}
+	if isSubPath(srcObj.GetPath(), dstDir.GetPath()) {
+		return nil, errors.Errorf("cannot move %s into itself", srcObj.GetPath())
+	}
+	d.tree.mu.Lock()
+	defer d.tree.mu.Unlock()
+	n, err := d.tree.lookup(srcObj.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	if _, err = d.tree.add(dstDir.GetPath(), n); err != nil {
+		return nil, err
+	}
+	d.tree.detach(srcObj.GetPath())
+	return toObj(stdpath.Join(dstDir.GetPath(), n.name), n), nil
+}
+
+func (d *Memory) Rename(ctx context.Context, srcObj model.Obj, newName string) (model.Obj, error) {
+	if err := d.before(ctx, OpRename); err != nil {
+		return nil, err
+	}
+	if newName == "" || strings.Contains(newName, "/") {
+		return nil, errors.Errorf("invalid name: %s", newName)
+	}
+	if srcObj.GetPath() == "/" {
+		return nil, errors.New("cannot rename the root folder")
+	}
+	d.tree.mu.Lock()
+	defer d.tree.mu.Unlock()
+	n, err := d.tree.lookup(srcObj.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	parentPath := stdpath.Dir(srcObj.GetPath())
+	parent, _ := d.tree.lookup(parentPath)
+	if _, ok := parent.children[newName]; ok {
+		return nil, errors.Errorf("object already exists: %s", stdpath.Join(parentPath, newName))
+	}
+	delete(parent.children, n.name)
+	n.name = newName
+	parent.children[newName] = n
+	return toObj(stdpath.Join(parentPath, newName), n), nil
+}
+
+func (d *Memory) Copy(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	if err := d.before(ctx, OpCopy); err != nil {
+		return nil, err
+	}
+	if isSubPath(srcObj.GetPath(), dstDir.GetPath()) {
+		return nil, errors.Errorf("cannot copy %s into itself", srcObj.GetPath())
+	}
+	d.tree.mu.Lock()
+	defer d.tree.mu.Unlock()
+	n, err := d.tree.lookup(srcObj.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	c, err := d.tree.add(dstDir.GetPath(), n.clone())
+	if err != nil {
+		return nil, err
+	}
+	return toObj(stdpath.Join(dstDir.GetPath(), c.name), c), nil
+}
+
+func (d *Memory) Remove(ctx context.Context, obj model.Obj) error {
+	if err := d.before(ctx, OpRemove); err != nil {
+		return err
+	}
+	if obj.GetPath() == "/" {
+		return errors.New("cannot remove the root folder")
+	}
+	d.tree.mu.Lock()
+	defer d.tree.mu.Unlock()
+	if _, err := d.tree.lookup(obj.GetPath()); err != nil {
+		return err
+	}
+	d.tree.detach(obj.GetPath())
+	return nil
+}
+
+// Put 先把内容完整读进来，读的过程中不持有锁；同名文件会被覆盖
+func (d *Memory) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
+	if err := d.before(ctx, OpPut); err != nil {
+		return nil, err
+	}
+	if up == nil {
+		up = func(float64) {}
+	}
+	data, err := io.ReadAll(&driver.ReaderUpdatingProgress{
+		Reader:         file,
+		UpdateProgress: up,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if size := file.GetSize(); size >= 0 && int64(len(data)) != size {
+		return nil, errors.Errorf("size mismatch of %s: expect %d, got %d", file.GetName(), size, len(data))
+	}
+	modified := file.GetModifiedTime()
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+	return d.putNode(dstDir.GetPath(), &node{
+		name:     file.GetName(),
+		data:     data,
+		hash:     hashData(data),
+		modified: modified,
+		created:  time.Now(),
+	})
+}
+
+// RapidUpload 存储里已经有内容一样的文件时直接共用它的数据
+func (d *Memory) RapidUpload(ctx context.Context, dstDir model.Obj, file model.FileStreamer) (model.Obj, bool, error) {
+	if err := d.before(ctx, OpPut); err != nil {
+		return nil, false, err
+	}
+	d.tree.mu.RLock()
+	n := &node{name: file.GetName(), created: time.Now()}
+	found := d.tree.root.findByHash(file.GetSize(), file.GetHash())
+	if found != nil {
+		n.data, n.hash = found.data, found.hash
+	}
+	d.tree.mu.RUnlock()
+	if found == nil {
+		return nil, false, nil
+	}
+	modified := file.GetModifiedTime()
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+	n.modified = modified
+	obj, err := d.putNode(dstDir.GetPath(), n)
+	return obj, err == nil, err
+}
+
+// PutURL 只记下地址，Link的时候直接返回它
+func (d *Memory) PutURL(ctx context.Context, dstDir model.Obj, name, url string) (model.Obj, error) {
+	if err := d.before(ctx, OpPutURL); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return d.putNode(dstDir.GetPath(), &node{
+		name:     name,
+		url:      url,
+		modified: now,
+		created:  now,
+	})
+}
+
+// Other 支持stats，返回文件数、目录数和占用的字节数
+func (d *Memory) Other(ctx context.Context, args model.OtherArgs) (interface{}, error) {
+	if err := d.before(ctx, OpOther); err != nil {
+		return nil, err
+	}
+	switch args.Method {
+	case "stats":
+		d.tree.mu.RLock()
+		defer d.tree.mu.RUnlock()
+		n, err := d.tree.lookup(args.Obj.GetPath())
+		if err != nil {
+			return nil, err
+		}
+		var s Stats
+		n.walk(&s)
+		return s, nil
+	default:
+		return nil, errors.Errorf("unsupported method: %s", args.Method)
+	}
+}
+
+// InjectFault 让op这个操作之后都返回err，err为nil时取消。测试里用来制造确定的失败
+func (d *Memory) InjectFault(op string, err error) {
+	d.faultMu.Lock()
+	defer d.faultMu.Unlock()
+	if d.injected == nil {
+		d.injected = make(map[string]error)
+	}
+	if err == nil {
+		delete(d.injected, op)
+	} else {
+		d.injected[op] = err
+	}
+}
+
+var _ driver.Driver = (*Memory)(nil)
+var _ driver.Reference = (*Memory)(nil)
+var _ driver.GetRooter = (*Memory)(nil)
+var _ driver.Getter = (*Memory)(nil)
+var _ driver.GetObjInfo = (*Memory)(nil)
+var _ driver.MkdirResult = (*Memory)(nil)
+var _ driver.MoveResult = (*Memory)(nil)
+var _ driver.RenameResult = (*Memory)(nil)
+var _ driver.CopyResult = (*Memory)(nil)
+var _ driver.Remove = (*Memory)(nil)
+var _ driver.PutResult = (*Memory)(nil)
+var _ driver.PutURLResult = (*Memory)(nil)
+var _ driver.RapidUpload = (*Memory)(nil)
+var _ driver.Other = (*Memory)(nil)
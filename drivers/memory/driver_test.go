@@ -0,0 +1,190 @@
+package memory
+
+import (
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/model"
+	"HelaList/internal/stream"
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+func newMemory(t *testing.T, addition Addition) *Memory {
+	t.Helper()
+	d := &Memory{Addition: addition}
+	d.SetStorage(model.Storage{MountPath: "/memory"})
+	if err := d.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func put(d *Memory, dir, name, content string) error {
+	file := &stream.FileStream{
+		Obj:    &model.Object{Name: name, Size: int64(len(content))},
+		Reader: strings.NewReader(content),
+	}
+	_, err := d.Put(context.Background(), &model.Object{Path: dir, IsFolder: true}, file, nil)
+	return err
+}
+
+func TestConformance(t *testing.T) {
+	drivertest.Run(t, newMemory(t, Addition{}))
+}
+
+func TestConformanceWithLatency(t *testing.T) {
+	drivertest.Run(t, newMemory(t, Addition{Latency: 1}))
+}
+
+func TestLatency(t *testing.T) {
+	d := newMemory(t, Addition{Latency: 50})
+	root, _ := d.GetRoot(context.Background())
+	start := time.Now()
+	if _, err := d.List(context.Background(), root, model.ListArgs{}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("list took %v, want at least 50ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.List(ctx, root, model.ListArgs{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("list with canceled context: got %v", err)
+	}
+}
+
+func TestFaultRate(t *testing.T) {
+	d := newMemory(t, Addition{FaultRate: 1, FaultOps: "put"})
+	if err := put(d, "/", "a.txt", "a"); err == nil || !strings.Contains(err.Error(), "injected fault on put") {
+		t.Fatalf("put: want injected fault, got %v", err)
+	}
+	root, _ := d.GetRoot(context.Background())
+	if _, err := d.List(context.Background(), root, model.ListArgs{}); err != nil {
+		t.Fatalf("list should not fail: %v", err)
+	}
+
+	// 同一个种子失败的顺序一样
+	results := func() []bool {
+		d := newMemory(t, Addition{FaultRate: 0.5, Seed: 42})
+		var res []bool
+		for i := 0; i < 32; i++ {
+			res = append(res, put(d, "/", "a.txt", "a") == nil)
+		}
+		return res
+	}
+	a, b := results(), results()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("seeded faults differ at %d", i)
+		}
+	}
+
+	if err := (&Memory{Addition: Addition{FaultOps: "nope"}}).Init(context.Background()); err == nil {
+		t.Fatal("unknown operation should be rejected")
+	}
+}
+
+func TestInjectFault(t *testing.T) {
+	d := newMemory(t, Addition{})
+	if err := put(d, "/", "a.txt", "a"); err != nil {
+		t.Fatal(err)
+	}
+	file := &model.Object{Path: "/a.txt"}
+	boom := errors.New("boom")
+	d.InjectFault(OpLink, boom)
+	if _, err := d.Link(context.Background(), file, model.LinkArgs{}); err != boom {
+		t.Fatalf("link: want boom, got %v", err)
+	}
+	d.InjectFault(OpLink, nil)
+	if _, err := d.Link(context.Background(), file, model.LinkArgs{}); err != nil {
+		t.Fatalf("link after clearing fault: %v", err)
+	}
+}
+
+func TestReference(t *testing.T) {
+	a := newMemory(t, Addition{})
+	b := &Memory{}
+	if err := b.InitReference(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := put(a, "/", "shared.txt", "shared"); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := b.Get(context.Background(), "/shared.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := b.Link(context.Background(), obj, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err = buf.ReadFrom(l.MFile); err != nil || buf.String() != "shared" {
+		t.Fatalf("read shared file: %q, %v", buf.String(), err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	d := newMemory(t, Addition{})
+	root, _ := d.GetRoot(context.Background())
+	if _, err := d.MakeDir(context.Background(), root, "dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := put(d, "/dir", "a.txt", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.Other(context.Background(), model.OtherArgs{Obj: root, Method: "stats"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := res.(Stats); s.Files != 1 || s.Dirs != 2 || s.Bytes != 5 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestHashAndRapidUpload(t *testing.T) {
+	d := newMemory(t, Addition{})
+	if err := put(d, "/", "a.txt", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := d.Get(context.Background(), "/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md5 := utils.HashData(utils.MD5, []byte("hello"))
+	if got := obj.GetHash().GetHash(utils.MD5); got != md5 {
+		t.Fatalf("md5 = %q, want %q", got, md5)
+	}
+	if obj.GetHash().GetHash(utils.SHA256) == "" {
+		t.Fatal("sha256 is missing")
+	}
+
+	root := &model.Object{Path: "/", IsFolder: true}
+	// 秒传不应该读文件内容
+	file := &stream.FileStream{
+		Obj:    &model.Object{Name: "b.txt", Size: 5, HashInfo: utils.NewHashInfo(utils.MD5, md5)},
+		Reader: iotest.ErrReader(errors.New("should not be read")),
+	}
+	newObj, ok, err := d.RapidUpload(context.Background(), root, file)
+	if err != nil || !ok {
+		t.Fatalf("rapid upload: ok %v, err %v", ok, err)
+	}
+	if newObj.GetName() != "b.txt" || newObj.GetSize() != 5 {
+		t.Fatalf("unexpected obj %s %d", newObj.GetName(), newObj.GetSize())
+	}
+
+	file.Obj = &model.Object{Name: "c.txt", Size: 5, HashInfo: utils.NewHashInfo(utils.MD5, utils.HashData(utils.MD5, []byte("world")))}
+	if _, ok, err = d.RapidUpload(context.Background(), root, file); err != nil || ok {
+		t.Fatalf("rapid upload of unknown content: ok %v, err %v", ok, err)
+	}
+}
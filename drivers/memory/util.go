@@ -0,0 +1,220 @@
+package memory
+
+import (
+	"HelaList/internal/model"
+	"context"
+	stdpath "path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// node 内存里的一个文件或目录。data写入后只会被整体替换，不会原地修改
+type node struct {
+	name     string
+	isDir    bool
+	data     []byte
+	url      string // PutURL放进来的文件只有地址
+	hash     utils.HashInfo
+	modified time.Time
+	created  time.Time
+	children map[string]*node
+}
+
+// tree 一个内存存储的全部数据，引用同一存储的挂载共用一个tree
+type tree struct {
+	mu   sync.RWMutex
+	root *node
+}
+
+func newTree() *tree {
+	now := time.Now()
+	return &tree{root: &node{
+		isDir:    true,
+		modified: now,
+		created:  now,
+		children: make(map[string]*node),
+	}}
+}
+
+// lookup 按路径找节点，调用方需要持有锁
+func (t *tree) lookup(path string) (*node, error) {
+	n := t.root
+	for _, name := range strings.Split(strings.Trim(stdpath.Clean("/"+path), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if !n.isDir {
+			return nil, errors.Errorf("object not found: %s", path)
+		}
+		child, ok := n.children[name]
+		if !ok {
+			return nil, errors.Errorf("object not found: %s", path)
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// add 把n放到dirPath目录下，已经有同名对象时报错
+func (t *tree) add(dirPath string, n *node) (*node, error) {
+	dir, err := t.lookup(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.isDir {
+		return nil, errors.Errorf("not a folder: %s", dirPath)
+	}
+	if _, ok := dir.children[n.name]; ok {
+		return nil, errors.Errorf("object already exists: %s", stdpath.Join(dirPath, n.name))
+	}
+	dir.children[n.name] = n
+	dir.modified = time.Now()
+	return n, nil
+}
+
+// detach 把path对应的节点从父目录里摘掉
+func (t *tree) detach(path string) {
+	parent, err := t.lookup(stdpath.Dir(path))
+	if err != nil {
+		return
+	}
+	delete(parent.children, stdpath.Base(path))
+	parent.modified = time.Now()
+}
+
+// clone 深拷贝目录结构，文件内容不会被原地修改，可以共用
+func (n *node) clone() *node {
+	c := *n
+	c.created = time.Now()
+	if n.children != nil {
+		c.children = make(map[string]*node, len(n.children))
+		for name, child := range n.children {
+			c.children[name] = child.clone()
+		}
+	}
+	return &c
+}
+
+// Stats Other("stats")的返回值
+type Stats struct {
+	Files int   `json:"files"`
+	Dirs  int   `json:"dirs"`
+	Bytes int64 `json:"bytes"`
+}
+
+func (n *node) walk(s *Stats) {
+	if !n.isDir {
+		s.Files++
+		s.Bytes += int64(len(n.data))
+		return
+	}
+	s.Dirs++
+	for _, child := range n.children {
+		child.walk(s)
+	}
+}
+
+func toObj(path string, n *node) *model.Object {
+	return &model.Object{
+		Path:         path,
+		Name:         n.name,
+		Size:         int64(len(n.data)),
+		ModifiedTime: n.modified,
+		CreatedTime:  n.created,
+		IsFolder:     n.isDir,
+		HashInfo:     n.hash,
+	}
+}
+
+func hashData(data []byte) utils.HashInfo {
+	h := utils.NewMultiHasher(model.CommonHashes)
+	_, _ = h.Write(data)
+	return *h.GetHashInfo()
+}
+
+// findByHash 找一个大小和哈希都对得上的文件，秒传用。调用方需要持有锁
+func (n *node) findByHash(size int64, hash utils.HashInfo) *node {
+	if !n.isDir {
+		if n.url == "" && int64(len(n.data)) == size && sameHash(n.hash, hash) {
+			return n
+		}
+		return nil
+	}
+	for _, child := range n.children {
+		if found := child.findByHash(size, hash); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// sameHash 至少有一种共同的哈希，并且共同的都一样
+func sameHash(a, b utils.HashInfo) bool {
+	common := false
+	for ht, v := range b.All() {
+		if g := a.GetHash(ht); v != "" && g != "" {
+			if !strings.EqualFold(v, g) {
+				return false
+			}
+			common = true
+		}
+	}
+	return common
+}
+
+// putNode 放入一个文件，覆盖同名文件，同名的是目录时报错
+func (d *Memory) putNode(dirPath string, n *node) (model.Obj, error) {
+	d.tree.mu.Lock()
+	defer d.tree.mu.Unlock()
+	dir, err := d.tree.lookup(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	if old, ok := dir.children[n.name]; ok {
+		if old.isDir {
+			return nil, errors.Errorf("a folder with the same name exists: %s", stdpath.Join(dirPath, n.name))
+		}
+		n.created = old.created
+		delete(dir.children, n.name)
+	}
+	if _, err = d.tree.add(dirPath, n); err != nil {
+		return nil, err
+	}
+	return toObj(stdpath.Join(dirPath, n.name), n), nil
+}
+
+// before 每个操作开始前调用：先等待配置的延迟，再看要不要失败
+func (d *Memory) before(ctx context.Context, op string) error {
+	if d.Latency > 0 {
+		timer := time.NewTimer(time.Duration(d.Latency) * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	d.faultMu.Lock()
+	defer d.faultMu.Unlock()
+	if err, ok := d.injected[op]; ok {
+		return err
+	}
+	if d.FaultRate > 0 && (len(d.faultOps) == 0 || d.faultOps[op]) && d.rand.Float64() < d.FaultRate {
+		return errors.Errorf("injected fault on %s", op)
+	}
+	return nil
+}
+
+func isOp(op string) bool {
+	return slices.Contains(allOps, op)
+}
+
+// isSubPath 判断p是否是root本身或在root之下
+func isSubPath(root, p string) bool {
+	return root == "/" || p == root || strings.HasPrefix(p, root+"/")
+}
@@ -0,0 +1,244 @@
+package rclone
+
+import (
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	stdpath "path"
+
+	"github.com/pkg/errors"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// 把rclone的后端包装成HelaList的驱动，rclone支持的网盘都可以直接挂载。
+// 对象的Path是"/"加上rclone里的remote路径（相对于配置的根目录）
+
+type Rclone struct {
+	model.Storage
+	Addition
+	f fs.Fs
+}
+
+type Addition struct {
+	driver.RootPath
+	RemoteType string `json:"remote_type" required:"true" help:"rclone backend type, such as s3, drive, onedrive, sftp"`
+	Options    string `json:"options" type:"text" help:"one 'key = value' per line, the same as a section in rclone.conf"`
+}
+
+var config = driver.Config{
+	Name:        "rclone",
+	LocalSort:   true,
+	OnlyProxy:   true, // 内容都要经过rclone读出来
+	DefaultRoot: "",
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &Rclone{}
+	})
+}
+
+func (d *Rclone) Config() driver.Config {
+	return config
+}
+
+func (d *Rclone) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *Rclone) Init(ctx context.Context) error {
+	opts := parseOptions(d.Options)
+	if d.RemoteType == "" {
+		// 直接粘贴rclone.conf的一节时，type也在里面
+		d.RemoteType = opts["type"]
+	}
+	delete(opts, "type")
+	if d.RemoteType == "" {
+		return errors.New("remote type is required")
+	}
+	info, err := fs.Find(d.RemoteType)
+	if err != nil {
+		return errors.Wrapf(err, "unsupported remote type %s", d.RemoteType)
+	}
+	m := d.configMap(info, opts)
+	f, err := info.NewFs(ctx, d.GetStorage().MountPath, rootPath(d.RootFolderPath), m)
+	if err != nil {
+		if errors.Is(err, fs.ErrorIsFile) {
+			return errors.New("root folder path points to a file")
+		}
+		return errors.WithStack(err)
+	}
+	d.f = f
+	return nil
+}
+
+func (d *Rclone) Drop(ctx context.Context) error {
+	if d.f == nil {
+		return nil
+	}
+	if s, ok := d.f.(fs.Shutdowner); ok {
+		return errors.WithStack(s.Shutdown(ctx))
+	}
+	return nil
+}
+
+// Get 根目录和目录也能拿到，找不到时交给op去列父目录
+func (d *Rclone) Get(ctx context.Context, path string) (model.Obj, error) {
+	remote := toRemote(path)
+	if remote == "" {
+		return &model.Object{
+			Path:     "/",
+			Name:     "root",
+			IsFolder: true,
+		}, nil
+	}
+	o, err := d.f.NewObject(ctx, remote)
+	if err == nil {
+		return objectToObj(ctx, o), nil
+	}
+	if errors.Is(err, fs.ErrorIsDir) {
+		return &model.Object{
+			Path:     "/" + remote,
+			Name:     stdpath.Base(remote),
+			IsFolder: true,
+		}, nil
+	}
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil, errors.Errorf("object not found: %s", path)
+	}
+	return nil, errors.WithStack(err)
+}
+
+func (d *Rclone) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	entries, err := d.f.List(ctx, toRemote(dir.GetPath()))
+	if err != nil {
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			return nil, errors.Errorf("object not found: %s", dir.GetPath())
+		}
+		return nil, errors.WithStack(err)
+	}
+	objs := make([]model.Obj, 0, len(entries))
+	for _, entry := range entries {
+		switch e := entry.(type) {
+		case fs.Object:
+			objs = append(objs, objectToObj(ctx, e))
+		case fs.Directory:
+			objs = append(objs, &model.Object{
+				Path:         "/" + e.Remote(),
+				Name:         stdpath.Base(e.Remote()),
+				ModifiedTime: e.ModTime(ctx),
+				IsFolder:     true,
+			})
+		}
+	}
+	return objs, nil
+}
+
+// Link 按范围打开rclone的对象，和FTP一样由服务器中转
+func (d *Rclone) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	o, err := d.f.NewObject(ctx, toRemote(file.GetPath()))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &model.Link{
+		RangeReader:   &rangeReader{o: o},
+		ContentLength: o.Size(),
+	}, nil
+}
+
+func (d *Rclone) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) (model.Obj, error) {
+	remote := stdpath.Join(toRemote(parentDir.GetPath()), dirName)
+	if err := operations.Mkdir(ctx, d.f, remote); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &model.Object{
+		Path:     "/" + remote,
+		Name:     dirName,
+		IsFolder: true,
+	}, nil
+}
+
+func (d *Rclone) Move(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	return d.move(ctx, srcObj, stdpath.Join(toRemote(dstDir.GetPath()), srcObj.GetName()))
+}
+
+func (d *Rclone) Rename(ctx context.Context, srcObj model.Obj, newName string) (model.Obj, error) {
+	return d.move(ctx, srcObj, stdpath.Join(stdpath.Dir(toRemote(srcObj.GetPath())), newName))
+}
+
+// Copy 单个文件交给operations.Copy，后端支持时会在服务端复制；目录逐层复制
+func (d *Rclone) Copy(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	srcRemote := toRemote(srcObj.GetPath())
+	dstRemote := stdpath.Join(toRemote(dstDir.GetPath()), srcObj.GetName())
+	if srcObj.IsDir() {
+		if isSubRemote(srcRemote, dstRemote) {
+			return nil, errors.New("cannot copy a folder into itself")
+		}
+		if err := d.copyDir(ctx, srcRemote, dstRemote); err != nil {
+			return nil, err
+		}
+		return &model.Object{
+			Path:     "/" + dstRemote,
+			Name:     srcObj.GetName(),
+			IsFolder: true,
+		}, nil
+	}
+	o, err := d.f.NewObject(ctx, srcRemote)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dst, err := operations.Copy(ctx, d.f, nil, dstRemote, o)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return objectToObj(ctx, dst), nil
+}
+
+func (d *Rclone) Remove(ctx context.Context, obj model.Obj) error {
+	remote := toRemote(obj.GetPath())
+	if obj.IsDir() {
+		if remote == "" {
+			return errors.New("cannot remove the root folder")
+		}
+		return errors.WithStack(operations.Purge(ctx, d.f, remote))
+	}
+	o, err := d.f.NewObject(ctx, remote)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(operations.DeleteFile(ctx, o))
+}
+
+// Put 目标已存在时用Update覆盖，有些后端（比如Google Drive）直接Put会产生同名的重复文件
+func (d *Rclone) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
+	remote := stdpath.Join(toRemote(dstDir.GetPath()), file.GetName())
+	reader := driver.NewLimitedUploadStream(ctx, &driver.ReaderUpdatingProgress{
+		Reader:         file,
+		UpdateProgress: up,
+	})
+	src := newObjectInfo(d.f, remote, file)
+	var o fs.Object
+	existing, err := d.f.NewObject(ctx, remote)
+	switch {
+	case err == nil:
+		err = existing.Update(ctx, reader, src)
+		o = existing
+	case errors.Is(err, fs.ErrorObjectNotFound):
+		o, err = d.f.Put(ctx, reader, src)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return objectToObj(ctx, o), nil
+}
+
+var _ driver.Driver = (*Rclone)(nil)
+var _ driver.Getter = (*Rclone)(nil)
+var _ driver.MkdirResult = (*Rclone)(nil)
+var _ driver.MoveResult = (*Rclone)(nil)
+var _ driver.RenameResult = (*Rclone)(nil)
+var _ driver.CopyResult = (*Rclone)(nil)
+var _ driver.Remove = (*Rclone)(nil)
+var _ driver.PutResult = (*Rclone)(nil)
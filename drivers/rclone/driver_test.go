@@ -0,0 +1,163 @@
+package rclone
+
+import (
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/model"
+	"HelaList/internal/stream"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/google/uuid"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/obscure"
+)
+
+func newRclone(t *testing.T, root string, addition Addition) *Rclone {
+	t.Helper()
+	d := &Rclone{Addition: addition}
+	d.RootFolderPath = root
+	d.SetStorage(model.Storage{MountPath: "/rclone"})
+	if err := d.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = d.Drop(context.Background()) })
+	return d
+}
+
+func TestConformanceLocal(t *testing.T) {
+	drivertest.Run(t, newRclone(t, t.TempDir(), Addition{RemoteType: "local"}))
+}
+
+func put(t *testing.T, d *Rclone, dirPath, name, content string) model.Obj {
+	t.Helper()
+	file := &stream.FileStream{
+		Obj:    &model.Object{Name: name, Size: int64(len(content))},
+		Reader: strings.NewReader(content),
+	}
+	obj, err := d.Put(context.Background(), &model.Object{Path: dirPath, IsFolder: true}, file, func(float64) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func read(t *testing.T, d *Rclone, obj model.Obj, start, length int64) string {
+	t.Helper()
+	l, err := d.Link(context.Background(), obj, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := l.RangeReader.RangeRead(context.Background(), http_range.Range{Start: start, Length: length})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// memory后端没有空目录，跑不了完整的一致性测试，只测文件操作。
+// 它的数据是整个进程共用的，每个测试用自己的桶；type也可以写在配置里
+func TestMemoryBackend(t *testing.T) {
+	ctx := context.Background()
+	d := newRclone(t, "bucket-"+uuid.NewString(), Addition{Options: "[mem]\ntype = memory\n"})
+	put(t, d, "/", "a.txt", "first version")
+	// 已经存在的走Update覆盖，不会多出同名文件
+	obj := put(t, d, "/", "a.txt", "hello rclone")
+	if got := read(t, d, obj, 6, 3); got != "rcl" {
+		t.Fatalf("range = %q", got)
+	}
+
+	copied, err := d.Copy(ctx, obj, &model.Object{Path: "/dir", IsFolder: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.GetPath() != "/dir/a.txt" || read(t, d, copied, 0, -1) != "hello rclone" {
+		t.Fatalf("copied = %+v", copied)
+	}
+	renamed, err := d.Rename(ctx, obj, "b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Get(ctx, "/a.txt"); err == nil || !strings.Contains(err.Error(), "object not found") {
+		t.Fatalf("a.txt after rename: %v", err)
+	}
+
+	objs, err := d.List(ctx, &model.Object{Path: "/", IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, o := range objs {
+		names = append(names, fmt.Sprintf("%s:%v:%d", o.GetName(), o.IsDir(), o.GetSize()))
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "b.txt:false:12,dir:true:0" {
+		t.Fatalf("list = %s", got)
+	}
+
+	if err = d.Remove(ctx, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Remove(ctx, &model.Object{Path: "/dir", IsFolder: true}); err != nil {
+		t.Fatal(err)
+	}
+	if objs, err = d.List(ctx, &model.Object{Path: "/", IsFolder: true}, model.ListArgs{}); err != nil || len(objs) != 0 {
+		t.Fatalf("list after remove = %v, %v", objs, err)
+	}
+}
+
+// 本地后端的根目录是绝对路径，不能被当成相对于当前目录的路径
+func TestLocalAbsoluteRoot(t *testing.T) {
+	root := t.TempDir()
+	d := newRclone(t, root+"/", Addition{RemoteType: "local"})
+	if obj := put(t, d, "/", "a.txt", "hello"); obj.GetPath() != "/a.txt" {
+		t.Fatalf("path = %s", obj.GetPath())
+	}
+	data, err := os.ReadFile(filepath.Join(root, "a.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("file on disk = %q, %v", data, err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	opts := parseOptions("[remote]\n# comment\ntype = sftp\nhost=example.com\n\nuser = me \nbad line\n")
+	if got := formatOptions(opts); got != "host = example.com\ntype = sftp\nuser = me\n" {
+		t.Fatalf("options = %q", got)
+	}
+
+	// 缺少type时报错
+	d := &Rclone{Addition: Addition{Options: "host = example.com"}}
+	if err := d.Init(context.Background()); err == nil {
+		t.Fatal("init without a remote type should fail")
+	}
+}
+
+// 用户填的明文密码要替它混淆，已经混淆过的不动
+func TestObscurePassword(t *testing.T) {
+	info, err := fs.Find("sftp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Rclone{}
+	for _, value := range []string{"secret", obscure.MustObscure("secret")} {
+		m := d.configMap(info, parseOptions("pass = "+value))
+		got, ok := m.Get("pass")
+		if !ok {
+			t.Fatal("pass not found")
+		}
+		if plain, err := obscure.Reveal(got); err != nil || plain != "secret" {
+			t.Fatalf("pass %q: revealed %q, %v", value, plain, err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package rclone
+
+import (
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	"io"
+	stdpath "path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/pkg/errors"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// parseOptions 解析rclone.conf格式的配置，忽略空行、注释和[section]
+func parseOptions(text string) configmap.Simple {
+	opts := configmap.Simple{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' || line[0] == '[' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		opts[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return opts
+}
+
+func formatOptions(opts configmap.Simple) string {
+	keys := make([]string, 0, len(opts))
+	for key := range opts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, key := range keys {
+		sb.WriteString(key + " = " + opts[key] + "\n")
+	}
+	return sb.String()
+}
+
+// configMap 按用户配置、后端默认值的顺序取配置。
+// 后端刷新OAuth令牌等需要写回配置时，写进Options并保存到数据库，而不是rclone自己的配置文件
+func (d *Rclone) configMap(info *fs.RegInfo, opts configmap.Simple) *configmap.Map {
+	defaults := configmap.Simple{}
+	for _, opt := range info.Options {
+		if value, ok := opts[opt.Name]; ok && opt.IsPassword && value != "" {
+			// rclone要求密码是混淆过的，用户填明文时替它混淆
+			if _, err := obscure.Reveal(value); err != nil {
+				opts[opt.Name] = obscure.MustObscure(value)
+			}
+		}
+		defaults[opt.Name] = opt.String()
+	}
+	m := configmap.New()
+	m.AddGetter(opts, configmap.PriorityNormal)
+	m.AddGetter(defaults, configmap.PriorityDefault)
+	m.AddSetter(setterFunc(func(key, value string) {
+		saved := parseOptions(d.Options)
+		saved[key] = value
+		d.Options = formatOptions(saved)
+		opts[key] = value
+		op.MustSaveDriverStorage(d)
+	}))
+	return m
+}
+
+type setterFunc func(key, value string)
+
+func (f setterFunc) Set(key, value string) {
+	f(key, value)
+}
+
+// rootPath 和rclone的"remote:path"里的path一样原样传给后端，只去掉末尾的"/"。
+// 开头的"/"不能去，local、sftp之类的后端靠它区分绝对路径和相对路径
+func rootPath(root string) string {
+	if root == "/" {
+		return root
+	}
+	return strings.TrimSuffix(root, "/")
+}
+
+// toRemote 把对象路径转换成rclone的remote，根目录是空字符串
+func toRemote(path string) string {
+	return strings.Trim(path, "/")
+}
+
+// isSubRemote 判断p是否是dir本身或在dir之下
+func isSubRemote(dir, p string) bool {
+	return dir == "" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+func objectToObj(ctx context.Context, o fs.Object) model.Obj {
+	size := o.Size()
+	if size < 0 {
+		// 有些后端不知道文件大小
+		size = 0
+	}
+	return &model.Object{
+		Path:         "/" + o.Remote(),
+		Name:         stdpath.Base(o.Remote()),
+		Size:         size,
+		ModifiedTime: o.ModTime(ctx),
+	}
+}
+
+func newObjectInfo(f fs.Fs, remote string, file model.FileStreamer) fs.ObjectInfo {
+	mtime := file.GetModifiedTime()
+	if mtime.IsZero() {
+		mtime = time.Now()
+	}
+	return object.NewStaticObjectInfo(remote, mtime, file.GetSize(), true, nil, f)
+}
+
+func (d *Rclone) move(ctx context.Context, srcObj model.Obj, dstRemote string) (model.Obj, error) {
+	srcRemote := toRemote(srcObj.GetPath())
+	if srcObj.IsDir() {
+		if isSubRemote(srcRemote, dstRemote) {
+			return nil, errors.New("cannot move a folder into itself")
+		}
+		if err := operations.DirMove(ctx, d.f, srcRemote, dstRemote); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return &model.Object{
+			Path:         "/" + dstRemote,
+			Name:         stdpath.Base(dstRemote),
+			ModifiedTime: srcObj.GetModifiedTime(),
+			IsFolder:     true,
+		}, nil
+	}
+	o, err := d.f.NewObject(ctx, srcRemote)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dst, err := operations.Move(ctx, d.f, nil, dstRemote, o)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return objectToObj(ctx, dst), nil
+}
+
+// copyDir 递归复制目录，空目录也会建出来
+func (d *Rclone) copyDir(ctx context.Context, srcRemote, dstRemote string) error {
+	if err := operations.Mkdir(ctx, d.f, dstRemote); err != nil {
+		return errors.WithStack(err)
+	}
+	entries, err := d.f.List(ctx, srcRemote)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, entry := range entries {
+		dst := stdpath.Join(dstRemote, stdpath.Base(entry.Remote()))
+		switch e := entry.(type) {
+		case fs.Object:
+			if _, err = operations.Copy(ctx, d.f, nil, dst, e); err != nil {
+				return errors.WithStack(err)
+			}
+		case fs.Directory:
+			if err = d.copyDir(ctx, e.Remote(), dst); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type rangeReader struct {
+	o fs.Object
+}
+
+func (r *rangeReader) RangeRead(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+	end := int64(-1)
+	if httpRange.Length >= 0 {
+		end = httpRange.Start + httpRange.Length - 1
+	}
+	rc, err := r.o.Open(ctx, &fs.RangeOption{Start: httpRange.Start, End: end})
+	return rc, errors.WithStack(err)
+}
@@ -0,0 +1,351 @@
+package s3
+
+import (
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"bytes"
+	"context"
+	stdpath "path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+)
+
+// S3兼容的对象存储。对象存储本身没有目录，这里用"/"分隔的key模拟目录：
+// 列目录时按前缀加分隔符列举，新建目录时写一个以"/"结尾的空对象占位。
+// 对象的Path是带根前缀的完整key（以"/"开头、不以"/"结尾）
+
+type S3 struct {
+	model.Storage
+	Addition
+	client  *s3.Client
+	presign *s3.PresignClient
+}
+
+type Addition struct {
+	driver.RootPath
+	Endpoint        string `json:"endpoint" help:"leave empty for AWS, fill in for MinIO and other S3-compatible services"`
+	Region          string `json:"region" default:"us-east-1"`
+	Bucket          string `json:"bucket" required:"true"`
+	AccessKeyID     string `json:"access_key_id" required:"true"`
+	SecretAccessKey string `json:"secret_access_key" required:"true"`
+	SessionToken    string `json:"session_token"`
+	ForcePathStyle  bool   `json:"force_path_style" default:"false" help:"MinIO and most self-hosted services need this"`
+	SignURLExpire   int    `json:"sign_url_expire" type:"number" default:"4" help:"presigned url expiration in hours"`
+	PartSize        int    `json:"part_size" type:"number" default:"16" help:"multipart upload part size in MB"`
+}
+
+var config = driver.Config{
+	Name:        "s3",
+	LocalSort:   true,
+	DefaultRoot: "/",
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &S3{}
+	})
+}
+
+func (d *S3) Config() driver.Config {
+	return config
+}
+
+func (d *S3) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *S3) Init(ctx context.Context) error {
+	if d.Bucket == "" {
+		return errors.New("bucket is required")
+	}
+	if d.Region == "" {
+		d.Region = "us-east-1"
+	}
+	d.RootFolderPath = "/" + strings.Trim(d.RootFolderPath, "/")
+	opts := s3.Options{
+		Region:       d.Region,
+		UsePathStyle: d.ForcePathStyle,
+		Credentials: aws.NewCredentialsCache(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{
+				AccessKeyID:     d.AccessKeyID,
+				SecretAccessKey: d.SecretAccessKey,
+				SessionToken:    d.SessionToken,
+				Source:          "HelaList",
+			}, nil
+		})),
+	}
+	if d.Endpoint != "" {
+		endpoint := d.Endpoint
+		if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+			endpoint = "https://" + endpoint
+		}
+		opts.BaseEndpoint = aws.String(endpoint)
+	}
+	d.client = s3.New(opts)
+	d.presign = s3.NewPresignClient(d.client)
+	return nil
+}
+
+func (d *S3) Drop(ctx context.Context) error {
+	return nil
+}
+
+func (d *S3) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	prefix := dirKey(dir.GetPath())
+	var objs []model.Obj
+	p := s3.NewListObjectsV2Paginator(d.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(d.Bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, cp := range page.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(aws.ToString(cp.Prefix), prefix), "/")
+			if name == "" {
+				continue
+			}
+			objs = append(objs, &model.Object{
+				Path:     stdpath.Join(dir.GetPath(), name),
+				Name:     name,
+				IsFolder: true,
+			})
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			// 目录自己的占位对象
+			if key == prefix {
+				continue
+			}
+			name := strings.TrimPrefix(key, prefix)
+			objs = append(objs, &model.Object{
+				Path:         stdpath.Join(dir.GetPath(), name),
+				Name:         name,
+				Size:         aws.ToInt64(obj.Size),
+				ModifiedTime: aws.ToTime(obj.LastModified),
+				HashInfo:     etagHash(obj.ETag),
+			})
+		}
+	}
+	return objs, nil
+}
+
+// Link 返回预签名的下载地址，客户端可以直接302过去，不经过服务器
+func (d *S3) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	expire := time.Duration(d.SignURLExpire) * time.Hour
+	if expire <= 0 {
+		expire = 4 * time.Hour
+	}
+	req, err := d.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.Bucket),
+		Key:    aws.String(fileKey(file.GetPath())),
+	}, s3.WithPresignExpires(expire))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// 比签名早一点过期，免得拿到缓存里快过期的链接
+	cacheExpire := expire - time.Minute
+	return &model.Link{
+		URL:        req.URL,
+		Expiration: &cacheExpire,
+	}, nil
+}
+
+func (d *S3) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) (model.Obj, error) {
+	dirPath := stdpath.Join(parentDir.GetPath(), dirName)
+	_, err := d.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(d.Bucket),
+		Key:    aws.String(dirKey(dirPath)),
+		Body:   bytes.NewReader(nil),
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &model.Object{
+		Path:         dirPath,
+		Name:         dirName,
+		ModifiedTime: time.Now(),
+		IsFolder:     true,
+	}, nil
+}
+
+func (d *S3) Move(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	dstPath := stdpath.Join(dstDir.GetPath(), srcObj.GetName())
+	if err := d.copyObj(ctx, srcObj, dstPath); err != nil {
+		return nil, err
+	}
+	if err := d.removeObj(ctx, srcObj); err != nil {
+		return nil, err
+	}
+	return movedObj(srcObj, dstPath), nil
+}
+
+func (d *S3) Rename(ctx context.Context, srcObj model.Obj, newName string) (model.Obj, error) {
+	dstPath := stdpath.Join(stdpath.Dir(srcObj.GetPath()), newName)
+	if err := d.copyObj(ctx, srcObj, dstPath); err != nil {
+		return nil, err
+	}
+	if err := d.removeObj(ctx, srcObj); err != nil {
+		return nil, err
+	}
+	return movedObj(srcObj, dstPath), nil
+}
+
+func (d *S3) Copy(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	dstPath := stdpath.Join(dstDir.GetPath(), srcObj.GetName())
+	if err := d.copyObj(ctx, srcObj, dstPath); err != nil {
+		return nil, err
+	}
+	return movedObj(srcObj, dstPath), nil
+}
+
+func (d *S3) Remove(ctx context.Context, obj model.Obj) error {
+	return d.removeObj(ctx, obj)
+}
+
+// Put 用manager.Uploader上传，超过分片大小时自动走分片上传
+func (d *S3) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
+	dstPath := stdpath.Join(dstDir.GetPath(), file.GetName())
+	partSize := int64(d.PartSize) * 1024 * 1024
+	if partSize < manager.MinUploadPartSize {
+		partSize = manager.DefaultUploadPartSize
+	}
+	uploader := manager.NewUploader(d.client, func(u *manager.Uploader) {
+		u.PartSize = partSize
+	})
+	reader := driver.NewLimitedUploadStream(ctx, &driver.ReaderUpdatingProgress{
+		Reader:         file,
+		UpdateProgress: up,
+	})
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(d.Bucket),
+		Key:    aws.String(fileKey(dstPath)),
+		Body:   reader,
+	}
+	if mimetype := file.GetMimetype(); mimetype != "" {
+		input.ContentType = aws.String(mimetype)
+	}
+	out, err := uploader.Upload(ctx, input)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &model.Object{
+		Path:         dstPath,
+		Name:         file.GetName(),
+		Size:         file.GetSize(),
+		ModifiedTime: time.Now(),
+		HashInfo:     etagHash(out.ETag),
+	}, nil
+}
+
+var _ driver.Driver = (*S3)(nil)
+var _ driver.MkdirResult = (*S3)(nil)
+var _ driver.MoveResult = (*S3)(nil)
+var _ driver.RenameResult = (*S3)(nil)
+var _ driver.CopyResult = (*S3)(nil)
+var _ driver.Remove = (*S3)(nil)
+var _ driver.PutResult = (*S3)(nil)
+
+// copyObj 把对象复制到dstPath，目录会把前缀下的所有key都复制过去
+func (d *S3) copyObj(ctx context.Context, srcObj model.Obj, dstPath string) error {
+	if !srcObj.IsDir() {
+		return d.copyKey(ctx, fileKey(srcObj.GetPath()), fileKey(dstPath))
+	}
+	srcPrefix, dstPrefix := dirKey(srcObj.GetPath()), dirKey(dstPath)
+	if strings.HasPrefix(dstPrefix, srcPrefix) {
+		return errors.New("cannot copy a folder into itself")
+	}
+	keys, err := d.listKeys(ctx, srcPrefix)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		// 只有公共前缀、没有占位对象的目录，补一个占位对象
+		_, err = d.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(d.Bucket),
+			Key:    aws.String(dstPrefix),
+			Body:   bytes.NewReader(nil),
+		})
+		return errors.WithStack(err)
+	}
+	for _, key := range keys {
+		if err = d.copyKey(ctx, key, dstPrefix+strings.TrimPrefix(key, srcPrefix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *S3) copyKey(ctx context.Context, srcKey, dstKey string) error {
+	_, err := d.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(d.Bucket),
+		CopySource: aws.String(copySource(d.Bucket, srcKey)),
+		Key:        aws.String(dstKey),
+	})
+	return errors.WithStack(err)
+}
+
+// removeObj 删除对象，目录会删除前缀下的所有key
+func (d *S3) removeObj(ctx context.Context, obj model.Obj) error {
+	if !obj.IsDir() {
+		_, err := d.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(d.Bucket),
+			Key:    aws.String(fileKey(obj.GetPath())),
+		})
+		return errors.WithStack(err)
+	}
+	keys, err := d.listKeys(ctx, dirKey(obj.GetPath()))
+	if err != nil {
+		return err
+	}
+	// DeleteObjects一次最多1000个key
+	for len(keys) > 0 {
+		n := min(len(keys), 1000)
+		ids := make([]types.ObjectIdentifier, 0, n)
+		for _, key := range keys[:n] {
+			ids = append(ids, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+		out, err := d.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(d.Bucket),
+			Delete: &types.Delete{Objects: ids, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return errors.Errorf("failed delete %s: %s", aws.ToString(e.Key), aws.ToString(e.Message))
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// listKeys 递归列出前缀下的所有key，包括目录占位对象
+func (d *S3) listKeys(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	p := s3.NewListObjectsV2Paginator(d.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(d.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,175 @@
+package s3
+
+import (
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/model"
+	"HelaList/internal/stream"
+	"context"
+	"net/http/httptest"
+	stdpath "path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const testBucket = "bucket"
+
+// newS3 连一个进程内的假S3，root是桶里的根目录
+func newS3(t *testing.T, root string) (*S3, *fakeS3) {
+	t.Helper()
+	backend := newFakeS3(testBucket)
+	server := httptest.NewServer(backend)
+	t.Cleanup(server.Close)
+	d := &S3{Addition: Addition{
+		Endpoint:        server.URL,
+		Bucket:          testBucket,
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		ForcePathStyle:  true,
+	}}
+	d.RootFolderPath = root
+	d.SetStorage(model.Storage{MountPath: "/s3"})
+	if err := d.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return d, backend
+}
+
+func keys(backend *fakeS3) string {
+	return strings.Join(backend.keys(), ",")
+}
+
+func dir(path string) model.Obj {
+	return &model.Object{Path: path, Name: stdpath.Base(path), IsFolder: true}
+}
+
+func put(t *testing.T, d *S3, dirPath, name, content string) {
+	t.Helper()
+	file := &stream.FileStream{
+		Obj:    &model.Object{Name: name, Size: int64(len(content))},
+		Reader: strings.NewReader(content),
+	}
+	if _, err := d.Put(context.Background(), dir(dirPath), file, func(float64) {}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func names(t *testing.T, d *S3, path string) string {
+	t.Helper()
+	objs, err := d.List(context.Background(), dir(path), model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for _, obj := range objs {
+		name := obj.GetName()
+		if obj.IsDir() {
+			name += "/"
+		}
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
+func TestConformance(t *testing.T) {
+	d, _ := newS3(t, "/")
+	drivertest.Run(t, d)
+}
+
+func TestConformanceWithRoot(t *testing.T) {
+	d, _ := newS3(t, "/prefix")
+	drivertest.Run(t, d)
+}
+
+func TestList(t *testing.T) {
+	d, backend := newS3(t, "/root")
+	ctx := context.Background()
+	if _, err := d.MakeDir(ctx, dir("/root"), "empty"); err != nil {
+		t.Fatal(err)
+	}
+	put(t, d, "/root", "a.txt", "aaa")
+	put(t, d, "/root/implicit", "b.txt", "bbb")
+	if got := keys(backend); got != "root/a.txt,root/empty/,root/implicit/b.txt" {
+		t.Fatalf("keys = %s", got)
+	}
+	// 没有占位对象的公共前缀也算目录，目录自己的占位对象不列出来
+	if got := names(t, d, "/root"); got != "a.txt,empty/,implicit/" {
+		t.Fatalf("list = %s", got)
+	}
+	if got := names(t, d, "/root/empty"); got != "" {
+		t.Fatalf("empty dir = %s", got)
+	}
+	objs, err := d.List(ctx, dir("/root"), model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range objs {
+		if obj.GetName() == "a.txt" && (obj.GetSize() != 3 || obj.GetPath() != "/root/a.txt") {
+			t.Fatalf("a.txt = %+v", obj)
+		}
+	}
+}
+
+func TestCopyMoveRemoveFolder(t *testing.T) {
+	d, backend := newS3(t, "/")
+	ctx := context.Background()
+	put(t, d, "/src", "a.txt", "aaa")
+	put(t, d, "/src/sub", "b.txt", "bbb")
+	if _, err := d.MakeDir(ctx, dir("/"), "dst"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Copy(ctx, dir("/src"), dir("/dst")); err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(backend); got != "dst/,dst/src/a.txt,dst/src/sub/b.txt,src/a.txt,src/sub/b.txt" {
+		t.Fatalf("keys after copy = %s", got)
+	}
+	if _, err := d.Copy(ctx, dir("/src"), dir("/src/sub")); err == nil {
+		t.Fatal("copying a folder into itself should fail")
+	}
+
+	// 目标已经有同名目录，合并进去
+	if _, err := d.Move(ctx, dir("/dst/src"), dir("/")); err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(backend); got != "dst/,src/a.txt,src/sub/b.txt" {
+		t.Fatalf("keys after move = %s", got)
+	}
+
+	if _, err := d.Rename(ctx, dir("/src"), "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(backend); got != "dst/,renamed/a.txt,renamed/sub/b.txt" {
+		t.Fatalf("keys after rename = %s", got)
+	}
+
+	if err := d.Remove(ctx, dir("/renamed")); err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(backend); got != "dst/" {
+		t.Fatalf("keys after remove = %s", got)
+	}
+}
+
+// 只有公共前缀、没有占位对象的空目录复制过去也要是个目录
+func TestCopyImplicitFolder(t *testing.T) {
+	d, backend := newS3(t, "/")
+	ctx := context.Background()
+	if _, err := d.MakeDir(ctx, dir("/"), "empty"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Copy(ctx, dir("/empty"), dir("/")); err == nil {
+		t.Fatal("copying a folder onto itself should fail")
+	}
+	if _, err := d.MakeDir(ctx, dir("/"), "dst"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Copy(ctx, dir("/empty"), dir("/dst")); err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(backend); got != "dst/,dst/empty/,empty/" {
+		t.Fatalf("keys = %s", got)
+	}
+}
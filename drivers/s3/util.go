@@ -0,0 +1,53 @@
+package s3
+
+import (
+	"HelaList/internal/model"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// fileKey 把对象路径转换成key，去掉开头的"/"
+func fileKey(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+// dirKey 目录对应的前缀，以"/"结尾；桶的根目录对应空前缀
+func dirKey(path string) string {
+	key := strings.Trim(path, "/")
+	if key == "" {
+		return ""
+	}
+	return key + "/"
+}
+
+// copySource CopyObject要求的源格式是 bucket/key，key需要做url转义
+func copySource(bucket, key string) string {
+	return bucket + "/" + strings.ReplaceAll(url.PathEscape(key), "%2F", "/")
+}
+
+// movedObj 复制、移动、改名后的对象，S3的这些接口不返回对象信息，直接按源对象构造
+func movedObj(src model.Obj, dstPath string) model.Obj {
+	name := dstPath[strings.LastIndex(dstPath, "/")+1:]
+	return &model.Object{
+		Path:         dstPath,
+		Name:         name,
+		Size:         src.GetSize(),
+		ModifiedTime: time.Now(),
+		IsFolder:     src.IsDir(),
+		HashInfo:     src.GetHash(),
+	}
+}
+
+// etagHash 普通上传的对象ETag就是内容的MD5。分片上传的ETag带"-"，不是MD5，
+// 用KMS加密的对象ETag也不是，不过长度一样没法分辨，这种桶就别指望校验了
+func etagHash(etag *string) utils.HashInfo {
+	e := strings.Trim(aws.ToString(etag), `"`)
+	if len(e) != utils.MD5.Width || strings.Contains(e, "-") {
+		return utils.HashInfo{}
+	}
+	return utils.NewHashInfo(utils.MD5, strings.ToLower(e))
+}
@@ -0,0 +1,269 @@
+package sftp
+
+import (
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	"os"
+	stdpath "path"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils/random"
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTP存储：通过SSH挂载远程服务器上的一个目录。
+// 对象的Path是远程服务器上的绝对路径，连接断开后下次操作时自动重连
+
+type SFTP struct {
+	model.Storage
+	Addition
+	sshConfig *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *sftp.Client
+}
+
+type Addition struct {
+	driver.RootPath
+	Address    string `json:"address" required:"true" help:"host:port, port defaults to 22"`
+	Username   string `json:"username" required:"true"`
+	Password   string `json:"password"`
+	PrivateKey string `json:"private_key" type:"text" help:"PEM encoded private key, takes precedence over password"`
+	Passphrase string `json:"passphrase" help:"passphrase of the private key"`
+	HostKey    string `json:"host_key" required:"true" help:"pinned host key, either a line from known_hosts/authorized_keys or a SHA256 fingerprint"`
+}
+
+var config = driver.Config{
+	Name:          "sftp",
+	LocalSort:     true,
+	OnlyLinkMFile: true, // 只能由服务器从SSH连接上读出来再发给客户端
+	DefaultRoot:   "/",
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &SFTP{}
+	})
+}
+
+func (d *SFTP) Config() driver.Config {
+	return config
+}
+
+func (d *SFTP) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *SFTP) Init(ctx context.Context) error {
+	if d.RootFolderPath == "" {
+		d.RootFolderPath = "/"
+	}
+	d.RootFolderPath = stdpath.Clean("/" + d.RootFolderPath)
+	auth, err := d.authMethods()
+	if err != nil {
+		return err
+	}
+	hostKeyCallback, err := pinnedHostKey(d.HostKey)
+	if err != nil {
+		return err
+	}
+	d.sshConfig = &ssh.ClientConfig{
+		User:            d.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	}
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	info, err := client.Stat(d.RootFolderPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed stat root folder %s", d.RootFolderPath)
+	}
+	if !info.IsDir() {
+		return errors.Errorf("root folder %s is not a directory", d.RootFolderPath)
+	}
+	return nil
+}
+
+func (d *SFTP) Drop(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client != nil {
+		err := d.client.Close()
+		d.client = nil
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Get 根目录也走这里，所以不需要GetRooter
+func (d *SFTP) Get(ctx context.Context, path string) (model.Obj, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	remotePath := stdpath.Join(d.RootFolderPath, path)
+	info, err := client.Stat(remotePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("object not found: %s", path)
+		}
+		return nil, errors.WithStack(err)
+	}
+	return d.fileInfoToObj(remotePath, info), nil
+}
+
+func (d *SFTP) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	infos, err := client.ReadDir(dir.GetPath())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	objs := make([]model.Obj, 0, len(infos))
+	for _, info := range infos {
+		remotePath := stdpath.Join(dir.GetPath(), info.Name())
+		if info.Mode()&os.ModeSymlink != 0 {
+			// ReadDir返回的是链接本身，大小和类型要看它指向的对象
+			target, err := client.Stat(remotePath)
+			if err != nil {
+				// 断掉的链接
+				continue
+			}
+			info = renamedFileInfo{FileInfo: target, name: info.Name()}
+		}
+		objs = append(objs, d.fileInfoToObj(remotePath, info))
+	}
+	return objs, nil
+}
+
+// Link 直接把远程文件作为MFile返回，它支持Seek和ReadAt，预览、流媒体和WebDAV的Range请求都能用
+func (d *SFTP) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	f, err := client.Open(file.GetPath())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &model.Link{
+		MFile:         f,
+		ContentLength: file.GetSize(),
+		SyncClosers:   utils.NewSyncClosers(f),
+	}, nil
+}
+
+func (d *SFTP) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) (model.Obj, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	dirPath, err := childPath(parentDir, dirName)
+	if err != nil {
+		return nil, err
+	}
+	if err = client.Mkdir(dirPath); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return d.statObj(client, dirPath)
+}
+
+func (d *SFTP) Move(ctx context.Context, srcObj, dstDir model.Obj) (model.Obj, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	dstPath, err := childPath(dstDir, srcObj.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if err = client.Rename(srcObj.GetPath(), dstPath); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return d.statObj(client, dstPath)
+}
+
+func (d *SFTP) Rename(ctx context.Context, srcObj model.Obj, newName string) (model.Obj, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkName(newName); err != nil {
+		return nil, err
+	}
+	dstPath := stdpath.Join(stdpath.Dir(srcObj.GetPath()), newName)
+	if err = client.Rename(srcObj.GetPath(), dstPath); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return d.statObj(client, dstPath)
+}
+
+func (d *SFTP) Remove(ctx context.Context, obj model.Obj) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	if stdpath.Clean(obj.GetPath()) == d.RootFolderPath {
+		return errors.New("cannot remove the root folder")
+	}
+	if obj.IsDir() {
+		return errors.WithStack(client.RemoveAll(obj.GetPath()))
+	}
+	return errors.WithStack(client.Remove(obj.GetPath()))
+}
+
+// Put 先写到同目录下的临时文件，写完再改名，中途失败不会留下半个文件
+func (d *SFTP) Put(ctx context.Context, dstDir model.Obj, file model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	dstPath, err := childPath(dstDir, file.GetName())
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := stdpath.Join(dstDir.GetPath(), "."+file.GetName()+".uploading-"+random.String(8))
+	tmp, err := client.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	reader := driver.NewLimitedUploadStream(ctx, &driver.ReaderUpdatingProgress{
+		Reader:         file,
+		UpdateProgress: up,
+	})
+	_, err = tmp.ReadFrom(reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = d.replace(client, tmpPath, dstPath)
+	}
+	if err != nil {
+		_ = client.Remove(tmpPath)
+		return nil, errors.WithStack(err)
+	}
+	if mtime := file.GetModifiedTime(); !mtime.IsZero() {
+		// 保留源文件的修改时间，失败了也不影响上传结果
+		_ = client.Chtimes(dstPath, time.Now(), mtime)
+	}
+	return d.statObj(client, dstPath)
+}
+
+var _ driver.Driver = (*SFTP)(nil)
+var _ driver.Getter = (*SFTP)(nil)
+var _ driver.MkdirResult = (*SFTP)(nil)
+var _ driver.MoveResult = (*SFTP)(nil)
+var _ driver.RenameResult = (*SFTP)(nil)
+var _ driver.Remove = (*SFTP)(nil)
+var _ driver.PutResult = (*SFTP)(nil)
@@ -0,0 +1,193 @@
+package sftp
+
+import (
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/model"
+	"context"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newSFTP(s *testServer, addition Addition) *SFTP {
+	addition.Address = s.addr
+	if addition.Username == "" {
+		addition.Username = testUser
+	}
+	d := &SFTP{Addition: addition}
+	d.SetStorage(model.Storage{MountPath: "/sftp"})
+	return d
+}
+
+func initSFTP(t *testing.T, d *SFTP) *SFTP {
+	t.Helper()
+	if err := d.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = d.Drop(context.Background()) })
+	return d
+}
+
+// initErr 期望Init失败，返回错误信息
+func initErr(t *testing.T, d *SFTP) string {
+	t.Helper()
+	err := d.Init(context.Background())
+	_ = d.Drop(context.Background())
+	if err == nil {
+		t.Fatal("init should fail")
+	}
+	return err.Error()
+}
+
+func authorizedKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func TestConformance(t *testing.T) {
+	s := newTestServer(t)
+	addition := Addition{Password: testPassword, HostKey: authorizedKey(s.hostKey)}
+	addition.RootFolderPath = t.TempDir()
+	drivertest.Run(t, initSFTP(t, newSFTP(s, addition)))
+}
+
+func TestPrivateKeyAuth(t *testing.T) {
+	s := newTestServer(t)
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(s.clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := ssh.MarshalPrivateKeyWithPassphrase(s.clientKey, "", []byte("pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey := ssh.FingerprintSHA256(s.hostKey)
+
+	for name, addition := range map[string]Addition{
+		"plain": {PrivateKey: string(pem.EncodeToMemory(block)), HostKey: hostKey},
+		// 私钥优先，密码填错了也不影响
+		"with wrong password": {PrivateKey: string(pem.EncodeToMemory(block)), Password: "wrong", HostKey: hostKey},
+		"passphrase":          {PrivateKey: string(pem.EncodeToMemory(encrypted)), Passphrase: "pass", HostKey: hostKey},
+	} {
+		t.Run(name, func(t *testing.T) {
+			addition.RootFolderPath = root
+			d := initSFTP(t, newSFTP(s, addition))
+			obj, err := d.Get(context.Background(), "/a.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if obj.GetSize() != 1 {
+				t.Fatalf("a.txt = %+v", obj)
+			}
+		})
+	}
+
+	other, err := ssh.MarshalPrivateKey(newKey(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, addition := range map[string]Addition{
+		"unknown key":    {PrivateKey: string(pem.EncodeToMemory(other)), HostKey: hostKey},
+		"bad passphrase": {PrivateKey: string(pem.EncodeToMemory(encrypted)), Passphrase: "wrong", HostKey: hostKey},
+		"no passphrase":  {PrivateKey: string(pem.EncodeToMemory(encrypted)), HostKey: hostKey},
+		"not a key":      {PrivateKey: "garbage", HostKey: hostKey},
+		"wrong password": {Password: "wrong", HostKey: hostKey},
+		"no credentials": {HostKey: hostKey},
+	} {
+		t.Run(name, func(t *testing.T) {
+			addition.RootFolderPath = root
+			initErr(t, newSFTP(s, addition))
+		})
+	}
+}
+
+func TestHostKey(t *testing.T) {
+	s := newTestServer(t)
+	other, err := ssh.NewPublicKey(newKey(t).Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	fingerprint := ssh.FingerprintSHA256(s.hostKey)
+
+	// 三种写法都能认出服务器
+	for name, hostKey := range map[string]string{
+		"authorized_keys": authorizedKey(s.hostKey),
+		"known_hosts":     "example.com " + authorizedKey(s.hostKey),
+		"fingerprint":     "  " + fingerprint + "\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			addition := Addition{Password: testPassword, HostKey: hostKey}
+			addition.RootFolderPath = root
+			initSFTP(t, newSFTP(s, addition))
+		})
+	}
+
+	// 和固定的不一致时连不上，密码也不会发出去
+	for name, hostKey := range map[string]string{
+		"authorized_keys": authorizedKey(other),
+		"known_hosts":     "example.com " + authorizedKey(other),
+		"fingerprint":     ssh.FingerprintSHA256(other),
+	} {
+		t.Run(name+" mismatch", func(t *testing.T) {
+			addition := Addition{Password: testPassword, HostKey: hostKey}
+			addition.RootFolderPath = root
+			if msg := initErr(t, newSFTP(s, addition)); !strings.Contains(msg, "host key mismatch") {
+				t.Fatalf("err = %s", msg)
+			}
+		})
+	}
+
+	t.Run("not pinned", func(t *testing.T) {
+		addition := Addition{Password: testPassword}
+		addition.RootFolderPath = root
+		if msg := initErr(t, newSFTP(s, addition)); !strings.Contains(msg, "not pinned") || !strings.Contains(msg, fingerprint) {
+			t.Fatalf("err = %s", msg)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		addition := Addition{Password: testPassword, HostKey: "not a key"}
+		addition.RootFolderPath = root
+		if msg := initErr(t, newSFTP(s, addition)); !strings.Contains(msg, "invalid host key") {
+			t.Fatalf("err = %s", msg)
+		}
+	})
+}
+
+// 根目录末尾的/会被去掉，根目录本身删不掉，也不能是文件
+func TestRoot(t *testing.T) {
+	s := newTestServer(t)
+	root := t.TempDir()
+	addition := Addition{Password: testPassword, HostKey: authorizedKey(s.hostKey)}
+	addition.RootFolderPath = root + "/"
+	d := initSFTP(t, newSFTP(s, addition))
+	if d.RootFolderPath != root {
+		t.Fatalf("root = %s", d.RootFolderPath)
+	}
+	rootObj, err := d.Get(context.Background(), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rootObj.GetPath() != root || !rootObj.IsDir() {
+		t.Fatalf("root obj = %+v", rootObj)
+	}
+	if err = d.Remove(context.Background(), rootObj); err == nil {
+		t.Fatal("removing the root should fail")
+	}
+
+	file := filepath.Join(root, "file")
+	if err = os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	addition.RootFolderPath = file
+	if msg := initErr(t, newSFTP(s, addition)); !strings.Contains(msg, "not a directory") {
+		t.Fatalf("err = %s", msg)
+	}
+}
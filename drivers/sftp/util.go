@@ -0,0 +1,157 @@
+package sftp
+
+import (
+	"HelaList/internal/model"
+	"net"
+	"os"
+	stdpath "path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func (d *SFTP) authMethods() ([]ssh.AuthMethod, error) {
+	if d.PrivateKey != "" {
+		var signer ssh.Signer
+		var err error
+		if d.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(d.PrivateKey), []byte(d.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(d.PrivateKey))
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid private key")
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+	if d.Password != "" {
+		return []ssh.AuthMethod{ssh.Password(d.Password)}, nil
+	}
+	return nil, errors.New("either password or private key is required")
+}
+
+// pinnedHostKey 只接受和配置一致的主机公钥。
+// 没有配置时直接拒绝，并在错误里带上对方的指纹，方便管理员核对后填进来
+func pinnedHostKey(pinned string) (ssh.HostKeyCallback, error) {
+	pinned = strings.TrimSpace(pinned)
+	if pinned == "" {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return errors.Errorf("host key of %s is not pinned, its fingerprint is %s", hostname, ssh.FingerprintSHA256(key))
+		}, nil
+	}
+	if strings.HasPrefix(pinned, "SHA256:") {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if fp := ssh.FingerprintSHA256(key); fp != pinned {
+				return errors.Errorf("host key mismatch for %s: got %s", hostname, fp)
+			}
+			return nil
+		}, nil
+	}
+	// authorized_keys格式是"类型 公钥"，known_hosts格式前面多一个主机名
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pinned))
+	if err != nil {
+		_, _, key, _, _, err = ssh.ParseKnownHosts([]byte(pinned))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid host key")
+		}
+	}
+	return ssh.FixedHostKey(key), nil
+}
+
+// getClient 返回当前的SFTP连接，连接不存在或已经断开时重新建立
+func (d *SFTP) getClient() (*sftp.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client != nil {
+		return d.client, nil
+	}
+	addr := d.Address
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	conn, err := ssh.Dial("tcp", addr, d.sshConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed connect to %s", addr)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.WithStack(err)
+	}
+	d.client = client
+	go func() {
+		// 连接断开后清掉，下次调用时重连
+		_ = client.Wait()
+		d.mu.Lock()
+		if d.client == client {
+			d.client = nil
+		}
+		d.mu.Unlock()
+	}()
+	return client, nil
+}
+
+// replace 把tmpPath改名成dstPath，dstPath已存在时覆盖
+func (d *SFTP) replace(client *sftp.Client, tmpPath, dstPath string) error {
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(tmpPath, dstPath)
+	}
+	// 标准SFTP的rename在目标存在时会失败，只能先删掉
+	if err := client.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return client.Rename(tmpPath, dstPath)
+}
+
+func (d *SFTP) fileInfoToObj(remotePath string, info os.FileInfo) model.Obj {
+	name := info.Name()
+	if remotePath == d.RootFolderPath {
+		name = "root"
+	}
+	size := info.Size()
+	if info.IsDir() {
+		size = 0
+	}
+	return &model.Object{
+		Path:         remotePath,
+		Name:         name,
+		Size:         size,
+		ModifiedTime: info.ModTime(),
+		IsFolder:     info.IsDir(),
+	}
+}
+
+func (d *SFTP) statObj(client *sftp.Client, remotePath string) (model.Obj, error) {
+	info, err := client.Stat(remotePath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return d.fileInfoToObj(remotePath, info), nil
+}
+
+type renamedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (r renamedFileInfo) Name() string {
+	return r.name
+}
+
+// childPath 返回dir下名为name的对象的远程路径
+func childPath(dir model.Obj, name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	return stdpath.Join(dir.GetPath(), name), nil
+}
+
+// checkName 名字里不能带路径分隔符，否则可以借着改名、上传跑到别的目录
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return errors.Errorf("invalid name: %q", name)
+	}
+	return nil
+}
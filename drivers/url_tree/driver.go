@@ -0,0 +1,257 @@
+package url_tree
+
+import (
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	stdpath "path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// 地址树存储：目录和地址都写在Addition里，适合整理一批外部链接当成一个可浏览的挂载。
+// 下载时直接给出地址，重定向还是代理由存储的配置决定。
+// 新建目录、改名、删除、PutURL都会改写Addition里的结构并保存到数据库
+
+type URLTree struct {
+	model.Storage
+	Addition
+	mu     sync.RWMutex
+	root   *node
+	asJSON bool
+}
+
+type Addition struct {
+	URLStructure string `json:"url_structure" type:"text" default:"https://example.com/file.txt\nfolder:\n  name.txt:https://example.com/name.txt" help:"one entry per line, 'name:' is a folder and lines below it with more indent are inside it, a file is '[name:[size:[modified:]]]url'; a JSON array of {name, url, size, modified, children} also works"`
+}
+
+var config = driver.Config{
+	Name:        "url_tree",
+	LocalSort:   true,
+	NoUpload:    true,
+	DefaultRoot: "/",
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &URLTree{}
+	})
+}
+
+func (d *URLTree) Config() driver.Config {
+	return config
+}
+
+func (d *URLTree) GetAddition() driver.Additional {
+	return &d.Addition
+}
+
+func (d *URLTree) Init(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.asJSON = isJSON(d.URLStructure)
+	var err error
+	if d.asJSON {
+		d.root, err = parseJSON(d.URLStructure)
+	} else {
+		d.root, err = parseText(d.URLStructure)
+	}
+	return err
+}
+
+func (d *URLTree) Drop(ctx context.Context) error {
+	return nil
+}
+
+func (d *URLTree) GetRoot(ctx context.Context) (model.Obj, error) {
+	return d.Get(ctx, "/")
+}
+
+func (d *URLTree) Get(ctx context.Context, path string) (model.Obj, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	n, err := d.root.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return toObj(path, n), nil
+}
+
+func (d *URLTree) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	n, err := d.root.lookup(dir.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	if !n.isDir() {
+		return nil, errors.Errorf("not a folder: %s", dir.GetPath())
+	}
+	objs := make([]model.Obj, 0, len(n.Children))
+	for _, c := range n.Children {
+		objs = append(objs, toObj(stdpath.Join(dir.GetPath(), c.Name), c))
+	}
+	return objs, nil
+}
+
+func (d *URLTree) Link(ctx context.Context, file model.Obj, args model.LinkArgs) (*model.Link, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	n, err := d.root.lookup(file.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	if n.isDir() {
+		return nil, errors.Errorf("not a file: %s", file.GetPath())
+	}
+	return &model.Link{URL: n.URL}, nil
+}
+
+func (d *URLTree) MakeDir(ctx context.Context, parentDir model.Obj, dirName string) (model.Obj, error) {
+	n := &node{Name: dirName}
+	err := d.update(func() error {
+		parent, err := d.dir(parentDir.GetPath())
+		if err != nil {
+			return err
+		}
+		return parent.add(n)
+	}, dirName)
+	if err != nil {
+		return nil, err
+	}
+	return toObj(stdpath.Join(parentDir.GetPath(), dirName), n), nil
+}
+
+func (d *URLTree) Rename(ctx context.Context, srcObj model.Obj, newName string) (model.Obj, error) {
+	var n *node
+	err := d.update(func() error {
+		parent, err := d.dir(stdpath.Dir(srcObj.GetPath()))
+		if err != nil {
+			return err
+		}
+		if n = parent.child(srcObj.GetName()); n == nil {
+			return errors.Errorf("object not found: %s", srcObj.GetPath())
+		}
+		if !validName(newName) {
+			return errors.Errorf("invalid name: %q", newName)
+		}
+		if parent.child(newName) != nil {
+			return errors.Errorf("object already exists: %s", newName)
+		}
+		n.Name = newName
+		return nil
+	}, newName)
+	if err != nil {
+		return nil, err
+	}
+	return toObj(stdpath.Join(stdpath.Dir(srcObj.GetPath()), newName), n), nil
+}
+
+func (d *URLTree) Remove(ctx context.Context, obj model.Obj) error {
+	return d.update(func() error {
+		if obj.GetPath() == "/" || obj.GetPath() == "" {
+			return errors.New("can not remove the root folder")
+		}
+		parent, err := d.dir(stdpath.Dir(obj.GetPath()))
+		if err != nil {
+			return err
+		}
+		if parent.child(obj.GetName()) == nil {
+			return errors.Errorf("object not found: %s", obj.GetPath())
+		}
+		parent.removeChild(obj.GetName())
+		return nil
+	})
+}
+
+// PutURL 和普通上传一样，同名的文件会被覆盖
+func (d *URLTree) PutURL(ctx context.Context, dstDir model.Obj, name, url string) (model.Obj, error) {
+	if !schemeRe.MatchString(url) || strings.ContainsAny(url, " \t\r\n") {
+		return nil, errors.Errorf("invalid url: %q", url)
+	}
+	n := &node{Name: name, URL: url}
+	err := d.update(func() error {
+		parent, err := d.dir(dstDir.GetPath())
+		if err != nil {
+			return err
+		}
+		if old := parent.child(name); old != nil {
+			if old.isDir() {
+				return errors.Errorf("a folder with the same name exists: %s", stdpath.Join(dstDir.GetPath(), name))
+			}
+			parent.removeChild(name)
+		}
+		return parent.add(n)
+	}, name)
+	if err != nil {
+		return nil, err
+	}
+	return toObj(stdpath.Join(dstDir.GetPath(), name), n), nil
+}
+
+func (d *URLTree) dir(path string) (*node, error) {
+	n, err := d.root.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	if !n.isDir() {
+		return nil, errors.Errorf("not a folder: %s", path)
+	}
+	return n, nil
+}
+
+// update 在树的一份拷贝上修改，成功后替换并把新的结构保存到数据库，失败时树保持原样。
+// names是这次会写进结构的名字，文本格式里有些名字写不进去
+func (d *URLTree) update(fn func() error, names ...string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.asJSON {
+		for _, name := range names {
+			if strings.Contains(name, ":") || strings.HasPrefix(name, "#") || strings.TrimSpace(name) != name {
+				return errors.Errorf("name %q can not be written into the text structure, switch to the json structure", name)
+			}
+		}
+	}
+	old := d.root
+	d.root = old.clone()
+	if err := fn(); err != nil {
+		d.root = old
+		return err
+	}
+	text, err := marshal(d.root, d.asJSON)
+	if err != nil {
+		d.root = old
+		return err
+	}
+	d.URLStructure = text
+	op.MustSaveDriverStorage(d)
+	return nil
+}
+
+func toObj(path string, n *node) *model.Object {
+	obj := &model.Object{
+		Path:     path,
+		Name:     n.Name,
+		Size:     n.Size,
+		IsFolder: n.isDir(),
+	}
+	if path == "/" {
+		obj.Name = "root"
+	}
+	if n.Modified > 0 {
+		obj.ModifiedTime = time.Unix(n.Modified, 0)
+	}
+	return obj
+}
+
+var _ driver.Driver = (*URLTree)(nil)
+var _ driver.GetRooter = (*URLTree)(nil)
+var _ driver.Getter = (*URLTree)(nil)
+var _ driver.MkdirResult = (*URLTree)(nil)
+var _ driver.RenameResult = (*URLTree)(nil)
+var _ driver.Remove = (*URLTree)(nil)
+var _ driver.PutURLResult = (*URLTree)(nil)
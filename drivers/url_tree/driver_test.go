@@ -0,0 +1,224 @@
+package url_tree
+
+import (
+	"HelaList/internal/bootstrap"
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const textStructure = `# 注释
+https://example.com/a.mp4
+b.mp4:https://example.com/b?id=1
+folder:
+  c.iso:1048576:https://example.com/c.iso
+  d.iso:2048:1759300000:https://example.com/d.iso
+  sub:
+    https://example.com/e.txt
+empty:
+`
+
+// mount 存储配置存进数据库，修改后保存Addition要用到
+func mount(t *testing.T, mountPath, structure string) *URLTree {
+	t.Helper()
+	addition, err := json.Marshal(Addition{URLStructure: structure})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return drivertest.Mount(t, model.Storage{
+		MountPath: mountPath,
+		Driver:    "url_tree",
+		Addition:  string(addition),
+	}).(*URLTree)
+}
+
+// saved 数据库里保存的结构
+func saved(t *testing.T, mountPath string) string {
+	t.Helper()
+	var s model.Storage
+	if err := bootstrap.Db.Where("mount_path = ?", mountPath).First(&s).Error; err != nil {
+		t.Fatal(err)
+	}
+	var a Addition
+	if err := json.Unmarshal([]byte(s.Addition), &a); err != nil {
+		t.Fatal(err)
+	}
+	return a.URLStructure
+}
+
+func list(t *testing.T, d *URLTree, path string) []model.Obj {
+	t.Helper()
+	objs, err := d.List(context.Background(), &model.Object{Path: path, IsFolder: true}, model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objs
+}
+
+func TestParseText(t *testing.T) {
+	d := mount(t, "/text", textStructure)
+	root := list(t, d, "/")
+	var got []string
+	for _, obj := range root {
+		got = append(got, obj.GetName())
+	}
+	if strings.Join(got, ",") != "a.mp4,b.mp4,folder,empty" {
+		t.Fatalf("root = %v", got)
+	}
+	if !root[2].IsDir() || !root[3].IsDir() || root[0].IsDir() {
+		t.Fatal("folders and files are mixed up")
+	}
+
+	obj, err := d.Get(context.Background(), "/folder/d.iso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetSize() != 2048 || obj.GetModifiedTime().Unix() != 1759300000 {
+		t.Fatalf("d.iso size %d modified %v", obj.GetSize(), obj.GetModifiedTime())
+	}
+	if objs := list(t, d, "/folder/sub"); len(objs) != 1 || objs[0].GetName() != "e.txt" {
+		t.Fatalf("sub = %v", objs)
+	}
+	l, err := d.Link(context.Background(), &model.Object{Path: "/b.mp4"}, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.URL != "https://example.com/b?id=1" {
+		t.Fatalf("link = %s", l.URL)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, structure := range []string{
+		"not a folder or url",
+		"a:https://example.com/1\na:https://example.com/2",
+		"x:1:2:3:https://example.com/x",
+		"big:lots:https://example.com/big",
+		`[{"name":"a/b","url":"https://example.com"}]`,
+		`[{"name":"a"`,
+	} {
+		d := &URLTree{Addition: Addition{URLStructure: structure}}
+		if err := d.Init(context.Background()); err == nil {
+			t.Fatalf("%q should not parse", structure)
+		}
+	}
+}
+
+func TestEditText(t *testing.T) {
+	ctx := context.Background()
+	d := mount(t, "/edit-text", textStructure)
+	folder, _ := d.Get(ctx, "/folder")
+	if _, err := d.MakeDir(ctx, folder, "new"); err != nil {
+		t.Fatal(err)
+	}
+	newDir, _ := d.Get(ctx, "/folder/new")
+	if _, err := d.PutURL(ctx, newDir, "f.bin", "https://example.com/f.bin"); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := d.Get(ctx, "/a.mp4")
+	if _, err := d.Rename(ctx, a, "movie.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	empty, _ := d.Get(ctx, "/empty")
+	if err := d.Remove(ctx, empty); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.MakeDir(ctx, folder, "a:b"); err == nil {
+		t.Fatal("':' can not be written into the text structure")
+	}
+
+	// 保存的结构重新加载后和现在一样
+	structure := saved(t, "/edit-text")
+	if structure != d.URLStructure {
+		t.Fatalf("saved structure differs:\n%s", structure)
+	}
+	reloaded := &URLTree{Addition: Addition{URLStructure: structure}}
+	if err := reloaded.Init(ctx); err != nil {
+		t.Fatalf("%v\n%s", err, structure)
+	}
+	for _, path := range []string{"/movie.mp4", "/b.mp4", "/folder/c.iso", "/folder/sub/e.txt", "/folder/new/f.bin"} {
+		if _, err := reloaded.Get(ctx, path); err != nil {
+			t.Fatalf("%s: %v\n%s", path, err, structure)
+		}
+	}
+	if _, err := reloaded.Get(ctx, "/empty"); err == nil {
+		t.Fatal("removed folder is back")
+	}
+	l, _ := reloaded.Link(ctx, &model.Object{Path: "/movie.mp4"}, model.LinkArgs{})
+	if l.URL != "https://example.com/a.mp4" {
+		t.Fatalf("renamed link = %s", l.URL)
+	}
+}
+
+func TestEditJSON(t *testing.T) {
+	ctx := context.Background()
+	d := mount(t, "/edit-json", `[{"name":"dir","children":[{"url":"https://example.com/x.txt","size":3}]}]`)
+	dir, err := d.Get(ctx, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := d.Get(ctx, "/dir/x.txt")
+	if err != nil || x.GetSize() != 3 {
+		t.Fatalf("x.txt: %v", err)
+	}
+	// JSON格式里名字可以带冒号
+	if _, err = d.PutURL(ctx, dir, "a:b.txt", "https://example.com/ab"); err != nil {
+		t.Fatal(err)
+	}
+	structure := saved(t, "/edit-json")
+	if !strings.HasPrefix(structure, "[") {
+		t.Fatalf("structure is no longer json:\n%s", structure)
+	}
+	reloaded := &URLTree{Addition: Addition{URLStructure: structure}}
+	if err = reloaded.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = reloaded.Get(ctx, "/dir/a:b.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFailedEditKeepsTree(t *testing.T) {
+	ctx := context.Background()
+	d := mount(t, "/keep", textStructure)
+	b, _ := d.Get(ctx, "/b.mp4")
+	if _, err := d.Rename(ctx, b, "folder"); err == nil {
+		t.Fatal("rename onto an existing name should fail")
+	}
+	if _, err := d.Get(ctx, "/b.mp4"); err != nil {
+		t.Fatal("failed rename changed the tree")
+	}
+	root, _ := d.GetRoot(ctx)
+	if _, err := d.PutURL(ctx, root, "folder", "https://example.com/folder"); err == nil {
+		t.Fatal("put url over a folder should fail")
+	}
+	if saved(t, "/keep") != textStructure {
+		t.Fatal("failed edits should not be saved")
+	}
+}
+
+func TestPutURLThroughOp(t *testing.T) {
+	ctx := context.Background()
+	d := mount(t, "/op", "")
+	if err := op.PutURL(ctx, d, "/a/b", "c.txt", "https://example.com/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	l, _, err := op.Link(ctx, d, "/a/b/c.txt", model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.URL != "https://example.com/c.txt" {
+		t.Fatalf("link = %s", l.URL)
+	}
+	if got := saved(t, "/op"); got != "a:\n  b:\n    https://example.com/c.txt\n" {
+		t.Fatalf("saved structure:\n%s", got)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	drivertest.Run(t, mount(t, "/conformance", textStructure))
+}
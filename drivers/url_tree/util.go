@@ -0,0 +1,250 @@
+package url_tree
+
+import (
+	"encoding/json"
+	"net/url"
+	stdpath "path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// node 目录或者一个地址，URL为空的是目录。JSON格式直接就是[]*node
+type node struct {
+	Name     string  `json:"name,omitempty"`
+	URL      string  `json:"url,omitempty"`
+	Size     int64   `json:"size,omitempty"`
+	Modified int64   `json:"modified,omitempty"` // unix秒
+	Children []*node `json:"children,omitempty"`
+}
+
+func (n *node) isDir() bool {
+	return n.URL == ""
+}
+
+func (n *node) child(name string) *node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *node) removeChild(name string) {
+	n.Children = slices.DeleteFunc(n.Children, func(c *node) bool {
+		return c.Name == name
+	})
+}
+
+func (n *node) clone() *node {
+	c := *n
+	c.Children = make([]*node, len(n.Children))
+	for i, child := range n.Children {
+		c.Children[i] = child.clone()
+	}
+	if n.Children == nil {
+		c.Children = nil
+	}
+	return &c
+}
+
+// lookup 按路径找节点
+func (n *node) lookup(path string) (*node, error) {
+	cur := n
+	for _, name := range strings.Split(strings.Trim(stdpath.Clean("/"+path), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if !cur.isDir() {
+			return nil, errors.Errorf("object not found: %s", path)
+		}
+		if cur = cur.child(name); cur == nil {
+			return nil, errors.Errorf("object not found: %s", path)
+		}
+	}
+	return cur, nil
+}
+
+// add 把c放进目录n，校验名字
+func (n *node) add(c *node) error {
+	if !validName(c.Name) {
+		return errors.Errorf("invalid name: %q", c.Name)
+	}
+	if n.child(c.Name) != nil {
+		return errors.Errorf("object already exists: %s", c.Name)
+	}
+	n.Children = append(n.Children, c)
+	return nil
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\r\n")
+}
+
+// nameFromURL 没写名字时用地址的最后一段，连这个都没有就用域名
+func nameFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if name := stdpath.Base(u.Path); validName(name) {
+		return name
+	}
+	return u.Host
+}
+
+// 文本格式，每层缩进两个空格（缩进多少都行，只看比上一行多还是少）：
+//
+//	https://example.com/a.mp4
+//	b.mp4:https://example.com/b
+//	folder:
+//	  c.iso:1048576:https://example.com/c.iso
+//	  d.iso:1048576:1759300000:https://example.com/d.iso
+//	  sub:
+//	    https://example.com/e.txt
+//
+// 以":"结尾、没有地址的行是目录；地址前面依次可以写名字、大小、修改时间（unix秒）。
+// 空行和#开头的行会被忽略，改动后重新生成时不会保留
+var schemeRe = regexp.MustCompile(`[A-Za-z][A-Za-z0-9+.-]*://`)
+
+func parseText(text string) (*node, error) {
+	root := &node{}
+	type level struct {
+		indent int
+		dir    *node
+	}
+	stack := []level{{-1, root}}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		for stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		n, err := parseLine(trimmed)
+		if err == nil {
+			err = stack[len(stack)-1].dir.add(n)
+		}
+		if err != nil {
+			return nil, errors.WithMessagef(err, "line %d", i+1)
+		}
+		if n.isDir() {
+			stack = append(stack, level{indent, n})
+		}
+	}
+	return root, nil
+}
+
+func parseLine(line string) (*node, error) {
+	loc := schemeRe.FindStringIndex(line)
+	if loc == nil {
+		name, ok := strings.CutSuffix(line, ":")
+		if !ok {
+			return nil, errors.Errorf("neither a folder nor an url: %s", line)
+		}
+		return &node{Name: name}, nil
+	}
+	n := &node{URL: line[loc[0]:]}
+	var fields []string
+	if prefix := strings.TrimSuffix(line[:loc[0]], ":"); prefix != "" {
+		fields = strings.Split(prefix, ":")
+	}
+	if len(fields) > 3 {
+		return nil, errors.Errorf("too many fields before the url: %s", line)
+	}
+	var err error
+	if len(fields) > 0 {
+		n.Name = strings.TrimSpace(fields[0])
+	}
+	if len(fields) > 1 {
+		if n.Size, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return nil, errors.Errorf("invalid size: %s", fields[1])
+		}
+	}
+	if len(fields) > 2 {
+		if n.Modified, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+			return nil, errors.Errorf("invalid modified time: %s", fields[2])
+		}
+	}
+	if n.Name == "" {
+		n.Name = nameFromURL(n.URL)
+	}
+	return n, nil
+}
+
+func writeText(b *strings.Builder, n *node, depth int) {
+	for _, c := range n.Children {
+		b.WriteString(strings.Repeat("  ", depth))
+		switch {
+		case c.isDir():
+			b.WriteString(c.Name + ":\n")
+			writeText(b, c, depth+1)
+			continue
+		case c.Modified != 0:
+			b.WriteString(c.Name + ":" + strconv.FormatInt(c.Size, 10) + ":" + strconv.FormatInt(c.Modified, 10) + ":")
+		case c.Size != 0:
+			b.WriteString(c.Name + ":" + strconv.FormatInt(c.Size, 10) + ":")
+		case c.Name != nameFromURL(c.URL):
+			b.WriteString(c.Name + ":")
+		}
+		b.WriteString(c.URL + "\n")
+	}
+}
+
+func parseJSON(text string) (*node, error) {
+	root := &node{}
+	if err := json.Unmarshal([]byte(text), &root.Children); err != nil {
+		return nil, errors.Wrap(err, "invalid json structure")
+	}
+	// 检查名字、补全省略的名字，顺便把目录重建一遍以检查重名
+	var check func(dir *node) error
+	check = func(dir *node) error {
+		children := dir.Children
+		dir.Children = nil
+		for _, c := range children {
+			if !c.isDir() && c.Name == "" {
+				c.Name = nameFromURL(c.URL)
+			}
+			if err := dir.add(c); err != nil {
+				return err
+			}
+			if c.isDir() {
+				if err := check(c); err != nil {
+					return errors.WithMessage(err, c.Name)
+				}
+			}
+		}
+		return nil
+	}
+	if err := check(root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// isJSON 以"["开头的就是JSON格式
+func isJSON(text string) bool {
+	return strings.HasPrefix(strings.TrimSpace(text), "[")
+}
+
+// marshal 按原来的格式重新生成结构
+func marshal(root *node, asJSON bool) (string, error) {
+	if asJSON {
+		children := root.Children
+		if children == nil {
+			children = []*node{}
+		}
+		data, err := json.MarshalIndent(children, "", "  ")
+		return string(data), errors.WithStack(err)
+	}
+	var b strings.Builder
+	writeText(&b, root, 0)
+	return b.String(), nil
+}
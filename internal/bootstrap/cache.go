@@ -0,0 +1,26 @@
+package bootstrap
+
+import (
+	"HelaList/configs"
+	"HelaList/internal/redis"
+	"log"
+)
+
+// InitListCache 按配置准备目录列表缓存要用的Redis，返回nil表示用内存缓存。
+// op经repository引用了bootstrap，这里不能反过来引用op，由调用方交给op.SetListCache。要在加载存储之前调用
+func InitListCache() *redis.Service {
+	switch configs.Conf.Cache.ListCache {
+	case configs.ListCacheRedis:
+		if redis.RedisService == nil {
+			InitRedis()
+		}
+		if redis.RedisService != nil {
+			return redis.RedisService
+		}
+		log.Println("Redis is unavailable, list cache falls back to memory")
+	case configs.ListCacheMemory, "":
+	default:
+		log.Printf("unknown list cache %q, using memory", configs.Conf.Cache.ListCache)
+	}
+	return nil
+}
@@ -137,6 +137,12 @@ type PutURLResult interface {
 	PutURL(ctx context.Context, dstDir model.Obj, name, url string) (model.Obj, error)
 }
 
+// RapidUpload 秒传：存储里已经有内容一样的文件时，凭file带的哈希直接建出新文件，不读file。
+// 存储里没有时返回false，调用方再走普通上传。op层只在哈希可信(model.HashTrusted)时才会调用
+type RapidUpload interface {
+	RapidUpload(ctx context.Context, dstDir model.Obj, file model.FileStreamer) (model.Obj, bool, error)
+}
+
 type Other interface {
 	Other(ctx context.Context, args model.OtherArgs) (interface{}, error)
 }
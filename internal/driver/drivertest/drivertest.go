@@ -0,0 +1,429 @@
+// Package drivertest 驱动的一致性测试。驱动包在自己的测试里初始化好一个驱动，交给Run就行：
+//
+//	func TestConformance(t *testing.T) {
+//		d := &Local{}
+//		... // SetStorage、填Addition、Init
+//		drivertest.Run(t, d)
+//	}
+//
+// 测试只通过internal/driver里的接口调用驱动，和op层一样优先用带Result的版本，
+// 驱动没实现的可选接口对应的子测试会被跳过。写入类的测试都在根目录下新建的临时目录里进行，结束后删掉
+package drivertest
+
+import (
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/stream"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	stdpath "path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+)
+
+// Run 对已经初始化好的驱动跑一遍一致性测试
+func Run(t *testing.T, d driver.Driver) {
+	t.Helper()
+	s := &suite{d: d, ctx: context.Background()}
+	root := s.root(t)
+	if !root.IsDir() {
+		t.Fatalf("root is not a folder")
+	}
+	t.Run("ListRoot", func(t *testing.T) {
+		s.list(t, root, "/")
+	})
+	if !s.writable() {
+		t.Log("driver can not make dirs, put and remove, skip write tests")
+		return
+	}
+
+	name := "drivertest-" + randomHex(4)
+	base := s.mkdir(t, root, "/", name)
+	basePath := "/" + name
+	t.Cleanup(func() {
+		if err := s.remove(base); err != nil {
+			t.Logf("failed clean up %s: %v", basePath, err)
+		}
+	})
+
+	t.Run("MakeDir", func(t *testing.T) {
+		dir := s.mkdir(t, base, basePath, "dir")
+		if !dir.IsDir() {
+			t.Fatalf("new dir is not a folder")
+		}
+		sub := s.mkdir(t, dir, stdpath.Join(basePath, "dir"), "中文 目录")
+		if sub.GetName() != "中文 目录" {
+			t.Fatalf("unexpected name %q", sub.GetName())
+		}
+		s.mustFind(t, dir, stdpath.Join(basePath, "dir"), "中文 目录", true)
+	})
+
+	t.Run("PutAndLink", func(t *testing.T) {
+		data := []byte("hello, drivertest")
+		s.put(t, base, basePath, "hello.txt", data)
+		obj := s.mustFind(t, base, basePath, "hello.txt", false)
+		if obj.GetSize() != int64(len(data)) {
+			t.Fatalf("size = %d, want %d", obj.GetSize(), len(data))
+		}
+		s.checkContent(t, obj, data)
+		s.checkRange(t, obj, data, 7, 5)
+		s.checkRange(t, obj, data, 7, -1)
+	})
+
+	t.Run("PutOverwrite", func(t *testing.T) {
+		s.put(t, base, basePath, "over.txt", []byte("first version"))
+		s.put(t, base, basePath, "over.txt", []byte("second"))
+		var n int
+		for _, obj := range s.list(t, base, basePath) {
+			if obj.GetName() == "over.txt" {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Fatalf("found %d over.txt after overwrite", n)
+		}
+		s.checkContent(t, s.mustFind(t, base, basePath, "over.txt", false), []byte("second"))
+	})
+
+	t.Run("PutEmpty", func(t *testing.T) {
+		s.put(t, base, basePath, "empty", nil)
+		obj := s.mustFind(t, base, basePath, "empty", false)
+		if obj.GetSize() != 0 {
+			t.Fatalf("size = %d, want 0", obj.GetSize())
+		}
+		s.checkContent(t, obj, nil)
+	})
+
+	t.Run("PutLarge", func(t *testing.T) {
+		data := make([]byte, 3<<20+17)
+		_, _ = rand.Read(data)
+		s.put(t, base, basePath, "large.bin", data)
+		obj := s.mustFind(t, base, basePath, "large.bin", false)
+		s.checkContent(t, obj, data)
+		s.checkRange(t, obj, data, 1<<20+3, 1<<20)
+	})
+
+	t.Run("Getter", func(t *testing.T) {
+		g, ok := d.(driver.Getter)
+		if !ok {
+			t.Skip("driver does not implement Getter")
+		}
+		s.put(t, base, basePath, "get.txt", []byte("get"))
+		obj, err := g.Get(s.ctx, stdpath.Join(basePath, "get.txt"))
+		if err != nil {
+			t.Fatalf("get: %+v", err)
+		}
+		if obj.GetName() != "get.txt" || obj.IsDir() || obj.GetSize() != 3 {
+			t.Fatalf("unexpected obj %s, dir %v, size %d", obj.GetName(), obj.IsDir(), obj.GetSize())
+		}
+		_, err = g.Get(s.ctx, stdpath.Join(basePath, "missing"))
+		if err == nil || !strings.Contains(err.Error(), "object not found") {
+			t.Fatalf("get missing object: want object not found, got %v", err)
+		}
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		if !implements[driver.Rename](d) && !implements[driver.RenameResult](d) {
+			t.Skip("driver does not implement Rename")
+		}
+		s.put(t, base, basePath, "old.txt", []byte("rename me"))
+		obj := s.mustFind(t, base, basePath, "old.txt", false)
+		s.rename(t, obj, "new.txt")
+		s.mustNotFind(t, base, basePath, "old.txt")
+		s.checkContent(t, s.mustFind(t, base, basePath, "new.txt", false), []byte("rename me"))
+	})
+
+	t.Run("Move", func(t *testing.T) {
+		if !implements[driver.Move](d) && !implements[driver.MoveResult](d) {
+			t.Skip("driver does not implement Move")
+		}
+		dst := s.mkdir(t, base, basePath, "move-dst")
+		dstPath := stdpath.Join(basePath, "move-dst")
+		s.put(t, base, basePath, "move.txt", []byte("move me"))
+		s.move(t, s.mustFind(t, base, basePath, "move.txt", false), dst)
+		s.mustNotFind(t, base, basePath, "move.txt")
+		s.checkContent(t, s.mustFind(t, dst, dstPath, "move.txt", false), []byte("move me"))
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		if !implements[driver.Copy](d) && !implements[driver.CopyResult](d) {
+			t.Skip("driver does not implement Copy")
+		}
+		src := s.mkdir(t, base, basePath, "copy-src")
+		srcPath := stdpath.Join(basePath, "copy-src")
+		s.put(t, src, srcPath, "a.txt", []byte("copy me"))
+		dst := s.mkdir(t, base, basePath, "copy-dst")
+		dstPath := stdpath.Join(basePath, "copy-dst")
+		s.copy(t, src, dst)
+		s.mustFind(t, base, basePath, "copy-src", true)
+		copied := s.mustFind(t, dst, dstPath, "copy-src", true)
+		s.checkContent(t, s.mustFind(t, copied, stdpath.Join(dstPath, "copy-src"), "a.txt", false), []byte("copy me"))
+		s.checkContent(t, s.mustFind(t, src, srcPath, "a.txt", false), []byte("copy me"))
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		dir := s.mkdir(t, base, basePath, "remove-dir")
+		s.put(t, dir, stdpath.Join(basePath, "remove-dir"), "inner.txt", []byte("x"))
+		s.put(t, base, basePath, "remove.txt", []byte("x"))
+		if err := s.remove(s.mustFind(t, base, basePath, "remove.txt", false)); err != nil {
+			t.Fatalf("remove file: %+v", err)
+		}
+		if err := s.remove(dir); err != nil {
+			t.Fatalf("remove non-empty dir: %+v", err)
+		}
+		s.mustNotFind(t, base, basePath, "remove.txt")
+		s.mustNotFind(t, base, basePath, "remove-dir")
+	})
+
+	t.Run("PutURL", func(t *testing.T) {
+		p, ok := d.(driver.PutURLResult)
+		if !ok {
+			t.Skip("driver does not implement PutURL")
+		}
+		const url = "https://example.com/file.txt"
+		if _, err := p.PutURL(s.ctx, base, "url.txt", url); err != nil {
+			t.Fatalf("put url: %+v", err)
+		}
+		obj := s.mustFind(t, base, basePath, "url.txt", false)
+		l, err := d.Link(s.ctx, obj, model.LinkArgs{})
+		if err != nil {
+			t.Fatalf("link: %+v", err)
+		}
+		defer l.Close()
+		if l.URL != url {
+			t.Fatalf("link url = %q, want %q", l.URL, url)
+		}
+	})
+}
+
+type suite struct {
+	d   driver.Driver
+	ctx context.Context
+}
+
+func implements[T any](d driver.Driver) bool {
+	_, ok := d.(T)
+	return ok
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *suite) writable() bool {
+	return (implements[driver.Mkdir](s.d) || implements[driver.MkdirResult](s.d)) &&
+		(implements[driver.Put](s.d) || implements[driver.PutResult](s.d)) &&
+		implements[driver.Remove](s.d)
+}
+
+// root 和op.Get取根目录的顺序一样：Getter、GetRooter、再按Addition里的根目录配置
+func (s *suite) root(t *testing.T) model.Obj {
+	t.Helper()
+	if g, ok := s.d.(driver.Getter); ok {
+		if obj, err := g.Get(s.ctx, "/"); err == nil {
+			return obj
+		}
+	}
+	if r, ok := s.d.(driver.GetRooter); ok {
+		obj, err := r.GetRoot(s.ctx)
+		if err != nil {
+			t.Fatalf("get root: %+v", err)
+		}
+		return obj
+	}
+	switch r := s.d.GetAddition().(type) {
+	case driver.IRootPath:
+		return &model.Object{Path: r.GetRootPath(), Name: "root", IsFolder: true}
+	case driver.IRootId:
+		return &model.Object{Id: r.GetRootId(), Name: "root", IsFolder: true}
+	}
+	t.Fatalf("driver has no way to get the root folder")
+	return nil
+}
+
+// list 和op.List一样，驱动没填Path的对象按请求路径补上
+func (s *suite) list(t *testing.T, dir model.Obj, dirPath string) []model.Obj {
+	t.Helper()
+	objs, err := s.d.List(s.ctx, dir, model.ListArgs{ReqPath: dirPath, Refresh: true})
+	if err != nil {
+		t.Fatalf("list %s: %+v", dirPath, err)
+	}
+	for _, obj := range objs {
+		if sp, ok := obj.(model.SetPath); ok && obj.GetPath() == "" {
+			sp.SetPath(stdpath.Join(dirPath, obj.GetName()))
+		}
+	}
+	return objs
+}
+
+func (s *suite) find(t *testing.T, dir model.Obj, dirPath, name string) model.Obj {
+	t.Helper()
+	for _, obj := range s.list(t, dir, dirPath) {
+		if obj.GetName() == name {
+			return obj
+		}
+	}
+	return nil
+}
+
+func (s *suite) mustFind(t *testing.T, dir model.Obj, dirPath, name string, isDir bool) model.Obj {
+	t.Helper()
+	obj := s.find(t, dir, dirPath, name)
+	if obj == nil {
+		t.Fatalf("%s not found in %s", name, dirPath)
+	}
+	if obj.IsDir() != isDir {
+		t.Fatalf("%s: is dir = %v, want %v", name, obj.IsDir(), isDir)
+	}
+	return obj
+}
+
+func (s *suite) mustNotFind(t *testing.T, dir model.Obj, dirPath, name string) {
+	t.Helper()
+	if s.find(t, dir, dirPath, name) != nil {
+		t.Fatalf("%s should not exist in %s", name, dirPath)
+	}
+}
+
+func (s *suite) mkdir(t *testing.T, parent model.Obj, parentPath, name string) model.Obj {
+	t.Helper()
+	var err error
+	switch m := s.d.(type) {
+	case driver.MkdirResult:
+		var obj model.Obj
+		if obj, err = m.MakeDir(s.ctx, parent, name); err == nil && obj != nil {
+			return obj
+		}
+	case driver.Mkdir:
+		err = m.MakeDir(s.ctx, parent, name)
+	}
+	if err != nil {
+		t.Fatalf("make dir %s in %s: %+v", name, parentPath, err)
+	}
+	return s.mustFind(t, parent, parentPath, name, true)
+}
+
+func (s *suite) put(t *testing.T, dir model.Obj, dirPath, name string, data []byte) {
+	t.Helper()
+	file := &stream.FileStream{
+		Ctx: s.ctx,
+		Obj: &model.Object{
+			Name:         name,
+			Size:         int64(len(data)),
+			ModifiedTime: time.Now(),
+		},
+		Reader:   bytes.NewReader(data),
+		Mimetype: "application/octet-stream",
+	}
+	var last float64
+	up := func(p float64) {
+		if p < last {
+			t.Errorf("progress went back from %v to %v", last, p)
+		}
+		last = p
+	}
+	var err error
+	switch p := s.d.(type) {
+	case driver.PutResult:
+		_, err = p.Put(s.ctx, dir, file, up)
+	case driver.Put:
+		err = p.Put(s.ctx, dir, file, up)
+	}
+	_ = file.Close()
+	if err != nil {
+		t.Fatalf("put %s to %s: %+v", name, dirPath, err)
+	}
+}
+
+func (s *suite) rename(t *testing.T, obj model.Obj, name string) {
+	t.Helper()
+	var err error
+	switch r := s.d.(type) {
+	case driver.RenameResult:
+		_, err = r.Rename(s.ctx, obj, name)
+	case driver.Rename:
+		err = r.Rename(s.ctx, obj, name)
+	}
+	if err != nil {
+		t.Fatalf("rename %s to %s: %+v", obj.GetName(), name, err)
+	}
+}
+
+func (s *suite) move(t *testing.T, obj, dstDir model.Obj) {
+	t.Helper()
+	var err error
+	switch m := s.d.(type) {
+	case driver.MoveResult:
+		_, err = m.Move(s.ctx, obj, dstDir)
+	case driver.Move:
+		err = m.Move(s.ctx, obj, dstDir)
+	}
+	if err != nil {
+		t.Fatalf("move %s to %s: %+v", obj.GetName(), dstDir.GetName(), err)
+	}
+}
+
+func (s *suite) copy(t *testing.T, obj, dstDir model.Obj) {
+	t.Helper()
+	var err error
+	switch c := s.d.(type) {
+	case driver.CopyResult:
+		_, err = c.Copy(s.ctx, obj, dstDir)
+	case driver.Copy:
+		err = c.Copy(s.ctx, obj, dstDir)
+	}
+	if err != nil {
+		t.Fatalf("copy %s to %s: %+v", obj.GetName(), dstDir.GetName(), err)
+	}
+}
+
+func (s *suite) remove(obj model.Obj) error {
+	return s.d.(driver.Remove).Remove(s.ctx, obj)
+}
+
+func (s *suite) read(t *testing.T, obj model.Obj, httpRange http_range.Range) []byte {
+	t.Helper()
+	l, err := s.d.Link(s.ctx, obj, model.LinkArgs{})
+	if err != nil {
+		t.Fatalf("link %s: %+v", obj.GetName(), err)
+	}
+	defer l.Close()
+	rc, err := stream.RangeReadLink(s.ctx, l, httpRange)
+	if err != nil {
+		t.Fatalf("open %s: %+v", obj.GetName(), err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read %s: %+v", obj.GetName(), err)
+	}
+	return data
+}
+
+func (s *suite) checkContent(t *testing.T, obj model.Obj, want []byte) {
+	t.Helper()
+	if got := s.read(t, obj, http_range.Range{Length: -1}); !bytes.Equal(got, want) {
+		t.Fatalf("content of %s differs: got %d bytes, want %d bytes", obj.GetName(), len(got), len(want))
+	}
+}
+
+// checkRange length为-1时读到文件结尾
+func (s *suite) checkRange(t *testing.T, obj model.Obj, data []byte, start, length int64) {
+	t.Helper()
+	want := data[start:]
+	if length >= 0 {
+		want = want[:length]
+	}
+	got := s.read(t, obj, http_range.Range{Start: start, Length: length})
+	if !bytes.Equal(got, want) {
+		t.Fatalf("range [%d, +%d) of %s differs: got %d bytes, want %d bytes", start, length, obj.GetName(), len(got), len(want))
+	}
+}
@@ -0,0 +1,60 @@
+package drivertest
+
+import (
+	"HelaList/internal/bootstrap"
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+var (
+	dbOnce sync.Once
+	dbErr  error
+)
+
+// SetupDB 存储配置要存进数据库，测试里换成内存sqlite，表和cmd/server里迁移的一样，
+// 别的包(任务、WebDAV属性)的测试也用它。连接池里每个连接默认各开一个空库，所以要cache=shared
+func SetupDB(t testing.TB) {
+	t.Helper()
+	dbOnce.Do(func() {
+		var db *gorm.DB
+		db, dbErr = gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+		if dbErr == nil {
+			dbErr = db.AutoMigrate(&model.User{}, &model.Storage{}, &model.DeadProp{}, &model.Task{})
+		}
+		if dbErr == nil {
+			bootstrap.Db = db
+		}
+	})
+	// 出错了每个测试都要失败，不能只有第一个
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+}
+
+// Mount 通过op.CreateStorage挂载存储，返回加载好的驱动。
+// Driver不填就是memory(调用方要导入drivers/memory)，Addition不填就是"{}"
+func Mount(t testing.TB, storage model.Storage) driver.Driver {
+	t.Helper()
+	SetupDB(t)
+	if storage.Driver == "" {
+		storage.Driver = "memory"
+	}
+	if storage.Addition == "" {
+		storage.Addition = "{}"
+	}
+	if _, err := op.CreateStorage(context.Background(), storage); err != nil {
+		t.Fatal(err)
+	}
+	d, err := op.GetStorageByMountPath(storage.MountPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
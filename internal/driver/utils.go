@@ -22,7 +22,10 @@ type Progress struct {
 func (p *Progress) Write(b []byte) (n int, err error) {
 	n = len(b)
 	p.Done += int64(n)
-	p.up(float64(p.Done) / float64(p.Total) * 100)
+	if p.Total > 0 {
+		// 大小未知时不报进度，避免除零
+		p.up(float64(p.Done) / float64(p.Total) * 100)
+	}
 	return
 }
 
@@ -0,0 +1,878 @@
+package fs
+
+import (
+	"HelaList/configs"
+	"HelaList/internal/model"
+	"HelaList/internal/stream"
+	"HelaList/internal/task"
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	stdpath "path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 解压和压缩。解压分两步：先把压缩包解到本地临时目录（Decompress任务），
+// 再把临时目录上传到目标路径（DecompressUpload任务），这样上传失败重试时不用重新解压。
+// 压缩是把选中的对象打包成本地临时文件，再上传到目标目录
+
+// 目标位置已经有同名对象时的处理方式。同名的目录总是合并
+const (
+	ConflictOverwrite = "overwrite" // 覆盖已有的文件
+	ConflictSkip      = "skip"      // 保留已有的，跳过这一个
+	ConflictRename    = "rename"    // 新的改名为"name (n).ext"
+)
+
+// DecompressArgs 解压参数。会作为任务参数存进数据库，压缩包的密码除外
+type DecompressArgs struct {
+	SrcPath       string `json:"src_path"`
+	DstDirPath    string `json:"dst_dir_path"`
+	Password      string `json:"-"` // 只放在内存里，见archivePasswords
+	Conflict      string `json:"conflict"`
+	PutIntoNewDir bool   `json:"put_into_new_dir"` // 解压到以压缩包命名的新目录里
+}
+
+// CompressArgs 压缩参数，Name的扩展名决定格式：.zip或者.tar.gz/.tgz
+type CompressArgs struct {
+	SrcPaths   []string `json:"src_paths"`
+	DstDirPath string   `json:"dst_dir_path"`
+	Name       string   `json:"name"`
+	Conflict   string   `json:"conflict"`
+}
+
+// decompressPayload 解压任务存进数据库的参数，密码换成archivePasswords里的key
+type decompressPayload struct {
+	DecompressArgs
+	PasswordKey string `json:"password_key,omitempty"`
+}
+
+// archivePasswords 解压任务用到的密码，不落库。重启后密码就没了，带密码的任务要重新提交
+var archivePasswords sync.Map
+
+func newDecompressPayload(args DecompressArgs) decompressPayload {
+	p := decompressPayload{DecompressArgs: args}
+	if args.Password != "" {
+		p.PasswordKey = uuid.NewString()
+		archivePasswords.Store(p.PasswordKey, args.Password)
+	}
+	return p
+}
+
+// args 取回内存里的密码
+func (p decompressPayload) args() (DecompressArgs, error) {
+	args := p.DecompressArgs
+	if p.PasswordKey != "" {
+		password, ok := archivePasswords.Load(p.PasswordKey)
+		if !ok {
+			return args, errors.New("archive password is lost after restart, submit the task again")
+		}
+		args.Password = password.(string)
+	}
+	return args, nil
+}
+
+type decompressUploadPayload struct {
+	TmpDir     string `json:"tmp_dir"`
+	DstDirPath string `json:"dst_dir_path"`
+	Conflict   string `json:"conflict"`
+}
+
+const (
+	formatZip   = "zip"
+	formatTar   = "tar"
+	formatTarGz = "tar.gz"
+)
+
+// archiveFormat 按扩展名判断压缩包格式，不认识的返回空字符串
+func archiveFormat(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return formatZip
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return formatTarGz
+	case strings.HasSuffix(name, ".tar"):
+		return formatTar
+	}
+	return ""
+}
+
+// splitExt 拆出扩展名，.tar.gz算作一个整体
+func splitExt(name string) (string, string) {
+	if strings.HasSuffix(strings.ToLower(name), ".tar.gz") {
+		return name[:len(name)-7], name[len(name)-7:]
+	}
+	ext := stdpath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		// .bashrc这种没有主名的
+		return name, ""
+	}
+	return base, ext
+}
+
+func checkConflict(conflict *string) error {
+	switch *conflict {
+	case ConflictOverwrite, ConflictSkip, ConflictRename:
+	case "":
+		*conflict = ConflictRename
+	default:
+		return errors.Errorf("unknown conflict policy: %s", *conflict)
+	}
+	return nil
+}
+
+// resolveConflict 决定要写到dirPath下的name实际用什么名字，skip为true表示跳过
+func resolveConflict(ctx context.Context, dirPath, name string, isDir bool, conflict string) (string, bool, error) {
+	existing, err := get(ctx, stdpath.Join(dirPath, name))
+	if err != nil {
+		if strings.Contains(err.Error(), "object not found") {
+			return name, false, nil
+		}
+		return "", false, err
+	}
+	if existing.IsDir() && isDir {
+		return name, false, nil
+	}
+	switch conflict {
+	case ConflictSkip:
+		return "", true, nil
+	case ConflictOverwrite:
+		// 文件直接上传就会覆盖，只有文件和目录互相顶替时要先删掉旧的
+		if existing.IsDir() != isDir {
+			if err = remove(ctx, stdpath.Join(dirPath, name)); err != nil {
+				return "", false, err
+			}
+		}
+		return name, false, nil
+	}
+	base, ext := splitExt(name)
+	for n := 1; ; n++ {
+		renamed := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if _, err = get(ctx, stdpath.Join(dirPath, renamed)); err != nil {
+			if strings.Contains(err.Error(), "object not found") {
+				return renamed, false, nil
+			}
+			return "", false, err
+		}
+	}
+}
+
+// reporter 汇报进度，*task.Task实现了它，同步执行时用nopReporter
+type reporter interface {
+	SetStatus(status string)
+	SetProgress(p float64)
+}
+
+type nopReporter struct{}
+
+func (nopReporter) SetStatus(string)    {}
+func (nopReporter) SetProgress(float64) {}
+
+// progress 按字节数统计多个文件合起来的总进度
+type progress struct {
+	rep   reporter
+	total int64
+	done  int64
+}
+
+func (p *progress) add(n int64) {
+	p.done += n
+	if p.total > 0 {
+		p.rep.SetProgress(float64(p.done) / float64(p.total) * 100)
+	}
+}
+
+func (p *progress) reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, p: p}
+}
+
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.p.add(int64(n))
+	return n, err
+}
+
+// localPath 把压缩包里的路径映射到dir下，去掉..之类的，不让文件解压到dir外面
+func localPath(dir, name string) (string, bool) {
+	clean := stdpath.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	if clean == "/" {
+		return "", false
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), true
+}
+
+// decodeZipName Windows上打的zip文件名经常是GBK编码，不是合法的UTF-8时按GB18030解码
+func decodeZipName(name string) string {
+	if utf8.ValidString(name) {
+		return name
+	}
+	if decoded, err := simplifiedchinese.GB18030.NewDecoder().String(name); err == nil {
+		return decoded
+	}
+	return name
+}
+
+var (
+	errEntryTooLarge   = errors.New("entry is larger than its declared size")
+	errArchiveTooLarge = errors.New("archive is too large to extract")
+)
+
+// extractQuota 整个压缩包还能解出来多少字节，上限是configs.MaxExtractSize
+type extractQuota struct {
+	remain int64
+}
+
+func newExtractQuota() *extractQuota {
+	return &extractQuota{remain: configs.MaxExtractSize}
+}
+
+// reader 单个条目最多读size字节，同时扣总额度。不管头里写的大小，超出时报错而不是截断
+func (q *extractQuota) reader(r io.Reader, size int64) io.Reader {
+	return &quotaReader{r: r, entry: size, q: q}
+}
+
+type quotaReader struct {
+	r     io.Reader
+	entry int64
+	q     *extractQuota
+}
+
+func (r *quotaReader) Read(p []byte) (int, error) {
+	// 最多多读一个字节，刚好能发现超出
+	if limit := min(r.entry, r.q.remain) + 1; int64(len(p)) > limit {
+		p = p[:limit]
+	}
+	n, err := r.r.Read(p)
+	r.entry -= int64(n)
+	r.q.remain -= int64(n)
+	if r.entry < 0 {
+		return n, errEntryTooLarge
+	}
+	if r.q.remain < 0 {
+		return n, errArchiveTooLarge
+	}
+	return n, err
+}
+
+// writeLocalFile 把r写到path，返回写入内容的CRC32
+func writeLocalFile(path string, r io.Reader) (uint32, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	h := crc32.NewIEEE()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return h.Sum32(), nil
+}
+
+func decompress(ctx context.Context, args DecompressArgs) (*task.Task, error) {
+	if err := checkConflict(&args.Conflict); err != nil {
+		return nil, err
+	}
+	srcObj, err := get(ctx, args.SrcPath)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed get src [%s]", args.SrcPath)
+	}
+	if srcObj.IsDir() || archiveFormat(srcObj.GetName()) == "" {
+		return nil, errors.Errorf("not a supported archive: %s", args.SrcPath)
+	}
+	if m := task.GetManager(task.Decompress); m != nil && ctx.Value(configs.NoTaskKey) == nil {
+		return m.Submit(ctx, fmt.Sprintf("decompress %s to %s", args.SrcPath, args.DstDirPath), newDecompressPayload(args))
+	}
+	tmpDir, err := extract(ctx, args, nopReporter{})
+	if err != nil {
+		return nil, err
+	}
+	err = uploadExtracted(ctx, decompressUploadPayload{
+		TmpDir:     tmpDir,
+		DstDirPath: args.DstDirPath,
+		Conflict:   args.Conflict,
+	}, nopReporter{})
+	if err != nil {
+		// 同步执行不会重试，临时目录直接清掉
+		_ = os.RemoveAll(tmpDir)
+	}
+	return nil, err
+}
+
+func runDecompressTask(t *task.Task) error {
+	var p decompressPayload
+	if err := t.Decode(&p); err != nil {
+		return err
+	}
+	args, err := p.args()
+	if err != nil {
+		return err
+	}
+	tmpDir, err := extract(t.Ctx(), args, t)
+	if err != nil {
+		return err
+	}
+	// 解压完就用不到密码了，失败重试时还要用所以留到这里才删
+	archivePasswords.Delete(p.PasswordKey)
+	payload := decompressUploadPayload{
+		TmpDir:     tmpDir,
+		DstDirPath: args.DstDirPath,
+		Conflict:   args.Conflict,
+	}
+	m := task.GetManager(task.DecompressUpload)
+	if m == nil {
+		return uploadExtracted(t.Ctx(), payload, t)
+	}
+	if _, err = m.Submit(t.Ctx(), fmt.Sprintf("upload extracted %s to %s", stdpath.Base(args.SrcPath), args.DstDirPath), payload); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return err
+	}
+	t.SetStatus("extracted, uploading in another task")
+	return nil
+}
+
+func runDecompressUploadTask(t *task.Task) error {
+	var p decompressUploadPayload
+	if err := t.Decode(&p); err != nil {
+		return err
+	}
+	return uploadExtracted(t.Ctx(), p, t)
+}
+
+// extract 把压缩包解到新建的临时目录里并返回这个目录，失败时临时目录会被删掉
+func extract(ctx context.Context, args DecompressArgs, rep reporter) (string, error) {
+	srcObj, err := get(ctx, args.SrcPath)
+	if err != nil {
+		return "", errors.WithMessagef(err, "failed get src [%s]", args.SrcPath)
+	}
+	l, _, err := link(ctx, args.SrcPath, model.LinkArgs{})
+	if err != nil {
+		return "", errors.WithMessagef(err, "failed link src [%s]", args.SrcPath)
+	}
+	defer l.Close()
+	tmpDir, err := os.MkdirTemp("", "helalist-decompress-*")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	dir := tmpDir
+	if args.PutIntoNewDir {
+		base, _ := splitExt(srcObj.GetName())
+		dir = filepath.Join(tmpDir, base)
+		if err = os.MkdirAll(dir, 0o755); err != nil {
+			_ = os.RemoveAll(tmpDir)
+			return "", errors.WithStack(err)
+		}
+	}
+	switch format := archiveFormat(srcObj.GetName()); format {
+	case formatZip:
+		err = extractZip(ctx, l, srcObj.GetSize(), args.Password, dir, rep)
+	case formatTar, formatTarGz:
+		err = extractTar(ctx, l, srcObj.GetSize(), format == formatTarGz, dir, rep)
+	default:
+		err = errors.Errorf("not a supported archive: %s", args.SrcPath)
+	}
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return "", errors.WithMessagef(err, "failed extract [%s]", args.SrcPath)
+	}
+	return tmpDir, nil
+}
+
+// extractZip 目录用范围读取拿到，每个文件的压缩数据再单独请求一次，进度按压缩后的字节数算
+func extractZip(ctx context.Context, l *model.Link, size int64, password, dir string, rep reporter) error {
+	zr, err := zip.NewReader(stream.NewLinkReaderAt(ctx, l, size), size)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	p := &progress{rep: rep}
+	var declared uint64
+	for _, f := range zr.File {
+		p.total += int64(f.CompressedSize64)
+		declared += f.UncompressedSize64
+	}
+	// 头里写的大小只用来提前拒绝，实际解出来的字节数在quota里另算
+	if declared > uint64(configs.MaxExtractSize) {
+		return errArchiveTooLarge
+	}
+	quota := newExtractQuota()
+	for i, f := range zr.File {
+		if utils.IsCanceled(ctx) {
+			return ctx.Err()
+		}
+		name := decodeZipName(f.Name)
+		path, ok := localPath(dir, name)
+		if !ok {
+			continue
+		}
+		rep.SetStatus(fmt.Sprintf("extracting %s (%d/%d)", name, i+1, len(zr.File)))
+		mode := f.Mode()
+		if mode.IsDir() {
+			if err = os.MkdirAll(path, 0o755); err != nil {
+				return errors.WithStack(err)
+			}
+			continue
+		}
+		if mode&os.ModeSymlink != 0 {
+			// 符号链接不解压。zip里其他的模式位不太可靠，都当普通文件
+			p.add(int64(f.CompressedSize64))
+			continue
+		}
+		if err = extractZipFile(ctx, l, f, password, path, p, quota); err != nil {
+			return errors.WithMessagef(err, "failed extract %s", name)
+		}
+		_ = os.Chtimes(path, f.Modified, f.Modified)
+	}
+	return nil
+}
+
+func extractZipFile(ctx context.Context, l *model.Link, f *zip.File, password, path string, p *progress, quota *extractQuota) error {
+	offset, err := f.DataOffset()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	rc, err := stream.RangeReadLink(ctx, l, http_range.Range{Start: offset, Length: int64(f.CompressedSize64)})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	raw, err := decryptZipEntry(f, p.reader(rc), password)
+	if err != nil {
+		return err
+	}
+	method, checkCRC, err := zipEntryMethod(f)
+	if err != nil {
+		return err
+	}
+	var r io.Reader
+	switch method {
+	case zip.Store:
+		r = raw
+	case zip.Deflate:
+		fr := flate.NewReader(raw)
+		defer fr.Close()
+		r = fr
+	default:
+		return errors.Errorf("unsupported compression method %d", method)
+	}
+	sum, err := writeLocalFile(path, quota.reader(r, int64(f.UncompressedSize64)))
+	if err != nil {
+		return err
+	}
+	// 读到结尾才会校验AES的认证码
+	if _, err = io.Copy(io.Discard, raw); err != nil {
+		return errors.WithStack(err)
+	}
+	if checkCRC && sum != f.CRC32 {
+		if f.Flags&zipFlagEncrypted != 0 {
+			return errWrongPassword
+		}
+		return errors.New("checksum mismatch, the archive is corrupted")
+	}
+	return nil
+}
+
+// extractTar tar只能从头顺序读，进度按读过的压缩包字节数算
+func extractTar(ctx context.Context, l *model.Link, size int64, gz bool, dir string, rep reporter) error {
+	rc, err := stream.RangeReadLink(ctx, l, http_range.Range{Length: -1})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	p := &progress{rep: rep, total: size}
+	r := p.reader(rc)
+	if gz {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer gr.Close()
+		r = gr
+	}
+	tr := tar.NewReader(r)
+	quota := newExtractQuota()
+	for n := 1; ; n++ {
+		if utils.IsCanceled(ctx) {
+			return ctx.Err()
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		path, ok := localPath(dir, hdr.Name)
+		if !ok {
+			continue
+		}
+		rep.SetStatus(fmt.Sprintf("extracting %s (%d)", hdr.Name, n))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(path, 0o755); err != nil {
+				return errors.WithStack(err)
+			}
+		case tar.TypeReg:
+			if _, err = writeLocalFile(path, quota.reader(tr, hdr.Size)); err != nil {
+				return errors.WithMessagef(err, "failed extract %s", hdr.Name)
+			}
+			_ = os.Chtimes(path, hdr.ModTime, hdr.ModTime)
+		}
+	}
+}
+
+// uploadExtracted 把临时目录里的内容上传到DstDirPath。上传成功的文件会从临时目录删掉，
+// 重试时只传剩下的；全部成功后删除临时目录
+func uploadExtracted(ctx context.Context, payload decompressUploadPayload, rep reporter) error {
+	u := &extractedUploader{
+		ctx:      ctx,
+		conflict: payload.Conflict,
+		rep:      rep,
+		p:        &progress{rep: rep},
+	}
+	err := filepath.WalkDir(payload.TmpDir, func(_ string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		u.p.total += info.Size()
+		u.count++
+		return nil
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = u.uploadDir(payload.TmpDir, payload.DstDirPath); err != nil {
+		return err
+	}
+	if err = os.RemoveAll(payload.TmpDir); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+type extractedUploader struct {
+	ctx      context.Context
+	conflict string
+	rep      reporter
+	p        *progress
+	count    int
+	index    int
+}
+
+func (u *extractedUploader) uploadDir(localDir, dstDirPath string) error {
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, e := range entries {
+		if utils.IsCanceled(u.ctx) {
+			return u.ctx.Err()
+		}
+		local := filepath.Join(localDir, e.Name())
+		info, err := e.Info()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		name, skip, err := resolveConflict(u.ctx, dstDirPath, e.Name(), e.IsDir(), u.conflict)
+		if err != nil {
+			return err
+		}
+		if e.IsDir() {
+			if skip {
+				continue
+			}
+			dstPath := stdpath.Join(dstDirPath, name)
+			if err = makeDir(u.ctx, dstPath); err != nil {
+				return errors.WithMessagef(err, "failed make dir [%s]", dstPath)
+			}
+			if err = u.uploadDir(local, dstPath); err != nil {
+				return err
+			}
+			continue
+		}
+		u.index++
+		if skip {
+			u.p.add(info.Size())
+			continue
+		}
+		u.rep.SetStatus(fmt.Sprintf("uploading %s (%d/%d)", stdpath.Join(dstDirPath, name), u.index, u.count))
+		if err = u.uploadFile(local, info, dstDirPath, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *extractedUploader) uploadFile(local string, info os.FileInfo, dstDirPath, name string) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fileStream := &stream.FileStream{
+		Ctx: u.ctx,
+		Obj: &model.Object{
+			Name:         name,
+			Size:         info.Size(),
+			ModifiedTime: info.ModTime(),
+		},
+		Reader:   f,
+		Mimetype: utils.GetMimeType(name),
+		Closers:  utils.NewClosers(f),
+	}
+	done, total := u.p.done, u.p.total
+	up := func(percent float64) {
+		if total > 0 {
+			u.rep.SetProgress((float64(done) + percent/100*float64(info.Size())) / float64(total) * 100)
+		}
+	}
+	if err = put(u.ctx, dstDirPath, fileStream, up); err != nil {
+		return errors.WithMessagef(err, "failed put [%s]", stdpath.Join(dstDirPath, name))
+	}
+	u.p.add(info.Size())
+	if err = os.Remove(local); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func compress(ctx context.Context, args CompressArgs) (*task.Task, error) {
+	if err := checkConflict(&args.Conflict); err != nil {
+		return nil, err
+	}
+	if len(args.SrcPaths) == 0 {
+		return nil, errors.New("nothing to compress")
+	}
+	if args.Name == "" || strings.ContainsAny(args.Name, "/\\") {
+		return nil, errors.Errorf("invalid archive name: %s", args.Name)
+	}
+	if format := archiveFormat(args.Name); format != formatZip && format != formatTarGz {
+		return nil, errors.Errorf("archive name must end with .zip, .tar.gz or .tgz: %s", args.Name)
+	}
+	if m := task.GetManager(task.Compress); m != nil && ctx.Value(configs.NoTaskKey) == nil {
+		return m.Submit(ctx, fmt.Sprintf("compress %d items to %s", len(args.SrcPaths), stdpath.Join(args.DstDirPath, args.Name)), args)
+	}
+	return nil, runCompress(ctx, args, nopReporter{})
+}
+
+func runCompressTask(t *task.Task) error {
+	var args CompressArgs
+	if err := t.Decode(&args); err != nil {
+		return err
+	}
+	return runCompress(t.Ctx(), args, t)
+}
+
+// compressEntry 要打包的一个对象，name是它在压缩包里的路径
+type compressEntry struct {
+	path string
+	name string
+	obj  model.Obj
+}
+
+// collectEntries 递归列出srcPath下要打包的所有对象
+func collectEntries(ctx context.Context, srcPath, name string, obj model.Obj, entries []compressEntry) ([]compressEntry, error) {
+	entries = append(entries, compressEntry{path: srcPath, name: name, obj: obj})
+	if !obj.IsDir() {
+		return entries, nil
+	}
+	objs, err := list(ctx, srcPath, &ListArgs{NoLog: true})
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed list [%s]", srcPath)
+	}
+	for _, o := range objs {
+		if entries, err = collectEntries(ctx, stdpath.Join(srcPath, o.GetName()), name+"/"+o.GetName(), o, entries); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// runCompress 先在本地打包成临时文件，再上传到目标目录。选中的对象同名时，后面的在包里加上" (n)"
+func runCompress(ctx context.Context, args CompressArgs, rep reporter) error {
+	var entries []compressEntry
+	used := make(map[string]bool)
+	for _, srcPath := range args.SrcPaths {
+		obj, err := get(ctx, srcPath)
+		if err != nil {
+			return errors.WithMessagef(err, "failed get src [%s]", srcPath)
+		}
+		name := obj.GetName()
+		base, ext := splitExt(name)
+		for n := 1; used[name]; n++ {
+			name = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+		used[name] = true
+		if entries, err = collectEntries(ctx, srcPath, name, obj, entries); err != nil {
+			return err
+		}
+	}
+	// 打包前先看目标位置，跳过的时候就不用白打包了
+	name, skip, err := resolveConflict(ctx, args.DstDirPath, args.Name, false, args.Conflict)
+	if err != nil || skip {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "helalist-compress-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// 重试时会重新打包，临时文件不用留
+	defer os.Remove(tmp.Name())
+	if archiveFormat(args.Name) == formatZip {
+		err = writeZip(ctx, tmp, entries, rep)
+	} else {
+		err = writeTarGz(ctx, tmp, entries, rep)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = errors.WithStack(closeErr)
+	}
+	if err != nil {
+		return errors.WithMessagef(err, "failed compress to %s", args.Name)
+	}
+
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return errors.WithStack(err)
+	}
+	fileStream := &stream.FileStream{
+		Ctx: ctx,
+		Obj: &model.Object{
+			Name:         name,
+			Size:         info.Size(),
+			ModifiedTime: info.ModTime(),
+		},
+		Reader:   f,
+		Mimetype: utils.GetMimeType(name),
+		Closers:  utils.NewClosers(f),
+	}
+	rep.SetStatus("uploading " + stdpath.Join(args.DstDirPath, name))
+	rep.SetProgress(0)
+	if err = put(ctx, args.DstDirPath, fileStream, rep.SetProgress); err != nil {
+		return errors.WithMessagef(err, "failed put [%s]", stdpath.Join(args.DstDirPath, name))
+	}
+	return nil
+}
+
+// addEntries 依次读出每个文件交给write写进压缩包
+func addEntries(ctx context.Context, entries []compressEntry, rep reporter, write func(e compressEntry, r io.Reader) error) error {
+	p := &progress{rep: rep}
+	for _, e := range entries {
+		if !e.obj.IsDir() {
+			p.total += e.obj.GetSize()
+		}
+	}
+	for i, e := range entries {
+		if utils.IsCanceled(ctx) {
+			return ctx.Err()
+		}
+		rep.SetStatus(fmt.Sprintf("compressing %s (%d/%d)", e.name, i+1, len(entries)))
+		if e.obj.IsDir() {
+			if err := write(e, nil); err != nil {
+				return errors.WithStack(err)
+			}
+			continue
+		}
+		l, _, err := link(ctx, e.path, model.LinkArgs{})
+		if err != nil {
+			return errors.WithMessagef(err, "failed link [%s]", e.path)
+		}
+		rc, err := openLink(ctx, l)
+		if err != nil {
+			_ = l.Close()
+			return errors.WithMessagef(err, "failed open [%s]", e.path)
+		}
+		err = write(e, p.reader(rc))
+		_ = rc.Close()
+		_ = l.Close()
+		if err != nil {
+			return errors.WithMessagef(err, "failed compress [%s]", e.path)
+		}
+	}
+	return nil
+}
+
+func writeZip(ctx context.Context, w io.Writer, entries []compressEntry, rep reporter) error {
+	zw := zip.NewWriter(w)
+	err := addEntries(ctx, entries, rep, func(e compressEntry, r io.Reader) error {
+		if r == nil {
+			_, err := zw.CreateHeader(&zip.FileHeader{Name: e.name + "/", Modified: e.obj.GetModifiedTime()})
+			return err
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     e.name,
+			Method:   zip.Deflate,
+			Modified: e.obj.GetModifiedTime(),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fw, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(zw.Close())
+}
+
+func writeTarGz(ctx context.Context, w io.Writer, entries []compressEntry, rep reporter) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	err := addEntries(ctx, entries, rep, func(e compressEntry, r io.Reader) error {
+		hdr := &tar.Header{
+			Name:    e.name,
+			ModTime: e.obj.GetModifiedTime(),
+		}
+		if r == nil {
+			hdr.Typeflag, hdr.Name, hdr.Mode = tar.TypeDir, e.name+"/", 0o755
+			return tw.WriteHeader(hdr)
+		}
+		hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeReg, 0o644, e.obj.GetSize()
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(gw.Close())
+}
@@ -0,0 +1,36 @@
+package fs
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDecompressPayloadKeepsPasswordInMemory(t *testing.T) {
+	p := newDecompressPayload(DecompressArgs{SrcPath: "/a.zip", DstDirPath: "/out", Password: "secret"})
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Fatalf("password is persisted: %s", data)
+	}
+
+	var restored decompressPayload
+	if err = json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+	args, err := restored.args()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args.Password != "secret" || args.SrcPath != "/a.zip" {
+		t.Fatalf("args = %+v", args)
+	}
+
+	// 重启后内存里的密码没了
+	archivePasswords.Delete(restored.PasswordKey)
+	if _, err = restored.args(); err == nil {
+		t.Fatal("lost password should be reported")
+	}
+}
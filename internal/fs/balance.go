@@ -0,0 +1,88 @@
+package fs
+
+import (
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"HelaList/internal/stream"
+	"context"
+	stderrors "errors"
+	"log"
+	stdpath "path"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// tryStorages 负载均衡的几个存储挂在同一路径下时，读失败了换下一个再试。
+// 对象不存在、请求被取消这种换了也一样的错误直接返回
+func tryStorages[T any](ctx context.Context, storages []driver.Driver, fn func(storage driver.Driver) (T, error)) (res T, err error) {
+	for i, storage := range storages {
+		res, err = fn(storage)
+		if err == nil || i == len(storages)-1 || !retryable(ctx, err) {
+			break
+		}
+		log.Printf("storage %s failed, try next: %v", storage.GetStorage().MountPath, err)
+	}
+	return res, err
+}
+
+func retryable(ctx context.Context, err error) bool {
+	return !utils.IsCanceled(ctx) && !strings.Contains(err.Error(), "object not found")
+}
+
+// forWriteStorages 写操作在镜像策略下每个存储都要做一遍，其它策略只有一个。
+// 某个镜像失败了也会继续写剩下的，错误合在一起返回
+func forWriteStorages(path string, fn func(storage driver.Driver, actualPath string) error) error {
+	storages, actualPath, err := op.GetWriteStoragesAndActualPath(path)
+	if err != nil {
+		return errors.WithMessage(err, "failed get storage")
+	}
+	if len(storages) == 1 {
+		return fn(storages[0], actualPath)
+	}
+	var errs []error
+	for _, storage := range storages {
+		if err = fn(storage, actualPath); err != nil {
+			errs = append(errs, errors.WithMessagef(err, "mirror %s", storage.GetStorage().MountPath))
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+// mirrorFile 文件已经写进src之后，从src读出来再写到其它镜像里。上传的流只能读一次
+func mirrorFile(ctx context.Context, src driver.Driver, mirrors []driver.Driver, dirPath, name string, lazyCache ...bool) error {
+	filePath := stdpath.Join(dirPath, name)
+	var errs []error
+	for _, dst := range mirrors {
+		l, obj, err := op.Link(ctx, src, filePath, model.LinkArgs{})
+		if err != nil {
+			return errors.WithMessagef(err, "failed link [%s] on %s", filePath, src.GetStorage().MountPath)
+		}
+		rc, err := openLink(ctx, l)
+		if err != nil {
+			_ = l.Close()
+			return errors.WithMessagef(err, "failed open [%s] on %s", filePath, src.GetStorage().MountPath)
+		}
+		fileStream := &stream.FileStream{
+			Ctx: ctx,
+			Obj: &model.Object{
+				Name:         name,
+				Size:         obj.GetSize(),
+				ModifiedTime: obj.GetModifiedTime(),
+				CreatedTime:  obj.GetCreatedTime(),
+				HashInfo:     obj.GetHash(),
+			},
+			Reader:      rc,
+			Mimetype:    utils.GetMimeType(name),
+			TrustedHash: true,
+		}
+		fileStream.Add(rc)
+		fileStream.Add(l)
+		if err = op.Put(ctx, dst, dirPath, fileStream, nil, lazyCache...); err != nil {
+			errs = append(errs, errors.WithMessagef(err, "mirror %s", dst.GetStorage().MountPath))
+		}
+	}
+	return stderrors.Join(errs...)
+}
@@ -1,55 +1,175 @@
 package fs
 
 import (
+	"HelaList/configs"
+	"HelaList/internal/model"
 	"HelaList/internal/op"
+	"HelaList/internal/stream"
+	"HelaList/internal/task"
 	"context"
 	"fmt"
+	"io"
+	stdpath "path"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
 )
 
-// 在同一存储空间内复制对象。
-func copy(ctx context.Context, srcPath, dstPath string, lazyCache ...bool) error {
-	srcStorage, srcActualPath, err := op.GetStorageAndActualPath(srcPath)
+// 复制对象到dstPath目录下。同一存储交给驱动自己复制，跨存储时走流式复制。
+// 跨存储且ctx里没有NoTaskKey时提交为后台任务，返回对应的任务，否则同步执行并返回nil。
+func copy(ctx context.Context, srcPath, dstPath string, lazyCache ...bool) (*task.Task, error) {
+	srcStorages, srcActualPath, err := op.GetWriteStoragesAndActualPath(srcPath)
 	if err != nil {
-		return fmt.Errorf("failed to get source storage for %s: %w", srcPath, err)
+		return nil, fmt.Errorf("failed to get source storage for %s: %w", srcPath, err)
 	}
 	dstStorage, dstActualPath, err := op.GetStorageAndActualPath(dstPath)
 	if err != nil {
-		return fmt.Errorf("failed to get destination storage for %s: %w", dstPath, err)
+		return nil, fmt.Errorf("failed to get destination storage for %s: %w", dstPath, err)
 	}
 
-	// 仅处理同一存储的情况
-	if srcStorage.GetStorage() == dstStorage.GetStorage() {
-		err = op.Copy(ctx, srcStorage, srcActualPath, dstActualPath, lazyCache...)
-		if err != nil {
-			return fmt.Errorf("failed to copy %s to %s: %w", srcPath, dstPath, err)
+	// 同一路径下负载均衡的几个存储算同一个存储，镜像的话每个都copy一遍
+	if op.SameMount(srcStorages[0], dstStorage) {
+		for _, storage := range srcStorages {
+			err = op.Copy(ctx, storage, srcActualPath, dstActualPath, lazyCache...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to copy %s to %s: %w", srcPath, dstPath, err)
+			}
 		}
-		return nil
+		return nil, nil
 	}
 
-	// todo: 跨网盘复制文件
-	return fmt.Errorf("cross-storage copy is not supported by this function")
+	if m := task.GetManager(task.Copy); m != nil && ctx.Value(configs.NoTaskKey) == nil {
+		return m.Submit(ctx, fmt.Sprintf("copy %s to %s", srcPath, dstPath), copyMovePayload{SrcPath: srcPath, DstDirPath: dstPath})
+	}
+	if err = copyBetweenStorages(ctx, srcPath, dstPath, nil, lazyCache...); err != nil {
+		return nil, fmt.Errorf("failed to copy %s to %s: %w", srcPath, dstPath, err)
+	}
+	return nil, nil
 }
 
-// 在同一存储空间内移动对象。
-func move(ctx context.Context, srcPath, dstPath string, lazyCache ...bool) error {
-	srcStorage, srcActualPath, err := op.GetStorageAndActualPath(srcPath)
+// 移动对象到dstPath目录下。跨存储时先完整复制一份并校验，全部成功后才删除源对象，
+// 复制中途失败时源对象保持不动，目标端可能留下已经复制完的部分。
+func move(ctx context.Context, srcPath, dstPath string, lazyCache ...bool) (*task.Task, error) {
+	srcStorages, srcActualPath, err := op.GetWriteStoragesAndActualPath(srcPath)
 	if err != nil {
-		return fmt.Errorf("failed to get source storage for %s: %w", srcPath, err)
+		return nil, fmt.Errorf("failed to get source storage for %s: %w", srcPath, err)
 	}
 	dstStorage, dstActualPath, err := op.GetStorageAndActualPath(dstPath)
 	if err != nil {
-		return fmt.Errorf("failed to get destination storage for %s: %w", dstPath, err)
+		return nil, fmt.Errorf("failed to get destination storage for %s: %w", dstPath, err)
+	}
+
+	// 同一路径下负载均衡的几个存储算同一个存储，镜像的话每个都move一遍
+	if op.SameMount(srcStorages[0], dstStorage) {
+		for _, storage := range srcStorages {
+			err = op.Move(ctx, storage, srcActualPath, dstActualPath, lazyCache...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to move %s to %s: %w", srcPath, dstPath, err)
+			}
+		}
+		return nil, nil
+	}
+
+	if m := task.GetManager(task.Move); m != nil && ctx.Value(configs.NoTaskKey) == nil {
+		return m.Submit(ctx, fmt.Sprintf("move %s to %s", srcPath, dstPath), copyMovePayload{SrcPath: srcPath, DstDirPath: dstPath})
+	}
+	if err = moveBetweenStorages(ctx, srcPath, dstPath, nil, lazyCache...); err != nil {
+		return nil, fmt.Errorf("failed to move %s to %s: %w", srcPath, dstPath, err)
+	}
+	return nil, nil
+}
+
+// moveBetweenStorages 先完整复制到dstDirPath，成功后再删除源对象
+func moveBetweenStorages(ctx context.Context, srcPath, dstDirPath string, up model.UpdateProgress, lazyCache ...bool) error {
+	if err := copyBetweenStorages(ctx, srcPath, dstDirPath, up, lazyCache...); err != nil {
+		return err
+	}
+	if err := remove(ctx, srcPath); err != nil {
+		return errors.WithMessagef(err, "copied but failed to remove source [%s]", srcPath)
+	}
+	return nil
+}
+
+// copyBetweenStorages 把srcPath（文件或目录）复制到另一个存储的dstDirPath目录下，
+// 目录会递归复制。文件内容通过源驱动的Link读出，再用目标驱动的Put写入，不落本地磁盘。
+// up收到的是当前正在复制的那个文件的进度，可以为nil
+func copyBetweenStorages(ctx context.Context, srcPath, dstDirPath string, up model.UpdateProgress, lazyCache ...bool) error {
+	srcObj, err := get(ctx, srcPath)
+	if err != nil {
+		return errors.WithMessagef(err, "failed get src [%s]", srcPath)
+	}
+	if !srcObj.IsDir() {
+		return copyFileBetweenStorages(ctx, srcPath, srcObj, dstDirPath, up, lazyCache...)
 	}
 
-	// 仅处理同一存储的情况
-	if srcStorage.GetStorage() == dstStorage.GetStorage() {
-		err = op.Move(ctx, srcStorage, srcActualPath, dstActualPath, lazyCache...)
-		if err != nil {
-			return fmt.Errorf("failed to move %s to %s: %w", srcPath, dstPath, err)
+	dstPath := stdpath.Join(dstDirPath, srcObj.GetName())
+	if err = makeDir(ctx, dstPath, lazyCache...); err != nil {
+		return errors.WithMessagef(err, "failed make dir [%s]", dstPath)
+	}
+	objs, err := list(ctx, srcPath, &ListArgs{NoLog: true})
+	if err != nil {
+		return errors.WithMessagef(err, "failed list src [%s]", srcPath)
+	}
+	for _, obj := range objs {
+		if utils.IsCanceled(ctx) {
+			return ctx.Err()
 		}
-		return nil
+		if err = copyBetweenStorages(ctx, stdpath.Join(srcPath, obj.GetName()), dstPath, up, lazyCache...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFileBetweenStorages 复制单个文件，写完后检查目标文件的大小和两边都有的哈希，和源文件不一致时视为失败
+func copyFileBetweenStorages(ctx context.Context, srcPath string, srcObj model.Obj, dstDirPath string, up model.UpdateProgress, lazyCache ...bool) error {
+	l, _, err := link(ctx, srcPath, model.LinkArgs{})
+	if err != nil {
+		return errors.WithMessagef(err, "failed link src [%s]", srcPath)
+	}
+	rc, err := openLink(ctx, l)
+	if err != nil {
+		_ = l.Close()
+		return errors.WithMessagef(err, "failed open src [%s]", srcPath)
+	}
+	// 修改时间放在Obj里交给目标驱动，能设置修改时间的驱动会保留下来
+	fileStream := &stream.FileStream{
+		Ctx: ctx,
+		Obj: &model.Object{
+			Name:         srcObj.GetName(),
+			Size:         srcObj.GetSize(),
+			ModifiedTime: srcObj.GetModifiedTime(),
+			CreatedTime:  srcObj.GetCreatedTime(),
+			// 带上源文件的哈希，目标存储能秒传就不用真的读，上传完也会按它校验
+			HashInfo: srcObj.GetHash(),
+		},
+		Reader:      rc,
+		Mimetype:    utils.GetMimeType(srcObj.GetName()),
+		TrustedHash: true,
+	}
+	fileStream.Add(rc)
+	fileStream.Add(l)
+	// put会负责关闭fileStream
+	if err = put(ctx, dstDirPath, fileStream, up, lazyCache...); err != nil {
+		return errors.WithMessagef(err, "failed put [%s]", stdpath.Join(dstDirPath, srcObj.GetName()))
 	}
 
-	// todo: 跨网盘移动文件
-	return fmt.Errorf("cross-storage move is not supported by this function")
+	dstPath := stdpath.Join(dstDirPath, srcObj.GetName())
+	dstObj, err := get(ctx, dstPath)
+	if err != nil {
+		return errors.WithMessagef(err, "failed verify [%s]", dstPath)
+	}
+	if dstObj.GetSize() != srcObj.GetSize() {
+		return errors.Errorf("size mismatch after copy [%s]: expect %d, got %d", dstPath, srcObj.GetSize(), dstObj.GetSize())
+	}
+	if err = model.CheckHash(srcObj.GetHash(), dstObj.GetHash()); err != nil {
+		return errors.WithMessagef(err, "hash mismatch after copy [%s]", dstPath)
+	}
+	return nil
+}
+
+// openLink 按MFile、RangeReader、URL的优先级打开link的完整内容
+func openLink(ctx context.Context, l *model.Link) (io.ReadCloser, error) {
+	return stream.RangeReadLink(ctx, l, http_range.Range{Length: -1})
 }
@@ -2,7 +2,9 @@ package fs
 
 import (
 	"HelaList/internal/model"
+	"HelaList/internal/task"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 )
@@ -23,7 +25,7 @@ func List(ctx context.Context, path string, args *ListArgs) ([]model.Obj, error)
 	res, err := list(ctx, path, args)
 	if err != nil {
 		if !args.NoLog {
-			log.Println("failed list %s: %+v", path, err)
+			log.Printf("failed list %s: %+v", path, err)
 		}
 		return nil, err
 	}
@@ -41,7 +43,7 @@ func Get(ctx context.Context, path string) (model.Obj, error) {
 func MakeDir(ctx context.Context, path string, lazyCache ...bool) error {
 	err := makeDir(ctx, path, lazyCache...)
 	if err != nil {
-		fmt.Errorf("failed make dir %s: %+v", path, err)
+		log.Printf("failed make dir %s: %+v", path, err)
 	}
 	return err
 }
@@ -49,7 +51,7 @@ func MakeDir(ctx context.Context, path string, lazyCache ...bool) error {
 func Rename(ctx context.Context, srcPath, dstName string, lazyCache ...bool) error {
 	err := rename(ctx, srcPath, dstName, lazyCache...)
 	if err != nil {
-		fmt.Errorf("failed rename %s to %s: %+v", srcPath, dstName, err)
+		log.Printf("failed rename %s to %s: %+v", srcPath, dstName, err)
 	}
 	return err
 }
@@ -57,32 +59,73 @@ func Rename(ctx context.Context, srcPath, dstName string, lazyCache ...bool) err
 func Remove(ctx context.Context, path string) error {
 	err := remove(ctx, path)
 	if err != nil {
-		fmt.Errorf("failed remove %s: %+v", path, err)
+		log.Printf("failed remove %s: %+v", path, err)
 	}
 	return err
 }
 
-func Move(ctx context.Context, srcPath, dstPath string, lazyCache ...bool) error {
-	err := move(ctx, srcPath, dstPath, lazyCache...)
+// Move 跨存储移动会作为后台任务执行并返回该任务，其余情况同步完成，返回的任务为nil
+func Move(ctx context.Context, srcPath, dstPath string, lazyCache ...bool) (*task.Task, error) {
+	t, err := move(ctx, srcPath, dstPath, lazyCache...)
 	if err != nil {
-		fmt.Errorf("failed move %s to %s: %+v", srcPath, dstPath, err)
+		log.Printf("failed move %s to %s: %+v", srcPath, dstPath, err)
 	}
-	return err
+	return t, err
 }
 
-func Copy(ctx context.Context, srcPath, dstPath string, lazyCache ...bool) error {
-	err := copy(ctx, srcPath, dstPath, lazyCache...)
+// Copy 跨存储复制会作为后台任务执行并返回该任务，其余情况同步完成，返回的任务为nil
+func Copy(ctx context.Context, srcPath, dstPath string, lazyCache ...bool) (*task.Task, error) {
+	t, err := copy(ctx, srcPath, dstPath, lazyCache...)
 	if err != nil {
-		fmt.Errorf("failed copy %s to %s: %+v", srcPath, dstPath, err)
+		log.Printf("failed copy %s to %s: %+v", srcPath, dstPath, err)
 	}
-	return err
+	return t, err
+}
+
+// Decompress 解压作为后台任务执行并返回该任务，任务系统没有初始化时同步完成，返回的任务为nil
+func Decompress(ctx context.Context, args DecompressArgs) (*task.Task, error) {
+	t, err := decompress(ctx, args)
+	if err != nil {
+		log.Printf("failed decompress %s to %s: %+v", args.SrcPath, args.DstDirPath, err)
+	}
+	return t, err
+}
+
+// Compress 和Decompress一样，优先作为后台任务执行
+func Compress(ctx context.Context, args CompressArgs) (*task.Task, error) {
+	t, err := compress(ctx, args)
+	if err != nil {
+		log.Printf("failed compress %v to %s: %+v", args.SrcPaths, args.DstDirPath, err)
+	}
+	return t, err
+}
+
+// PutAsTask 把已经缓存到本地临时文件的上传交给后台任务，任务成功后删除临时文件
+func PutAsTask(ctx context.Context, dstDirPath string, args UploadArgs) (*task.Task, error) {
+	m := task.GetManager(task.Upload)
+	if m == nil {
+		return nil, errors.New("task system is not initialized")
+	}
+	return m.Submit(ctx, fmt.Sprintf("upload %s to %s", args.Name, dstDirPath), uploadPayload{
+		DstDirPath: dstDirPath,
+		UploadArgs: args,
+	})
 }
 
 // PutDirectly 将文件直接上传并等待完成。
 func PutDirectly(ctx context.Context, dstDirPath string, file model.FileStreamer, lazyCache ...bool) error {
 	err := putDirectly(ctx, dstDirPath, file, lazyCache...)
 	if err != nil {
-		fmt.Errorf("failed put %s: %+v", dstDirPath, err)
+		log.Printf("failed put %s: %+v", dstDirPath, err)
+	}
+	return err
+}
+
+// PutURL 在支持的存储里放入一个只有地址的文件，下载时直接用这个地址
+func PutURL(ctx context.Context, dstDirPath, dstName, url string) error {
+	err := putURL(ctx, dstDirPath, dstName, url)
+	if err != nil {
+		log.Printf("failed put url %s to %s: %+v", url, dstDirPath, err)
 	}
 	return err
 }
@@ -90,7 +133,7 @@ func PutDirectly(ctx context.Context, dstDirPath string, file model.FileStreamer
 func Link(ctx context.Context, path string, args model.LinkArgs) (*model.Link, model.Obj, error) {
 	res, file, err := link(ctx, path, args)
 	if err != nil {
-		fmt.Errorf("failed link %s: %+v", path, err)
+		log.Printf("failed link %s: %+v", path, err)
 		return nil, nil, err
 	}
 	return res, file, nil
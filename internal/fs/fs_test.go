@@ -0,0 +1,561 @@
+package fs_test
+
+import (
+	"HelaList/configs"
+	"HelaList/drivers/memory"
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/fs"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"HelaList/internal/stream"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	stdpath "path"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+)
+
+// 测试都挂在内存存储上
+
+func mount(t *testing.T, mountPath string) *memory.Memory {
+	t.Helper()
+	return mountStorage(t, model.Storage{MountPath: mountPath})
+}
+
+func mountStorage(t *testing.T, storage model.Storage) *memory.Memory {
+	t.Helper()
+	storage.CacheExpiration = 30
+	return drivertest.Mount(t, storage).(*memory.Memory)
+}
+
+func put(t *testing.T, dirPath, name, content string) {
+	t.Helper()
+	file := &stream.FileStream{
+		Obj:    &model.Object{Name: name, Size: int64(len(content))},
+		Reader: strings.NewReader(content),
+	}
+	if err := fs.PutDirectly(context.Background(), dirPath, file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	l, _, err := fs.Link(context.Background(), path, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	rc, err := stream.RangeReadLink(context.Background(), l, http_range.Range{Length: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func names(t *testing.T, path string) []string {
+	t.Helper()
+	objs, err := fs.List(context.Background(), path, &fs.ListArgs{NoLog: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for _, obj := range objs {
+		res = append(res, obj.GetName())
+	}
+	return res
+}
+
+func exists(path string) bool {
+	_, err := fs.Get(context.Background(), path)
+	return err == nil
+}
+
+func TestPutListGet(t *testing.T) {
+	mount(t, "/put")
+	if err := fs.MakeDir(context.Background(), "/put/a/b"); err != nil {
+		t.Fatal(err)
+	}
+	put(t, "/put/a/b", "hello.txt", "hello")
+	if got := names(t, "/put/a/b"); len(got) != 1 || got[0] != "hello.txt" {
+		t.Fatalf("list = %v", got)
+	}
+	obj, err := fs.Get(context.Background(), "/put/a/b/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetSize() != 5 || obj.IsDir() {
+		t.Fatalf("unexpected obj size %d, dir %v", obj.GetSize(), obj.IsDir())
+	}
+	if got := read(t, "/put/a/b/hello.txt"); got != "hello" {
+		t.Fatalf("content = %q", got)
+	}
+	if _, err = fs.Get(context.Background(), "/put/a/missing"); err == nil || !strings.Contains(err.Error(), "object not found") {
+		t.Fatalf("get missing: %v", err)
+	}
+}
+
+func TestRenameRemove(t *testing.T) {
+	mount(t, "/rr")
+	put(t, "/rr", "old.txt", "x")
+	if err := fs.Rename(context.Background(), "/rr/old.txt", "new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if exists("/rr/old.txt") || !exists("/rr/new.txt") {
+		t.Fatalf("rename did not update the listing: %v", names(t, "/rr"))
+	}
+	if err := fs.Remove(context.Background(), "/rr/new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if exists("/rr/new.txt") {
+		t.Fatal("removed file still exists")
+	}
+}
+
+func TestCopyAcrossStorages(t *testing.T) {
+	mount(t, "/copy-src")
+	mount(t, "/copy-dst")
+	if err := fs.MakeDir(context.Background(), "/copy-src/dir/sub"); err != nil {
+		t.Fatal(err)
+	}
+	put(t, "/copy-src/dir", "a.txt", "aaa")
+	put(t, "/copy-src/dir/sub", "b.txt", "bbb")
+	// 任务系统没有初始化，跨存储复制同步完成
+	task, err := fs.Copy(context.Background(), "/copy-src/dir", "/copy-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task != nil {
+		t.Fatal("copy should run synchronously without the task system")
+	}
+	if got := read(t, "/copy-dst/dir/a.txt"); got != "aaa" {
+		t.Fatalf("a.txt = %q", got)
+	}
+	if got := read(t, "/copy-dst/dir/sub/b.txt"); got != "bbb" {
+		t.Fatalf("b.txt = %q", got)
+	}
+	if !exists("/copy-src/dir/a.txt") {
+		t.Fatal("copy removed the source")
+	}
+}
+
+func TestMoveAcrossStoragesKeepsSourceOnFailure(t *testing.T) {
+	mount(t, "/move-src")
+	dst := mount(t, "/move-dst")
+	put(t, "/move-src", "a.txt", "aaa")
+
+	dst.InjectFault(memory.OpPut, errors.New("disk full"))
+	if _, err := fs.Move(context.Background(), "/move-src/a.txt", "/move-dst"); err == nil {
+		t.Fatal("move should fail when the destination refuses the upload")
+	}
+	if !exists("/move-src/a.txt") {
+		t.Fatal("source was removed although the copy failed")
+	}
+
+	dst.InjectFault(memory.OpPut, nil)
+	if _, err := fs.Move(context.Background(), "/move-src/a.txt", "/move-dst"); err != nil {
+		t.Fatal(err)
+	}
+	if exists("/move-src/a.txt") {
+		t.Fatal("source still exists after move")
+	}
+	if got := read(t, "/move-dst/a.txt"); got != "aaa" {
+		t.Fatalf("a.txt = %q", got)
+	}
+}
+
+func TestCompressAndDecompress(t *testing.T) {
+	mount(t, "/arc-src")
+	mount(t, "/arc-dst")
+	if err := fs.MakeDir(context.Background(), "/arc-src/docs/sub"); err != nil {
+		t.Fatal(err)
+	}
+	put(t, "/arc-src/docs", "a.txt", "aaa")
+	put(t, "/arc-src/docs/sub", "b.txt", strings.Repeat("b", 100000))
+	put(t, "/arc-src", "c.txt", "ccc")
+
+	for _, name := range []string{"pack.zip", "pack.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := fs.Compress(context.Background(), fs.CompressArgs{
+				SrcPaths:   []string{"/arc-src/docs", "/arc-src/c.txt"},
+				DstDirPath: "/arc-src",
+				Name:       name,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 压缩包可以直接当目录浏览
+			archivePath := stdpath.Join("/arc-src", name)
+			if got := read(t, stdpath.Join(archivePath, "docs/sub/b.txt")); got != strings.Repeat("b", 100000) {
+				t.Fatalf("b.txt inside the archive has %d bytes", len(got))
+			}
+
+			dstDir := "/arc-dst/" + strings.ReplaceAll(name, ".", "-")
+			args := fs.DecompressArgs{SrcPath: archivePath, DstDirPath: dstDir}
+			if _, err = fs.Decompress(context.Background(), args); err != nil {
+				t.Fatal(err)
+			}
+			if got := read(t, dstDir+"/docs/a.txt"); got != "aaa" {
+				t.Fatalf("a.txt = %q", got)
+			}
+			if got := read(t, dstDir+"/c.txt"); got != "ccc" {
+				t.Fatalf("c.txt = %q", got)
+			}
+
+			// 再解压一次，默认给冲突的文件改名
+			if _, err = fs.Decompress(context.Background(), args); err != nil {
+				t.Fatal(err)
+			}
+			if got := read(t, dstDir+"/c (1).txt"); got != "ccc" {
+				t.Fatalf("c (1).txt = %q", got)
+			}
+			args.Conflict = fs.ConflictSkip
+			if _, err = fs.Decompress(context.Background(), args); err != nil {
+				t.Fatal(err)
+			}
+			if exists(dstDir + "/c (2).txt") {
+				t.Fatal("skip policy still wrote a renamed copy")
+			}
+		})
+	}
+}
+
+// 加密的zip是用zip -P(ZipCrypto)和bsdtar(ZipCrypto带数据描述符、WinZip AES)生成的，密码都是secret
+func TestDecompressEncryptedZip(t *testing.T) {
+	mount(t, "/enc-zip")
+	for _, name := range []string{"crypto.zip", "crypto_dd.zip", "aes128.zip", "aes256.zip"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			put(t, "/enc-zip", name, string(data))
+			args := fs.DecompressArgs{SrcPath: "/enc-zip/" + name, DstDirPath: "/enc-zip/out-" + name}
+			if _, err = fs.Decompress(context.Background(), args); err == nil {
+				t.Fatal("decompress without password should fail")
+			}
+			args.Password = "wrong"
+			if _, err = fs.Decompress(context.Background(), args); err == nil {
+				t.Fatal("decompress with a wrong password should fail")
+			}
+			args.Password = "secret"
+			if _, err = fs.Decompress(context.Background(), args); err != nil {
+				t.Fatal(err)
+			}
+			if got := read(t, args.DstDirPath+"/docs/a.txt"); got != "hello zip\n" {
+				t.Fatalf("a.txt = %q", got)
+			}
+			if got := read(t, args.DstDirPath+"/b.txt"); got != strings.Repeat("b", 5000) {
+				t.Fatalf("b.txt has %d bytes", len(got))
+			}
+		})
+	}
+}
+
+// zipWithDeclaredSize 打一个zip，条目头里写的解压后大小是declared，实际内容是content
+func zipWithDeclaredSize(t *testing.T, entries map[string]string, declared int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range entries {
+		var compressed bytes.Buffer
+		fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = fw.Write([]byte(content))
+		_ = fw.Close()
+		size := len(content)
+		if declared >= 0 {
+			size = declared
+		}
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               name,
+			Method:             zip.Deflate,
+			CRC32:              crc32.ChecksumIEEE([]byte(content)),
+			CompressedSize64:   uint64(compressed.Len()),
+			UncompressedSize64: uint64(size),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(compressed.Bytes())
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestDecompressBomb(t *testing.T) {
+	mount(t, "/bomb")
+	old := configs.MaxExtractSize
+	configs.MaxExtractSize = 100000
+	defer func() { configs.MaxExtractSize = old }()
+
+	// 头里的大小写小了，实际解出来更多
+	put(t, "/bomb", "liar.zip", zipWithDeclaredSize(t, map[string]string{"a": strings.Repeat("a", 50000)}, 10))
+	// 每个条目都老实，但加起来超过上限
+	big := map[string]string{"a": strings.Repeat("a", 60000), "b": strings.Repeat("b", 60000)}
+	put(t, "/bomb", "big.zip", zipWithDeclaredSize(t, big, -1))
+	// 头里的大小也加起来超过上限，不用解压就能拒绝
+	put(t, "/bomb", "declared.zip", zipWithDeclaredSize(t, map[string]string{"a": "a"}, 200000))
+	// tar.gz里头的大小是对的，只能靠总额度
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, name := range []string{"a", "b"} {
+		_ = tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: 60000})
+		_, _ = tw.Write([]byte(strings.Repeat(name, 60000)))
+	}
+	_ = tw.Close()
+	_ = gw.Close()
+	put(t, "/bomb", "big.tar.gz", buf.String())
+
+	for _, name := range []string{"liar.zip", "big.zip", "declared.zip", "big.tar.gz"} {
+		args := fs.DecompressArgs{SrcPath: "/bomb/" + name, DstDirPath: "/bomb/out"}
+		if _, err := fs.Decompress(context.Background(), args); err == nil {
+			t.Fatalf("%s: decompress should fail", name)
+		}
+	}
+	if exists("/bomb/out") {
+		t.Fatal("nothing should be uploaded")
+	}
+}
+
+func TestCompressSkipDoesNotPack(t *testing.T) {
+	d := mount(t, "/arc-skip")
+	put(t, "/arc-skip", "a.txt", "aaa")
+	put(t, "/arc-skip", "pack.zip", "old")
+	// 目标已经存在又要跳过时，不应该去读源文件
+	d.InjectFault(memory.OpLink, errors.New("should not read"))
+	defer d.InjectFault(memory.OpLink, nil)
+	_, err := fs.Compress(context.Background(), fs.CompressArgs{
+		SrcPaths:   []string{"/arc-skip/a.txt"},
+		DstDirPath: "/arc-skip",
+		Name:       "pack.zip",
+		Conflict:   fs.ConflictSkip,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.InjectFault(memory.OpLink, nil)
+	if got := read(t, "/arc-skip/pack.zip"); got != "old" {
+		t.Fatalf("pack.zip = %q", got)
+	}
+}
+
+func TestListCache(t *testing.T) {
+	d := mount(t, "/cache")
+	put(t, "/cache", "a.txt", "a")
+	names(t, "/cache")
+	// 有缓存时不会再调用驱动的List
+	d.InjectFault(memory.OpList, errors.New("list is down"))
+	if got := names(t, "/cache"); len(got) != 1 {
+		t.Fatalf("cached list = %v", got)
+	}
+	if _, err := fs.List(context.Background(), "/cache", &fs.ListArgs{Refresh: true, NoLog: true}); err == nil {
+		t.Fatal("refresh should reach the driver")
+	}
+}
+
+func TestPutURL(t *testing.T) {
+	mount(t, "/url")
+	if err := fs.PutURL(context.Background(), "/url/links", "a.txt", "https://example.com/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	l, _, err := fs.Link(context.Background(), "/url/links/a.txt", model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l.URL != "https://example.com/a.txt" {
+		t.Fatalf("link url = %q", l.URL)
+	}
+}
+
+// storageNames 直接列某一个存储，不经过负载均衡
+func storageNames(t *testing.T, d *memory.Memory, path string) []string {
+	t.Helper()
+	objs, err := op.List(context.Background(), d, path, model.ListArgs{Refresh: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for _, obj := range objs {
+		res = append(res, obj.GetName())
+	}
+	return res
+}
+
+func TestReadRetriesNextStorage(t *testing.T) {
+	a := mount(t, "/retry")
+	// 两个存储共用一份数据，哪个坏了都能从另一个读到
+	b := mountStorage(t, model.Storage{MountPath: "/retry.balance1", Remark: "ref:/retry"})
+	put(t, "/retry", "a.txt", "hello")
+	a.InjectFault(memory.OpLink, errors.New("backend down"))
+	a.InjectFault(memory.OpList, errors.New("backend down"))
+	defer a.InjectFault(memory.OpLink, nil)
+	defer a.InjectFault(memory.OpList, nil)
+	for range 4 {
+		if got := read(t, "/retry/a.txt"); got != "hello" {
+			t.Fatalf("content = %q", got)
+		}
+		if got := names(t, "/retry"); len(got) != 1 {
+			t.Fatalf("list = %v", got)
+		}
+	}
+	b.InjectFault(memory.OpLink, errors.New("backend down"))
+	defer b.InjectFault(memory.OpLink, nil)
+	if _, _, err := fs.Link(context.Background(), "/retry/a.txt", model.LinkArgs{}); err == nil {
+		t.Fatal("link should fail when all storages are down")
+	}
+}
+
+func TestMirrorWritesAllStorages(t *testing.T) {
+	a := mountStorage(t, model.Storage{MountPath: "/mirror", BalanceStrategy: op.BalanceMirror})
+	b := mountStorage(t, model.Storage{MountPath: "/mirror.balance1"})
+	if err := fs.MakeDir(context.Background(), "/mirror/d"); err != nil {
+		t.Fatal(err)
+	}
+	put(t, "/mirror/d", "f.txt", "mirrored")
+	if err := fs.PutURL(context.Background(), "/mirror/d", "u.txt", "https://example.com/u.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename(context.Background(), "/mirror/d/u.txt", "v.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Copy(context.Background(), "/mirror/d/f.txt", "/mirror"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove(context.Background(), "/mirror/d/v.txt"); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []*memory.Memory{a, b} {
+		if got := storageNames(t, d, "/d"); len(got) != 1 || got[0] != "f.txt" {
+			t.Fatalf("%s: /d = %v", d.MountPath, got)
+		}
+		if got := storageNames(t, d, "/"); len(got) != 2 {
+			t.Fatalf("%s: / = %v", d.MountPath, got)
+		}
+	}
+	// 每个存储里的内容都要一样，轮着读几次
+	for range 2 {
+		if got := read(t, "/mirror/d/f.txt"); got != "mirrored" {
+			t.Fatalf("content = %q", got)
+		}
+	}
+}
+
+func putWithHash(dirPath, name string, reader io.Reader, size int64, hash utils.HashInfo) error {
+	return fs.PutDirectly(context.Background(), dirPath, &stream.FileStream{
+		Obj:    &model.Object{Name: name, Size: size, HashInfo: hash},
+		Reader: reader,
+	})
+}
+
+func TestUploadHashCheck(t *testing.T) {
+	mount(t, "/hash")
+	wrong := utils.NewHashInfo(utils.MD5, utils.HashData(utils.MD5, []byte("other")))
+	if err := putWithHash("/hash", "a.txt", strings.NewReader("hello"), 5, wrong); err == nil {
+		t.Fatal("upload with a wrong md5 should fail")
+	}
+	if exists("/hash/a.txt") {
+		t.Fatal("corrupted upload was kept")
+	}
+	right := utils.NewHashInfo(utils.SHA1, utils.HashData(utils.SHA1, []byte("hello")))
+	if err := putWithHash("/hash", "a.txt", strings.NewReader("hello"), 5, right); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := fs.Get(context.Background(), "/hash/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetHash().GetHash(utils.SHA1) != right.GetHash(utils.SHA1) {
+		t.Fatalf("hash = %s", obj.GetHash())
+	}
+}
+
+func TestOverwriteWithWrongHashKeepsOldFile(t *testing.T) {
+	mount(t, "/hash-over")
+	put(t, "/hash-over", "a.txt", "original")
+	wrong := utils.NewHashInfo(utils.MD5, utils.HashData(utils.MD5, []byte("other")))
+	if err := putWithHash("/hash-over", "a.txt", strings.NewReader("corrupted"), 9, wrong); err == nil {
+		t.Fatal("upload with a wrong md5 should fail")
+	}
+	if got := read(t, "/hash-over/a.txt"); got != "original" {
+		t.Fatalf("a.txt = %q", got)
+	}
+	objs, err := fs.List(context.Background(), "/hash-over", &fs.ListArgs{NoLog: true, Refresh: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 {
+		t.Fatalf("temp file left behind: %d objs", len(objs))
+	}
+
+	// 哈希对的照常覆盖
+	right := utils.NewHashInfo(utils.MD5, utils.HashData(utils.MD5, []byte("updated")))
+	if err := putWithHash("/hash-over", "a.txt", strings.NewReader("updated"), 7, right); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, "/hash-over/a.txt"); got != "updated" {
+		t.Fatalf("a.txt = %q", got)
+	}
+}
+
+func TestRapidUploadAndCopyHash(t *testing.T) {
+	mount(t, "/rapid-src")
+	mount(t, "/rapid-dst")
+	put(t, "/rapid-dst", "x.txt", "same content")
+	hash := utils.NewHashInfo(utils.SHA256, utils.HashData(utils.SHA256, []byte("same content")))
+	// 客户端报的哈希不能秒传，不然知道哈希就能拿到别人的文件
+	if err := putWithHash("/rapid-dst", "stolen.txt", iotest.ErrReader(errors.New("read")), 12, hash); err == nil {
+		t.Fatal("client hash was used for rapid upload")
+	}
+	// 服务端自己拿到的哈希可以，目标里已经有同样的内容，不读文件也能传上去
+	if err := fs.PutDirectly(context.Background(), "/rapid-dst", &stream.FileStream{
+		Obj:         &model.Object{Name: "y.txt", Size: 12, HashInfo: hash},
+		Reader:      iotest.ErrReader(errors.New("should not be read")),
+		TrustedHash: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, "/rapid-dst/y.txt"); got != "same content" {
+		t.Fatalf("y.txt = %q", got)
+	}
+
+	put(t, "/rapid-src", "z.txt", "copied")
+	if _, err := fs.Copy(context.Background(), "/rapid-src/z.txt", "/rapid-dst"); err != nil {
+		t.Fatal(err)
+	}
+	src, err := fs.Get(context.Background(), "/rapid-src/z.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := fs.Get(context.Background(), "/rapid-dst/z.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md5 := src.GetHash().GetHash(utils.MD5)
+	if md5 == "" || dst.GetHash().GetHash(utils.MD5) != md5 {
+		t.Fatalf("hash after copy: src %s, dst %s", src.GetHash(), dst.GetHash())
+	}
+}
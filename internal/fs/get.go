@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"HelaList/internal/driver"
 	"HelaList/internal/model"
 	"HelaList/internal/op"
 	"context"
@@ -22,7 +23,7 @@ func get(ctx context.Context, path string) (model.Obj, error) {
 			}
 		}
 	}
-	storage, actualPath, err := op.GetStorageAndActualPath(path)
+	storages, actualPath, err := op.GetStoragesAndActualPath(path)
 	if err != nil {
 		// if there are no storage prefix with path, maybe root folder
 		if path == "/" {
@@ -35,5 +36,7 @@ func get(ctx context.Context, path string) (model.Obj, error) {
 		}
 		return nil, errors.WithMessage(err, "failed get storage")
 	}
-	return op.Get(ctx, storage, actualPath)
+	return tryStorages(ctx, storages, func(storage driver.Driver) (model.Obj, error) {
+		return op.Get(ctx, storage, actualPath)
+	})
 }
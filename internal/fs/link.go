@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"HelaList/internal/driver"
 	"HelaList/internal/model"
 	"HelaList/internal/op"
 	"HelaList/internal/server/common"
@@ -11,11 +12,15 @@ import (
 )
 
 func link(ctx context.Context, path string, args model.LinkArgs) (*model.Link, model.Obj, error) {
-	storage, actualPath, err := op.GetStorageAndActualPath(path)
+	storages, actualPath, err := op.GetStoragesAndActualPath(path)
 	if err != nil {
 		return nil, nil, errors.WithMessage(err, "failed get storage")
 	}
-	l, obj, err := op.Link(ctx, storage, actualPath, args)
+	var obj model.Obj
+	l, err := tryStorages(ctx, storages, func(storage driver.Driver) (l *model.Link, err error) {
+		l, obj, err = op.Link(ctx, storage, actualPath, args)
+		return l, err
+	})
 	if err != nil {
 		return nil, nil, errors.WithMessage(err, "failed link")
 	}
@@ -1,9 +1,10 @@
 package fs
 
 import (
+	"HelaList/internal/driver"
 	"HelaList/internal/model"
 	"context"
-	"fmt"
+	"log"
 
 	"HelaList/configs"
 	"HelaList/internal/op"
@@ -17,20 +18,22 @@ func list(ctx context.Context, path string, args *ListArgs) ([]model.Obj, error)
 	meta, _ := ctx.Value(configs.MetaKey).(*model.Meta)
 	user, _ := ctx.Value(configs.UserKey).(*model.User)
 	virtualFiles := op.GetStorageVirtualFilesByPath(path)
-	storage, actualPath, err := op.GetStorageAndActualPath(path)
+	storages, actualPath, err := op.GetStoragesAndActualPath(path)
 	if err != nil && len(virtualFiles) == 0 {
 		return nil, errors.WithMessage(err, "failed get storage")
 	}
 
 	var _objs []model.Obj
-	if storage != nil {
-		_objs, err = op.List(ctx, storage, actualPath, model.ListArgs{
-			ReqPath: path,
-			Refresh: args.Refresh,
+	if len(storages) > 0 {
+		_objs, err = tryStorages(ctx, storages, func(storage driver.Driver) ([]model.Obj, error) {
+			return op.List(ctx, storage, actualPath, model.ListArgs{
+				ReqPath: path,
+				Refresh: args.Refresh,
+			})
 		})
 		if err != nil {
 			if !args.NoLog {
-				fmt.Errorf("fs/list: %+v", err)
+				log.Printf("fs/list: %+v", err)
 			}
 			if len(virtualFiles) == 0 {
 				return nil, errors.WithMessage(err, "failed get objs")
@@ -3,6 +3,7 @@ package fs
 import (
 	"context"
 
+	"HelaList/internal/driver"
 	"HelaList/internal/model"
 	"HelaList/internal/op"
 
@@ -10,27 +11,21 @@ import (
 )
 
 func makeDir(ctx context.Context, path string, lazyCache ...bool) error {
-	storage, actualPath, err := op.GetStorageAndActualPath(path)
-	if err != nil {
-		return errors.WithMessage(err, "failed get storage")
-	}
-	return op.MakeDir(ctx, storage, actualPath, lazyCache...)
+	return forWriteStorages(path, func(storage driver.Driver, actualPath string) error {
+		return op.MakeDir(ctx, storage, actualPath, lazyCache...)
+	})
 }
 
 func rename(ctx context.Context, srcPath, dstName string, lazyCache ...bool) error {
-	storage, srcActualPath, err := op.GetStorageAndActualPath(srcPath)
-	if err != nil {
-		return errors.WithMessage(err, "failed get storage")
-	}
-	return op.Rename(ctx, storage, srcActualPath, dstName, lazyCache...)
+	return forWriteStorages(srcPath, func(storage driver.Driver, srcActualPath string) error {
+		return op.Rename(ctx, storage, srcActualPath, dstName, lazyCache...)
+	})
 }
 
 func remove(ctx context.Context, path string) error {
-	storage, actualPath, err := op.GetStorageAndActualPath(path)
-	if err != nil {
-		return errors.WithMessage(err, "failed get storage")
-	}
-	return op.Remove(ctx, storage, actualPath)
+	return forWriteStorages(path, func(storage driver.Driver, actualPath string) error {
+		return op.Remove(ctx, storage, actualPath)
+	})
 }
 
 func other(ctx context.Context, args model.FsOtherArgs) (interface{}, error) {
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"HelaList/internal/driver"
 	"HelaList/internal/model"
 	"HelaList/internal/op"
 	"context"
@@ -10,14 +11,32 @@ import (
 )
 
 func putDirectly(ctx context.Context, dstDirPath string, file model.FileStreamer, lazyCache ...bool) error {
-	storage, dstDirActualPath, err := op.GetStorageAndActualPath(dstDirPath)
+	return put(ctx, dstDirPath, file, nil, lazyCache...)
+}
+
+// put 和putDirectly一样，只是多了进度回调，给后台任务用
+func put(ctx context.Context, dstDirPath string, file model.FileStreamer, up model.UpdateProgress, lazyCache ...bool) error {
+	storages, dstDirActualPath, err := op.GetWriteStoragesAndActualPath(dstDirPath)
 	if err != nil {
 		_ = file.Close()
 		return errors.WithMessage(err, "failed get storage")
 	}
-	if storage.Config().NoUpload {
-		_ = file.Close()
-		return errors.WithStack(fmt.Errorf("UploadNotSupported"))
+	for _, storage := range storages {
+		if storage.Config().NoUpload {
+			_ = file.Close()
+			return errors.WithStack(fmt.Errorf("UploadNotSupported"))
+		}
 	}
-	return op.Put(ctx, storage, dstDirActualPath, file, nil, lazyCache...)
+	name := file.GetName()
+	if err = op.Put(ctx, storages[0], dstDirActualPath, file, up, lazyCache...); err != nil {
+		return err
+	}
+	// 镜像：流已经被读完了，从第一个存储里读出来再写到别的里面
+	return mirrorFile(ctx, storages[0], storages[1:], dstDirActualPath, name, lazyCache...)
+}
+
+func putURL(ctx context.Context, dstDirPath, dstName, url string) error {
+	return forWriteStorages(dstDirPath, func(storage driver.Driver, dstDirActualPath string) error {
+		return op.PutURL(ctx, storage, dstDirActualPath, dstName, url)
+	})
 }
@@ -0,0 +1,101 @@
+package fs
+
+import (
+	"HelaList/internal/model"
+	"HelaList/internal/stream"
+	"HelaList/internal/task"
+	"os"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// fs层负责的后台任务。参数会被存进数据库，所以只能放可以序列化成json的东西
+
+func init() {
+	task.RegisterHandler(task.Copy, runCopyTask)
+	task.RegisterHandler(task.Move, runMoveTask)
+	task.RegisterHandler(task.Upload, runUploadTask)
+	task.RegisterHandler(task.Decompress, runDecompressTask)
+	task.RegisterHandler(task.DecompressUpload, runDecompressUploadTask)
+	task.RegisterHandler(task.Compress, runCompressTask)
+}
+
+type copyMovePayload struct {
+	SrcPath    string `json:"src_path"`
+	DstDirPath string `json:"dst_dir_path"`
+}
+
+func runCopyTask(t *task.Task) error {
+	var p copyMovePayload
+	if err := t.Decode(&p); err != nil {
+		return err
+	}
+	t.SetStatus("copying " + p.SrcPath)
+	return copyBetweenStorages(t.Ctx(), p.SrcPath, p.DstDirPath, t.SetProgress)
+}
+
+func runMoveTask(t *task.Task) error {
+	var p copyMovePayload
+	if err := t.Decode(&p); err != nil {
+		return err
+	}
+	t.SetStatus("moving " + p.SrcPath)
+	return moveBetweenStorages(t.Ctx(), p.SrcPath, p.DstDirPath, t.SetProgress)
+}
+
+// UploadArgs 描述一个已经落到本地临时文件、等待上传的文件
+type UploadArgs struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Mimetype string    `json:"mimetype"`
+	TmpPath  string    `json:"tmp_path"`
+	Hash     string    `json:"hash"` // utils.HashInfo.String()，客户端给了哈希时上传完校验
+}
+
+type uploadPayload struct {
+	DstDirPath string `json:"dst_dir_path"`
+	UploadArgs
+}
+
+func runUploadTask(t *task.Task) error {
+	var p uploadPayload
+	if err := t.Decode(&p); err != nil {
+		return err
+	}
+	f, err := os.Open(p.TmpPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed open tmp file of %s", p.Name)
+	}
+	mimetype := p.Mimetype
+	if mimetype == "" {
+		mimetype = utils.GetMimeType(p.Name)
+	}
+	var hash utils.HashInfo
+	if p.Hash != "" {
+		hash = utils.FromString(p.Hash)
+	}
+	fileStream := &stream.FileStream{
+		Ctx: t.Ctx(),
+		Obj: &model.Object{
+			Name:         p.Name,
+			Size:         p.Size,
+			ModifiedTime: p.Modified,
+			HashInfo:     hash,
+		},
+		Reader:   f,
+		Mimetype: mimetype,
+		Closers:  utils.NewClosers(f),
+	}
+	t.SetStatus("uploading " + p.Name)
+	if err = put(t.Ctx(), p.DstDirPath, fileStream, t.SetProgress); err != nil {
+		return err
+	}
+	// 失败时保留临时文件，重试还要用
+	if err = os.Remove(p.TmpPath); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
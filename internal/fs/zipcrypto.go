@@ -0,0 +1,241 @@
+package fs
+
+import (
+	"archive/zip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// 加密zip的解密。标准库的archive/zip不认加密标志，这里拿到原始的压缩数据后自己先解密。
+// 支持两种：传统的ZipCrypto，以及WinZip的AES（压缩方法号99，真正的压缩方法写在0x9901扩展字段里）
+
+var (
+	errPasswordRequired = errors.New("password required")
+	errWrongPassword    = errors.New("wrong password")
+)
+
+const (
+	zipFlagEncrypted      = 0x1
+	zipFlagDataDescriptor = 0x8
+	zipMethodAES          = 99
+	zipExtraAES           = 0x9901
+	zipCryptoHeaderSize   = 12
+	zipAESVerifierSize    = 2
+	zipAESTagSize         = 10
+)
+
+// zipAESInfo 0x9901扩展字段里的内容
+type zipAESInfo struct {
+	version  uint16 // 1是AE-1，2是AE-2，AE-2不写CRC
+	strength byte   // 1、2、3分别是AES-128、192、256
+	method   uint16 // 真正的压缩方法
+}
+
+func parseZipAES(extra []byte) (*zipAESInfo, error) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if id == zipExtraAES && size >= 7 {
+			info := &zipAESInfo{
+				version:  binary.LittleEndian.Uint16(extra),
+				strength: extra[4],
+				method:   binary.LittleEndian.Uint16(extra[5:]),
+			}
+			if info.strength < 1 || info.strength > 3 {
+				return nil, errors.Errorf("unknown aes strength %d", info.strength)
+			}
+			return info, nil
+		}
+		extra = extra[size:]
+	}
+	return nil, errors.New("missing aes extra field")
+}
+
+// zipEntryMethod 返回条目真正的压缩方法，以及解密后是否还需要校验CRC
+func zipEntryMethod(f *zip.File) (uint16, bool, error) {
+	if f.Method != zipMethodAES {
+		return f.Method, true, nil
+	}
+	info, err := parseZipAES(f.Extra)
+	if err != nil {
+		return 0, false, err
+	}
+	return info.method, info.version != 2, nil
+}
+
+// decryptZipEntry 把原始的压缩数据包成解密后的流，条目没有加密时原样返回。
+// raw读到结尾时AES的认证码才会被校验
+func decryptZipEntry(f *zip.File, raw io.Reader, password string) (io.Reader, error) {
+	if f.Flags&zipFlagEncrypted == 0 {
+		return raw, nil
+	}
+	if password == "" {
+		return nil, errPasswordRequired
+	}
+	if f.Method == zipMethodAES {
+		return newZipAESReader(f, raw, password)
+	}
+	return newZipCryptoReader(f, raw, password)
+}
+
+// zipCryptoReader 传统ZipCrypto，三个32位的密钥随着明文滚动更新
+type zipCryptoReader struct {
+	r    io.Reader
+	keys [3]uint32
+}
+
+func newZipCryptoReader(f *zip.File, raw io.Reader, password string) (*zipCryptoReader, error) {
+	z := &zipCryptoReader{r: raw, keys: [3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for i := 0; i < len(password); i++ {
+		z.update(password[i])
+	}
+	header := make([]byte, zipCryptoHeaderSize)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	z.decrypt(header)
+	// 头的最后一个字节用来校验密码，写了数据描述符的文件用修改时间的高字节
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&zipFlagDataDescriptor != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if header[zipCryptoHeaderSize-1] != check {
+		return nil, errWrongPassword
+	}
+	return z, nil
+}
+
+func (z *zipCryptoReader) update(b byte) {
+	z.keys[0] = crc32.IEEETable[byte(z.keys[0])^b] ^ (z.keys[0] >> 8)
+	z.keys[1] = (z.keys[1]+(z.keys[0]&0xff))*134775813 + 1
+	z.keys[2] = crc32.IEEETable[byte(z.keys[2])^byte(z.keys[1]>>24)] ^ (z.keys[2] >> 8)
+}
+
+func (z *zipCryptoReader) decrypt(p []byte) {
+	for i := range p {
+		t := uint16(z.keys[2]) | 2
+		p[i] ^= byte((t * (t ^ 1)) >> 8)
+		z.update(p[i])
+	}
+}
+
+func (z *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := z.r.Read(p)
+	z.decrypt(p[:n])
+	return n, err
+}
+
+// zipAESReader WinZip AES：盐 + 2字节密码校验值 + 密文 + 10字节认证码。
+// 密文用AES-CTR加密，计数器是从1开始的小端整数，认证码是密文的HMAC-SHA1截断
+type zipAESReader struct {
+	r       io.Reader
+	block   cipher.Block
+	mac     hash.Hash
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int
+	remain  int64
+	err     error
+}
+
+func newZipAESReader(f *zip.File, raw io.Reader, password string) (*zipAESReader, error) {
+	info, err := parseZipAES(f.Extra)
+	if err != nil {
+		return nil, err
+	}
+	keyLen := 8 + 8*int(info.strength)
+	saltLen := keyLen / 2
+	remain := int64(f.CompressedSize64) - int64(saltLen+zipAESVerifierSize+zipAESTagSize)
+	if remain < 0 {
+		return nil, errors.New("encrypted entry is truncated")
+	}
+	head := make([]byte, saltLen+zipAESVerifierSize)
+	if _, err = io.ReadFull(raw, head); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	key, err := pbkdf2.Key(sha1.New, password, head[:saltLen], 1000, 2*keyLen+zipAESVerifierSize)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !hmac.Equal(key[2*keyLen:], head[saltLen:]) {
+		return nil, errWrongPassword
+	}
+	block, err := aes.NewCipher(key[:keyLen])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &zipAESReader{
+		r:      raw,
+		block:  block,
+		mac:    hmac.New(sha1.New, key[keyLen:2*keyLen]),
+		used:   aes.BlockSize,
+		remain: remain,
+	}, nil
+}
+
+func (z *zipAESReader) Read(p []byte) (int, error) {
+	if z.remain <= 0 {
+		if z.err == nil {
+			z.err = z.verify()
+		}
+		return 0, z.err
+	}
+	if int64(len(p)) > z.remain {
+		p = p[:z.remain]
+	}
+	n, err := z.r.Read(p)
+	z.mac.Write(p[:n])
+	for i := 0; i < n; i++ {
+		if z.used == aes.BlockSize {
+			z.next()
+		}
+		p[i] ^= z.stream[z.used]
+		z.used++
+	}
+	z.remain -= int64(n)
+	if err == io.EOF && z.remain > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && z.remain == 0 {
+		z.err = z.verify()
+		err = z.err
+	}
+	return n, err
+}
+
+// next 计数器加一，生成下一块密钥流
+func (z *zipAESReader) next() {
+	for i := range z.counter {
+		z.counter[i]++
+		if z.counter[i] != 0 {
+			break
+		}
+	}
+	z.block.Encrypt(z.stream[:], z.counter[:])
+	z.used = 0
+}
+
+// verify 密文读完后比对认证码，成功时返回io.EOF
+func (z *zipAESReader) verify() error {
+	tag := make([]byte, zipAESTagSize)
+	if _, err := io.ReadFull(z.r, tag); err != nil {
+		return errors.WithStack(err)
+	}
+	if !hmac.Equal(tag, z.mac.Sum(nil)[:zipAESTagSize]) {
+		return errors.New("aes authentication failed, the archive is corrupted")
+	}
+	return io.EOF
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DeadProp 是WebDAV客户端通过PROPPATCH写入的自定义属性，按路径+属性名唯一
+type DeadProp struct {
+	Id       uuid.UUID `json:"id" gorm:"primaryKey"`
+	Path     string    `json:"path" gorm:"uniqueIndex:idx_dead_prop_name;index"`
+	Space    string    `json:"space" gorm:"uniqueIndex:idx_dead_prop_name"` // xml命名空间
+	Local    string    `json:"local" gorm:"uniqueIndex:idx_dead_prop_name"` // xml本地名
+	Lang     string    `json:"lang"`
+	InnerXML string    `json:"inner_xml" gorm:"type:text"`
+}
+
+func (DeadProp) TableName() string {
+	return "dead_props"
+}
+
+func (p *DeadProp) BeforeCreate(tx *gorm.DB) error {
+	if p.Id == uuid.Nil {
+		p.Id = uuid.Must(uuid.NewV7())
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+文件哈希直接用utils.HashInfo，MD5、SHA1、SHA256已经注册好了。
+网盘自己的哈希(比如迅雷的gcid)用utils.RegisterHash注册一个新的HashType，
+驱动把能拿到的哈希放进Object.HashInfo就行，拿不到的不用填
+*/
+
+// 常用的几种哈希，上传时按这个顺序边传边算
+var CommonHashes = []*utils.HashType{utils.MD5, utils.SHA1, utils.SHA256}
+
+// HasHash 至少有一种哈希
+func HasHash(h utils.HashInfo) bool {
+	for _, v := range h.All() {
+		if v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// HashTrusted 流带的哈希是服务端自己从存储拿到的(复制、镜像)才能拿去秒传。
+// 客户端报上来的哈希只能用来校验，不然知道别人文件的哈希就能秒传一份到自己目录下
+type HashTrusted interface {
+	IsHashTrusted() bool
+}
+
+// CheckHash 比较两边都有的哈希，有一个不一样就报错。没有共同的哈希时返回nil
+func CheckHash(expect, got utils.HashInfo) error {
+	for ht, v := range expect.All() {
+		if g := got.GetHash(ht); v != "" && g != "" && !strings.EqualFold(v, g) {
+			return errors.Errorf("%s mismatch: expect %s, got %s", ht.Name, v, g)
+		}
+	}
+	return nil
+}
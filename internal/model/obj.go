@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/dlclark/regexp2"
 	"github.com/google/uuid"
@@ -19,7 +20,7 @@ type Obj interface {
 	GetModifiedTime() time.Time
 	GetCreatedTime() time.Time
 	IsDir() bool
-	// GetHash() // 哈希还没实现，所以暂时不做
+	GetHash() utils.HashInfo
 	GetId() uuid.UUID
 	GetPath() string
 }
@@ -34,6 +35,10 @@ type ObjWrapName struct {
 	Obj
 }
 
+func (o *ObjWrapName) Unwrap() Obj {
+	return o.Obj
+}
+
 func UnwrapObj(obj Obj) Obj {
 	if unwrap, ok := obj.(ObjUnwrap); ok {
 		obj = unwrap.Unwrap()
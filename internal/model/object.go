@@ -3,6 +3,7 @@ package model
 import (
 	"time"
 
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/google/uuid"
 )
 
@@ -14,7 +15,7 @@ type Object struct {
 	ModifiedTime time.Time
 	CreatedTime  time.Time // 文件创建时间
 	IsFolder     bool
-	// HashInfo // 哈希检验和先不做
+	HashInfo     utils.HashInfo // 存储能直接拿到的哈希，没有就是空的
 }
 
 func (o *Object) GetName() string {
@@ -52,6 +53,6 @@ func (o *Object) SetPath(path string) {
 	o.Path = path
 }
 
-/*
-func (o *Object) GetHash()
-*/
+func (o *Object) GetHash() utils.HashInfo {
+	return o.HashInfo
+}
@@ -20,6 +20,9 @@ type Storage struct {
 	ModifiedTime    time.Time `json:"modified_time"`                               // 修改时间
 	Disabled        bool      `json:"disabled"`                                    // 该存储是否被禁用
 	Sort                      // 排序用
+	// 负载均衡，几个存储挂在同一路径下(xxx、xxx.balance1...)时才有用
+	BalanceStrategy string `json:"balance_strategy"` // 同一路径下按挂载路径排序，第一个填了的为准，都没填就轮询
+	BalanceWeight   int    `json:"balance_weight"`   // weighted策略的权重，不填为1
 	// 代理配置
 	WebProxy         bool   `json:"web_proxy"`          // 是否启用Web代理
 	WebdavPolicy     string `json:"webdav_policy"`      // WebDAV策略
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 任务状态
+const (
+	TaskPending   = iota // 排队中，包括重试前的等待
+	TaskRunning          // 运行中
+	TaskPaused           // 已暂停
+	TaskSucceeded        // 已完成
+	TaskFailed           // 重试次数用完后仍然失败
+	TaskCanceled         // 被用户取消
+)
+
+// Task 是后台任务落库的样子，运行时的状态由internal/task维护，这里只是它的快照
+type Task struct {
+	Id        uuid.UUID  `gorm:"type:uuid;primarykey" json:"id"`
+	Type      string     `gorm:"index;not null" json:"type"` // 任务类别，比如copy、move、upload
+	Name      string     `json:"name"`                       // 给人看的描述
+	Creator   uuid.UUID  `gorm:"type:uuid;index" json:"creator"`
+	State     int        `gorm:"index" json:"state"`
+	Status    string     `json:"status"`   // 当前进行到哪一步
+	Progress  float64    `json:"progress"` // 0~100
+	Error     string     `gorm:"type:text" json:"error"`
+	Retry     int        `json:"retry"`              // 已经重试的次数
+	Payload   string     `gorm:"type:text" json:"-"` // 任务参数，json格式，重启后靠它恢复任务
+	StartTime *time.Time `json:"start_time"`
+	EndTime   *time.Time `json:"end_time"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (Task) TableName() string {
+	return "tasks"
+}
+
+func (t *Task) BeforeCreate(tx *gorm.DB) error {
+	if t.Id == uuid.Nil {
+		t.Id = uuid.Must(uuid.NewV7())
+	}
+	return nil
+}
+
+// Done 判断任务是否已经结束，结束的任务不会再被调度
+func (t *Task) Done() bool {
+	return t.State == TaskSucceeded || t.State == TaskFailed || t.State == TaskCanceled
+}
@@ -59,9 +59,9 @@ func (u *User) IsGuest() bool {
 	return u.Identity == GUEST
 }
 
-// func (u *User) CanWrite() bool {
-// 	return !u.Disabled && (u.Identity == ADMIN || u.Identity == GENERAL)
-// }
+func (u *User) CanWrite() bool {
+	return !u.Disabled && (u.Identity == ADMIN || u.Identity == GENERAL)
+}
 
 // 密码加密相关
 
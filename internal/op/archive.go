@@ -0,0 +1,433 @@
+package op
+
+import (
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/stream"
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	stdpath "path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 压缩包浏览：把zip、tar、tar.gz当作只读的目录，压缩包里的路径直接拼在压缩包后面，
+// 比如/backup.zip/docs/readme.md。第一次进入压缩包时把整个目录结构解析出来，每一层都放进listCache，
+// 缓存key带着压缩包的大小和修改时间，压缩包变了才重新解析。内容都通过存储的Link按范围读取，大的远程压缩包不用整个下载
+
+type archiveKind int
+
+const (
+	archiveZip archiveKind = iota + 1
+	archiveTar
+	archiveTarGz
+)
+
+func archiveKindOf(name string) archiveKind {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(name, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveTarGz
+	}
+	return 0
+}
+
+var errArchiveReadOnly = errors.New("archive is read-only")
+
+// archiveObj 压缩包里的条目，Path是它在存储里的完整路径
+type archiveObj struct {
+	model.Object
+	archive string // 压缩包在存储里的路径
+	entry   string // 条目在压缩包里的原始名字，读取内容时靠它找回条目
+	offset  int64  // tar里数据的起始位置
+}
+
+// asArchiveObj Get会在列表结果外面再包一层显示名，要一直拆到底
+func asArchiveObj(obj model.Obj) (*archiveObj, bool) {
+	for {
+		switch o := obj.(type) {
+		case *archiveObj:
+			return o, true
+		case model.ObjUnwrap:
+			obj = o.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+func isArchiveObj(obj model.Obj) bool {
+	_, ok := asArchiveObj(obj)
+	return ok
+}
+
+// archiveKey 压缩包里目录的缓存key，带上压缩包的大小和修改时间。
+// 压缩包变了key也跟着变，旧的目录结构不会再被读到，留着等过期就行，不用一层层去删
+func archiveKey(storage driver.Driver, archive model.Obj, archivePath, inner string) string {
+	stamp := fmt.Sprintf("@%d.%d", archive.GetSize(), archive.GetModifiedTime().UnixNano())
+	return stdpath.Join(Key(storage, archivePath)+stamp, inner)
+}
+
+// findArchive 找到路径经过的压缩包，返回压缩包对象、它的路径和压缩包内的路径。
+// 名字像压缩包的目录不算，继续往下找
+func findArchive(ctx context.Context, storage driver.Driver, path string) (model.Obj, string, string, bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, part := range parts {
+		if archiveKindOf(part) == 0 {
+			continue
+		}
+		archivePath := "/" + strings.Join(parts[:i+1], "/")
+		obj, err := GetUnwrap(ctx, storage, archivePath)
+		if err != nil {
+			return nil, "", "", false
+		}
+		if obj.IsDir() {
+			continue
+		}
+		return obj, archivePath, "/" + strings.Join(parts[i+1:], "/"), true
+	}
+	return nil, "", "", false
+}
+
+func listArchive(ctx context.Context, storage driver.Driver, archive model.Obj, archivePath, inner string, args model.ListArgs) ([]model.Obj, error) {
+	key := archiveKey(storage, archive, archivePath, inner)
+	root := archiveKey(storage, archive, archivePath, "/")
+	_, parsed := listCache.Get(root)
+	if !parsed || args.Refresh {
+		// 每一层都会重新放进缓存，覆盖掉旧的
+		_, err, _ := listGroup.Do(root, func() ([]model.Obj, error) {
+			return nil, parseArchive(ctx, storage, archive, archivePath)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if files, ok := listCache.Get(key); ok {
+		return files, nil
+	}
+	return nil, errors.Errorf("object not found: %s", stdpath.Join(archivePath, inner))
+}
+
+// archiveEntry 解析压缩包得到的一个条目
+type archiveEntry struct {
+	name     string // 显示的名字
+	raw      string // 压缩包里的原始名字
+	size     int64
+	modified time.Time
+	isDir    bool
+	offset   int64
+}
+
+// parseArchive 解析压缩包，把每一层目录的内容放进listCache
+func parseArchive(ctx context.Context, storage driver.Driver, archive model.Obj, archivePath string) error {
+	link, _, err := Link(ctx, storage, archivePath, model.LinkArgs{})
+	if err != nil {
+		return errors.WithMessage(err, "failed link archive")
+	}
+	defer link.Close()
+	var entries []archiveEntry
+	switch archiveKindOf(archive.GetName()) {
+	case archiveZip:
+		entries, err = listZip(stream.NewLinkReaderAt(ctx, link, archive.GetSize()), archive.GetSize())
+	case archiveTar:
+		entries, err = listTar(io.NewSectionReader(stream.NewLinkReaderAt(ctx, link, archive.GetSize()), 0, archive.GetSize()))
+	case archiveTarGz:
+		// gzip只能从头解压，只好顺着读一遍
+		var rc io.ReadCloser
+		rc, err = stream.RangeReadLink(ctx, link, http_range.Range{Length: -1})
+		if err != nil {
+			break
+		}
+		defer rc.Close()
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(rc); err != nil {
+			break
+		}
+		entries, err = listTar(gz)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read archive %s", archivePath)
+	}
+
+	children := map[string][]model.Obj{"/": {}}
+	dirs := map[string]*archiveObj{}
+	var addDir func(p string) *archiveObj
+	addDir = func(p string) *archiveObj {
+		if dir, ok := dirs[p]; ok || p == "/" {
+			return dir
+		}
+		parent := stdpath.Dir(p)
+		addDir(parent)
+		dir := &archiveObj{
+			Object: model.Object{
+				Path:     stdpath.Join(archivePath, p),
+				Name:     stdpath.Base(p),
+				IsFolder: true,
+			},
+			archive: archivePath,
+		}
+		dirs[p] = dir
+		children[p] = []model.Obj{}
+		children[parent] = append(children[parent], dir)
+		return dir
+	}
+	files := map[string]int{}
+	for _, e := range entries {
+		p := stdpath.Clean("/" + strings.ReplaceAll(e.name, "\\", "/"))
+		if p == "/" {
+			continue
+		}
+		if e.isDir {
+			addDir(p).ModifiedTime = e.modified
+			continue
+		}
+		parent := stdpath.Dir(p)
+		addDir(parent)
+		obj := &archiveObj{
+			Object: model.Object{
+				Path:         stdpath.Join(archivePath, p),
+				Name:         stdpath.Base(p),
+				Size:         e.size,
+				ModifiedTime: e.modified,
+			},
+			archive: archivePath,
+			entry:   e.raw,
+			offset:  e.offset,
+		}
+		// tar里同名的条目后面的覆盖前面的
+		if i, ok := files[p]; ok {
+			children[parent][i] = obj
+			continue
+		}
+		files[p] = len(children[parent])
+		children[parent] = append(children[parent], obj)
+	}
+
+	expiration := archiveCacheExpiration(storage)
+	for p, objs := range children {
+		model.WrapObjsName(objs)
+		listCache.Fill(archiveKey(storage, archive, archivePath, p), objs, expiration)
+	}
+	return nil
+}
+
+// archiveCacheExpiration 不缓存列表的存储（别名、加密）也缓存压缩包的目录结构，解析一次代价不小
+func archiveCacheExpiration(storage driver.Driver) time.Duration {
+	if e := storage.GetStorage().CacheExpiration; e > 0 {
+		return time.Minute * time.Duration(e)
+	}
+	return 30 * time.Minute
+}
+
+func listZip(r io.ReaderAt, size int64) ([]archiveEntry, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]archiveEntry, 0, len(zr.File))
+	for _, f := range zr.File {
+		entries = append(entries, archiveEntry{
+			name:     zipEntryName(f),
+			raw:      f.Name,
+			size:     int64(f.UncompressedSize64),
+			modified: f.Modified,
+			isDir:    f.FileInfo().IsDir(),
+		})
+	}
+	return entries, nil
+}
+
+// zipEntryName Windows上打的zip文件名经常是GBK编码，不是合法的UTF-8时按GB18030解码
+func zipEntryName(f *zip.File) string {
+	if utf8.ValidString(f.Name) {
+		return f.Name
+	}
+	if name, err := simplifiedchinese.GB18030.NewDecoder().String(f.Name); err == nil {
+		return name
+	}
+	return f.Name
+}
+
+// listTar r能Seek时tar会直接跳过文件内容，只读各个文件头
+func listTar(r io.Reader) ([]archiveEntry, error) {
+	seeker, _ := r.(io.Seeker)
+	tr := tar.NewReader(r)
+	var entries []archiveEntry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		mode := hdr.FileInfo().Mode()
+		if !mode.IsDir() && !mode.IsRegular() {
+			// 链接、设备文件之类的不显示
+			continue
+		}
+		e := archiveEntry{
+			name:     hdr.Name,
+			raw:      hdr.Name,
+			size:     hdr.Size,
+			modified: hdr.ModTime,
+			isDir:    mode.IsDir(),
+		}
+		if seeker != nil {
+			if e.offset, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+}
+
+// archiveLink 压缩包里的文件只能由服务器读出来再发给客户端
+func archiveLink(ctx context.Context, storage driver.Driver, obj *archiveObj, args model.LinkArgs) (*model.Link, error) {
+	l, archive, err := Link(ctx, storage, obj.archive, args)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed link archive")
+	}
+	var rr model.RangeReaderIF
+	switch archiveKindOf(obj.archive) {
+	case archiveZip:
+		rr, err = newZipEntryReader(ctx, l, archive.GetSize(), obj.entry)
+	case archiveTar:
+		rr = &tarEntryReader{link: l, offset: obj.offset, size: obj.Size}
+	case archiveTarGz:
+		rr = &tarGzEntryReader{link: l, entry: obj.entry, size: obj.Size}
+	}
+	if err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	link := &model.Link{
+		RangeReader:   rr,
+		ContentLength: obj.Size,
+	}
+	link.Add(l)
+	return link, nil
+}
+
+// clampRange 把Length小于0或超出文件的范围截到文件结尾
+func clampRange(httpRange http_range.Range, size int64) http_range.Range {
+	if httpRange.Length < 0 || httpRange.Start+httpRange.Length > size {
+		httpRange.Length = size - httpRange.Start
+	}
+	return httpRange
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// skipAndLimit 压缩过的内容只能从头解压，丢掉范围前面的部分
+func skipAndLimit(r io.Reader, c io.Closer, httpRange http_range.Range) (io.ReadCloser, error) {
+	if _, err := io.CopyN(io.Discard, r, httpRange.Start); err != nil {
+		_ = c.Close()
+		return nil, errors.Wrap(err, "failed to skip to range start")
+	}
+	return &readCloser{Reader: io.LimitReader(r, httpRange.Length), Closer: c}, nil
+}
+
+type zipEntryReader struct {
+	link   *model.Link
+	file   *zip.File
+	offset int64
+}
+
+func newZipEntryReader(ctx context.Context, link *model.Link, size int64, entry string) (*zipEntryReader, error) {
+	zr, err := zip.NewReader(stream.NewLinkReaderAt(ctx, link, size), size)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read zip")
+	}
+	for _, f := range zr.File {
+		if f.Name != entry {
+			continue
+		}
+		if f.Flags&0x1 != 0 {
+			return nil, errors.New("zip entry is password protected")
+		}
+		if f.Method != zip.Store && f.Method != zip.Deflate {
+			return nil, errors.Errorf("unsupported zip compression method: %d", f.Method)
+		}
+		offset, err := f.DataOffset()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to locate zip entry")
+		}
+		return &zipEntryReader{link: link, file: f, offset: offset}, nil
+	}
+	return nil, errors.Errorf("object not found: %s", entry)
+}
+
+// RangeRead 没压缩的条目直接按范围读，deflate的从条目开头解压
+func (r *zipEntryReader) RangeRead(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+	httpRange = clampRange(httpRange, int64(r.file.UncompressedSize64))
+	if r.file.Method == zip.Store {
+		return stream.RangeReadLink(ctx, r.link, http_range.Range{Start: r.offset + httpRange.Start, Length: httpRange.Length})
+	}
+	rc, err := stream.RangeReadLink(ctx, r.link, http_range.Range{Start: r.offset, Length: int64(r.file.CompressedSize64)})
+	if err != nil {
+		return nil, err
+	}
+	return skipAndLimit(flate.NewReader(rc), rc, httpRange)
+}
+
+type tarEntryReader struct {
+	link   *model.Link
+	offset int64
+	size   int64
+}
+
+func (r *tarEntryReader) RangeRead(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+	httpRange = clampRange(httpRange, r.size)
+	return stream.RangeReadLink(ctx, r.link, http_range.Range{Start: r.offset + httpRange.Start, Length: httpRange.Length})
+}
+
+type tarGzEntryReader struct {
+	link  *model.Link
+	entry string
+	size  int64
+}
+
+func (r *tarGzEntryReader) RangeRead(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+	httpRange = clampRange(httpRange, r.size)
+	rc, err := stream.RangeReadLink(ctx, r.link, http_range.Range{Length: -1})
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		_ = rc.Close()
+		return nil, errors.WithStack(err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			_ = rc.Close()
+			if err == io.EOF {
+				return nil, errors.Errorf("object not found: %s", r.entry)
+			}
+			return nil, errors.WithStack(err)
+		}
+		if hdr.Name == r.entry {
+			return skipAndLimit(tr, rc, httpRange)
+		}
+	}
+}
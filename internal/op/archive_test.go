@@ -0,0 +1,209 @@
+package op_test
+
+import (
+	"HelaList/drivers/memory"
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"HelaList/internal/stream"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
+)
+
+// 压缩包里的文件，名字以/结尾的是目录
+type archiveFile struct {
+	name, content string
+}
+
+func makeZip(t *testing.T, files []archiveFile) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i, f := range files {
+		// 一半存储一半压缩，两种读法都要覆盖
+		method := zip.Deflate
+		if i%2 == 0 {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: method, Modified: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = io.WriteString(w, f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func makeTar(t *testing.T, files []archiveFile) string {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(f.name, "/") {
+			hdr.Mode, hdr.Typeflag = 0755, tar.TypeDir
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func makeTarGz(t *testing.T, files []archiveFile) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(gw, makeTar(t, files)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func listNames(t *testing.T, d driver.Driver, path string) string {
+	t.Helper()
+	objs, err := op.List(context.Background(), d, path, model.ListArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for _, obj := range objs {
+		name := obj.GetName()
+		if obj.IsDir() {
+			name += "/"
+		}
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
+func readLink(t *testing.T, d driver.Driver, path string, start, length int64) string {
+	t.Helper()
+	l, _, err := op.Link(context.Background(), d, path, model.LinkArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	rc, err := stream.RangeReadLink(context.Background(), l, http_range.Range{Start: start, Length: length})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBrowseArchives(t *testing.T) {
+	files := []archiveFile{
+		{"docs/", ""},
+		{"docs/a.txt", "hello archive"},
+		{"docs/deep/b.txt", strings.Repeat("b", 5000)},
+		{"top.txt", "top"},
+	}
+	for _, tc := range []struct {
+		name string
+		data string
+	}{
+		{"a.zip", makeZip(t, files)},
+		{"a.tar", makeTar(t, files)},
+		{"a.tar.gz", makeTarGz(t, files)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := mount(t, "/op-archive-"+tc.name)
+			put(t, d, "/", tc.name, tc.data)
+
+			if got := listNames(t, d, "/"+tc.name); got != "docs/,top.txt" {
+				t.Fatalf("root = %s", got)
+			}
+			// 没有单独目录条目的中间目录也要有
+			if got := listNames(t, d, "/"+tc.name+"/docs"); got != "a.txt,deep/" {
+				t.Fatalf("docs = %s", got)
+			}
+			obj, err := op.Get(context.Background(), d, "/"+tc.name+"/docs/deep/b.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if obj.GetSize() != 5000 || obj.IsDir() {
+				t.Fatalf("b.txt = %+v", obj)
+			}
+			if got := readLink(t, d, "/"+tc.name+"/docs/a.txt", 0, -1); got != "hello archive" {
+				t.Fatalf("a.txt = %q", got)
+			}
+			if got := readLink(t, d, "/"+tc.name+"/docs/deep/b.txt", 4990, 20); got != strings.Repeat("b", 10) {
+				t.Fatalf("b.txt range = %q", got)
+			}
+			if _, err = op.List(context.Background(), d, "/"+tc.name+"/missing", model.ListArgs{}); err == nil {
+				t.Fatal("listing a missing folder should fail")
+			}
+			if err = op.MakeDir(context.Background(), d, "/"+tc.name+"/docs/new"); err == nil {
+				t.Fatal("archives should be read-only")
+			}
+		})
+	}
+}
+
+// 压缩包换了内容以后，里面每一层都不能再读到旧的
+func TestArchiveChanged(t *testing.T) {
+	d := mount(t, "/op-archive-changed")
+	put(t, d, "/", "a.zip", makeZip(t, []archiveFile{{"docs/old.txt", "old"}, {"docs/sub/x.txt", "x"}}))
+	if got := listNames(t, d, "/a.zip/docs"); got != "old.txt,sub/" {
+		t.Fatalf("docs = %s", got)
+	}
+	if got := listNames(t, d, "/a.zip/docs/sub"); got != "x.txt" {
+		t.Fatalf("sub = %s", got)
+	}
+
+	// 外层的key先过期或者被Redis挤掉了，里面几层还在
+	op.DeleteCache(d, "/a.zip")
+	put(t, d, "/", "a.zip", makeZip(t, []archiveFile{{"docs/new.txt", "new content"}}))
+	if got := listNames(t, d, "/a.zip/docs"); got != "new.txt" {
+		t.Fatalf("docs after change = %s", got)
+	}
+	if _, err := op.List(context.Background(), d, "/a.zip/docs/sub", model.ListArgs{}); err == nil {
+		t.Fatal("folder removed from the archive is still listed")
+	}
+	if got := readLink(t, d, "/a.zip/docs/new.txt", 0, -1); got != "new content" {
+		t.Fatalf("new.txt = %q", got)
+	}
+}
+
+// 驱动查对象出错时，Link要把这个错误报出来，不能换一种方式再找一遍
+func TestLinkReportsGetObjInfoError(t *testing.T) {
+	d := mount(t, "/op-link-error")
+	put(t, d, "/", "a.txt", "hello")
+	op.ClearCache(d, "/")
+	d.(*memory.Memory).InjectFault(memory.OpGet, errors.New("backend down"))
+	_, _, err := op.Link(context.Background(), d, "/a.txt", model.LinkArgs{})
+	if err == nil || !strings.Contains(err.Error(), "backend down") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,340 @@
+package op
+
+import (
+	"HelaList/internal/model"
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/go-cache"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// ListCache 目录列表缓存，key是Key(storage, path)。
+// 默认放在进程内存里，多实例部署时换成NewRedisListCache，各节点共享同一份列表
+type ListCache interface {
+	Get(key string) ([]model.Obj, bool)
+	// Fill 放入刚从存储读出来的列表，没有改过东西，不用通知别的节点。objs为空时不缓存
+	Fill(key string, objs []model.Obj, expiration time.Duration)
+	// Set 这个节点改过列表之后写回去，别的节点要丢掉本地副本。expiration<=0表示不缓存
+	Set(key string, objs []model.Obj, expiration time.Duration)
+	Del(key string)
+}
+
+var listCache = NewMemListCache() // 文件缓存
+
+// SetListCache 替换列表缓存，要在加载存储之前调用，运行中替换会和正在列目录的请求抢
+func SetListCache(c ListCache) {
+	listCache = c
+}
+
+type memListCache struct {
+	cache cache.ICache[[]model.Obj]
+}
+
+func NewMemListCache() ListCache {
+	return newMemListCache()
+}
+
+func newMemListCache() *memListCache {
+	return &memListCache{cache: cache.NewMemCache(cache.WithShards[[]model.Obj](64))}
+}
+
+func (c *memListCache) Get(key string) ([]model.Obj, bool) {
+	return c.cache.Get(key)
+}
+
+func (c *memListCache) Fill(key string, objs []model.Obj, expiration time.Duration) {
+	if len(objs) == 0 {
+		c.Del(key)
+		return
+	}
+	c.Set(key, objs, expiration)
+}
+
+func (c *memListCache) Set(key string, objs []model.Obj, expiration time.Duration) {
+	c.cache.Set(key, objs, cache.WithEx[[]model.Obj](expiration))
+}
+
+func (c *memListCache) Del(key string) {
+	c.cache.Del(key)
+}
+
+func (c *memListCache) Clear() {
+	c.cache.Clear()
+}
+
+// ListCacheStore Redis列表缓存用到的能力，redis.Service实现了它
+type ListCacheStore interface {
+	SetFileListCache(path string, files interface{}, expiration time.Duration) error
+	GetFileListCache(path string, dest interface{}) error
+	DelFileListCache(path string) error
+	Publish(channel string, payload string) error
+	Subscribe(ctx context.Context, channel string, onSubscribe func(), onMessage func(payload string))
+}
+
+const (
+	listInvalidateChannel = "file:list:invalidate"
+	// Redis出错之后这么久都只用本地缓存，不然每个请求都要等一次超时
+	listCacheRetry = 30 * time.Second
+)
+
+// listInvalidation 一个节点改了列表之后发出去的消息，其它节点收到后丢掉本地的副本
+type listInvalidation struct {
+	Node string   `json:"node"`
+	Keys []string `json:"keys"`
+}
+
+// cachedObj 存进Redis的对象。model.Obj是接口没法直接反序列化，哈希用字符串存
+type cachedObj struct {
+	Id           uuid.UUID `json:"id"`
+	Path         string    `json:"path"`
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	ModifiedTime time.Time `json:"modified"`
+	CreatedTime  time.Time `json:"created"`
+	IsFolder     bool      `json:"is_dir"`
+	Hash         string    `json:"hash"`
+}
+
+type cachedList struct {
+	Objs   []cachedObj `json:"objs"`
+	Expire time.Time   `json:"expire"`
+}
+
+// newCachedList 驱动自己的对象类型(别名、压缩包条目)带着存不进Redis的字段，这种列表只放本地
+func newCachedList(objs []model.Obj, expiration time.Duration) (*cachedList, bool) {
+	list := &cachedList{Objs: make([]cachedObj, 0, len(objs)), Expire: time.Now().Add(expiration)}
+	for _, obj := range objs {
+		o, ok := model.UnwrapObj(obj).(*model.Object)
+		if !ok {
+			return nil, false
+		}
+		list.Objs = append(list.Objs, cachedObj{
+			Id:           o.Id,
+			Path:         o.Path,
+			Name:         o.Name,
+			Size:         o.Size,
+			ModifiedTime: o.ModifiedTime,
+			CreatedTime:  o.CreatedTime,
+			IsFolder:     o.IsFolder,
+			Hash:         o.HashInfo.String(),
+		})
+	}
+	return list, true
+}
+
+func (l *cachedList) objs() []model.Obj {
+	objs := make([]model.Obj, 0, len(l.Objs))
+	for _, o := range l.Objs {
+		objs = append(objs, &model.Object{
+			Id:           o.Id,
+			Path:         o.Path,
+			Name:         o.Name,
+			Size:         o.Size,
+			ModifiedTime: o.ModifiedTime,
+			CreatedTime:  o.CreatedTime,
+			IsFolder:     o.IsFolder,
+			HashInfo:     utils.FromString(o.Hash),
+		})
+	}
+	model.WrapObjsName(objs)
+	return objs
+}
+
+// redisListCache 本地内存在前、Redis在后的两级缓存。
+// 每次改动(Set/Del)都会把key发到listInvalidateChannel，其它节点收到后删掉本地副本，下次从Redis读新的；
+// 列目录时填进来的(Fill)只写Redis不通知，不然每次列目录都会冲掉所有节点的本地缓存。
+// Redis出错时退回只用本地缓存，这段时间节点之间互相看不到修改，最多旧到缓存过期。
+// 断开期间改过的key记在pending里，恢复后先从Redis删掉并通知别的节点，再清空本地缓存，
+// 不然本地清掉之后会从Redis读回改之前的列表
+type redisListCache struct {
+	store ListCacheStore
+	local *memListCache
+	node  string
+	// 非0时表示Redis出过错，这个时间(UnixNano)之前不再访问Redis
+	downUntil atomic.Int64
+
+	pendingMu sync.Mutex
+	pending   map[string]struct{}
+}
+
+// NewRedisListCache 创建Redis列表缓存并订阅失效消息，ctx取消后停止订阅
+func NewRedisListCache(ctx context.Context, store ListCacheStore) ListCache {
+	c := &redisListCache{
+		store:   store,
+		local:   newMemListCache(),
+		node:    uuid.NewString(),
+		pending: make(map[string]struct{}),
+	}
+	go store.Subscribe(ctx, listInvalidateChannel, c.resync, c.onInvalidate)
+	return c
+}
+
+func (c *redisListCache) Get(key string) ([]model.Obj, bool) {
+	if objs, ok := c.local.Get(key); ok {
+		return objs, true
+	}
+	if !c.available() {
+		return nil, false
+	}
+	var list cachedList
+	if err := c.store.GetFileListCache(key, &list); err != nil {
+		if !errors.Is(err, goredis.Nil) {
+			c.markDown(err)
+		}
+		return nil, false
+	}
+	c.markUp()
+	ttl := time.Until(list.Expire)
+	if ttl <= 0 {
+		return nil, false
+	}
+	objs := list.objs()
+	c.local.Set(key, objs, ttl)
+	return objs, true
+}
+
+func (c *redisListCache) Fill(key string, objs []model.Obj, expiration time.Duration) {
+	c.local.Fill(key, objs, expiration)
+	// 断开期间填的不用记进pending，恢复时本地缓存反正会清空
+	if !c.available() {
+		return
+	}
+	var err error
+	if list, ok := newCachedList(objs, expiration); ok && expiration > 0 && len(objs) > 0 {
+		err = c.store.SetFileListCache(key, list, expiration)
+	} else {
+		err = c.store.DelFileListCache(key)
+	}
+	if err != nil {
+		c.markDown(err)
+		return
+	}
+	c.markUp()
+}
+
+func (c *redisListCache) Set(key string, objs []model.Obj, expiration time.Duration) {
+	c.local.Set(key, objs, expiration)
+	if !c.available() {
+		c.addPending(key)
+		return
+	}
+	var err error
+	if list, ok := newCachedList(objs, expiration); ok && expiration > 0 {
+		err = c.store.SetFileListCache(key, list, expiration)
+	} else {
+		// 存不进Redis的也要把旧的删掉，不然别的节点会读到旧列表
+		err = c.store.DelFileListCache(key)
+	}
+	c.publish(key, err)
+}
+
+func (c *redisListCache) Del(key string) {
+	c.local.Del(key)
+	if !c.available() {
+		c.addPending(key)
+		return
+	}
+	c.publish(key, c.store.DelFileListCache(key))
+}
+
+func (c *redisListCache) publish(key string, err error) {
+	if err == nil {
+		err = c.invalidate([]string{key})
+	}
+	if err != nil {
+		c.addPending(key)
+		c.markDown(err)
+		return
+	}
+	c.markUp()
+}
+
+func (c *redisListCache) invalidate(keys []string) error {
+	msg, _ := json.Marshal(listInvalidation{Node: c.node, Keys: keys})
+	return c.store.Publish(listInvalidateChannel, string(msg))
+}
+
+func (c *redisListCache) addPending(key string) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	c.pending[key] = struct{}{}
+}
+
+// flushPending 把断开期间改过的key从Redis删掉并通知别的节点，失败时留着下次再试
+func (c *redisListCache) flushPending() error {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	if len(c.pending) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(c.pending))
+	for key := range c.pending {
+		if err := c.store.DelFileListCache(key); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	if err := c.invalidate(keys); err != nil {
+		return err
+	}
+	clear(c.pending)
+	return nil
+}
+
+func (c *redisListCache) onInvalidate(payload string) {
+	var msg listInvalidation
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		log.Printf("bad list cache invalidation: %v", err)
+		return
+	}
+	if msg.Node == c.node {
+		return
+	}
+	for _, key := range msg.Keys {
+		c.local.Del(key)
+	}
+}
+
+// resync 每次(重新)订阅上都会调用，断线期间的失效消息收不到，本地缓存全部作废。
+// 订阅上了说明Redis又能用了，断开期间改过的key马上处理，不能等这个节点下次访问Redis，
+// 不然别的节点这段时间会从Redis读到改之前的列表
+func (c *redisListCache) resync() {
+	c.local.Clear()
+	c.downUntil.Store(0)
+	if err := c.flushPending(); err != nil {
+		c.markDown(err)
+	}
+}
+
+// available 能不能访问Redis。刚恢复时要先处理完pending，再读Redis才不会读到旧的
+func (c *redisListCache) available() bool {
+	if time.Now().UnixNano() < c.downUntil.Load() {
+		return false
+	}
+	if err := c.flushPending(); err != nil {
+		c.markDown(err)
+		return false
+	}
+	return true
+}
+
+func (c *redisListCache) markDown(err error) {
+	if c.downUntil.Swap(time.Now().Add(listCacheRetry).UnixNano()) == 0 {
+		log.Printf("Redis list cache unavailable, falling back to local cache: %v", err)
+	}
+}
+
+func (c *redisListCache) markUp() {
+	if c.downUntil.Load() != 0 && c.downUntil.Swap(0) != 0 {
+		log.Println("Redis list cache recovered")
+		c.local.Clear()
+	}
+}
@@ -0,0 +1,257 @@
+package op_test
+
+import (
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// fakeStore 假的Redis，几个ListCache共用一个就相当于几个节点连着同一个Redis
+type fakeStore struct {
+	mu       sync.Mutex
+	data     map[string][]byte
+	subs     []func(string)
+	resubs   []func()
+	down     bool
+	calls    int
+	subReady chan struct{}
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{data: make(map[string][]byte), subReady: make(chan struct{}, 10)}
+}
+
+var errStoreDown = errors.New("connection refused")
+
+func (s *fakeStore) do(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.down {
+		return errStoreDown
+	}
+	return fn()
+}
+
+func (s *fakeStore) SetFileListCache(path string, files interface{}, expiration time.Duration) error {
+	return s.do(func() (err error) {
+		s.data[path], err = json.Marshal(files)
+		return
+	})
+}
+
+func (s *fakeStore) GetFileListCache(path string, dest interface{}) error {
+	return s.do(func() error {
+		data, ok := s.data[path]
+		if !ok {
+			return goredis.Nil
+		}
+		return json.Unmarshal(data, dest)
+	})
+}
+
+func (s *fakeStore) DelFileListCache(path string) error {
+	return s.do(func() error {
+		delete(s.data, path)
+		return nil
+	})
+}
+
+func (s *fakeStore) Publish(channel string, payload string) error {
+	var subs []func(string)
+	if err := s.do(func() error {
+		subs = s.subs
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		sub(payload)
+	}
+	return nil
+}
+
+func (s *fakeStore) Subscribe(ctx context.Context, channel string, onSubscribe func(), onMessage func(payload string)) {
+	s.mu.Lock()
+	s.subs = append(s.subs, onMessage)
+	s.resubs = append(s.resubs, onSubscribe)
+	s.mu.Unlock()
+	onSubscribe()
+	s.subReady <- struct{}{}
+	<-ctx.Done()
+}
+
+func (s *fakeStore) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+// reconnect 模拟订阅断线重连
+func (s *fakeStore) reconnect() {
+	s.mu.Lock()
+	resubs := s.resubs
+	s.mu.Unlock()
+	for _, resub := range resubs {
+		resub()
+	}
+}
+
+func (s *fakeStore) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func newNode(t *testing.T, ctx context.Context, store *fakeStore) op.ListCache {
+	t.Helper()
+	c := op.NewRedisListCache(ctx, store)
+	select {
+	case <-store.subReady:
+	case <-time.After(time.Second):
+		t.Fatal("not subscribed")
+	}
+	return c
+}
+
+func names(objs []model.Obj) string {
+	var s string
+	for _, obj := range objs {
+		s += obj.GetName() + ","
+	}
+	return s
+}
+
+func TestRedisListCacheInvalidation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := newFakeStore()
+	a, b := newNode(t, ctx, store), newNode(t, ctx, store)
+
+	hash := utils.NewHashInfo(utils.MD5, "d41d8cd98f00b204e9800998ecf8427e")
+	a.Set("/m/dir", []model.Obj{&model.Object{Name: "a.txt", Size: 3, HashInfo: hash}}, time.Minute)
+	objs, ok := b.Get("/m/dir")
+	if !ok || names(objs) != "a.txt," {
+		t.Fatalf("other node got %q %v", names(objs), ok)
+	}
+	if objs[0].GetSize() != 3 || objs[0].GetHash().GetHash(utils.MD5) != hash.GetHash(utils.MD5) {
+		t.Fatalf("obj was not restored: %+v", model.UnwrapObj(objs[0]))
+	}
+
+	// b已经有本地副本了，a改了之后b要丢掉它重新读
+	a.Set("/m/dir", []model.Obj{&model.Object{Name: "a.txt"}, &model.Object{Name: "b", IsFolder: true}}, time.Minute)
+	if objs, _ = b.Get("/m/dir"); names(objs) != "a.txt,b," {
+		t.Fatalf("stale listing on other node: %q", names(objs))
+	}
+	a.Del("/m/dir")
+	if _, ok = b.Get("/m/dir"); ok {
+		t.Fatal("deleted listing still cached on other node")
+	}
+
+	// 不缓存的和驱动自己的对象类型不进Redis
+	a.Set("/m/zero", []model.Obj{&model.Object{Name: "x"}}, 0)
+	a.Set("/m/custom", []model.Obj{&struct{ model.Object }{model.Object{Name: "x"}}}, time.Minute)
+	if _, ok = b.Get("/m/zero"); ok {
+		t.Fatal("listing without expiration was shared")
+	}
+	if _, ok = b.Get("/m/custom"); ok {
+		t.Fatal("custom objects were shared")
+	}
+	if _, ok = a.Get("/m/custom"); !ok {
+		t.Fatal("custom objects should stay in local cache")
+	}
+}
+
+func TestRedisListCacheFallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := newFakeStore()
+	a, b := newNode(t, ctx, store), newNode(t, ctx, store)
+
+	store.setDown(true)
+	a.Set("/m/dir", []model.Obj{&model.Object{Name: "a.txt"}}, time.Minute)
+	if objs, ok := a.Get("/m/dir"); !ok || names(objs) != "a.txt," {
+		t.Fatalf("local cache not used while redis is down: %q %v", names(objs), ok)
+	}
+	// 出错之后一段时间内不再碰Redis
+	calls := store.callCount()
+	a.Set("/m/other", nil, time.Minute)
+	a.Del("/m/dir")
+	if store.callCount() != calls {
+		t.Fatal("redis was called during backoff")
+	}
+
+	// 重连之后本地缓存作废，又能互相通知了
+	store.setDown(false)
+	store.reconnect()
+	if _, ok := a.Get("/m/other"); ok {
+		t.Fatal("local cache was not cleared after reconnect")
+	}
+	a.Set("/m/dir", []model.Obj{&model.Object{Name: "b.txt"}}, time.Minute)
+	if objs, ok := b.Get("/m/dir"); !ok || names(objs) != "b.txt," {
+		t.Fatalf("listing not shared after recovery: %q %v", names(objs), ok)
+	}
+}
+
+// Redis断开期间改过的列表，恢复后不能从Redis读回改之前的
+func TestRedisListCacheChangesDuringOutage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := newFakeStore()
+	a, b := newNode(t, ctx, store), newNode(t, ctx, store)
+
+	a.Set("/m/dir", []model.Obj{&model.Object{Name: "old.txt"}}, time.Minute)
+	if _, ok := b.Get("/m/dir"); !ok {
+		t.Fatal("listing not shared")
+	}
+
+	store.setDown(true)
+	a.Set("/m/dir", []model.Obj{&model.Object{Name: "new.txt"}}, time.Minute)
+	a.Del("/m/gone")
+	store.setDown(false)
+	store.reconnect()
+
+	for name, c := range map[string]op.ListCache{"a": a, "b": b} {
+		if objs, ok := c.Get("/m/dir"); ok && names(objs) != "new.txt," {
+			t.Fatalf("node %s read the listing from before the outage: %q", name, names(objs))
+		}
+	}
+	a.Set("/m/dir", []model.Obj{&model.Object{Name: "b.txt"}}, time.Minute)
+	if objs, ok := b.Get("/m/dir"); !ok || names(objs) != "b.txt," {
+		t.Fatalf("listing not shared after recovery: %q %v", names(objs), ok)
+	}
+}
+
+// 列目录填缓存不算改动，别的节点的本地副本不能被冲掉，但没有副本的节点能从Redis读到
+func TestRedisListCacheFillDoesNotInvalidate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := newFakeStore()
+	a, b, c := newNode(t, ctx, store), newNode(t, ctx, store), newNode(t, ctx, store)
+
+	b.Fill("/m/dir", []model.Obj{&model.Object{Name: "b.txt"}}, time.Minute)
+	a.Fill("/m/dir", []model.Obj{&model.Object{Name: "a.txt"}}, time.Minute)
+	if objs, ok := b.Get("/m/dir"); !ok || names(objs) != "b.txt," {
+		t.Fatalf("fill on another node dropped the local copy: %q %v", names(objs), ok)
+	}
+	if objs, ok := c.Get("/m/dir"); !ok || names(objs) != "a.txt," {
+		t.Fatalf("filled listing not shared: %q %v", names(objs), ok)
+	}
+
+	// 空列表不缓存，Redis里旧的也删掉
+	a.Fill("/m/dir", nil, time.Minute)
+	if _, ok := a.Get("/m/dir"); ok {
+		t.Fatal("empty listing was cached")
+	}
+	if objs, ok := newNode(t, ctx, store).Get("/m/dir"); ok {
+		t.Fatalf("stale listing left in redis: %q", names(objs))
+	}
+}
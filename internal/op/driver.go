@@ -3,7 +3,12 @@ package op
 import (
 	"HelaList/configs"
 	"HelaList/internal/driver"
+	"bytes"
+	"encoding/json"
+	stderrors "errors"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -52,6 +57,7 @@ func GetDriverNames() []string {
 	for k := range driverInfoMap {
 		driverNames = append(driverNames, k)
 	}
+	slices.Sort(driverNames)
 	return driverNames
 }
 
@@ -59,6 +65,110 @@ func GetDriverInfoMap() map[string]driver.Info {
 	return driverInfoMap
 }
 
+func GetDriverInfo(name string) (driver.Info, error) {
+	info, ok := driverInfoMap[name]
+	if !ok {
+		return driver.Info{}, errors.Errorf("no driver named: %s", name)
+	}
+	return info, nil
+}
+
+// ErrInvalidAddition Addition没通过校验，handler据此返回400
+var ErrInvalidAddition = stderrors.New("invalid addition")
+
+// ValidateAddition 按驱动的Additional项检查存储的Addition，返回补全了默认值的Addition。
+// 没填的字段用默认值，必填项不能为空，select的值要在选项里，类型要和驱动的字段对得上
+func ValidateAddition(driverName, addition string) (string, error) {
+	info, err := GetDriverInfo(driverName)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(addition) == "" {
+		addition = "{}"
+	}
+	values := map[string]any{}
+	dec := json.NewDecoder(strings.NewReader(addition))
+	dec.UseNumber()
+	if err = dec.Decode(&values); err != nil {
+		return "", errors.Wrapf(ErrInvalidAddition, "addition is not a json object: %v", err)
+	}
+	for _, item := range info.Additional {
+		v, ok := values[item.Name]
+		if !ok || v == nil {
+			if item.Default != "" {
+				if values[item.Name], err = defaultValue(item); err != nil {
+					return "", err
+				}
+				continue
+			}
+			if item.Required {
+				return "", errors.Wrapf(ErrInvalidAddition, "%s is required", item.Name)
+			}
+			continue
+		}
+		if err = checkItem(item, v); err != nil {
+			return "", err
+		}
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	// 最后按驱动的结构体解析一遍，整数字段填了小数这类问题在这里报出来
+	driverNew, err := GetDriver(driverName)
+	if err != nil {
+		return "", err
+	}
+	dec = json.NewDecoder(bytes.NewReader(data))
+	if err = dec.Decode(driverNew().GetAddition()); err != nil {
+		return "", errors.Wrapf(ErrInvalidAddition, "%v", err)
+	}
+	return string(data), nil
+}
+
+func defaultValue(item driver.Item) (any, error) {
+	switch item.Type {
+	case configs.TypeBool:
+		b, err := strconv.ParseBool(item.Default)
+		if err != nil {
+			return nil, errors.Errorf("bad default of %s: %s", item.Name, item.Default)
+		}
+		return b, nil
+	case configs.TypeNumber:
+		if _, err := strconv.ParseFloat(item.Default, 64); err != nil {
+			return nil, errors.Errorf("bad default of %s: %s", item.Name, item.Default)
+		}
+		return json.Number(item.Default), nil
+	}
+	return item.Default, nil
+}
+
+func checkItem(item driver.Item, v any) error {
+	switch item.Type {
+	case configs.TypeBool:
+		if _, ok := v.(bool); !ok {
+			return errors.Wrapf(ErrInvalidAddition, "%s must be a boolean", item.Name)
+		}
+	case configs.TypeNumber:
+		if _, ok := v.(json.Number); !ok {
+			return errors.Wrapf(ErrInvalidAddition, "%s must be a number", item.Name)
+		}
+	default:
+		s, ok := v.(string)
+		if !ok {
+			return errors.Wrapf(ErrInvalidAddition, "%s must be a string", item.Name)
+		}
+		if item.Required && strings.TrimSpace(s) == "" {
+			return errors.Wrapf(ErrInvalidAddition, "%s is required", item.Name)
+		}
+		if item.Type == configs.TypeSelect && item.Options != "" && s != "" &&
+			!slices.Contains(strings.Split(item.Options, ","), s) {
+			return errors.Wrapf(ErrInvalidAddition, "%s must be one of %s", item.Name, item.Options)
+		}
+	}
+	return nil
+}
+
 func getMainItems(config driver.Config) []driver.Item {
 	items := []driver.Item{{
 		Name:     "mount_path",
@@ -138,7 +248,7 @@ func getAdditionalItems(t reflect.Type, defaultRoot string) []driver.Item {
 		}
 		item := driver.Item{
 			Name:     name,
-			Type:     strings.ToLower(field.Type.Name()),
+			Type:     itemType(field.Type),
 			Default:  tag.Get("default"),
 			Options:  tag.Get("options"),
 			Required: tag.Get("required") == "true",
@@ -153,11 +263,20 @@ func getAdditionalItems(t reflect.Type, defaultRoot string) []driver.Item {
 			}
 			item.Required = item.Default != ""
 		}
-		// set default type to string
-		if item.Type == "" {
-			item.Type = "string"
-		}
 		items = append(items, item)
 	}
 	return items
 }
+
+// itemType 没写type标签时按字段类型推断，前端和校验只认configs里的几种类型
+func itemType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return configs.TypeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return configs.TypeNumber
+	}
+	return configs.TypeString
+}
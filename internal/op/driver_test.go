@@ -0,0 +1,113 @@
+package op_test
+
+import (
+	"HelaList/configs"
+	"HelaList/drivers/memory"
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// validateDriver 借内存存储的实现，只换掉配置项
+type validateDriver struct {
+	memory.Memory
+	addition validateAddition
+}
+
+type validateAddition struct {
+	driver.RootPath
+	Name  string `json:"name" required:"true"`
+	Mode  string `json:"mode" type:"select" options:"fast,safe" default:"safe"`
+	Count int    `json:"count" type:"number" default:"3"`
+	Flag  bool   `json:"flag" default:"true"`
+	Ratio int    `json:"ratio"`
+}
+
+func (d *validateDriver) Config() driver.Config {
+	return driver.Config{Name: "validate_test", LocalSort: true, DefaultRoot: "/"}
+}
+
+func (d *validateDriver) GetAddition() driver.Additional {
+	return &d.addition
+}
+
+func init() {
+	op.RegisterDriver(func() driver.Driver {
+		return &validateDriver{}
+	})
+}
+
+func TestDriverInfo(t *testing.T) {
+	info, err := op.GetDriverInfo("validate_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := map[string]string{}
+	for _, item := range info.Additional {
+		types[item.Name] = item.Type
+	}
+	want := map[string]string{
+		"root_folder_path": configs.TypeString,
+		"name":             configs.TypeString,
+		"mode":             configs.TypeSelect,
+		"count":            configs.TypeNumber,
+		"flag":             configs.TypeBool,
+		"ratio":            configs.TypeNumber,
+	}
+	for name, typ := range want {
+		if types[name] != typ {
+			t.Fatalf("type of %s = %q, want %q", name, types[name], typ)
+		}
+	}
+	if _, err = op.GetDriverInfo("missing"); err == nil {
+		t.Fatal("unknown driver should fail")
+	}
+}
+
+func TestValidateAddition(t *testing.T) {
+	got, err := op.ValidateAddition("validate_test", `{"name":"n"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a validateAddition
+	if err = json.Unmarshal([]byte(got), &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Mode != "safe" || a.Count != 3 || !a.Flag || a.RootFolderPath != "/" {
+		t.Fatalf("defaults are not filled: %+v", a)
+	}
+
+	for _, addition := range []string{
+		`{}`,
+		`{"name":"  "}`,
+		`{"name":"n","mode":"slow"}`,
+		`{"name":"n","count":"3"}`,
+		`{"name":"n","count":1.5}`,
+		`{"name":"n","flag":"yes"}`,
+		`{"name":1}`,
+		`[]`,
+	} {
+		if _, err = op.ValidateAddition("validate_test", addition); !errors.Is(err, op.ErrInvalidAddition) {
+			t.Fatalf("%s: want invalid addition, got %v", addition, err)
+		}
+	}
+}
+
+func TestCreateStorageRejectsBadAddition(t *testing.T) {
+	mount(t, "/op-validate-setup")
+	_, err := op.CreateStorage(context.Background(), model.Storage{
+		MountPath: "/op-validate",
+		Driver:    "validate_test",
+		Addition:  `{"mode":"slow"}`,
+	})
+	if !errors.Is(err, op.ErrInvalidAddition) {
+		t.Fatalf("want invalid addition, got %v", err)
+	}
+	if op.HasStorage("/op-validate") {
+		t.Fatal("bad storage was mounted")
+	}
+}
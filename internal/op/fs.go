@@ -31,7 +31,6 @@ import (
 要么，你就顺从OpenList。毕竟，你要是自己魔改，无非也就是把他们改成泛型了。
 */
 
-var listCache = cache.NewMemCache(cache.WithShards[[]model.Obj](64)) // 文件缓存
 // singleflight用于将短时间内对多个统一key的并发请求进行合并，防止请求出现冲突
 var listGroup singleflight.Group[[]model.Obj]
 
@@ -58,7 +57,7 @@ func updateCacheObj(storage driver.Driver, path string, oldObj model.Obj, newObj
 				break
 			}
 		}
-		listCache.Set(key, objs, cache.WithEx[[]model.Obj](time.Minute*time.Duration(storage.GetStorage().CacheExpiration)))
+		listCache.Set(key, objs, time.Minute*time.Duration(storage.GetStorage().CacheExpiration))
 	}
 }
 
@@ -73,7 +72,7 @@ func delCacheObj(storage driver.Driver, path string, obj model.Obj) {
 				break
 			}
 		}
-		listCache.Set(key, objs, cache.WithEx[[]model.Obj](time.Minute*time.Duration(storage.GetStorage().CacheExpiration)))
+		listCache.Set(key, objs, time.Minute*time.Duration(storage.GetStorage().CacheExpiration))
 	}
 }
 
@@ -102,9 +101,11 @@ func addCacheObj(storage driver.Driver, path string, newObj model.Obj) {
 	key := Key(storage, path)
 	objs, ok := listCache.Get(key)
 	if ok {
+		// 只改本地切片的话Redis里还是旧的，所以同名的替换完也要Set回去
 		for i, obj := range objs {
 			if obj.GetName() == newObj.GetName() {
 				objs[i] = newObj
+				listCache.Set(key, objs, time.Minute*time.Duration(storage.GetStorage().CacheExpiration))
 				return
 			}
 		}
@@ -116,7 +117,7 @@ func addCacheObj(storage driver.Driver, path string, newObj model.Obj) {
 			objs = append([]model.Obj{newObj}, objs...)
 		}
 
-		listCache.Set(key, objs, cache.WithEx[[]model.Obj](time.Minute*time.Duration(storage.GetStorage().CacheExpiration)))
+		listCache.Set(key, objs, time.Minute*time.Duration(storage.GetStorage().CacheExpiration))
 	}
 }
 
@@ -200,6 +201,9 @@ func List(ctx context.Context, storage driver.Driver, path string, args model.Li
 		return nil, errors.Errorf("storage not init: %s", storage.GetStorage().Status)
 	}
 	path = utils.FixAndCleanPath(path)
+	if archive, archivePath, inner, ok := findArchive(ctx, storage, path); ok {
+		return listArchive(ctx, storage, archive, archivePath, inner, args)
+	}
 	key := Key(storage, path)
 	if !args.Refresh {
 		if files, ok := listCache.Get(key); ok {
@@ -219,7 +223,8 @@ func List(ctx context.Context, storage driver.Driver, path string, args model.Li
 			return nil, errors.Wrapf(err, "failed to list objs")
 		}
 		for _, f := range files {
-			if s, ok := f.(model.SetPath); ok {
+			// 驱动自己填了路径（比如本地的宿主机路径、S3的key）就不要覆盖
+			if s, ok := f.(model.SetPath); ok && f.GetPath() == "" {
 				s.SetPath(stdpath.Join(args.ReqPath, f.GetName()))
 			}
 		}
@@ -230,13 +235,7 @@ func List(ctx context.Context, storage driver.Driver, path string, args model.Li
 		}(utils.GetFullPath(storage.GetStorage().MountPath, path), files)
 
 		if !storage.Config().NoCache {
-			if len(files) > 0 {
-				// log.Debugf("set cache: %s => %+v", key, files)
-				listCache.Set(key, files, cache.WithEx[[]model.Obj](time.Minute*time.Duration(storage.GetStorage().CacheExpiration)))
-			} else {
-				// log.Debugf("del cache: %s", key)
-				listCache.Del(key)
-			}
+			listCache.Fill(key, files, time.Minute*time.Duration(storage.GetStorage().CacheExpiration))
 		}
 		return files, nil
 	})
@@ -264,6 +263,9 @@ func MakeDir(ctx context.Context, storage driver.Driver, path string, lazyCache
 				if err != nil {
 					return nil, errors.WithMessagef(err, "failed to get parent dir [%s]", parentPath)
 				}
+				if isArchiveObj(parentDir) {
+					return nil, errArchiveReadOnly
+				}
 
 				switch s := storage.(type) {
 				case driver.MkdirResult:
@@ -311,6 +313,9 @@ func Move(ctx context.Context, storage driver.Driver, srcPath, dstDirPath string
 	if err != nil {
 		return errors.WithMessage(err, "failed to get dst dir")
 	}
+	if isArchiveObj(srcObj) || isArchiveObj(dstDir) {
+		return errArchiveReadOnly
+	}
 	srcDirPath := stdpath.Dir(srcPath)
 
 	switch s := storage.(type) {
@@ -349,6 +354,9 @@ func Rename(ctx context.Context, storage driver.Driver, srcPath, dstName string,
 		return errors.WithMessage(err, "failed to get src object")
 	}
 	srcObj := model.UnwrapObj(srcRawObj)
+	if isArchiveObj(srcObj) {
+		return errArchiveReadOnly
+	}
 	srcDirPath := stdpath.Dir(srcPath)
 
 	switch s := storage.(type) {
@@ -387,6 +395,9 @@ func Copy(ctx context.Context, storage driver.Driver, srcPath, dstDirPath string
 	if err != nil {
 		return errors.WithMessage(err, "failed to get dst dir")
 	}
+	if isArchiveObj(srcObj) || isArchiveObj(dstDir) {
+		return errArchiveReadOnly
+	}
 
 	switch s := storage.(type) {
 	case driver.CopyResult:
@@ -426,6 +437,9 @@ func Remove(ctx context.Context, storage driver.Driver, path string) error {
 		}
 		return errors.WithMessage(err, "failed to get object")
 	}
+	if isArchiveObj(rawObj) {
+		return errArchiveReadOnly
+	}
 	dirPath := stdpath.Dir(path)
 
 	switch s := storage.(type) {
@@ -475,6 +489,8 @@ func Put(ctx context.Context, storage driver.Driver, dstDirPath string, file mod
 	dstPath := stdpath.Join(dstDirPath, file.GetName())
 	tempName := file.GetName() + ".openlist_to_delete"
 	tempPath := stdpath.Join(dstDirPath, tempName)
+	// 要校验哈希时也先把旧文件挪开，不然驱动原地覆盖之后发现传坏了，删掉的就是用户原来的文件
+	keepOld := storage.Config().NoOverwriteUpload || model.HasHash(file.GetHash())
 	fi, err := GetUnwrap(ctx, storage, dstPath)
 	if err == nil {
 		if fi.GetSize() == 0 {
@@ -482,7 +498,7 @@ func Put(ctx context.Context, storage driver.Driver, dstDirPath string, file mod
 			if err != nil {
 				return errors.WithMessagef(err, "while uploading, failed remove existing file which size = 0")
 			}
-		} else if storage.Config().NoOverwriteUpload {
+		} else if keepOld {
 			// try to rename old obj
 			err = Rename(ctx, storage, dstPath, tempName)
 			if err != nil {
@@ -501,36 +517,31 @@ func Put(ctx context.Context, storage driver.Driver, dstDirPath string, file mod
 	if err != nil {
 		return errors.WithMessagef(err, "failed to get dir [%s]", dstDirPath)
 	}
+	if isArchiveObj(parentDir) {
+		return errArchiveReadOnly
+	}
 	if up == nil {
 		up = func(p float64) {}
 	}
 
-	switch s := storage.(type) {
-	case driver.PutResult:
-		var newObj model.Obj
-		newObj, err = s.Put(ctx, parentDir, file, up)
-		if err == nil {
-			if newObj != nil {
-				addCacheObj(storage, dstDirPath, model.WrapObjName(newObj))
-			} else if !utils.IsBool(lazyCache...) {
-				DeleteCache(storage, dstDirPath)
-			}
-		}
-	case driver.Put:
-		err = s.Put(ctx, parentDir, file, up)
-		if err == nil && !utils.IsBool(lazyCache...) {
+	var newObj model.Obj
+	newObj, err = putFile(ctx, storage, parentDir, dstPath, file, up)
+	if errors.Is(err, errPutNotImplemented) {
+		return err
+	}
+	if err == nil {
+		if newObj != nil {
+			addCacheObj(storage, dstDirPath, model.WrapObjName(newObj))
+		} else if !utils.IsBool(lazyCache...) {
 			DeleteCache(storage, dstDirPath)
 		}
-	default:
-		return fmt.Errorf("NotImplement")
 	}
 	logrus.Debugf("put file [%s] done", file.GetName())
-	if storage.Config().NoOverwriteUpload && fi != nil && fi.GetSize() > 0 {
+	if keepOld && fi != nil && fi.GetSize() > 0 {
 		if err != nil {
 			// 如果上传失败，就恢复旧文件
-			err := Rename(ctx, storage, tempPath, file.GetName())
-			if err != nil {
-				fmt.Errorf("failed recover old obj: %+v", err)
+			if err := Rename(ctx, storage, tempPath, file.GetName()); err != nil {
+				logrus.Warnf("failed recover old obj: %+v", err)
 			}
 		} else {
 			// 如果上传成功，就把旧文件删除
@@ -547,6 +558,124 @@ func Put(ctx context.Context, storage driver.Driver, dstDirPath string, file mod
 	return errors.WithStack(err)
 }
 
+var errPutNotImplemented = errors.New("NotImplement")
+
+// putFile 带了可信的哈希时先试秒传，不行再真正上传。上传时顺便算哈希，
+// 和file带的哈希或者存储返回的哈希对不上时删掉传坏的文件并报错
+func putFile(ctx context.Context, storage driver.Driver, parentDir model.Obj, dstPath string, file model.FileStreamer, up driver.UpdateProgress) (model.Obj, error) {
+	expect := file.GetHash()
+	if r, ok := storage.(driver.RapidUpload); ok && model.HasHash(expect) && hashTrusted(file) {
+		obj, ok, err := r.RapidUpload(ctx, parentDir, file)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed rapid upload")
+		}
+		if ok {
+			logrus.Debugf("rapid upload [%s] done", file.GetName())
+			return obj, nil
+		}
+	}
+	var hs *hashStream
+	if model.HasHash(expect) {
+		hs = newHashStream(file, expect)
+		file = hs
+	}
+
+	var newObj model.Obj
+	var err error
+	switch s := storage.(type) {
+	case driver.PutResult:
+		newObj, err = s.Put(ctx, parentDir, file, up)
+	case driver.Put:
+		err = s.Put(ctx, parentDir, file, up)
+	default:
+		return nil, errPutNotImplemented
+	}
+	if err != nil || hs == nil {
+		return newObj, err
+	}
+	if newObj != nil {
+		err = model.CheckHash(expect, newObj.GetHash())
+	}
+	if err == nil {
+		err = model.CheckHash(expect, hs.sum())
+	}
+	if err != nil {
+		if e := Remove(ctx, storage, dstPath); e != nil {
+			logrus.Warnf("failed remove corrupted upload [%s]: %v", dstPath, e)
+		}
+		return nil, errors.WithMessagef(err, "uploaded file [%s] is corrupted", file.GetName())
+	}
+	return newObj, nil
+}
+
+func hashTrusted(file model.FileStreamer) bool {
+	t, ok := file.(model.HashTrusted)
+	return ok && t.IsHashTrusted()
+}
+
+// hashStream 驱动通过Read读文件时顺便算哈希。驱动用RangeRead、GetFile之类的方法
+// 绕过了Read的话读到的不全，这时候算出来的不作数
+type hashStream struct {
+	model.FileStreamer
+	hasher *utils.MultiHasher
+}
+
+func newHashStream(file model.FileStreamer, expect utils.HashInfo) *hashStream {
+	var types []*utils.HashType
+	for _, ht := range model.CommonHashes {
+		if expect.GetHash(ht) != "" {
+			types = append(types, ht)
+		}
+	}
+	return &hashStream{FileStreamer: file, hasher: utils.NewMultiHasher(types)}
+}
+
+func (s *hashStream) Read(p []byte) (int, error) {
+	n, err := s.FileStreamer.Read(p)
+	_, _ = s.hasher.Write(p[:n])
+	return n, err
+}
+
+func (s *hashStream) sum() utils.HashInfo {
+	if s.hasher.Size() != s.GetSize() {
+		return utils.HashInfo{}
+	}
+	return *s.hasher.GetHashInfo()
+}
+
+// PutURL 只把地址放进存储，只有实现了PutURLResult的驱动支持
+func PutURL(ctx context.Context, storage driver.Driver, dstDirPath, dstName, url string, lazyCache ...bool) error {
+	if storage.Config().CheckStatus && storage.GetStorage().Status != configs.WORK {
+		return errors.Errorf("storage not init: %s", storage.GetStorage().Status)
+	}
+	s, ok := storage.(driver.PutURLResult)
+	if !ok {
+		return errors.New("not implemented")
+	}
+	dstDirPath = utils.FixAndCleanPath(dstDirPath)
+	err := MakeDir(ctx, storage, dstDirPath)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to make dir [%s]", dstDirPath)
+	}
+	dstDir, err := GetUnwrap(ctx, storage, dstDirPath)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to get dir [%s]", dstDirPath)
+	}
+	if isArchiveObj(dstDir) {
+		return errArchiveReadOnly
+	}
+	newObj, err := s.PutURL(ctx, dstDir, dstName, url)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if newObj != nil {
+		addCacheObj(storage, dstDirPath, model.WrapObjName(newObj))
+	} else if !utils.IsBool(lazyCache...) {
+		DeleteCache(storage, dstDirPath)
+	}
+	return nil
+}
+
 var linkCache = cache.NewMemCache(cache.WithShards[*model.Link](16))
 var linkG = singleflight.Group[*model.Link]{Remember: true}
 var errLinkMFileCache = stderrors.New("ErrLinkMFileCache")
@@ -569,12 +698,13 @@ func Link(ctx context.Context, storage driver.Driver, path string, args model.Li
 				break
 			}
 		}
+	} else if _, _, _, ok := findArchive(ctx, storage, path); ok {
+		// 压缩包里的文件驱动不认识，只能从压缩包的列表里找
+		file, err = GetUnwrap(ctx, storage, path)
+	} else if g, ok := storage.(driver.GetObjInfo); ok {
+		file, err = g.GetObjInfo(ctx, path)
 	} else {
-		if g, ok := storage.(driver.GetObjInfo); ok {
-			file, err = g.GetObjInfo(ctx, path)
-		} else {
-			file, err = GetUnwrap(ctx, storage, path)
-		}
+		file, err = GetUnwrap(ctx, storage, path)
 	}
 	if file == nil {
 		if err != nil {
@@ -585,6 +715,10 @@ func Link(ctx context.Context, storage driver.Driver, path string, args model.Li
 	if file.IsDir() {
 		return nil, nil, errors.WithStack(errors.New("NotFile"))
 	}
+	if a, ok := asArchiveObj(file); ok {
+		link, err := archiveLink(ctx, storage, a, args)
+		return link, file, err
+	}
 
 	key := stdpath.Join(Key(storage, path), args.Type)
 	if link, ok := linkCache.Get(key); ok {
@@ -0,0 +1,228 @@
+package op
+
+import (
+	"HelaList/configs"
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/generic_sync"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// StorageHealth 一个存储最近一次健康检查的结果
+type StorageHealth struct {
+	MountPath string    `json:"mount_path"`
+	Driver    string    `json:"driver"`
+	Status    string    `json:"status"`
+	Healthy   bool      `json:"healthy"`
+	Latency   int64     `json:"latency"` // 列根目录花的时间，毫秒
+	LastError string    `json:"last_error"`
+	LastCheck time.Time `json:"last_check"`
+	Failures  int       `json:"failures"`   // 连续失败的次数
+	NextRetry time.Time `json:"next_retry"` // 失败后下一次重新初始化的时间
+}
+
+// healthRecord check保证同一个存储同时只有一个检查在跑，mu只保护字段，
+// 这样慢的检查不会卡住查询健康状况的请求
+type healthRecord struct {
+	check sync.Mutex
+	mu    sync.Mutex
+	StorageHealth
+}
+
+var healthMap generic_sync.MapOf[string, *healthRecord]
+
+var healthOnce sync.Once
+
+// StartHealthCheck 按配置的间隔在后台检查所有存储，只会启动一次
+func StartHealthCheck(ctx context.Context) {
+	conf := configs.Conf.Health
+	if !conf.Enabled || conf.Interval <= 0 {
+		return
+	}
+	healthOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(time.Duration(conf.Interval) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					CheckAllStorages(ctx)
+				}
+			}
+		}()
+	})
+}
+
+// CheckAllStorages 检查一轮所有没禁用的存储，还在退避时间里的失败存储跳过
+func CheckAllStorages(ctx context.Context) {
+	storages := GetAllStorages()
+	mountPaths := make(map[string]bool, len(storages))
+	var wg sync.WaitGroup
+	for _, storage := range storages {
+		mountPaths[storage.GetStorage().MountPath] = true
+		if storage.GetStorage().Disabled {
+			continue
+		}
+		wg.Add(1)
+		go func(storage driver.Driver) {
+			defer wg.Done()
+			checkStorage(ctx, storage, false)
+		}(storage)
+	}
+	wg.Wait()
+	// 已经卸载的存储不用再留着记录
+	healthMap.Range(func(mountPath string, _ *healthRecord) bool {
+		if !mountPaths[mountPath] {
+			healthMap.Delete(mountPath)
+		}
+		return true
+	})
+}
+
+// CheckStorage 立刻检查一个存储，失败的存储不管退避时间直接重新初始化
+func CheckStorage(ctx context.Context, mountPath string) (StorageHealth, error) {
+	storage, err := GetStorageByMountPath(mountPath)
+	if err != nil {
+		return StorageHealth{}, err
+	}
+	return checkStorage(ctx, storage, true), nil
+}
+
+func checkStorage(ctx context.Context, storage driver.Driver, force bool) StorageHealth {
+	mountPath := storage.GetStorage().MountPath
+	record, _ := healthMap.LoadOrStore(mountPath, &healthRecord{})
+	record.check.Lock()
+	defer record.check.Unlock()
+
+	now := time.Now()
+	record.mu.Lock()
+	// 上次就是坏的(或者启动时就没初始化成功)，先重新初始化再检查
+	failing := record.Failures > 0 || storage.GetStorage().Status != configs.WORK
+	if failing && !force && now.Before(record.NextRetry) {
+		defer record.mu.Unlock()
+		return record.snapshot(storage)
+	}
+	record.mu.Unlock()
+	wasHealthy := storage.GetStorage().Status == configs.WORK
+
+	var err error
+	if failing {
+		storage, err = reinitStorage(ctx, storage)
+	}
+	var latency time.Duration
+	if err == nil {
+		latency, err = probeStorage(ctx, storage)
+	}
+
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	record.LastCheck = now
+	record.Latency = latency.Milliseconds()
+	if err != nil {
+		record.Failures++
+		record.LastError = err.Error()
+		record.NextRetry = now.Add(backoff(record.Failures))
+		storage.GetStorage().SetStatus(err.Error())
+		logrus.Warnf("storage %s is unhealthy (%d failures): %v", mountPath, record.Failures, err)
+	} else {
+		record.Failures = 0
+		record.LastError = ""
+		record.NextRetry = time.Time{}
+		storage.GetStorage().SetStatus(configs.WORK)
+	}
+	if healthy := err == nil; healthy != wasHealthy {
+		MustSaveDriverStorage(storage)
+		go callStorageHooks("status", storage)
+	}
+	return record.snapshot(storage)
+}
+
+// reinitStorage 用同样的配置新建一个驱动实例初始化，换进storagesMap之后再Drop旧的。
+// 旧实例还在处理别的请求，不能在它上面重新解析Addition、再Init一遍
+func reinitStorage(ctx context.Context, old driver.Driver) (driver.Driver, error) {
+	mountPath := old.GetStorage().MountPath
+	// 检查期间存储被删掉或者已经换了新实例(修改过配置)，就不用再初始化了
+	current, ok := storagesMap.Load(mountPath)
+	if !ok {
+		return old, errors.Errorf("storage %s was removed", mountPath)
+	}
+	if current != old {
+		return current, nil
+	}
+	driverNew, err := GetDriver(old.GetStorage().Driver)
+	if err != nil {
+		return old, errors.WithMessage(err, "failed get driver new")
+	}
+	storage := driverNew()
+	err = initStorage(ctx, *old.GetStorage(), storage)
+	if e := old.Drop(ctx); e != nil {
+		logrus.Warnf("failed drop storage %s: %v", mountPath, e)
+	}
+	return storage, err
+}
+
+// probeStorage 列一次根目录，不走缓存
+func probeStorage(ctx context.Context, storage driver.Driver) (time.Duration, error) {
+	if timeout := configs.Conf.Health.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+	start := time.Now()
+	root, err := Get(ctx, storage, "/")
+	if err == nil {
+		_, err = storage.List(ctx, root, model.ListArgs{Refresh: true})
+	}
+	if err != nil {
+		return time.Since(start), errors.WithMessage(err, "health check failed")
+	}
+	return time.Since(start), nil
+}
+
+// backoff 第n次失败之后等多久再重新初始化
+func backoff(failures int) time.Duration {
+	conf := configs.Conf.Health
+	minBackoff := time.Duration(max(conf.MinBackoff, 1)) * time.Second
+	maxBackoff := time.Duration(max(conf.MaxBackoff, conf.MinBackoff, 1)) * time.Second
+	d := minBackoff
+	for i := 1; i < failures && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+func (r *healthRecord) snapshot(storage driver.Driver) StorageHealth {
+	h := r.StorageHealth
+	h.MountPath = storage.GetStorage().MountPath
+	h.Driver = storage.GetStorage().Driver
+	h.Status = storage.GetStorage().Status
+	h.Healthy = h.Status == configs.WORK && h.Failures == 0
+	return h
+}
+
+// GetStoragesHealth 所有存储的健康状况，还没检查过的只看Status
+func GetStoragesHealth() []StorageHealth {
+	storages := GetAllStorages()
+	res := make([]StorageHealth, 0, len(storages))
+	for _, storage := range storages {
+		if record, ok := healthMap.Load(storage.GetStorage().MountPath); ok {
+			record.mu.Lock()
+			res = append(res, record.snapshot(storage))
+			record.mu.Unlock()
+			continue
+		}
+		res = append(res, (&healthRecord{}).snapshot(storage))
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].MountPath < res[j].MountPath
+	})
+	return res
+}
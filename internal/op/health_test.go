@@ -0,0 +1,132 @@
+package op_test
+
+import (
+	"HelaList/configs"
+	"HelaList/drivers/memory"
+	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 钩子要在init里注册，测试跑起来之后注册会和别的goroutine抢
+var statusChanges = make(chan string, 10)
+
+func init() {
+	op.RegisterStorageHook(func(typ string, storage driver.Driver) {
+		if typ == "status" && storage.GetStorage().MountPath == "/op-health" {
+			statusChanges <- storage.GetStorage().Status
+		}
+	})
+	op.RegisterDriver(func() driver.Driver {
+		return &flaky{}
+	})
+}
+
+// flaky 列目录时按flakyErr出错的内存存储。重新初始化会换新实例，故障开关只能放在包级变量里
+type flaky struct {
+	memory.Memory
+}
+
+var flakyErr atomic.Pointer[error]
+
+func setFlaky(err error) {
+	if err == nil {
+		flakyErr.Store(nil)
+		return
+	}
+	flakyErr.Store(&err)
+}
+
+func (d *flaky) Config() driver.Config {
+	c := d.Memory.Config()
+	c.Name = "flaky"
+	return c
+}
+
+func (d *flaky) List(ctx context.Context, dir model.Obj, args model.ListArgs) ([]model.Obj, error) {
+	if err := flakyErr.Load(); err != nil {
+		return nil, *err
+	}
+	return d.Memory.List(ctx, dir, args)
+}
+
+func findHealth(t *testing.T, mountPath string) op.StorageHealth {
+	t.Helper()
+	for _, h := range op.GetStoragesHealth() {
+		if h.MountPath == mountPath {
+			return h
+		}
+	}
+	t.Fatalf("no health record for %s", mountPath)
+	return op.StorageHealth{}
+}
+
+func TestHealthCheck(t *testing.T) {
+	conf := configs.Conf.Health
+	configs.Conf.Health.MinBackoff, configs.Conf.Health.MaxBackoff = 10, 30
+	defer func() { configs.Conf.Health = conf }()
+
+	first := mountStorage(t, model.Storage{MountPath: "/op-health", Driver: "flaky"})
+	waitChange := func(want bool) {
+		t.Helper()
+		select {
+		case status := <-statusChanges:
+			if (status == configs.WORK) != want {
+				t.Fatalf("status changed to %q", status)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("status hook was not called")
+		}
+	}
+
+	op.CheckAllStorages(context.Background())
+	if h := findHealth(t, "/op-health"); !h.Healthy || h.LastCheck.IsZero() || h.LastError != "" {
+		t.Fatalf("healthy storage: %+v", h)
+	}
+
+	setFlaky(errors.New("backend down"))
+	defer setFlaky(nil)
+	op.CheckAllStorages(context.Background())
+	h := findHealth(t, "/op-health")
+	if h.Healthy || h.Failures != 1 || h.LastError == "" || h.Status == configs.WORK {
+		t.Fatalf("failed storage: %+v", h)
+	}
+	if got := h.NextRetry.Sub(h.LastCheck); got != 10*time.Second {
+		t.Fatalf("first backoff = %v", got)
+	}
+	waitChange(false)
+
+	// 还在退避时间里，定时检查不碰它
+	op.CheckAllStorages(context.Background())
+	if h = findHealth(t, "/op-health"); h.Failures != 1 {
+		t.Fatalf("storage was retried during backoff: %+v", h)
+	}
+
+	// 手动检查不管退避，每次失败间隔翻倍，最多30秒
+	for i, want := range []time.Duration{20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		if h, err := op.CheckStorage(context.Background(), "/op-health"); err != nil {
+			t.Fatal(err)
+		} else if h.Failures != i+2 || h.NextRetry.Sub(h.LastCheck) != want {
+			t.Fatalf("retry %d: %+v", i, h)
+		}
+	}
+
+	setFlaky(nil)
+	h, err := op.CheckStorage(context.Background(), "/op-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Healthy || h.Failures != 0 || h.Status != configs.WORK || !h.NextRetry.IsZero() {
+		t.Fatalf("recovered storage: %+v", h)
+	}
+	waitChange(true)
+	// 重新初始化用的是新实例，正在用旧实例的请求不受影响
+	if d, _ := op.GetStorageByMountPath("/op-health"); d == first || d.GetStorage().Status != configs.WORK {
+		t.Fatal("storage was not replaced by a new instance")
+	}
+}
@@ -0,0 +1,78 @@
+package op_test
+
+import (
+	"HelaList/drivers/memory"
+	"HelaList/internal/driver"
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"HelaList/internal/stream"
+	"context"
+	"strings"
+	"testing"
+)
+
+func mount(t *testing.T, mountPath string) driver.Driver {
+	t.Helper()
+	return mountStorage(t, model.Storage{MountPath: mountPath})
+}
+
+// mountStorage 挂内存存储，负载均衡的测试要带上顺序和策略
+func mountStorage(t *testing.T, storage model.Storage) driver.Driver {
+	t.Helper()
+	storage.CacheExpiration = 30
+	return drivertest.Mount(t, storage)
+}
+
+func put(t *testing.T, d driver.Driver, dirPath, name, content string) {
+	t.Helper()
+	file := &stream.FileStream{
+		Obj:    &model.Object{Name: name, Size: int64(len(content))},
+		Reader: strings.NewReader(content),
+	}
+	if err := op.Put(context.Background(), d, dirPath, file, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMakeDirCreatesParents(t *testing.T) {
+	d := mount(t, "/op-mkdir")
+	if err := op.MakeDir(context.Background(), d, "/a/b/c"); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := op.Get(context.Background(), d, "/a/b/c")
+	if err != nil || !obj.IsDir() {
+		t.Fatalf("get /a/b/c: %v", err)
+	}
+	// 已经存在的目录再建一次不报错，同名文件报错
+	if err = op.MakeDir(context.Background(), d, "/a/b/c"); err != nil {
+		t.Fatal(err)
+	}
+	put(t, d, "/a", "f", "x")
+	if err = op.MakeDir(context.Background(), d, "/a/f"); err == nil {
+		t.Fatal("make dir over a file should fail")
+	}
+}
+
+func TestRemoveRoot(t *testing.T) {
+	d := mount(t, "/op-remove")
+	if err := op.Remove(context.Background(), d, "/"); err == nil {
+		t.Fatal("removing the root folder should be refused")
+	}
+	// 删除不存在的对象视为成功
+	if err := op.Remove(context.Background(), d, "/missing"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOther(t *testing.T) {
+	d := mount(t, "/op-other")
+	put(t, d, "/", "a.txt", "hello")
+	res, err := op.Other(context.Background(), d, model.FsOtherArgs{Path: "/", Method: "stats"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := res.(memory.Stats); s.Files != 1 || s.Bytes != 5 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
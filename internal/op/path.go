@@ -1,8 +1,13 @@
 package op
 
 import (
+	"HelaList/configs"
 	"HelaList/internal/driver"
+	"HelaList/internal/model"
+	stderrors "errors"
+	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 
 	"github.com/OpenListTeam/OpenList/v4/pkg/generic_sync"
@@ -12,9 +17,19 @@ import (
 )
 
 func GetStorageAndActualPath(rawPath string) (storage driver.Driver, actualPath string, err error) {
+	storages, actualPath, err := GetStoragesAndActualPath(rawPath)
+	if err != nil {
+		return nil, "", err
+	}
+	return storages[0], actualPath, nil
+}
+
+// GetStoragesAndActualPath 读操作用，返回按负载均衡策略排好的候选存储，
+// 第一个读失败了可以依次换下一个。同一路径下的存储实际路径都一样
+func GetStoragesAndActualPath(rawPath string) (storages []driver.Driver, actualPath string, err error) {
 	rawPath = utils.FixAndCleanPath(rawPath)
-	storage = GetBalancedStorage(rawPath)
-	if storage == nil {
+	storages = GetBalancedStorages(rawPath)
+	if len(storages) == 0 {
 		if rawPath == "/" {
 			err = errors.New("please add a storage first")
 			return
@@ -22,32 +37,155 @@ func GetStorageAndActualPath(rawPath string) (storage driver.Driver, actualPath
 		err = errors.Errorf("storage not found for rawPath: %s", rawPath)
 		return
 	}
-	logrus.Debugln("use storage: ", storage.GetStorage().MountPath)
-	mountPath := utils.GetActualMountPath(storage.GetStorage().MountPath)
+	logrus.Debugln("use storage: ", storages[0].GetStorage().MountPath)
+	mountPath := utils.GetActualMountPath(storages[0].GetStorage().MountPath)
 	actualPath = utils.FixAndCleanPath(strings.TrimPrefix(rawPath, mountPath))
 	return
 }
 
+// GetWriteStoragesAndActualPath 写操作用，镜像策略返回所有正常的存储，别的策略只返回选中的那个
+func GetWriteStoragesAndActualPath(rawPath string) (storages []driver.Driver, actualPath string, err error) {
+	storages, actualPath, err = GetStoragesAndActualPath(rawPath)
+	if err != nil {
+		return
+	}
+	if len(storages) > 1 && balanceStrategy(storages) == BalanceMirror {
+		return
+	}
+	return storages[:1], actualPath, nil
+}
+
+// SameMount 两个存储是不是挂在同一个路径下(负载均衡的几个副本)
+func SameMount(a, b driver.Driver) bool {
+	return utils.GetActualMountPath(a.GetStorage().MountPath) == utils.GetActualMountPath(b.GetStorage().MountPath)
+}
+
+// 负载均衡策略
+const (
+	BalanceRoundRobin   = "round_robin"   // 轮询
+	BalanceWeighted     = "weighted"      // 按BalanceWeight加权轮询
+	BalanceLeastLatency = "least_latency" // 健康检查延迟最低的优先
+	BalanceFailover     = "failover"      // 按Order排，前面的坏了才用后面的
+	BalanceMirror       = "mirror"        // 读的时候轮询，写的时候每个都写
+)
+
+var ErrInvalidBalance = stderrors.New("invalid balance strategy")
+
+func checkBalance(storage model.Storage) error {
+	switch storage.BalanceStrategy {
+	case "", BalanceRoundRobin, BalanceWeighted, BalanceLeastLatency, BalanceFailover, BalanceMirror:
+	default:
+		return errors.WithMessage(ErrInvalidBalance, storage.BalanceStrategy)
+	}
+	if storage.BalanceWeight < 0 {
+		return errors.WithMessage(ErrInvalidBalance, "weight must not be negative")
+	}
+	return nil
+}
+
 // 当多个虚拟网盘挂载到同一个文件下时，如果要查找网盘，需要轮询查找
 // 这里我有往上提交pr,建议改成*int64进行原子操作，避免高并行出现混乱
 var balanceMap generic_sync.MapOf[string, *int64]
 
+// weighted策略的状态，每个存储当前的权重
+type weightedState struct {
+	mu      sync.Mutex
+	current map[string]int
+}
+
+var weightedMap generic_sync.MapOf[string, *weightedState]
+
 func GetBalancedStorage(path string) driver.Driver {
+	storages := GetBalancedStorages(path)
+	if len(storages) == 0 {
+		return nil
+	}
+	return storages[0]
+}
+
+// GetBalancedStorages 同一路径下的存储按策略排好，状态不是work的跳过。
+// 全都不能用时原样返回，让调用方拿到存储真正的错误
+func GetBalancedStorages(path string) []driver.Driver {
 	path = utils.FixAndCleanPath(path)
 	storages := getStoragesByPath(path)
-	storageNum := len(storages)
-	switch storageNum {
-	case 0:
-		return nil
-	case 1:
-		return storages[0]
+	if len(storages) <= 1 {
+		return storages
+	}
+	working := make([]driver.Driver, 0, len(storages))
+	for _, storage := range storages {
+		if storage.GetStorage().Status == configs.WORK {
+			working = append(working, storage)
+		}
+	}
+	if len(working) == 0 {
+		return storages
+	}
+	virtualPath := utils.GetActualMountPath(storages[0].GetStorage().MountPath)
+	switch balanceStrategy(storages) {
+	case BalanceFailover:
+		sortByOrder(working)
+	case BalanceLeastLatency:
+		sortByOrder(working)
+		slices.SortStableFunc(working, func(a, b driver.Driver) int {
+			return int(storageLatency(a) - storageLatency(b))
+		})
+	case BalanceWeighted:
+		i := pickWeighted(virtualPath, working)
+		working = slices.Concat(working[i:i+1], working[:i], working[i+1:])
 	default:
-		virtualPath := utils.GetActualMountPath(storages[0].GetStorage().MountPath)
 		// 如果不存在则存入一个新的 *int64(0)，LoadOrStore 会返回已存在的值或新值
 		p, _ := balanceMap.LoadOrStore(virtualPath, new(int64))
 		// 原子自增并转换为 0 基索引
 		idx := atomic.AddInt64(p, 1) - 1
-		i := int(idx % int64(storageNum))
-		return storages[i]
+		i := int(idx % int64(len(working)))
+		working = slices.Concat(working[i:], working[:i])
+	}
+	return working
+}
+
+// balanceStrategy 按挂载路径排序后第一个填了策略的存储为准
+func balanceStrategy(storages []driver.Driver) string {
+	for _, storage := range storages {
+		if s := storage.GetStorage().BalanceStrategy; s != "" {
+			return s
+		}
+	}
+	return BalanceRoundRobin
+}
+
+func sortByOrder(storages []driver.Driver) {
+	slices.SortStableFunc(storages, func(a, b driver.Driver) int {
+		return a.GetStorage().Order - b.GetStorage().Order
+	})
+}
+
+// storageLatency 最近一次健康检查的延迟，还没检查过的算0，让它先被用上
+func storageLatency(storage driver.Driver) int64 {
+	record, ok := healthMap.Load(storage.GetStorage().MountPath)
+	if !ok {
+		return 0
+	}
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	return record.Latency
+}
+
+// pickWeighted 平滑加权轮询(和nginx一样)：每次所有存储加上自己的权重，
+// 选当前权重最大的，再把它减去总权重。权重3:1时选出来是a a b a，不会连着扎堆
+func pickWeighted(virtualPath string, storages []driver.Driver) int {
+	state, _ := weightedMap.LoadOrStore(virtualPath, &weightedState{current: make(map[string]int)})
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	total, best := 0, 0
+	for i, storage := range storages {
+		weight := max(storage.GetStorage().BalanceWeight, 1)
+		mountPath := storage.GetStorage().MountPath
+		state.current[mountPath] += weight
+		total += weight
+		if state.current[mountPath] > state.current[storages[best].GetStorage().MountPath] {
+			best = i
+		}
 	}
+	state.current[storages[best].GetStorage().MountPath] -= total
+	return best
 }
@@ -0,0 +1,125 @@
+package op_test
+
+import (
+	"HelaList/configs"
+	"HelaList/drivers/memory"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// picks 连续选n次，返回选中存储的挂载路径后缀，主存储记成"-"
+func picks(t *testing.T, path string, n int) string {
+	t.Helper()
+	var res []string
+	for range n {
+		s := op.GetBalancedStorage(path)
+		if s == nil {
+			t.Fatalf("no storage for %s", path)
+		}
+		suffix := s.GetStorage().MountPath[strings.LastIndex(s.GetStorage().MountPath, "/")+1:]
+		if i := strings.Index(suffix, ".balance"); i >= 0 {
+			suffix = suffix[i+len(".balance"):]
+		} else {
+			suffix = "-"
+		}
+		res = append(res, suffix)
+	}
+	return strings.Join(res, "")
+}
+
+func TestRoundRobinSkipsBrokenStorages(t *testing.T) {
+	a := mount(t, "/bal-rr")
+	b := mount(t, "/bal-rr.balance1")
+	c := mount(t, "/bal-rr.balance2")
+	if got := picks(t, "/bal-rr/x", 6); got != "-12-12" {
+		t.Fatalf("picks = %s", got)
+	}
+	c.GetStorage().SetStatus("down")
+	if got := picks(t, "/bal-rr/x", 4); strings.Contains(got, "2") {
+		t.Fatalf("broken storage was picked: %s", got)
+	}
+	// 全坏了也要返回存储，不然报的是找不到存储
+	a.GetStorage().SetStatus("down")
+	b.GetStorage().SetStatus("down")
+	if got := op.GetBalancedStorages("/bal-rr"); len(got) != 3 {
+		t.Fatalf("got %d storages when all are down", len(got))
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	mountStorage(t, model.Storage{MountPath: "/bal-w", BalanceStrategy: op.BalanceWeighted, BalanceWeight: 3})
+	mountStorage(t, model.Storage{MountPath: "/bal-w.balance1"})
+	if got := picks(t, "/bal-w", 8); got != "--1---1-" {
+		t.Fatalf("picks = %s", got)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	a := mountStorage(t, model.Storage{MountPath: "/bal-f", BalanceStrategy: op.BalanceFailover, Order: 2})
+	b := mountStorage(t, model.Storage{MountPath: "/bal-f.balance1", Order: 1})
+	if got := picks(t, "/bal-f", 3); got != "111" {
+		t.Fatalf("picks = %s", got)
+	}
+	b.GetStorage().SetStatus("down")
+	if got := picks(t, "/bal-f", 3); got != "---" {
+		t.Fatalf("picks after failure = %s", got)
+	}
+	b.GetStorage().SetStatus(configs.WORK)
+	a.GetStorage().SetStatus("down")
+	if got := op.GetBalancedStorages("/bal-f"); len(got) != 1 || got[0] != b {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestLeastLatency(t *testing.T) {
+	a := mountStorage(t, model.Storage{MountPath: "/bal-l", BalanceStrategy: op.BalanceLeastLatency})
+	mountStorage(t, model.Storage{MountPath: "/bal-l.balance1"})
+	a.(*memory.Memory).Latency = 20
+	for _, mountPath := range []string{"/bal-l", "/bal-l.balance1"} {
+		if _, err := op.CheckStorage(context.Background(), mountPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := picks(t, "/bal-l", 3); got != "111" {
+		t.Fatalf("picks = %s", got)
+	}
+}
+
+func TestMirrorWriteStorages(t *testing.T) {
+	mountStorage(t, model.Storage{MountPath: "/bal-m", BalanceStrategy: op.BalanceMirror})
+	b := mountStorage(t, model.Storage{MountPath: "/bal-m.balance1"})
+	storages, actualPath, err := op.GetWriteStoragesAndActualPath("/bal-m/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(storages) != 2 || actualPath != "/a/b" {
+		t.Fatalf("got %d storages, actual path %s", len(storages), actualPath)
+	}
+	b.GetStorage().SetStatus("down")
+	if storages, _, _ = op.GetWriteStoragesAndActualPath("/bal-m"); len(storages) != 1 || storages[0] == b {
+		t.Fatal("broken mirror should not be written")
+	}
+
+	// 其它策略只写一个
+	mount(t, "/bal-one")
+	mount(t, "/bal-one.balance1")
+	if storages, _, _ = op.GetWriteStoragesAndActualPath("/bal-one"); len(storages) != 1 {
+		t.Fatalf("got %d write storages", len(storages))
+	}
+}
+
+func TestCreateStorageRejectsBadBalance(t *testing.T) {
+	mount(t, "/bal-bad-setup")
+	for _, storage := range []model.Storage{
+		{MountPath: "/bal-bad", Driver: "memory", Addition: "{}", BalanceStrategy: "random"},
+		{MountPath: "/bal-bad", Driver: "memory", Addition: "{}", BalanceWeight: -1},
+	} {
+		if _, err := op.CreateStorage(context.Background(), storage); !errors.Is(err, op.ErrInvalidBalance) {
+			t.Fatalf("want invalid balance, got %v", err)
+		}
+	}
+}
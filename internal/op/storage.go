@@ -49,6 +49,13 @@ func CreateStorage(ctx context.Context, storage model.Storage) (uuid.UUID, error
 		return uuid.Nil, errors.WithMessage(err, "failed get driver new")
 	}
 	storageDriver := driverNew()
+	storage.Addition, err = ValidateAddition(driverName, storage.Addition)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err = checkBalance(storage); err != nil {
+		return uuid.Nil, err
+	}
 
 	// 把storage插入数据库
 	err = service.CreateStorage(&storage)
@@ -164,6 +171,8 @@ func initStorage(ctx context.Context, storage model.Storage, storageDriver drive
 	storagesMap.Store(driverStorage.MountPath, storageDriver)
 	if err != nil {
 		err = errors.Wrap(err, "failed init storage")
+		// 把错误记在状态里，健康检查看到不是work会去重新初始化
+		driverStorage.SetStatus(err.Error())
 	} else {
 		driverStorage.SetStatus(configs.WORK)
 	}
@@ -253,6 +262,13 @@ func UpdateStorage(ctx context.Context, storage model.Storage) error {
 	if oldStorage.Driver != storage.Driver {
 		return errors.Errorf("driver cannot be changed")
 	}
+	storage.Addition, err = ValidateAddition(storage.Driver, storage.Addition)
+	if err != nil {
+		return err
+	}
+	if err = checkBalance(storage); err != nil {
+		return err
+	}
 	storage.ModifiedTime = time.Now()
 	storage.MountPath = utils.FixAndCleanPath(storage.MountPath)
 	err = service.UpdateStorage(&storage)
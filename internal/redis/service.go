@@ -3,8 +3,11 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -61,6 +64,20 @@ func (s *Service) Get(key string, dest interface{}) error {
 	return json.Unmarshal([]byte(data), dest)
 }
 
+// GetFromMaster 与Get相同，但总是读主节点。集群客户端开启了ReadOnly，
+// 普通的读可能落到还没同步的从节点上，读后写的场景要用这个
+func (s *Service) GetFromMaster(key string, dest interface{}) error {
+	var cmd *redis.StringCmd
+	_, err := s.client.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+		cmd = pipe.Get(s.ctx, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(cmd.Val()), dest)
+}
+
 func (s *Service) Del(keys ...string) error {
 	return s.client.Del(s.ctx, keys...).Err()
 }
@@ -77,13 +94,22 @@ func (s *Service) SetNX(key string, value interface{}, expiration time.Duration)
 	return s.client.SetNX(s.ctx, key, data, expiration).Result()
 }
 
-// 分布式锁
-func (s *Service) Lock(key string, expiration time.Duration) (bool, error) {
-	return s.client.SetNX(s.ctx, "lock:"+key, "locked", expiration).Result()
+// unlockScript 值还是自己的token时才删，锁过期后被别人拿到了就不能再删
+var unlockScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) end return 0`)
+
+// 分布式锁，拿到时返回一个随机token，Unlock时要带上
+func (s *Service) Lock(key string, expiration time.Duration) (string, bool, error) {
+	token := uuid.NewString()
+	ok, err := s.client.SetNX(s.ctx, "lock:"+key, token, expiration).Result()
+	if err != nil || !ok {
+		return "", false, err
+	}
+	return token, true, nil
 }
 
-func (s *Service) Unlock(key string) error {
-	return s.client.Del(s.ctx, "lock:"+key).Err()
+// Unlock 只释放token对应的那次加锁
+func (s *Service) Unlock(key, token string) error {
+	return unlockScript.Run(s.ctx, s.client, []string{"lock:" + key}, token).Err()
 }
 
 // 用户缓存相关
@@ -122,8 +148,9 @@ func (s *Service) SetFileListCache(path string, files interface{}, expiration ti
 	return s.Set("file:list:"+path, files, expiration)
 }
 
+// GetFileListCache 列表改完会马上通知别的节点来读，从节点可能还没同步，所以读主节点
 func (s *Service) GetFileListCache(path string, dest interface{}) error {
-	return s.Get("file:list:"+path, dest)
+	return s.GetFromMaster("file:list:"+path, dest)
 }
 
 func (s *Service) DelFileListCache(path string) error {
@@ -143,6 +170,40 @@ func (s *Service) DelStorageCache(storageId string) error {
 	return s.Del("storage:config:" + storageId)
 }
 
+// 发布订阅
+func (s *Service) Publish(channel string, payload string) error {
+	return s.client.Publish(s.ctx, channel, payload).Err()
+}
+
+// Subscribe 订阅channel，阻塞到ctx取消。每次(重新)订阅成功都会调用onSubscribe，
+// 断线期间发布的消息是收不到的，调用方要在这里丢掉可能过期的状态
+func (s *Service) Subscribe(ctx context.Context, channel string, onSubscribe func(), onMessage func(payload string)) {
+	pubsub := s.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+	for {
+		msg, err := pubsub.ReceiveTimeout(ctx, time.Minute)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// 超时只是这一分钟没有消息，连接断了go-redis下次Receive时会自己重连、重新订阅
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			if m.Kind == "subscribe" {
+				onSubscribe()
+			}
+		case *redis.Message:
+			onMessage(m.Payload)
+		}
+	}
+}
+
 // 关闭连接
 func (s *Service) Close() error {
 	return s.client.Close()
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"HelaList/internal/bootstrap"
+	"HelaList/internal/model"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func GetDeadPropsByPath(path string) ([]model.DeadProp, error) {
+	var props []model.DeadProp
+	if err := bootstrap.Db.Where("path = ?", path).Find(&props).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get dead props")
+	}
+	return props, nil
+}
+
+// PatchDeadProps 在同一个事务里写入set、删除remove，保证PROPPATCH要么全成功要么全失败
+func PatchDeadProps(path string, set []model.DeadProp, remove []model.DeadProp) error {
+	return errors.WithStack(bootstrap.Db.Transaction(func(tx *gorm.DB) error {
+		for _, p := range remove {
+			if err := tx.Where("path = ? AND space = ? AND local = ?", path, p.Space, p.Local).
+				Delete(&model.DeadProp{}).Error; err != nil {
+				return err
+			}
+		}
+		for i := range set {
+			set[i].Path = path
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "path"}, {Name: "space"}, {Name: "local"}},
+				DoUpdates: clause.AssignmentColumns([]string{"lang", "inner_xml"}),
+			}).Create(&set[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// DeleteDeadPropsByPath 删除path自身以及其下所有子路径的属性
+func DeleteDeadPropsByPath(path string) error {
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	return errors.WithStack(bootstrap.Db.
+		Where(`path = ? OR path LIKE ? ESCAPE '\'`, path, escapeLike(prefix)+"%").
+		Delete(&model.DeadProp{}).Error)
+}
+
+// CopyDeadProps 把src及其子路径的属性复制到dst下对应的路径
+func CopyDeadProps(src, dst string) error {
+	return errors.WithStack(bootstrap.Db.Transaction(func(tx *gorm.DB) error {
+		_, err := copyDeadProps(tx, src, dst)
+		return err
+	}))
+}
+
+// MoveDeadProps 把src及其子路径的属性搬到dst下对应的路径
+func MoveDeadProps(src, dst string) error {
+	return errors.WithStack(bootstrap.Db.Transaction(func(tx *gorm.DB) error {
+		props, err := copyDeadProps(tx, src, dst)
+		if err != nil {
+			return err
+		}
+		for _, p := range props {
+			if err := tx.Delete(&p).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// copyDeadProps 返回被复制的原始记录，目标上已有的同名属性会被覆盖
+func copyDeadProps(tx *gorm.DB, src, dst string) ([]model.DeadProp, error) {
+	prefix := strings.TrimSuffix(src, "/") + "/"
+	var props []model.DeadProp
+	if err := tx.Where(`path = ? OR path LIKE ? ESCAPE '\'`, src, escapeLike(prefix)+"%").
+		Find(&props).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range props {
+		c := model.DeadProp{
+			Path:     dst + strings.TrimPrefix(p.Path, src),
+			Space:    p.Space,
+			Local:    p.Local,
+			Lang:     p.Lang,
+			InnerXML: p.InnerXML,
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "path"}, {Name: "space"}, {Name: "local"}},
+			DoUpdates: clause.AssignmentColumns([]string{"lang", "inner_xml"}),
+		}).Create(&c).Error; err != nil {
+			return nil, err
+		}
+	}
+	return props, nil
+}
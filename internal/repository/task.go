@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"HelaList/internal/bootstrap"
+	"HelaList/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// SaveTask 任务不存在时插入，存在时整行覆盖
+func SaveTask(t *model.Task) error {
+	return errors.WithStack(bootstrap.Db.Save(t).Error)
+}
+
+func GetTasks() ([]model.Task, error) {
+	var tasks []model.Task
+	if err := bootstrap.Db.Order("created_at").Find(&tasks).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get tasks")
+	}
+	return tasks, nil
+}
+
+func DeleteTaskById(id uuid.UUID) error {
+	return errors.WithStack(bootstrap.Db.Delete(&model.Task{}, id).Error)
+}
+
+func DeleteTasksByIds(ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return errors.WithStack(bootstrap.Db.Where("id IN ?", ids).Delete(&model.Task{}).Error)
+}
@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 )
@@ -33,6 +34,11 @@ func CanProxy(storage driver.Driver, filename string) bool {
 
 // Proxy 处理代理请求
 func Proxy(c *gin.Context, link *model.Link, file model.Obj, proxyRange bool) error {
+	return ProxyHTTP(c.Writer, c.Request, link, file, proxyRange)
+}
+
+// ProxyHTTP 与Proxy相同，但只依赖net/http，供WebDAV这类不走gin.Context的处理器使用
+func ProxyHTTP(w http.ResponseWriter, r *http.Request, link *model.Link, file model.Obj, proxyRange bool) error {
 	defer func() {
 		if link != nil {
 			link.Close()
@@ -41,7 +47,12 @@ func Proxy(c *gin.Context, link *model.Link, file model.Obj, proxyRange bool) er
 
 	if link.MFile != nil {
 		// 处理内存文件
-		return serveFile(c, file, link.MFile)
+		return serveFile(w, r, file, link.MFile)
+	}
+
+	if link.RangeReader != nil {
+		// 只能按范围读取的驱动（比如FTP）
+		return serveRangeReader(w, r, file, link.RangeReader)
 	}
 
 	if link.URL == "" {
@@ -49,17 +60,17 @@ func Proxy(c *gin.Context, link *model.Link, file model.Obj, proxyRange bool) er
 	}
 
 	// 创建代理请求
-	req, err := http.NewRequestWithContext(c.Request.Context(), "GET", link.URL, nil)
+	req, err := http.NewRequestWithContext(r.Context(), "GET", link.URL, nil)
 	if err != nil {
 		return errors.Wrap(err, "failed to create request")
 	}
 
 	// 复制必要的请求头
-	copyHeaders(req, c.Request, link.Header)
+	copyHeaders(req, r, link.Header)
 
 	// 处理Range请求
-	if proxyRange && c.GetHeader("Range") != "" {
-		req.Header.Set("Range", c.GetHeader("Range"))
+	if proxyRange && r.Header.Get("Range") != "" {
+		req.Header.Set("Range", r.Header.Get("Range"))
 	}
 
 	// 发送请求
@@ -76,27 +87,69 @@ func Proxy(c *gin.Context, link *model.Link, file model.Obj, proxyRange bool) er
 	defer resp.Body.Close()
 
 	// 复制响应头
-	c.Status(resp.StatusCode)
-	copyResponseHeaders(c, resp)
+	copyResponseHeaders(w, resp)
 
 	// 设置内容相关头部
-	setContentHeaders(c, file, resp)
+	setContentHeaders(w, r, file, resp)
+
+	// 头部必须在WriteHeader之前设置好
+	w.WriteHeader(resp.StatusCode)
 
 	// 复制响应体
-	_, err = io.Copy(c.Writer, resp.Body)
+	_, err = io.Copy(w, resp.Body)
 	return err
 }
 
 // 服务内存文件
-func serveFile(c *gin.Context, file model.Obj, mfile io.ReadSeeker) error {
-	c.Header("Content-Type", getContentType(file.GetName()))
-	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\" %s\"", file.GetName()))
-	c.Header("Cache-Control", "public, max-age=3600")
+func serveFile(w http.ResponseWriter, r *http.Request, file model.Obj, mfile io.ReadSeeker) error {
+	w.Header().Set("Content-Type", getContentType(file.GetName()))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\" %s\"", file.GetName()))
+	w.Header().Set("Cache-Control", "public, max-age=3600")
 
-	http.ServeContent(c.Writer, c.Request, file.GetName(), file.GetModifiedTime(), mfile)
+	http.ServeContent(w, r, file.GetName(), file.GetModifiedTime(), mfile)
 	return nil
 }
 
+// 服务只支持按范围读取的文件，只处理单个Range，多个Range时返回整个文件
+func serveRangeReader(w http.ResponseWriter, r *http.Request, file model.Obj, rr model.RangeReaderIF) error {
+	size := file.GetSize()
+	w.Header().Set("Content-Type", getContentType(file.GetName()))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\" %s\"", file.GetName()))
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Accept-Ranges", "bytes")
+	if !file.GetModifiedTime().IsZero() {
+		w.Header().Set("Last-Modified", file.GetModifiedTime().UTC().Format(http.TimeFormat))
+	}
+
+	ranges, err := http_range.ParseRange(r.Header.Get("Range"), size)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+	httpRange := http_range.Range{Start: 0, Length: size}
+	status := http.StatusOK
+	if len(ranges) == 1 {
+		httpRange = ranges[0]
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", httpRange.ContentRange(size))
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(httpRange.Length, 10))
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return nil
+	}
+
+	rc, err := rr.RangeRead(r.Context(), httpRange)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	w.WriteHeader(status)
+	_, err = io.CopyN(w, rc, httpRange.Length)
+	return err
+}
+
 // 复制请求头
 func copyHeaders(req *http.Request, original *http.Request, additional http.Header) {
 	// 复制原始请求的关键头部
@@ -115,48 +168,48 @@ func copyHeaders(req *http.Request, original *http.Request, additional http.Head
 }
 
 // 复制响应头
-func copyResponseHeaders(c *gin.Context, resp *http.Response) {
+func copyResponseHeaders(w http.ResponseWriter, resp *http.Response) {
 	for key, values := range resp.Header {
 		// 跳过某些不应该转发的头部
 		if shouldSkipHeader(key) {
 			continue
 		}
 		for _, value := range values {
-			c.Header(key, value)
+			w.Header().Set(key, value)
 		}
 	}
 }
 
 // 设置内容相关头部
-func setContentHeaders(c *gin.Context, file model.Obj, resp *http.Response) {
+func setContentHeaders(w http.ResponseWriter, r *http.Request, file model.Obj, resp *http.Response) {
 	// 设置文件名
-	if c.GetHeader("Content-Disposition") == "" {
+	if r.Header.Get("Content-Disposition") == "" {
 		dispositionType := "inline"
-		if c.Query("type") == "download" || !isPreviewable(file.GetName()) {
+		if r.URL.Query().Get("type") == "download" || !isPreviewable(file.GetName()) {
 			dispositionType = "attachment"
 		}
-		c.Header("Content-Disposition", fmt.Sprintf("%s; filename=\" %s\"", dispositionType, file.GetName()))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=\" %s\"", dispositionType, file.GetName()))
 	}
 
 	// 设置内容类型
-	if c.GetHeader("Content-Type") == "" {
-		c.Header("Content-Type", getContentType(file.GetName()))
+	if r.Header.Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", getContentType(file.GetName()))
 	}
 
 	// 设置缓存控制
-	if c.GetHeader("Cache-Control") == "" {
+	if r.Header.Get("Cache-Control") == "" {
 		if configs.IsFileTypeIn(file.GetName(), configs.TextTypes) {
-			c.Header("Cache-Control", "public, max-age=300") // 5分钟缓存
+			w.Header().Set("Cache-Control", "public, max-age=300") // 5分钟缓存
 		} else {
-			c.Header("Cache-Control", "public, max-age=3600") // 1小时缓存
+			w.Header().Set("Cache-Control", "public, max-age=3600") // 1小时缓存
 		}
 	}
 
 	// 设置内容长度
 	if contentLength := resp.Header.Get("Content-Length"); contentLength != "" {
-		c.Header("Content-Length", contentLength)
+		w.Header().Set("Content-Length", contentLength)
 	} else if file.GetSize() > 0 {
-		c.Header("Content-Length", strconv.FormatInt(file.GetSize(), 10))
+		w.Header().Set("Content-Length", strconv.FormatInt(file.GetSize(), 10))
 	}
 }
 
@@ -301,8 +354,8 @@ func ProxyDownload(c *gin.Context, link *model.Link, filename string) error {
 	if resp.ContentLength > 0 {
 		c.Header("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
 	}
-	
-c.Status(resp.StatusCode)
+
+	c.Status(resp.StatusCode)
 
 	_, err = io.Copy(c.Writer, resp.Body)
 	return err
@@ -760,7 +760,11 @@ func executeOperation(c *gin.Context, operation string, params map[string]interf
 		if !ok1 || !ok2 {
 			return nil, fmt.Errorf("missing or invalid srcPath/dstPath parameters")
 		}
-		return nil, fs.Copy(ctx, srcPath, dstPath)
+		t, err := fs.Copy(ctx, srcPath, dstPath)
+		if err != nil || t == nil {
+			return nil, err
+		}
+		return t.Info(), nil
 
 	case "move_item":
 		srcPath, ok1 := params["srcPath"].(string)
@@ -768,7 +772,11 @@ func executeOperation(c *gin.Context, operation string, params map[string]interf
 		if !ok1 || !ok2 {
 			return nil, fmt.Errorf("missing or invalid srcPath/dstPath parameters")
 		}
-		return nil, fs.Move(ctx, srcPath, dstPath)
+		t, err := fs.Move(ctx, srcPath, dstPath)
+		if err != nil || t == nil {
+			return nil, err
+		}
+		return t.Info(), nil
 
 	case "preview_image":
 		path, ok := params["path"].(string)
@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"HelaList/internal/op"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DriverListHandler 所有驱动的名字，按字母排序
+func DriverListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, op.GetDriverNames())
+}
+
+// DriverInfoHandler 驱动的配置项，前端按它生成添加存储的表单
+func DriverInfoHandler(c *gin.Context) {
+	info, err := op.GetDriverInfo(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
@@ -6,7 +6,13 @@ import (
 	"HelaList/internal/model"
 	"HelaList/internal/server/common"
 	"HelaList/internal/stream"
+	"HelaList/internal/task"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
 	"strings"
 	"time"
 
@@ -195,10 +201,16 @@ func FsCopyHandler(c *gin.Context) {
 		return
 	}
 
-	if err := fs.Copy(c.Request.Context(), srcPath, dstPath); err != nil {
+	t, err := fs.Copy(c.Request.Context(), srcPath, dstPath)
+	if err != nil {
 		common.ErrorResponse(c, err, 500)
 		return
 	}
+	// 跨存储时作为后台任务执行，把任务信息返回给前端
+	if t != nil {
+		common.SuccessResponse(c, t.Info())
+		return
+	}
 
 	common.SuccessResponse(c)
 }
@@ -223,10 +235,116 @@ func FsMoveHandler(c *gin.Context) {
 		return
 	}
 
-	if err := fs.Move(c.Request.Context(), srcPath, dstPath); err != nil {
+	t, err := fs.Move(c.Request.Context(), srcPath, dstPath)
+	if err != nil {
+		common.ErrorResponse(c, err, 500)
+		return
+	}
+	// 跨存储时作为后台任务执行，把任务信息返回给前端
+	if t != nil {
+		common.SuccessResponse(c, t.Info())
+		return
+	}
+
+	common.SuccessResponse(c)
+}
+
+type FsDecompressReq struct {
+	SrcPath       string `json:"src_path" binding:"required"`
+	DstPath       string `json:"dst_path" binding:"required"`
+	Password      string `json:"password"`
+	Conflict      string `json:"conflict"` // overwrite、skip或rename，默认rename
+	PutIntoNewDir bool   `json:"put_into_new_dir"`
+}
+
+func FsDecompressHandler(c *gin.Context) {
+	var req FsDecompressReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResponse(c, err, 400)
+		return
+	}
+
+	user := c.Request.Context().Value(configs.UserKey).(*model.User)
+
+	srcPath, err := user.JoinPath(req.SrcPath)
+	if err != nil {
+		common.ErrorResponse(c, err, 403)
+		return
+	}
+	dstPath, err := user.JoinPath(req.DstPath)
+	if err != nil {
+		common.ErrorResponse(c, err, 403)
+		return
+	}
+
+	t, err := fs.Decompress(c.Request.Context(), fs.DecompressArgs{
+		SrcPath:       srcPath,
+		DstDirPath:    dstPath,
+		Password:      req.Password,
+		Conflict:      req.Conflict,
+		PutIntoNewDir: req.PutIntoNewDir,
+	})
+	if err != nil {
 		common.ErrorResponse(c, err, 500)
 		return
 	}
+	if t != nil {
+		common.SuccessResponse(c, t.Info())
+		return
+	}
+
+	common.SuccessResponse(c)
+}
+
+type FsCompressReq struct {
+	SrcPaths []string `json:"src_paths" binding:"required"`
+	DstPath  string   `json:"dst_path" binding:"required"`
+	Name     string   `json:"name" binding:"required"` // 扩展名决定格式：.zip、.tar.gz或.tgz
+	Conflict string   `json:"conflict"`
+}
+
+func FsCompressHandler(c *gin.Context) {
+	var req FsCompressReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResponse(c, err, 400)
+		return
+	}
+	if err := checkRelativePath(req.Name); err != nil {
+		common.ErrorResponse(c, err, 400)
+		return
+	}
+
+	user := c.Request.Context().Value(configs.UserKey).(*model.User)
+
+	srcPaths := make([]string, 0, len(req.SrcPaths))
+	for _, p := range req.SrcPaths {
+		srcPath, err := user.JoinPath(p)
+		if err != nil {
+			common.ErrorResponse(c, err, 403)
+			return
+		}
+		srcPaths = append(srcPaths, srcPath)
+	}
+	dstPath, err := user.JoinPath(req.DstPath)
+	if err != nil {
+		common.ErrorResponse(c, err, 403)
+		return
+	}
+
+	t, err := fs.Compress(c.Request.Context(), fs.CompressArgs{
+		SrcPaths:   srcPaths,
+		DstDirPath: dstPath,
+		Name:       req.Name,
+		Conflict:   req.Conflict,
+	})
+	if err != nil {
+		common.ErrorResponse(c, err, 500)
+		return
+	}
+	if t != nil {
+		common.SuccessResponse(c, t.Info())
+		return
+	}
 
 	common.SuccessResponse(c)
 }
@@ -261,6 +379,24 @@ func FsPutHandler(c *gin.Context) {
 		return
 	}
 
+	hash, err := hashFromHeader(c)
+	if err != nil {
+		_ = file.Close()
+		common.ErrorResponse(c, err, 400)
+		return
+	}
+
+	// As-Task为true时先把文件落到本地临时文件，再交给后台上传任务，请求立即返回
+	if c.GetHeader("As-Task") == "true" {
+		t, err := putAsTask(c, reqPath, fileHeader.Filename, file, hash)
+		if err != nil {
+			common.ErrorResponse(c, err, 500)
+			return
+		}
+		common.SuccessResponse(c, t.Info())
+		return
+	}
+
 	// 创建一个符合fs.PutDirectly要求的model.FileStreamer对象
 	fileStream := &stream.FileStream{
 		Ctx: c.Request.Context(),
@@ -268,6 +404,7 @@ func FsPutHandler(c *gin.Context) {
 			Name:         fileHeader.Filename,
 			Size:         fileHeader.Size,
 			ModifiedTime: time.Now(),
+			HashInfo:     hash,
 		},
 		Reader:  file,
 		Closers: utils.NewClosers(file),
@@ -282,6 +419,100 @@ func FsPutHandler(c *gin.Context) {
 	common.SuccessResponse(c)
 }
 
+type FsPutURLReq struct {
+	Path string `json:"path" binding:"required"`
+	Name string `json:"name" binding:"required"`
+	URL  string `json:"url" binding:"required"`
+}
+
+// FsPutURLHandler 把一个地址作为文件放进目录，只有url_tree之类实现了PutURL的存储支持。
+// 服务器代理下载时会去请求这个地址，所以路由上限制了只有管理员能调用
+func FsPutURLHandler(c *gin.Context) {
+	var req FsPutURLReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResponse(c, err, 400)
+		return
+	}
+	if err := checkRelativePath(req.Name); err != nil {
+		common.ErrorResponse(c, err, 400)
+		return
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		common.ErrorResponse(c, errors.New("url must be http or https"), 400)
+		return
+	}
+
+	user := c.Request.Context().Value(configs.UserKey).(*model.User)
+	reqPath, err := user.JoinPath(req.Path)
+	if err != nil {
+		common.ErrorResponse(c, err, 403)
+		return
+	}
+
+	if err := fs.PutURL(c.Request.Context(), reqPath, req.Name, req.URL); err != nil {
+		common.ErrorResponse(c, err, 500)
+		return
+	}
+	common.SuccessResponse(c)
+}
+
+// 客户端可以在这几个头里带上文件的哈希，上传完会校验，存储支持的话还能秒传
+var hashHeaders = map[string]*utils.HashType{
+	"X-File-Md5":    utils.MD5,
+	"X-File-Sha1":   utils.SHA1,
+	"X-File-Sha256": utils.SHA256,
+}
+
+func hashString(hash utils.HashInfo) string {
+	if !model.HasHash(hash) {
+		return ""
+	}
+	return hash.String()
+}
+
+func hashFromHeader(c *gin.Context) (utils.HashInfo, error) {
+	m := make(map[*utils.HashType]string)
+	for header, ht := range hashHeaders {
+		v := strings.ToLower(strings.TrimSpace(c.GetHeader(header)))
+		if v == "" {
+			continue
+		}
+		if _, err := hex.DecodeString(v); err != nil || len(v) != ht.Width {
+			return utils.HashInfo{}, fmt.Errorf("invalid %s: %s", header, v)
+		}
+		m[ht] = v
+	}
+	return utils.NewHashInfoByMap(m), nil
+}
+
+func putAsTask(c *gin.Context, dstDirPath, name string, file io.ReadCloser, hash utils.HashInfo) (*task.Task, error) {
+	defer file.Close()
+	tmp, err := os.CreateTemp("", "helalist-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(tmp, file)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+	t, err := fs.PutAsTask(c.Request.Context(), dstDirPath, fs.UploadArgs{
+		Name:     name,
+		Size:     size,
+		Modified: time.Now(),
+		TmpPath:  tmp.Name(),
+		Hash:     hashString(hash),
+	})
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+	return t, nil
+}
+
 type RenameReq struct {
 	Path string `json:"path" binding:"required"`
 	Name string `json:"name" binding:"required"`
@@ -402,19 +633,21 @@ func toObjResp(obj model.Obj, parent string) ObjResp {
 		IsDir:    obj.IsDir(),
 		Modified: obj.GetModifiedTime(),
 		Created:  obj.GetCreatedTime(),
+		HashInfo: obj.GetHash().Export(),
 	}
 }
 
 // api的响应对象
 
 type ObjResp struct {
-	Id       string    `json:"id"`
-	Path     string    `json:"path"`
-	Name     string    `json:"name"`
-	Size     int64     `json:"size"`
-	IsDir    bool      `json:"is_dir"`
-	Modified time.Time `json:"modified"`
-	Created  time.Time `json:"created"`
+	Id       string                     `json:"id"`
+	Path     string                     `json:"path"`
+	Name     string                     `json:"name"`
+	Size     int64                      `json:"size"`
+	IsDir    bool                       `json:"is_dir"`
+	Modified time.Time                  `json:"modified"`
+	Created  time.Time                  `json:"created"`
+	HashInfo map[*utils.HashType]string `json:"hash_info,omitempty"` // 比如{"md5":"..."}，存储拿不到就没有
 }
 
 type DirResp struct {
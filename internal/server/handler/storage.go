@@ -3,6 +3,7 @@ package handler
 import (
 	"HelaList/internal/model"
 	"HelaList/internal/op"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -16,7 +17,7 @@ func CreateStorageHandler(c *gin.Context) {
 	}
 	id, err := op.CreateStorage(c.Request.Context(), storage)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"id": id})
@@ -30,7 +31,7 @@ func UpdateStorageHandler(c *gin.Context) {
 	}
 	err := op.UpdateStorage(c.Request.Context(), storage)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(storageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "updated"})
@@ -95,3 +96,46 @@ func DeleteStorageHandler(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
+
+// StorageHealthHandler 所有存储的健康检查结果汇总
+func StorageHealthHandler(c *gin.Context) {
+	storages := op.GetStoragesHealth()
+	healthy := 0
+	for _, h := range storages {
+		if h.Healthy {
+			healthy++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total":    len(storages),
+		"healthy":  healthy,
+		"storages": storages,
+	})
+}
+
+type StorageCheckReq struct {
+	MountPath string `json:"mount_path" binding:"required"`
+}
+
+// StorageCheckHandler 立刻检查一个存储，坏掉的存储会马上重新初始化
+func StorageCheckHandler(c *gin.Context) {
+	var req StorageCheckReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h, err := op.CheckStorage(c.Request.Context(), req.MountPath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, h)
+}
+
+// storageErrorStatus 配置没通过校验是请求的问题，返回400
+func storageErrorStatus(err error) int {
+	if errors.Is(err, op.ErrInvalidAddition) || errors.Is(err, op.ErrInvalidBalance) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
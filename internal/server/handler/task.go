@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"HelaList/configs"
+	"HelaList/internal/model"
+	"HelaList/internal/server/common"
+	"HelaList/internal/task"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 后台任务相关接口，路径形如 /api/task/:type/xxx，type是copy、move、upload等任务类别。
+// 管理员能看到和操作所有任务，普通用户只能看到和操作自己提交的任务
+
+func getTaskManager(c *gin.Context) (*task.Manager, bool) {
+	m := task.GetManager(c.Param("type"))
+	if m == nil {
+		common.ErrorResponse(c, errors.New("unknown task type"), 404)
+		return nil, false
+	}
+	return m, true
+}
+
+func canAccessTask(user *model.User, info *model.Task) bool {
+	return user.IsAdmin() || info.Creator == user.Id
+}
+
+// 获取某一类的任务列表
+func TaskListHandler(c *gin.Context) {
+	m, ok := getTaskManager(c)
+	if !ok {
+		return
+	}
+	user := c.Request.Context().Value(configs.UserKey).(*model.User)
+	tasks := make([]model.Task, 0)
+	for _, info := range m.List() {
+		if canAccessTask(user, &info) {
+			tasks = append(tasks, info)
+		}
+	}
+	common.SuccessResponse(c, tasks)
+}
+
+// 获取单个任务
+func TaskInfoHandler(c *gin.Context) {
+	_, t, ok := getTask(c)
+	if !ok {
+		return
+	}
+	common.SuccessResponse(c, t.Info())
+}
+
+// getTask 解析查询参数tid，找到对应任务并检查权限
+func getTask(c *gin.Context) (*task.Manager, *task.Task, bool) {
+	m, ok := getTaskManager(c)
+	if !ok {
+		return nil, nil, false
+	}
+	id, err := uuid.Parse(c.Query("tid"))
+	if err != nil {
+		common.ErrorResponse(c, errors.New("invalid task id"), 400)
+		return nil, nil, false
+	}
+	t, err := m.Get(id)
+	if err != nil {
+		common.ErrorResponse(c, err, 404)
+		return nil, nil, false
+	}
+	user := c.Request.Context().Value(configs.UserKey).(*model.User)
+	info := t.Info()
+	if !canAccessTask(user, &info) {
+		// 不暴露别人任务是否存在
+		common.ErrorResponse(c, task.ErrTaskNotFound, 404)
+		return nil, nil, false
+	}
+	return m, t, true
+}
+
+// taskOperation 生成cancel、pause这类只需要任务id的接口
+func taskOperation(fn func(m *task.Manager, id uuid.UUID) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, t, ok := getTask(c)
+		if !ok {
+			return
+		}
+		if err := fn(m, t.ID()); err != nil {
+			common.ErrorResponse(c, err, 400)
+			return
+		}
+		common.SuccessResponse(c)
+	}
+}
+
+var (
+	TaskCancelHandler = taskOperation((*task.Manager).Cancel)
+	TaskPauseHandler  = taskOperation((*task.Manager).Pause)
+	TaskResumeHandler = taskOperation((*task.Manager).Resume)
+	TaskRetryHandler  = taskOperation((*task.Manager).Retry)
+	TaskDeleteHandler = taskOperation((*task.Manager).Remove)
+)
+
+// taskClear 生成按条件批量删除已结束任务的接口
+func taskClear(filter func(info *model.Task) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, ok := getTaskManager(c)
+		if !ok {
+			return
+		}
+		user := c.Request.Context().Value(configs.UserKey).(*model.User)
+		err := m.Clear(func(info *model.Task) bool {
+			return canAccessTask(user, info) && filter(info)
+		})
+		if err != nil {
+			common.ErrorResponse(c, err, 500)
+			return
+		}
+		common.SuccessResponse(c)
+	}
+}
+
+var (
+	// 清除所有已结束（成功、失败、取消）的任务
+	TaskClearDoneHandler = taskClear(func(info *model.Task) bool { return true })
+	// 只清除成功的任务
+	TaskClearSucceededHandler = taskClear(func(info *model.Task) bool {
+		return info.State == model.TaskSucceeded
+	})
+)
@@ -0,0 +1,102 @@
+package middlewares
+
+import (
+	"HelaList/configs"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"HelaList/internal/server/common"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// webdavWriteMethods 会修改资源的WebDAV方法，访客只能只读访问
+var webdavWriteMethods = map[string]bool{
+	"PUT":       true,
+	"MKCOL":     true,
+	"DELETE":    true,
+	"COPY":      true,
+	"MOVE":      true,
+	"PROPPATCH": true,
+	"LOCK":      true,
+	"UNLOCK":    true,
+}
+
+// WebDAVAuth WebDAV的认证中间件。WebDAV客户端不会走/api/user/login，
+// 所以这里同时支持Basic认证（用户名+密码）和Bearer认证（登录接口签发的JWT）。
+// 没带凭证时以访客身份只读访问；访客被禁用时返回401，让客户端弹出登录框
+func WebDAVAuth(c *gin.Context) {
+	user, status := webdavUser(c)
+	if user == nil {
+		// OPTIONS用来探测服务能力，很多客户端第一次请求不带凭证，不能拒绝
+		if c.Request.Method == http.MethodOptions {
+			if guest, err := op.GetGuest(); err == nil {
+				common.GinWithValue(c, configs.UserKey, guest)
+				c.Next()
+				return
+			}
+		}
+		if status == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", `Basic realm="HelaList"`)
+		}
+		c.Status(status)
+		c.Abort()
+		return
+	}
+	if webdavWriteMethods[c.Request.Method] && !user.CanWrite() {
+		c.Status(http.StatusForbidden)
+		c.Abort()
+		return
+	}
+	common.GinWithValue(c, configs.UserKey, user)
+	c.Next()
+}
+
+// webdavUser 解析请求里的凭证，失败时返回nil和应答的状态码
+func webdavUser(c *gin.Context) (*model.User, int) {
+	if username, password, ok := c.Request.BasicAuth(); ok {
+		user, err := op.GetUserByName(username)
+		if err != nil {
+			return nil, http.StatusUnauthorized
+		}
+		ok, err := user.CheckPassword(password)
+		if err != nil {
+			log.Errorf("[webdav auth] failed check password of %s: %v", username, err)
+			return nil, http.StatusInternalServerError
+		}
+		if !ok {
+			return nil, http.StatusUnauthorized
+		}
+		if user.Disabled {
+			return nil, http.StatusForbidden
+		}
+		return user, 0
+	}
+
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		claims, err := common.ParseToken(token)
+		if err != nil {
+			return nil, http.StatusUnauthorized
+		}
+		user, err := op.GetUserByName(claims.Username)
+		if err != nil || user.PasswordTS != claims.PwdTS {
+			return nil, http.StatusUnauthorized
+		}
+		if user.Disabled {
+			return nil, http.StatusForbidden
+		}
+		return user, 0
+	}
+
+	guest, err := op.GetGuest()
+	if err != nil {
+		log.Errorf("[webdav auth] failed get guest user: %v", err)
+		return nil, http.StatusInternalServerError
+	}
+	if guest.Disabled {
+		return nil, http.StatusUnauthorized
+	}
+	return guest, 0
+}
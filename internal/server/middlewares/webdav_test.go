@@ -0,0 +1,151 @@
+package middlewares
+
+import (
+	"HelaList/configs"
+	_ "HelaList/drivers/memory"
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/fs"
+	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"HelaList/internal/server/common"
+	"HelaList/internal/server/webdav"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// davTest 和router里一样把WebDAVAuth挂在webdav.Handler前面
+type davTest struct {
+	t *testing.T
+	r *gin.Engine
+}
+
+func newDavTest(t *testing.T) *davTest {
+	t.Helper()
+	if configs.Conf == nil {
+		configs.Conf = configs.DefaultConfig(t.TempDir())
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	dav := r.Group("/webdav")
+	dav.Use(WebDAVAuth)
+	serve := gin.WrapH(&webdav.Handler{Prefix: "/webdav", LockSystem: webdav.NewMemLS()})
+	dav.Any("/*path", serve)
+	for _, method := range []string{"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK"} {
+		dav.Handle(method, "/*path", serve)
+	}
+	return &davTest{t: t, r: r}
+}
+
+func (d *davTest) do(method, path, body string, auth func(r *http.Request)) *httptest.ResponseRecorder {
+	d.t.Helper()
+	r := httptest.NewRequest(method, "/webdav"+path, strings.NewReader(body))
+	if method == "PROPFIND" {
+		r.Header.Set("Depth", "1")
+	}
+	if auth != nil {
+		auth(r)
+	}
+	w := httptest.NewRecorder()
+	d.r.ServeHTTP(w, r)
+	return w
+}
+
+func (d *davTest) expect(want int, method, path, body string, auth func(r *http.Request)) *httptest.ResponseRecorder {
+	d.t.Helper()
+	w := d.do(method, path, body, auth)
+	if w.Code != want {
+		d.t.Fatalf("%s %s = %d, want %d: %s", method, path, w.Code, want, w.Body.String())
+	}
+	return w
+}
+
+func basic(username, password string) func(r *http.Request) {
+	return func(r *http.Request) { r.SetBasicAuth(username, password) }
+}
+
+func bearer(token string) func(r *http.Request) {
+	return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+}
+
+func createUser(t *testing.T, username string, identity int, basePath string, disabled bool) *model.User {
+	t.Helper()
+	u := &model.User{Username: username, Email: username + "@example.com", Identity: identity, BasePath: basePath, Disabled: disabled}
+	if err := u.SetPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestWebDAVAuth(t *testing.T) {
+	drivertest.Mount(t, model.Storage{MountPath: "/mw-dav", CacheExpiration: 30})
+	if err := fs.MakeDir(context.Background(), "/mw-dav/alice"); err != nil {
+		t.Fatal(err)
+	}
+	// 先把访客建出来，免得后面按身份找访客时找到别的GUEST用户
+	guest, err := op.GetGuest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := createUser(t, "mw-alice", model.GENERAL, "/mw-dav/alice", false)
+	createUser(t, "mw-reader", model.GUEST, "/", false)
+	createUser(t, "mw-disabled", model.GENERAL, "/", true)
+	d := newDavTest(t)
+
+	// Basic认证，路径限定在用户的BasePath下
+	d.expect(http.StatusCreated, "PUT", "/a.txt", "alice", basic("mw-alice", "secret"))
+	if w := d.expect(http.StatusOK, "GET", "/a.txt", "", basic("mw-alice", "secret")); w.Body.String() != "alice" {
+		t.Fatalf("a.txt = %q", w.Body.String())
+	}
+	if _, err := fs.Get(context.Background(), "/mw-dav/alice/a.txt"); err != nil {
+		t.Fatalf("file not written under the base path: %v", err)
+	}
+	d.expect(http.StatusNotFound, "GET", "/mw-dav/alice/a.txt", "", basic("mw-alice", "secret"))
+	if w := d.expect(webdav.StatusMulti, "PROPFIND", "/", "", basic("mw-alice", "secret")); strings.Contains(w.Body.String(), "mw-dav") {
+		t.Fatalf("base path leaked in hrefs: %s", w.Body.String())
+	}
+
+	for _, auth := range []func(r *http.Request){basic("mw-alice", "wrong"), basic("nobody", "secret")} {
+		w := d.expect(http.StatusUnauthorized, "GET", "/a.txt", "", auth)
+		if !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic") {
+			t.Fatalf("WWW-Authenticate = %q", w.Header().Get("WWW-Authenticate"))
+		}
+	}
+	d.expect(http.StatusForbidden, "GET", "/", "", basic("mw-disabled", "secret"))
+
+	// Bearer认证用登录接口签发的JWT
+	token, err := common.GenerateToken(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := d.expect(http.StatusOK, "GET", "/a.txt", "", bearer(token)); w.Body.String() != "alice" {
+		t.Fatalf("a.txt with token = %q", w.Body.String())
+	}
+	d.expect(http.StatusUnauthorized, "GET", "/a.txt", "", bearer("not-a-token"))
+
+	// 没有凭证时是访客，只读
+	d.expect(http.StatusOK, "GET", "/mw-dav/alice/a.txt", "", nil)
+	d.expect(http.StatusForbidden, "PUT", "/mw-dav/guest.txt", "guest", nil)
+	d.expect(http.StatusForbidden, "MKCOL", "/mw-dav/dir", "", nil)
+
+	// 没有写权限的用户
+	d.expect(http.StatusOK, "GET", "/mw-dav/alice/a.txt", "", basic("mw-reader", "secret"))
+	for _, method := range []string{"PUT", "DELETE", "MKCOL", "PROPPATCH", "LOCK"} {
+		d.expect(http.StatusForbidden, method, "/mw-dav/alice/a.txt", "", basic("mw-reader", "secret"))
+	}
+
+	// 访客被禁用后要求登录，但OPTIONS不带凭证也能用
+	guest.Disabled = true
+	t.Cleanup(func() { guest.Disabled = false })
+	d.expect(http.StatusUnauthorized, "GET", "/mw-dav/alice/a.txt", "", nil)
+	if w := d.expect(http.StatusOK, "OPTIONS", "/", "", nil); !strings.Contains(w.Header().Get("DAV"), "1") {
+		t.Fatalf("OPTIONS headers = %v", w.Header())
+	}
+}
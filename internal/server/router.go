@@ -4,12 +4,14 @@ import (
 	"HelaList/configs"
 	"HelaList/internal/bootstrap"
 	"HelaList/internal/rag"
+	"HelaList/internal/redis"
 	"HelaList/internal/repository"
 	"HelaList/internal/server/handler"
 	"HelaList/internal/server/middlewares"
 	"HelaList/internal/server/webdav"
 	"HelaList/internal/service"
 	"log"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,8 +24,10 @@ func Init() *gin.Engine {
 	r := gin.Default()
 	registerUserRoutes(r)
 	registerStorageRoutes(r)
+	registerDriverRoutes(r)
 	registerMetaRoutes(r)
 	registerFsRoutes(r)
+	registerTaskRoutes(r)
 	registerAIRoutes(r)
 	registerWebdavRoutes(r)
 	return r
@@ -74,11 +78,23 @@ func registerStorageRoutes(r *gin.Engine) {
 		storage.DELETE("/:id", handler.DeleteStorageHandler)
 		storage.GET("/all", handler.GetAllStoragesHandler)
 		storage.GET("/has/:mountPath", handler.HasStorageHandler)
+		// 健康信息里有后端的报错和延迟，手动检查还会重新初始化存储，只给管理员用
+		storage.GET("/health", middlewares.Auth(true), middlewares.AuthAdmin, handler.StorageHealthHandler)
+		storage.POST("/health/check", middlewares.Auth(true), middlewares.AuthAdmin, handler.StorageCheckHandler)
 		storage.GET("/:mountPath", handler.GetStorageByMountPathHandler)
 		storage.GET("/virtual-files", handler.GetStorageVirtualFilesByPathHandler)
 	}
 }
 
+func registerDriverRoutes(r *gin.Engine) {
+	api := r.Group("/api")
+	driver := api.Group("/driver")
+	{
+		driver.GET("/list", handler.DriverListHandler)
+		driver.GET("/info/:name", handler.DriverInfoHandler)
+	}
+}
+
 func registerMetaRoutes(r *gin.Engine) {
 	api := r.Group("/api")
 	meta := api.Group("/meta")
@@ -93,6 +109,23 @@ func registerMetaRoutes(r *gin.Engine) {
 	}
 }
 
+func registerTaskRoutes(r *gin.Engine) {
+	api := r.Group("/api")
+	t := api.Group("/task/:type")
+	t.Use(middlewares.Auth(true), middlewares.AuthNotGuest)
+	{
+		t.GET("/list", handler.TaskListHandler)
+		t.GET("/info", handler.TaskInfoHandler)
+		t.POST("/cancel", handler.TaskCancelHandler)
+		t.POST("/pause", handler.TaskPauseHandler)
+		t.POST("/resume", handler.TaskResumeHandler)
+		t.POST("/retry", handler.TaskRetryHandler)
+		t.POST("/delete", handler.TaskDeleteHandler)
+		t.POST("/clear_done", handler.TaskClearDoneHandler)
+		t.POST("/clear_succeeded", handler.TaskClearSucceededHandler)
+	}
+}
+
 func registerAIRoutes(r *gin.Engine) {
 	api := r.Group("/api")
 	ai := api.Group("/ai")
@@ -129,13 +162,44 @@ func registerWebdavRoutes(r *gin.Engine) {
 	// 创建 WebDAV Handler 实例
 	webdavHandler := &webdav.Handler{
 		Prefix:     "/webdav",
-		LockSystem: webdav.NewMemLS(), // 使用内存锁系统
-		// Logger: 可选的日志函数，用于记录错误
+		LockSystem: newWebdavLockSystem(),
+		DeadProps:  webdav.NewDBPropsHolder(), // PROPPATCH写入的属性存数据库，重启不丢
+		Logger: func(r *http.Request, err error) {
+			log.Printf("[webdav] %s %s: %+v", r.Method, r.URL.Path, err)
+		},
 	}
 
 	// 使用 gin.WrapH 将 http.Handler 包装为 Gin 中间件
-	// 支持 WebDAV 方法：OPTIONS, DELETE, MKCOL
-	r.Any("/webdav/*path", gin.WrapH(webdavHandler))
+	// r.Any 只覆盖标准HTTP方法，WebDAV扩展方法需要单独注册
+	dav := r.Group("/webdav")
+	dav.Use(middlewares.WebDAVAuth)
+	{
+		serve := gin.WrapH(webdavHandler)
+		dav.Any("", serve)
+		dav.Any("/*path", serve)
+		for _, method := range []string{"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK"} {
+			dav.Handle(method, "", serve)
+			dav.Handle(method, "/*path", serve)
+		}
+	}
+}
+
+// newWebdavLockSystem 按配置选择WebDAV锁系统，Redis不可用时退回内存锁
+func newWebdavLockSystem() webdav.LockSystem {
+	switch configs.Conf.Webdav.LockSystem {
+	case configs.WebdavLockRedis:
+		if redis.RedisService == nil {
+			bootstrap.InitRedis()
+		}
+		if redis.RedisService != nil {
+			return webdav.NewRedisLS(redis.RedisService)
+		}
+		log.Println("Redis is unavailable, WebDAV falls back to the in-memory lock system")
+	case configs.WebdavLockMemory, "":
+	default:
+		log.Printf("unknown webdav lock system %q, using the in-memory lock system", configs.Conf.Webdav.LockSystem)
+	}
+	return webdav.NewMemLS()
 }
 
 func registerFsRoutes(r *gin.Engine) {
@@ -149,9 +213,13 @@ func registerFsRoutes(r *gin.Engine) {
 		fs.POST("/mkdir", handler.FsMkdir)
 		fs.POST("/copy", handler.FsCopyHandler)
 		fs.POST("/move", handler.FsMoveHandler)
+		fs.POST("/decompress", handler.FsDecompressHandler)
+		fs.POST("/compress", handler.FsCompressHandler)
 		fs.POST("/rename", handler.FsRenameHandler)
 		fs.POST("/remove", handler.FsRemoveHandler)
 		fs.POST("/put", handler.FsPutHandler)
+		// 放进去的地址之后会由服务器代理访问，能指向内网，只给管理员用
+		fs.POST("/put_url", middlewares.AuthAdmin, handler.FsPutURLHandler)
 		fs.POST("/link", handler.FsLinkHandler)
 
 		// 下载、预览和流媒体相关路由
@@ -0,0 +1,189 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"sync"
+
+	"HelaList/internal/model"
+	"HelaList/internal/repository"
+)
+
+// NewMemPropsHolder 返回一个内存版的DeadPropsHolder，重启后属性会丢失，
+// 适合单机或者测试环境
+func NewMemPropsHolder() DeadPropsHolder {
+	return &memPropsHolder{
+		byName: make(map[string]map[xml.Name]Property),
+	}
+}
+
+type memPropsHolder struct {
+	mu     sync.RWMutex
+	byName map[string]map[xml.Name]Property
+}
+
+func (m *memPropsHolder) DeadProps(ctx context.Context, name string) (map[xml.Name]Property, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	props := m.byName[slashClean(name)]
+	if len(props) == 0 {
+		return nil, nil
+	}
+	ret := make(map[xml.Name]Property, len(props))
+	for k, v := range props {
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+func (m *memPropsHolder) Patch(ctx context.Context, name string, patches []Proppatch) ([]Propstat, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = slashClean(name)
+	pstat := Propstat{Status: http.StatusOK}
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			pstat.Props = append(pstat.Props, Property{XMLName: p.XMLName})
+			if patch.Remove {
+				delete(m.byName[name], p.XMLName)
+				continue
+			}
+			if m.byName[name] == nil {
+				m.byName[name] = make(map[xml.Name]Property)
+			}
+			m.byName[name][p.XMLName] = p
+		}
+	}
+	if len(m.byName[name]) == 0 {
+		delete(m.byName, name)
+	}
+	return []Propstat{pstat}, nil
+}
+
+func (m *memPropsHolder) Remove(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = slashClean(name)
+	prefix := strings.TrimSuffix(name, "/") + "/"
+	for k := range m.byName {
+		if k == name || strings.HasPrefix(k, prefix) {
+			delete(m.byName, k)
+		}
+	}
+	return nil
+}
+
+func (m *memPropsHolder) Copy(ctx context.Context, src, dst string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.copyLocked(slashClean(src), slashClean(dst), false)
+	return nil
+}
+
+func (m *memPropsHolder) Move(ctx context.Context, src, dst string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.copyLocked(slashClean(src), slashClean(dst), true)
+	return nil
+}
+
+// copyLocked 把src及其子路径的属性合并到dst下对应的路径，move为true时删除源
+func (m *memPropsHolder) copyLocked(src, dst string, move bool) {
+	prefix := strings.TrimSuffix(src, "/") + "/"
+	moved := make(map[string]map[xml.Name]Property)
+	for k, props := range m.byName {
+		if k != src && !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		moved[dst+strings.TrimPrefix(k, src)] = props
+		if move {
+			delete(m.byName, k)
+		}
+	}
+	for k, props := range moved {
+		if m.byName[k] == nil {
+			m.byName[k] = make(map[xml.Name]Property, len(props))
+		}
+		for n, p := range props {
+			m.byName[k][n] = p
+		}
+	}
+}
+
+// NewDBPropsHolder 返回一个存在数据库里的DeadPropsHolder，多个实例共享同一个库时属性也是共享的
+func NewDBPropsHolder() DeadPropsHolder {
+	return &dbPropsHolder{}
+}
+
+type dbPropsHolder struct{}
+
+func (d *dbPropsHolder) DeadProps(ctx context.Context, name string) (map[xml.Name]Property, error) {
+	rows, err := repository.GetDeadPropsByPath(slashClean(name))
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	ret := make(map[xml.Name]Property, len(rows))
+	for _, row := range rows {
+		n := xml.Name{Space: row.Space, Local: row.Local}
+		ret[n] = Property{
+			XMLName:  n,
+			Lang:     row.Lang,
+			InnerXML: []byte(row.InnerXML),
+		}
+	}
+	return ret, nil
+}
+
+func (d *dbPropsHolder) Patch(ctx context.Context, name string, patches []Proppatch) ([]Propstat, error) {
+	pstat := Propstat{Status: http.StatusOK}
+	// 同一个属性可能在一次PROPPATCH里先set后remove，按顺序折叠成最终结果再落库
+	final := make(map[xml.Name]*Property)
+	var order []xml.Name
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			pstat.Props = append(pstat.Props, Property{XMLName: p.XMLName})
+			if _, ok := final[p.XMLName]; !ok {
+				order = append(order, p.XMLName)
+			}
+			if patch.Remove {
+				final[p.XMLName] = nil
+				continue
+			}
+			final[p.XMLName] = &p
+		}
+	}
+	var set, remove []model.DeadProp
+	for _, n := range order {
+		if p := final[n]; p != nil {
+			set = append(set, model.DeadProp{
+				Space:    n.Space,
+				Local:    n.Local,
+				Lang:     p.Lang,
+				InnerXML: string(p.InnerXML),
+			})
+		} else {
+			remove = append(remove, model.DeadProp{Space: n.Space, Local: n.Local})
+		}
+	}
+	if err := repository.PatchDeadProps(slashClean(name), set, remove); err != nil {
+		return nil, err
+	}
+	return []Propstat{pstat}, nil
+}
+
+func (d *dbPropsHolder) Remove(ctx context.Context, name string) error {
+	return repository.DeleteDeadPropsByPath(slashClean(name))
+}
+
+func (d *dbPropsHolder) Copy(ctx context.Context, src, dst string) error {
+	return repository.CopyDeadProps(slashClean(src), slashClean(dst))
+}
+
+func (d *dbPropsHolder) Move(ctx context.Context, src, dst string) error {
+	return repository.MoveDeadProps(slashClean(src), slashClean(dst))
+}
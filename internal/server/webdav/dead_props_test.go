@@ -0,0 +1,153 @@
+package webdav
+
+import (
+	"HelaList/internal/driver/drivertest"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func prop(local, value string) Property {
+	return Property{XMLName: xml.Name{Space: "urn:test", Local: local}, InnerXML: []byte(value)}
+}
+
+// deadProps 把name上的属性拼成"名字=值"，按名字排序
+func deadProps(t *testing.T, h DeadPropsHolder, name string) string {
+	t.Helper()
+	props, err := h.DeadProps(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for n, p := range props {
+		res = append(res, n.Local+"="+string(p.InnerXML))
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
+func patchProps(t *testing.T, h DeadPropsHolder, name string, patches ...Proppatch) {
+	t.Helper()
+	pstats, err := h.Patch(context.Background(), name, patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pstats) != 1 || pstats[0].Status != http.StatusOK {
+		t.Fatalf("patch %s = %+v", name, pstats)
+	}
+}
+
+func TestDeadPropsHolders(t *testing.T) {
+	drivertest.SetupDB(t)
+	for name, h := range map[string]DeadPropsHolder{"mem": NewMemPropsHolder(), "db": NewDBPropsHolder()} {
+		t.Run(name, func(t *testing.T) {
+			// 库是共用的，每个子测试用自己的前缀
+			base := "/props-" + uuid.NewString()
+			ctx := context.Background()
+
+			patchProps(t, h, base+"/a.txt", Proppatch{Props: []Property{prop("color", "red"), prop("size", "big")}})
+			if got := deadProps(t, h, base+"/a.txt"); got != "color=red,size=big" {
+				t.Fatalf("props = %s", got)
+			}
+			// 同一次里先set后remove的按最后一步算，已有的值会被覆盖
+			patchProps(t, h, base+"/a.txt",
+				Proppatch{Props: []Property{prop("color", "blue"), prop("tmp", "x")}},
+				Proppatch{Remove: true, Props: []Property{prop("size", ""), prop("tmp", "")}},
+			)
+			if got := deadProps(t, h, base+"/a.txt"); got != "color=blue" {
+				t.Fatalf("props after patch = %s", got)
+			}
+
+			// 复制、移动带上子路径
+			patchProps(t, h, base+"/dir", Proppatch{Props: []Property{prop("p", "dir")}})
+			patchProps(t, h, base+"/dir/sub/b.txt", Proppatch{Props: []Property{prop("p", "b")}})
+			if err := h.Copy(ctx, base+"/dir", base+"/copy"); err != nil {
+				t.Fatal(err)
+			}
+			if err := h.Move(ctx, base+"/dir", base+"/moved"); err != nil {
+				t.Fatal(err)
+			}
+			for p, want := range map[string]string{
+				"/dir": "", "/dir/sub/b.txt": "",
+				"/copy": "p=dir", "/copy/sub/b.txt": "p=b",
+				"/moved": "p=dir", "/moved/sub/b.txt": "p=b",
+			} {
+				if got := deadProps(t, h, base+p); got != want {
+					t.Fatalf("%s = %q, want %q", p, got, want)
+				}
+			}
+
+			// 路径里的%和_是普通字符，删除不能波及别的资源，也要删掉自己下面的
+			for _, p := range []string{"/100%", "/100%/c", "/100x/c", "/a_b", "/a_b/c", "/axb/c"} {
+				patchProps(t, h, base+p, Proppatch{Props: []Property{prop("p", p)}})
+			}
+			for _, p := range []string{"/100%", "/a_b"} {
+				if err := h.Remove(ctx, base+p); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for p, want := range map[string]string{
+				"/100%": "", "/100%/c": "", "/100x/c": "p=/100x/c",
+				"/a_b": "", "/a_b/c": "", "/axb/c": "p=/axb/c",
+			} {
+				if got := deadProps(t, h, base+p); got != want {
+					t.Fatalf("%s after remove = %q, want %q", p, got, want)
+				}
+			}
+			if err := h.Copy(ctx, base+"/a_b", base+"/a_b2"); err != nil {
+				t.Fatal(err)
+			}
+			if got := deadProps(t, h, base+"/a_b2/c"); got != "" {
+				t.Fatalf("copy picked up another resource: %q", got)
+			}
+		})
+	}
+}
+
+// PROPPATCH写进去的属性，PROPFIND能读出来，删掉之后变成404
+func TestProppatch(t *testing.T) {
+	s := newDavServer(t, "/dav-proppatch")
+	s.h.DeadProps = NewDBPropsHolder()
+	s.expect(http.StatusCreated, "PUT", "/dav-proppatch/a.txt", "a")
+
+	ms := s.proppatch("/dav-proppatch/a.txt", `<?xml version="1.0"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:test">
+<D:set><D:prop><Z:color>red</Z:color></D:prop></D:set>
+</D:propertyupdate>`)
+	if len(ms.Responses) != 1 || !strings.Contains(ms.Responses[0].Propstat[0].Status, "200") {
+		t.Fatalf("set = %+v", ms)
+	}
+	find := `<?xml version="1.0"?>
+<D:propfind xmlns:D="DAV:" xmlns:Z="urn:test"><D:prop><Z:color/></D:prop></D:propfind>`
+	ms = s.propfind("/dav-proppatch/a.txt", "0", find)
+	if ps := ms.Responses[0].Propstat[0]; !strings.Contains(ps.Status, "200") || !strings.Contains(ps.Prop.Inner, ">red<") {
+		t.Fatalf("propfind after set = %+v", ms.Responses[0].Propstat)
+	}
+
+	s.proppatch("/dav-proppatch/a.txt", `<?xml version="1.0"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:test">
+<D:remove><D:prop><Z:color/></D:prop></D:remove>
+</D:propertyupdate>`)
+	ms = s.propfind("/dav-proppatch/a.txt", "0", find)
+	if ps := ms.Responses[0].Propstat[0]; !strings.Contains(ps.Status, "404") {
+		t.Fatalf("propfind after remove = %+v", ms.Responses[0].Propstat)
+	}
+}
+
+func (s *davServer) proppatch(path, body string) multistatus {
+	s.t.Helper()
+	w := s.do("PROPPATCH", path, body)
+	if w.Code != StatusMulti {
+		s.t.Fatalf("PROPPATCH %s = %d: %s", path, w.Code, w.Body.String())
+	}
+	var ms multistatus
+	if err := xml.Unmarshal(w.Body.Bytes(), &ms); err != nil {
+		s.t.Fatal(err)
+	}
+	return ms
+}
@@ -7,13 +7,18 @@ package webdav
 import (
 	"context"
 	"net/http"
+	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
 	"HelaList/configs"
 	"HelaList/internal/fs"
 	"HelaList/internal/model"
 	"HelaList/internal/op"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
 )
 
 // slashClean is equivalent to but slightly more efficient than
@@ -25,47 +30,251 @@ func slashClean(name string) string {
 	return path.Clean(name)
 }
 
+// isNotFound 判断fs层返回的错误是否表示对象不存在
+func isNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "object not found")
+}
+
+// copyMoveError 记录递归COPY时某个目标成员失败的原因，最终以multistatus的形式返回给客户端
+type copyMoveError struct {
+	reqPath string
+	status  int
+	err     error
+}
+
+// prepareDestination 按RFC 4918 9.8.4/9.9.3检查COPY/MOVE的目标：
+// 目标不存在时其父目录必须存在；目标已存在时Overwrite为F返回412，为T则先删掉目标。
+// created表示目标之前不存在，调用方据此返回201还是204
+func prepareDestination(ctx context.Context, dst string, overwrite bool) (created bool, status int, err error) {
+	if _, err := fs.Get(ctx, dst); err != nil {
+		if !isNotFound(err) {
+			return false, http.StatusInternalServerError, err
+		}
+		// RFC 4918 9.8.5/9.9.4
+		// 409 (Conflict) - A resource cannot be created at the destination until
+		// one or more intermediate collections have been created.
+		if _, err := fs.Get(ctx, path.Dir(dst)); err != nil {
+			if isNotFound(err) {
+				return false, http.StatusConflict, err
+			}
+			return false, http.StatusInternalServerError, err
+		}
+		return true, 0, nil
+	}
+	if !overwrite {
+		return false, http.StatusPreconditionFailed, os.ErrExist
+	}
+	// Section 9.9.3 says that "If a resource exists at the destination
+	// and the Overwrite header is "T", then prior to performing the move,
+	// the server must perform a DELETE with "Depth: infinity" on the
+	// destination resource.
+	if err := fs.Remove(ctx, dst); err != nil {
+		return false, http.StatusForbidden, err
+	}
+	return false, 0, nil
+}
+
 // moveFiles moves files and/or directories from src to dst.
 //
+// 驱动只提供"移动到某目录"和"原地改名"两种操作，目录和名字都变时拆成两步，
+// 先做哪一步取决于哪边不会撞名。跨存储的移动由fs层处理。
+//
 // See section 9.9.4 for when various HTTP status codes apply.
 func moveFiles(ctx context.Context, src, dst string, overwrite bool) (status int, err error) {
-	srcDir := path.Dir(src)
-	dstDir := path.Dir(dst)
-	srcName := path.Base(src)
-	dstName := path.Base(dst)
-	// user := ctx.Value(configs.UserKey).(*model.User)
-	if srcDir != dstDir {
-		return http.StatusForbidden, nil
+	if _, err := fs.Get(ctx, src); err != nil {
+		if isNotFound(err) {
+			return http.StatusNotFound, err
+		}
+		return http.StatusInternalServerError, err
 	}
-	if srcName != dstName {
-		return http.StatusForbidden, nil
+	created, status, err := prepareDestination(ctx, dst, overwrite)
+	if err != nil {
+		return status, err
 	}
-	if srcDir == dstDir {
+
+	srcDir, srcName := path.Split(src)
+	dstDir, dstName := path.Split(dst)
+	srcDir, dstDir = path.Clean(srcDir), path.Clean(dstDir)
+	noTaskCtx := context.WithValue(ctx, configs.NoTaskKey, struct{}{})
+	switch {
+	case srcDir == dstDir:
 		err = fs.Rename(ctx, src, dstName)
-	} else {
-		err = fs.Move(context.WithValue(ctx, configs.NoTaskKey, struct{}{}), src, dstDir)
-		if err != nil {
+	case srcName == dstName:
+		_, err = fs.Move(noTaskCtx, src, dstDir)
+	default:
+		if _, e := fs.Get(ctx, path.Join(dstDir, srcName)); isNotFound(e) {
+			// 目标目录里没有同名对象：先移动，再在目标目录里改名
+			if _, err = fs.Move(noTaskCtx, src, dstDir); err == nil {
+				err = fs.Rename(ctx, path.Join(dstDir, srcName), dstName)
+			}
+		} else if _, e := fs.Get(ctx, path.Join(srcDir, dstName)); isNotFound(e) {
+			// 源目录里没有和新名字同名的对象：先原地改名，再移动
+			if err = fs.Rename(ctx, src, dstName); err == nil {
+				if _, err = fs.Move(noTaskCtx, path.Join(srcDir, dstName), dstDir); err != nil {
+					// 移动失败时把名字改回去，别让源对象凭空换了名字
+					_ = fs.Rename(ctx, path.Join(srcDir, dstName), srcName)
+				}
+			}
+		} else {
+			// 两边都撞名，和COPY一样借目标目录下的临时目录中转
+			err = moveVia(noTaskCtx, src, dstDir, dstName)
+		}
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if created {
+		return http.StatusCreated, nil
+	}
+	return http.StatusNoContent, nil
+}
+
+// copyFiles copies files and/or directories from src to dst.
+//
+// 能整棵复制时直接交给fs.Copy（同存储由驱动完成，跨存储由fs层流式复制）；
+// 需要改名而目标目录里又有同名对象时，退化为逐个成员复制，
+// 单个成员失败不会中断整个COPY，失败项记录在errs里。
+//
+// See section 9.8.5 for when various HTTP status codes apply.
+func copyFiles(ctx context.Context, src, dst string, overwrite bool, depth int, recursion int, errs *[]copyMoveError) (status int, err error) {
+	if recursion == 1000 {
+		return http.StatusInternalServerError, errRecursionTooDeep
+	}
+	recursion++
+
+	srcObj, err := fs.Get(ctx, src)
+	if err != nil {
+		if isNotFound(err) {
+			return http.StatusNotFound, err
+		}
+		return http.StatusInternalServerError, err
+	}
+	created, status, err := prepareDestination(ctx, dst, overwrite)
+	if err != nil {
+		return status, err
+	}
+	status = http.StatusNoContent
+	if created {
+		status = http.StatusCreated
+	}
+
+	if srcObj.IsDir() && depth == 0 {
+		// Section 9.8.3 says that a COPY with "Depth: 0" only instructs
+		// that the collection and its properties, but not resources
+		// identified by its internal member URLs, are to be copied.
+		if err := fs.MakeDir(ctx, dst); err != nil {
 			return http.StatusInternalServerError, err
 		}
-		if srcName != dstName {
-			err = fs.Rename(ctx, path.Join(dstDir, srcName), dstName)
+		return status, nil
+	}
+
+	srcName := path.Base(src)
+	dstDir, dstName := path.Dir(dst), path.Base(dst)
+	noTaskCtx := context.WithValue(ctx, configs.NoTaskKey, struct{}{})
+	if srcName == dstName {
+		if _, err := fs.Copy(noTaskCtx, src, dstDir); err != nil {
+			return http.StatusInternalServerError, err
 		}
+		return status, nil
 	}
+	if _, e := fs.Get(ctx, path.Join(dstDir, srcName)); isNotFound(e) {
+		if _, err := fs.Copy(noTaskCtx, src, dstDir); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if err := fs.Rename(ctx, path.Join(dstDir, srcName), dstName); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return status, nil
+	}
+	if !srcObj.IsDir() {
+		// 目标目录里有同名对象(比如在同一个目录里复制出一个新名字)，先复制到临时目录里改好名再移过去
+		if err := copyFileVia(noTaskCtx, src, dstDir, dstName); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return status, nil
+	}
+
+	// 目标目录里有同名对象，没法先复制再改名：建好目标目录后逐个复制成员
+	if err := fs.MakeDir(ctx, dst); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	objs, err := fs.List(ctx, src, &fs.ListArgs{})
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	// TODO if there are no files copy, should return 204
-	return http.StatusCreated, nil
+	for _, obj := range objs {
+		name := obj.GetName()
+		s, err := copyFiles(ctx, path.Join(src, name), path.Join(dst, name), overwrite, depth, recursion, errs)
+		if err != nil {
+			*errs = append(*errs, copyMoveError{reqPath: path.Join(dst, name), status: s, err: err})
+		}
+	}
+	return status, nil
 }
 
-func copyFiles(ctx context.Context, src, dst string, overwrite bool) (status int, err error) {
-	dstDir := path.Dir(dst)
-	err = fs.Copy(context.WithValue(ctx, configs.NoTaskKey, struct{}{}), src, dstDir)
+// copyFileVia 把文件复制到dstDir下的临时目录，改名为dstName后移到dstDir，最后删掉临时目录
+func copyFileVia(ctx context.Context, src, dstDir, dstName string) error {
+	tmpDir := path.Join(dstDir, ".webdav-copy-"+uuid.NewString())
+	if err := fs.MakeDir(ctx, tmpDir); err != nil {
+		return err
+	}
+	defer func() {
+		if err := fs.Remove(ctx, tmpDir); err != nil {
+			log.Warnf("webdav: failed remove %s: %v", tmpDir, err)
+		}
+	}()
+	if _, err := fs.Copy(ctx, src, tmpDir); err != nil {
+		return err
+	}
+	tmpPath := path.Join(tmpDir, path.Base(src))
+	if path.Base(src) != dstName {
+		if err := fs.Rename(ctx, tmpPath, dstName); err != nil {
+			return err
+		}
+		tmpPath = path.Join(tmpDir, dstName)
+	}
+	_, err := fs.Move(ctx, tmpPath, dstDir)
+	return err
+}
+
+// moveVia 把src移到dstDir下的临时目录，改名为dstName后移到dstDir，最后删掉临时目录。
+// 中途失败时把源对象移回原处；移不回去就留着临时目录，不能连同源对象一起删掉
+func moveVia(ctx context.Context, src, dstDir, dstName string) error {
+	srcDir, srcName := path.Split(src)
+	tmpDir := path.Join(dstDir, ".webdav-copy-"+uuid.NewString())
+	if err := fs.MakeDir(ctx, tmpDir); err != nil {
+		return err
+	}
+	removeTmp := func() {
+		if err := fs.Remove(ctx, tmpDir); err != nil {
+			log.Warnf("webdav: failed remove %s: %v", tmpDir, err)
+		}
+	}
+	if _, err := fs.Move(ctx, src, tmpDir); err != nil {
+		removeTmp()
+		return err
+	}
+	tmpPath := path.Join(tmpDir, srcName)
+	err := fs.Rename(ctx, tmpPath, dstName)
+	if err == nil {
+		tmpPath = path.Join(tmpDir, dstName)
+		_, err = fs.Move(ctx, tmpPath, dstDir)
+	}
 	if err != nil {
-		return http.StatusInternalServerError, err
+		var restoreErr error
+		if tmpPath != path.Join(tmpDir, srcName) {
+			restoreErr = fs.Rename(ctx, tmpPath, srcName)
+		}
+		if restoreErr == nil {
+			_, restoreErr = fs.Move(ctx, path.Join(tmpDir, srcName), path.Clean(srcDir))
+		}
+		if restoreErr != nil {
+			log.Errorf("webdav: failed move %s back, it is left in %s: %v", src, tmpDir, restoreErr)
+			return err
+		}
 	}
-	// TODO if there are no files copy, should return 204
-	return http.StatusCreated, nil
+	removeTmp()
+	return err
 }
 
 // walkFS traverses filesystem fs starting at name up to depth levels.
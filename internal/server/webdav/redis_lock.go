@@ -0,0 +1,382 @@
+package webdav
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"HelaList/internal/redis"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// 多实例部署时锁必须放在所有节点都能看到的地方，这里把整张锁表序列化后存进Redis的一个key，
+// 每次操作前先用Service.Lock拿到分布式互斥锁，读出锁表、按memLS同样的规则判断，再写回去。
+// WebDAV同时存在的锁一般只有几十个，整表读写的开销可以接受，换来的是和memLS完全一致的语义。
+const (
+	redisLSKey      = "webdav:ls"
+	redisLSMutexKey = "webdav:ls:mutex"
+	// 互斥锁的过期时间，防止持有者进程崩溃后整个锁表被永久卡死
+	redisLSMutexTTL = 5 * time.Second
+	// 等待互斥锁的最长时间
+	redisLSMutexWait = 3 * time.Second
+	// Confirm持有锁的最长时间。节点在请求处理中途崩溃时不会调用release，
+	// 超过这个时间后认为持有已失效，其他节点可以继续使用这把锁
+	redisLSHoldTTL = 30 * time.Minute
+	// 无限期的锁（包括请求期间的临时锁）实际只给这么长的租期，
+	// 创建或刷新它的节点每隔三分之一租期续一次，节点崩溃后锁最多再留一个租期
+	redisLSLease = 3 * time.Minute
+)
+
+var errRedisLSBusy = errors.New("webdav: timed out waiting for the redis lock table")
+
+// redisLSRecord 是锁表里的一条锁，对应memLS里token非空的节点
+type redisLSRecord struct {
+	Root      string `json:"root"`
+	Duration  int64  `json:"duration"` // 纳秒，负数表示永不过期
+	OwnerXML  string `json:"owner_xml"`
+	ZeroDepth bool   `json:"zero_depth"`
+	// Expiry 是过期时间的UnixNano，Duration为负时是租期的结束时间
+	Expiry int64 `json:"expiry"`
+	// HeldUntil 非0表示正被某次请求的Confirm持有，到这个时间点为止
+	HeldUntil int64 `json:"held_until"`
+}
+
+func (r *redisLSRecord) details() LockDetails {
+	return LockDetails{
+		Root:      r.Root,
+		Duration:  time.Duration(r.Duration),
+		OwnerXML:  r.OwnerXML,
+		ZeroDepth: r.ZeroDepth,
+	}
+}
+
+func (r *redisLSRecord) held(now time.Time) bool {
+	return r.HeldUntil != 0 && now.UnixNano() < r.HeldUntil
+}
+
+func (r *redisLSRecord) setExpiry(now time.Time) {
+	d := time.Duration(r.Duration)
+	if d < 0 {
+		d = redisLSLease
+	}
+	r.Expiry = now.Add(d).UnixNano()
+}
+
+// redisLSStore 是redisLS用到的Redis操作，*redis.Service实现了它
+type redisLSStore interface {
+	Lock(key string, expiration time.Duration) (string, bool, error)
+	Unlock(key, token string) error
+	GetFromMaster(key string, dest interface{}) error
+	Set(key string, value interface{}, expiration time.Duration) error
+	Del(keys ...string) error
+}
+
+// NewRedisLS 返回一个基于Redis的LockSystem，多个HelaList实例共享同一份锁。
+// 各节点用请求时间判断过期，所以节点之间的时钟需要大致同步
+func NewRedisLS(s *redis.Service) LockSystem {
+	return newRedisLS(s)
+}
+
+func newRedisLS(s redisLSStore) *redisLS {
+	return &redisLS{s: s, owned: make(map[string]struct{})}
+}
+
+type redisLS struct {
+	s redisLSStore
+
+	mu sync.Mutex
+	// owned 本节点要续租的无限期锁
+	owned    map[string]struct{}
+	renewing bool
+}
+
+// withTable 在分布式互斥锁内读出锁表，执行fn，fn返回true时把锁表写回
+func (l *redisLS) withTable(now time.Time, fn func(table map[string]*redisLSRecord) (bool, error)) error {
+	deadline := time.Now().Add(redisLSMutexWait)
+	var mutex string
+	for {
+		token, ok, err := l.s.Lock(redisLSMutexKey, redisLSMutexTTL)
+		if err != nil {
+			return err
+		}
+		if ok {
+			mutex = token
+			break
+		}
+		if time.Now().After(deadline) {
+			return errRedisLSBusy
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer l.s.Unlock(redisLSMutexKey, mutex)
+
+	table := make(map[string]*redisLSRecord)
+	if err := l.s.GetFromMaster(redisLSKey, &table); err != nil && !errors.Is(err, goredis.Nil) {
+		return err
+	}
+	changed := collectExpiredRecords(table, now)
+	dirty, err := fn(table)
+	if err != nil {
+		return err
+	}
+	if !changed && !dirty {
+		return nil
+	}
+	if len(table) == 0 {
+		return l.s.Del(redisLSKey)
+	}
+	return l.s.Set(redisLSKey, table, tableTTL(table, now))
+}
+
+// tableTTL 锁表本身也要过期：所有锁都过期、也没人持有之后，整个key就没用了
+func tableTTL(table map[string]*redisLSRecord, now time.Time) time.Duration {
+	var last int64
+	for _, r := range table {
+		last = max(last, r.Expiry, r.HeldUntil)
+	}
+	return max(time.Duration(last-now.UnixNano()), time.Second)
+}
+
+// own 记下本节点要续租的锁，需要时启动续租的goroutine
+func (l *redisLS) own(token string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.owned[token] = struct{}{}
+	if !l.renewing {
+		l.renewing = true
+		go l.renewLoop()
+	}
+}
+
+func (l *redisLS) disown(token string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.owned, token)
+}
+
+// renewLoop 定期续租，没有要续的锁时退出
+func (l *redisLS) renewLoop() {
+	ticker := time.NewTicker(redisLSLease / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.mu.Lock()
+		if len(l.owned) == 0 {
+			l.renewing = false
+			l.mu.Unlock()
+			return
+		}
+		l.mu.Unlock()
+		_ = l.renew(time.Now())
+	}
+}
+
+// renew 把本节点持有的无限期锁的租期从now起延长一个redisLSLease，
+// 锁表里已经没有的（被别的节点解锁了）不再续
+func (l *redisLS) renew(now time.Time) error {
+	l.mu.Lock()
+	tokens := make([]string, 0, len(l.owned))
+	for t := range l.owned {
+		tokens = append(tokens, t)
+	}
+	l.mu.Unlock()
+	return l.withTable(now, func(table map[string]*redisLSRecord) (bool, error) {
+		dirty := false
+		for _, t := range tokens {
+			r := table[t]
+			if r == nil || r.Duration >= 0 {
+				l.disown(t)
+				continue
+			}
+			r.setExpiry(now)
+			dirty = true
+		}
+		return dirty, nil
+	})
+}
+
+// collectExpiredRecords 删除已过期且没有被持有的锁，返回锁表是否有变化
+func collectExpiredRecords(table map[string]*redisLSRecord, now time.Time) bool {
+	changed := false
+	for token, r := range table {
+		if r.held(now) {
+			continue
+		}
+		if r.HeldUntil != 0 {
+			// 持有者超时没有release，视为已释放
+			r.HeldUntil = 0
+			changed = true
+		}
+		if now.UnixNano() >= r.Expiry {
+			delete(table, token)
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (l *redisLS) Confirm(now time.Time, name0, name1 string, conditions ...Condition) (func(), error) {
+	var t0, t1 string
+	err := l.withTable(now, func(table map[string]*redisLSRecord) (bool, error) {
+		if name0 != "" {
+			if t0 = redisLSLookup(table, now, slashClean(name0), conditions...); t0 == "" {
+				return false, ErrConfirmationFailed
+			}
+		}
+		if name1 != "" {
+			if t1 = redisLSLookup(table, now, slashClean(name1), conditions...); t1 == "" {
+				return false, ErrConfirmationFailed
+			}
+		}
+		// Don't hold the same lock twice.
+		if t1 == t0 {
+			t1 = ""
+		}
+		heldUntil := now.Add(redisLSHoldTTL).UnixNano()
+		for _, t := range []string{t0, t1} {
+			if t != "" {
+				table[t].HeldUntil = heldUntil
+			}
+		}
+		return t0 != "" || t1 != "", nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if t0 == "" && t1 == "" {
+			return
+		}
+		_ = l.withTable(time.Now(), func(table map[string]*redisLSRecord) (bool, error) {
+			for _, t := range []string{t0, t1} {
+				r := table[t]
+				if t == "" || r == nil {
+					continue
+				}
+				// 和memLS的unhold一样只是取消持有，过期时间保持不变
+				r.HeldUntil = 0
+			}
+			return true, nil
+		})
+	}, nil
+}
+
+// redisLSLookup 与memLS.lookup相同：返回锁住name且匹配某个条件、当前没被持有的锁的token
+func redisLSLookup(table map[string]*redisLSRecord, now time.Time, name string, conditions ...Condition) string {
+	// TODO: support Condition.Not and Condition.ETag.
+	for _, c := range conditions {
+		r := table[c.Token]
+		if r == nil || r.held(now) {
+			continue
+		}
+		if name == r.Root {
+			return c.Token
+		}
+		if r.ZeroDepth {
+			continue
+		}
+		if r.Root == "/" || strings.HasPrefix(name, r.Root+"/") {
+			return c.Token
+		}
+	}
+	return ""
+}
+
+func (l *redisLS) Create(now time.Time, details LockDetails) (string, error) {
+	details.Root = slashClean(details.Root)
+	token := "opaquelocktoken:" + uuid.NewString()
+	err := l.withTable(now, func(table map[string]*redisLSRecord) (bool, error) {
+		if !redisLSCanCreate(table, details.Root, details.ZeroDepth) {
+			return false, ErrLocked
+		}
+		r := &redisLSRecord{
+			Root:      details.Root,
+			Duration:  int64(details.Duration),
+			OwnerXML:  details.OwnerXML,
+			ZeroDepth: details.ZeroDepth,
+		}
+		r.setExpiry(now)
+		table[token] = r
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if details.Duration < 0 {
+		l.own(token)
+	}
+	return token, nil
+}
+
+// redisLSCanCreate 与memLS.canCreate规则一致
+func redisLSCanCreate(table map[string]*redisLSRecord, name string, zeroDepth bool) bool {
+	for _, r := range table {
+		switch {
+		case r.Root == name:
+			// The target node is already locked.
+			return false
+		case isDescendant(r.Root, name):
+			// A descendent of the target node is locked, which conflicts with
+			// an infinite depth lock.
+			if !zeroDepth {
+				return false
+			}
+		case isDescendant(name, r.Root):
+			// An ancestor of the target node is locked with infinite depth.
+			if !r.ZeroDepth {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isDescendant 判断name是否在root之下（不含root本身）
+func isDescendant(name, root string) bool {
+	if root == "/" {
+		return name != "/"
+	}
+	return strings.HasPrefix(name, root+"/")
+}
+
+func (l *redisLS) Refresh(now time.Time, token string, duration time.Duration) (LockDetails, error) {
+	var ld LockDetails
+	err := l.withTable(now, func(table map[string]*redisLSRecord) (bool, error) {
+		r := table[token]
+		if r == nil {
+			return false, ErrNoSuchLock
+		}
+		if r.held(now) {
+			return false, ErrLocked
+		}
+		r.Duration = int64(duration)
+		r.setExpiry(now)
+		ld = r.details()
+		return true, nil
+	})
+	if err == nil && duration < 0 {
+		// 锁可能是别的节点建的，那个节点不在了也要有人续
+		l.own(token)
+	}
+	return ld, err
+}
+
+func (l *redisLS) Unlock(now time.Time, token string) error {
+	err := l.withTable(now, func(table map[string]*redisLSRecord) (bool, error) {
+		r := table[token]
+		if r == nil {
+			return false, ErrNoSuchLock
+		}
+		if r.held(now) {
+			return false, ErrLocked
+		}
+		delete(table, token)
+		return true, nil
+	})
+	if err == nil {
+		l.disown(token)
+	}
+	return err
+}
@@ -0,0 +1,168 @@
+package webdav
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// fakeRedis 假的Redis，几个redisLS共用一个就相当于几个节点
+type fakeRedis struct {
+	mu        sync.Mutex
+	data      map[string][]byte
+	ttl       map[string]time.Duration
+	locks     map[string]string
+	seq       int
+	badUnlock int
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{data: make(map[string][]byte), ttl: make(map[string]time.Duration), locks: make(map[string]string)}
+}
+
+func (f *fakeRedis) Lock(key string, expiration time.Duration) (string, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.locks[key]; ok {
+		return "", false, nil
+	}
+	f.seq++
+	token := strconv.Itoa(f.seq)
+	f.locks[key] = token
+	return token, true, nil
+}
+
+func (f *fakeRedis) Unlock(key, token string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.locks[key] != token {
+		f.badUnlock++
+		return nil
+	}
+	delete(f.locks, key)
+	return nil
+}
+
+func (f *fakeRedis) GetFromMaster(key string, dest interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.data[key]
+	if !ok {
+		return goredis.Nil
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (f *fakeRedis) Set(key string, value interface{}, expiration time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, err := json.Marshal(value)
+	f.data[key], f.ttl[key] = data, expiration
+	return err
+}
+
+func (f *fakeRedis) Del(keys ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range keys {
+		delete(f.data, key)
+		delete(f.ttl, key)
+	}
+	return nil
+}
+
+func (f *fakeRedis) tableTTL() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ttl[redisLSKey]
+}
+
+func (l *redisLS) ownedCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.owned)
+}
+
+// 节点崩溃后没人续租，无限期的锁过一个租期就失效
+func TestRedisLSInfiniteLockExpiresWithoutRenewal(t *testing.T) {
+	store := newFakeRedis()
+	a, b := newRedisLS(store), newRedisLS(store)
+	now := time.Now()
+	if _, err := a.Create(now, LockDetails{Root: "/a", Duration: infiniteTimeout}); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := store.tableTTL(); ttl <= 0 || ttl > redisLSLease {
+		t.Fatalf("table ttl = %v", ttl)
+	}
+	if _, err := b.Create(now.Add(redisLSLease-time.Second), LockDetails{Root: "/a", Duration: infiniteTimeout}); err != ErrLocked {
+		t.Fatalf("err = %v, want ErrLocked", err)
+	}
+	if _, err := b.Create(now.Add(redisLSLease+time.Second), LockDetails{Root: "/a", Duration: infiniteTimeout}); err != nil {
+		t.Fatal(err)
+	}
+	if store.badUnlock != 0 {
+		t.Fatalf("%d unlocks with a wrong token", store.badUnlock)
+	}
+}
+
+func TestRedisLSRenew(t *testing.T) {
+	store := newFakeRedis()
+	a, b := newRedisLS(store), newRedisLS(store)
+	now := time.Now()
+	token, err := a.Create(now, LockDetails{Root: "/a", Duration: infiniteTimeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 有限期的锁不用续
+	if _, err = a.Create(now, LockDetails{Root: "/b", Duration: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if n := a.ownedCount(); n != 1 {
+		t.Fatalf("owned = %d", n)
+	}
+	renewed := now.Add(redisLSLease / 2)
+	if err = a.renew(renewed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Create(now.Add(redisLSLease+time.Second), LockDetails{Root: "/a", Duration: infiniteTimeout}); err != ErrLocked {
+		t.Fatalf("err = %v, want ErrLocked", err)
+	}
+
+	// 别的节点解锁以后，续租时不再管它
+	if err = b.Unlock(renewed, token); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.renew(renewed); err != nil {
+		t.Fatal(err)
+	}
+	if n := a.ownedCount(); n != 0 {
+		t.Fatalf("owned = %d after unlock elsewhere", n)
+	}
+}
+
+// 请求结束时临时锁解掉，也不用再续
+func TestRedisLSTemporaryLock(t *testing.T) {
+	store := newFakeRedis()
+	l := newRedisLS(store)
+	h := &Handler{LockSystem: l}
+	token, _, err := h.lock(time.Now(), "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := l.ownedCount(); n != 1 {
+		t.Fatalf("owned = %d", n)
+	}
+	if err = l.Unlock(time.Now(), token); err != nil {
+		t.Fatal(err)
+	}
+	if n := l.ownedCount(); n != 0 {
+		t.Fatalf("owned = %d", n)
+	}
+	if _, ok := store.data[redisLSKey]; ok {
+		t.Fatal("empty lock table should be deleted")
+	}
+}
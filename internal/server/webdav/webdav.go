@@ -1,18 +1,27 @@
 package webdav
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"HelaList/internal/fs"
 	"HelaList/internal/model"
+	"HelaList/internal/op"
+	"HelaList/internal/server/common"
+	"HelaList/internal/stream"
 
 	"HelaList/configs"
+
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 )
 
 type Handler struct {
@@ -20,6 +29,9 @@ type Handler struct {
 	Prefix string
 	// LockSystem is the lock management system.
 	LockSystem LockSystem
+	// DeadProps stores the properties set by PROPPATCH. If nil, every
+	// PROPPATCH is answered with 403 Forbidden.
+	DeadProps DeadPropsHolder
 	// Logger is an optional error logger. If non-nil, it will be called
 	// for all HTTP requests.
 	Logger func(*http.Request, error)
@@ -45,6 +57,10 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "OPTIONS":
 			status, err = h.handleOptions(brw, r)
+		case "GET", "HEAD", "POST":
+			// 文件内容直接流式写给客户端，不能先缓存在内存里
+			useBufferedWriter = false
+			status, err = h.handleGetHeadPost(w, r)
 		case "DELETE":
 			status, err = h.handleDelete(brw, r)
 		case "MKCOL":
@@ -53,10 +69,28 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			status, err = h.handleCopyMove(brw, r)
 		case "COPY":
 			status, err = h.handleCopyMove(brw, r)
+		case "PUT":
+			status, err = h.handlePut(brw, r)
+		case "LOCK":
+			status, err = h.handleLock(brw, r)
+		case "UNLOCK":
+			status, err = h.handleUnlock(brw, r)
+		case "PROPFIND":
+			status, err = h.handlePropfind(brw, r)
+		case "PROPPATCH":
+			status, err = h.handleProppatch(brw, r)
 		}
 	}
 
 	if status != 0 {
+		// 处理器可能已经在brw上设置了头部（比如PUT返回的Etag），这里一并带上
+		if useBufferedWriter {
+			for k, vs := range brw.Header() {
+				for _, v := range vs {
+					w.Header().Add(k, v)
+				}
+			}
+		}
 		w.WriteHeader(status)
 		if status != http.StatusNoContent {
 			w.Write([]byte(StatusText(status)))
@@ -84,6 +118,8 @@ func (h *Handler) lock(now time.Time, root string) (token string, status int, er
 	return token, 0, nil
 }
 
+// confirmLocks 中的src和dst都是拼上用户BasePath之后的完整路径，
+// 这样不同用户的同名路径不会互相锁住
 func (h *Handler) confirmLocks(r *http.Request, src, dst string) (release func(), status int, err error) {
 	hdr := r.Header.Get("If")
 	if hdr == "" {
@@ -123,6 +159,7 @@ func (h *Handler) confirmLocks(r *http.Request, src, dst string) (release func()
 	if !ok {
 		return nil, http.StatusBadRequest, errInvalidIfHeader
 	}
+	user := r.Context().Value(configs.UserKey).(*model.User)
 	// ih is a disjunction (OR) of ifLists, so any ifList will do.
 	for _, l := range ih.lists {
 		lsrc := l.resourceTag
@@ -140,6 +177,10 @@ func (h *Handler) confirmLocks(r *http.Request, src, dst string) (release func()
 			if err != nil {
 				return nil, status, err
 			}
+			lsrc, err = user.JoinPath(lsrc)
+			if err != nil {
+				return nil, http.StatusForbidden, err
+			}
 		}
 		release, err = h.LockSystem.Confirm(time.Now(), lsrc, dst, l.conditions...)
 		if err == ErrConfirmationFailed {
@@ -184,23 +225,213 @@ func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) (status
 	return 0, nil
 }
 
-func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) (status int, err error) {
+// writtenResponseWriter 记录是否已经向客户端写过内容，
+// 代理中途出错时就不能再写一次错误状态码了
+type writtenResponseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *writtenResponseWriter) WriteHeader(statusCode int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *writtenResponseWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (h *Handler) handleGetHeadPost(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	reqPath, status, err := h.stripPrefix(r.URL.Path)
+	if err != nil {
+		return status, err
+	}
+	// TODO: check locks for read-only access??
+	ctx := r.Context()
+	user := ctx.Value(configs.UserKey).(*model.User)
+	reqPath, err = user.JoinPath(reqPath)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+	fi, err := fs.Get(ctx, reqPath)
+	if err != nil {
+		if strings.Contains(err.Error(), "object not found") {
+			return http.StatusNotFound, err
+		}
+		return http.StatusMethodNotAllowed, err
+	}
+	if fi.IsDir() {
+		return http.StatusMethodNotAllowed, nil
+	}
+	etag, err := findETag(ctx, h.LockSystem, reqPath, fi)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("ETag", etag)
+	if r.Method == http.MethodHead {
+		// HEAD只需要元信息，不必去驱动那里拿下载链接
+		w.Header().Set("Content-Type", utils.GetMimeType(fi.GetName()))
+		w.Header().Set("Content-Length", strconv.FormatInt(fi.GetSize(), 10))
+		w.Header().Set("Last-Modified", fi.GetModifiedTime().UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		return 0, nil
+	}
+	storage, _, err := op.GetStorageAndActualPath(reqPath)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if storage.GetStorage().Webdav302() {
+		link, _, err := fs.Link(ctx, reqPath, model.LinkArgs{
+			IP:       utils.ClientIP(r),
+			Header:   r.Header,
+			Redirect: true,
+		})
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		defer link.Close()
+		if link.URL != "" {
+			http.Redirect(w, r, link.URL, http.StatusFound)
+			return 0, nil
+		}
+		// 没有直链的驱动（比如只给MFile的）退回到代理
+		return h.proxyLink(w, r, link, fi)
+	}
+	link, _, err := fs.Link(ctx, reqPath, model.LinkArgs{
+		IP:     utils.ClientIP(r),
+		Header: r.Header,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return h.proxyLink(w, r, link, fi)
+}
+
+// proxyLink 由服务端中转文件内容。WebDAV客户端普遍依赖Range断点续传，所以总是转发Range头
+func (h *Handler) proxyLink(w http.ResponseWriter, r *http.Request, link *model.Link, fi model.Obj) (status int, err error) {
+	ww := &writtenResponseWriter{ResponseWriter: w}
+	if err := common.ProxyHTTP(ww, r, link, fi, true); err != nil {
+		if ww.written {
+			// 已经开始回传数据了，只能记录错误
+			return 0, err
+		}
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+}
+
+func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	defer func() {
+		// 驱动可能没把请求体读完，这里读干净，避免连接没法复用
+		if n, _ := io.ReadFull(r.Body, []byte{0}); n == 1 {
+			_, _ = utils.CopyWithBuffer(io.Discard, r.Body)
+		}
+		_ = r.Body.Close()
+	}()
 	reqPath, status, err := h.stripPrefix(r.URL.Path)
 	if err != nil {
 		return status, err
 	}
+	if reqPath == "" {
+		return http.StatusMethodNotAllowed, nil
+	}
+	ctx := r.Context()
+	user := ctx.Value(configs.UserKey).(*model.User)
+	reqPath, err = user.JoinPath(reqPath)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
 	release, status, err := h.confirmLocks(r, reqPath, "")
 	if err != nil {
 		return status, err
 	}
 	defer release()
+	// RFC 4918 §9.7.1：覆盖已有的资源返回204，新建的返回201，所以写之前先看一下在不在
+	existed := false
+	if fi, err := fs.Get(ctx, reqPath); err == nil {
+		if fi.IsDir() {
+			return http.StatusMethodNotAllowed, nil
+		}
+		existed = true
+	} else if !strings.Contains(err.Error(), "object not found") {
+		return http.StatusInternalServerError, err
+	}
+	// TODO(rost): Support the If-Match, If-None-Match headers? See bradfitz'
+	// comments in http.checkEtag.
+	obj := model.Object{
+		Name:         path.Base(reqPath),
+		Size:         r.ContentLength,
+		ModifiedTime: h.getModTime(r),
+		CreatedTime:  h.getCreateTime(r),
+	}
+	fsStream := &stream.FileStream{
+		Ctx:      ctx,
+		Obj:      &obj,
+		Reader:   r.Body,
+		Mimetype: r.Header.Get("Content-Type"),
+	}
+	if fsStream.Mimetype == "" {
+		fsStream.Mimetype = utils.GetMimeType(reqPath)
+	}
+	if r.ContentLength < 0 {
+		// chunked上传拿不到长度，而驱动都需要知道文件大小，先落到临时文件里
+		tmpF, err := os.CreateTemp("", "webdav-put-*")
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		n, err := utils.CopyWithBuffer(tmpF, r.Body)
+		if err == nil {
+			_, err = tmpF.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			_ = tmpF.Close()
+			_ = os.Remove(tmpF.Name())
+			return http.StatusInternalServerError, err
+		}
+		obj.Size = n
+		fsStream.Reader = tmpF
+		fsStream.SetTmpFile(tmpF)
+	}
+	err = fs.PutDirectly(ctx, path.Dir(reqPath), fsStream)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return http.StatusNotFound, err
+		}
+		// TODO(rost): Returning 405 Method Not Allowed might not be appropriate.
+		return http.StatusMethodNotAllowed, err
+	}
+	fi, err := fs.Get(ctx, reqPath)
+	if err != nil {
+		fi = &obj
+	}
+	etag, err := findETag(ctx, h.LockSystem, reqPath, fi)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Etag", etag)
+	if existed {
+		return http.StatusNoContent, nil
+	}
+	return http.StatusCreated, nil
+}
 
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	reqPath, status, err := h.stripPrefix(r.URL.Path)
+	if err != nil {
+		return status, err
+	}
 	ctx := r.Context()
 	user := ctx.Value(configs.UserKey).(*model.User)
 	reqPath, err = user.JoinPath(reqPath)
 	if err != nil {
 		return 403, err
 	}
+	release, status, err := h.confirmLocks(r, reqPath, "")
+	if err != nil {
+		return status, err
+	}
+	defer release()
 	// TODO: return MultiStatus where appropriate.
 
 	// "godoc os RemoveAll" says that "If the path does not exist, RemoveAll
@@ -215,6 +446,12 @@ func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) (status i
 	if err := fs.Remove(ctx, reqPath); err != nil {
 		return http.StatusMethodNotAllowed, err
 	}
+	if h.DeadProps != nil {
+		// 资源已经删掉了，属性清理失败不影响这次DELETE的结果
+		if err := h.DeadProps.Remove(ctx, reqPath); err != nil && h.Logger != nil {
+			h.Logger(r, err)
+		}
+	}
 	//fs.ClearCache(path.Dir(reqPath))
 	return http.StatusNoContent, nil
 }
@@ -224,18 +461,17 @@ func (h *Handler) handleMkcol(w http.ResponseWriter, r *http.Request) (status in
 	if err != nil {
 		return status, err
 	}
-	release, status, err := h.confirmLocks(r, reqPath, "")
-	if err != nil {
-		return status, err
-	}
-	defer release()
-
 	ctx := r.Context()
 	user := ctx.Value(configs.UserKey).(*model.User)
 	reqPath, err = user.JoinPath(reqPath)
 	if err != nil {
 		return 403, err
 	}
+	release, status, err := h.confirmLocks(r, reqPath, "")
+	if err != nil {
+		return status, err
+	}
+	defer release()
 
 	if r.ContentLength > 0 {
 		return http.StatusUnsupportedMediaType, nil
@@ -304,6 +540,12 @@ func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request) (status
 	if err != nil {
 		return 403, err
 	}
+	if strings.HasPrefix(dst, strings.TrimSuffix(src, "/")+"/") {
+		// 不能把一个集合复制或移动到它自己里面
+		return http.StatusForbidden, errDestinationInsideSource
+	}
+	// Overwrite默认为T，见RFC 4918 10.6
+	overwrite := r.Header.Get("Overwrite") != "F"
 
 	if r.Method == "COPY" {
 		// Section 7.5.1 says that a COPY only needs to lock the destination,
@@ -328,7 +570,16 @@ func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request) (status
 				return http.StatusBadRequest, errInvalidDepth
 			}
 		}
-		return copyFiles(ctx, src, dst, r.Header.Get("Overwrite") != "F")
+		var errs []copyMoveError
+		status, err = copyFiles(ctx, src, dst, overwrite, depth, 0, &errs)
+		if err != nil {
+			return status, err
+		}
+		h.copyMoveDeadProps(r, src, dst, status, false)
+		if len(errs) > 0 {
+			return h.writeCopyMoveErrors(w, user, errs)
+		}
+		return status, nil
 	}
 
 	release, status, err := h.confirmLocks(r, src, dst)
@@ -345,7 +596,325 @@ func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request) (status
 			return http.StatusBadRequest, errInvalidDepth
 		}
 	}
-	return moveFiles(ctx, src, dst, r.Header.Get("Overwrite") == "T")
+	status, err = moveFiles(ctx, src, dst, overwrite)
+	if err != nil {
+		return status, err
+	}
+	h.copyMoveDeadProps(r, src, dst, status, true)
+	return status, nil
+}
+
+// copyMoveDeadProps 让PROPPATCH设置的属性跟着资源走。status为204说明目标原本存在并已被删除，
+// 它的旧属性也要一并清掉
+func (h *Handler) copyMoveDeadProps(r *http.Request, src, dst string, status int, move bool) {
+	if h.DeadProps == nil {
+		return
+	}
+	ctx := r.Context()
+	var err error
+	if status == http.StatusNoContent {
+		err = h.DeadProps.Remove(ctx, dst)
+	}
+	if err == nil {
+		if move {
+			err = h.DeadProps.Move(ctx, src, dst)
+		} else {
+			err = h.DeadProps.Copy(ctx, src, dst)
+		}
+	}
+	// 资源本身已经复制/移动成功，属性出错只记录日志
+	if err != nil && h.Logger != nil {
+		h.Logger(r, err)
+	}
+}
+
+// writeCopyMoveErrors 按RFC 4918 9.8.8把部分失败的成员以207 Multi-Status返回
+func (h *Handler) writeCopyMoveErrors(w http.ResponseWriter, user *model.User, errs []copyMoveError) (int, error) {
+	mw := multistatusWriter{w: w}
+	for _, e := range errs {
+		href := path.Join(h.Prefix, strings.TrimPrefix(e.reqPath, user.BasePath))
+		err := mw.write(&response{
+			Href:                []string{(&url.URL{Path: href}).EscapedPath()},
+			Status:              fmt.Sprintf("HTTP/1.1 %d %s", e.status, StatusText(e.status)),
+			ResponseDescription: e.err.Error(),
+		})
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	if err := mw.close(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+}
+
+func (h *Handler) handleLock(w http.ResponseWriter, r *http.Request) (retStatus int, retErr error) {
+	duration, err := parseTimeout(r.Header.Get("Timeout"))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	li, status, err := readLockInfo(r.Body)
+	if err != nil {
+		return status, err
+	}
+
+	ctx := r.Context()
+	user := ctx.Value(configs.UserKey).(*model.User)
+	token, ld, now, created := "", LockDetails{}, time.Now(), false
+	if li == (lockInfo{}) {
+		// An empty lockInfo means to refresh the lock.
+		ih, ok := parseIfHeader(r.Header.Get("If"))
+		if !ok {
+			return http.StatusBadRequest, errInvalidIfHeader
+		}
+		if len(ih.lists) == 1 && len(ih.lists[0].conditions) == 1 {
+			token = ih.lists[0].conditions[0].Token
+		}
+		if token == "" {
+			return http.StatusBadRequest, errInvalidLockToken
+		}
+		ld, err = h.LockSystem.Refresh(now, token, duration)
+		if err != nil {
+			if err == ErrNoSuchLock {
+				return http.StatusPreconditionFailed, err
+			}
+			return http.StatusInternalServerError, err
+		}
+
+	} else {
+		// Section 9.10.3 says that "If no Depth header is submitted on a LOCK request,
+		// then the request MUST act as if a "Depth:infinity" had been submitted."
+		depth := infiniteDepth
+		if hdr := r.Header.Get("Depth"); hdr != "" {
+			depth = parseDepth(hdr)
+			if depth != 0 && depth != infiniteDepth {
+				// Section 9.10.3 says that "Values other than 0 or infinity must not be
+				// used with the Depth header on a LOCK method".
+				return http.StatusBadRequest, errInvalidDepth
+			}
+		}
+		reqPath, status, err := h.stripPrefix(r.URL.Path)
+		if err != nil {
+			return status, err
+		}
+		reqPath, err = user.JoinPath(reqPath)
+		if err != nil {
+			return http.StatusForbidden, err
+		}
+		ld = LockDetails{
+			Root:      reqPath,
+			Duration:  duration,
+			OwnerXML:  li.Owner.InnerXML,
+			ZeroDepth: depth == 0,
+		}
+		token, err = h.LockSystem.Create(now, ld)
+		if err != nil {
+			if err == ErrLocked {
+				return StatusLocked, err
+			}
+			return http.StatusInternalServerError, err
+		}
+		defer func() {
+			if retErr != nil {
+				h.LockSystem.Unlock(now, token)
+			}
+		}()
+
+		// RFC 4918 §9.10.4：锁一个不存在的地址时先建出一个空资源，返回201
+		if _, err := fs.Get(ctx, reqPath); err != nil {
+			if !strings.Contains(err.Error(), "object not found") {
+				return http.StatusInternalServerError, err
+			}
+			// 父目录不存在时是409，不能顺手把中间目录都建出来
+			if parent, err := fs.Get(ctx, path.Dir(reqPath)); err != nil || !parent.IsDir() {
+				return http.StatusConflict, fmt.Errorf("parent of %s is not a collection", reqPath)
+			}
+			err = fs.PutDirectly(ctx, path.Dir(reqPath), &stream.FileStream{
+				Ctx:      ctx,
+				Obj:      &model.Object{Name: path.Base(reqPath), ModifiedTime: now},
+				Reader:   strings.NewReader(""),
+				Mimetype: utils.GetMimeType(reqPath),
+			})
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+			created = true
+		}
+
+		// http://www.webdav.org/specs/rfc4918.html#HEADER_Lock-Token says that the
+		// Lock-Token value is a Coded-URL. We add angle brackets.
+		w.Header().Set("Lock-Token", "<"+token+">")
+	}
+
+	// 锁表里存的是带BasePath的完整路径，回给客户端的lockroot要换回它能看到的href
+	ld.Root = path.Join(h.Prefix, strings.TrimPrefix(ld.Root, user.BasePath))
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	writeLockInfo(w, token, ld)
+	return 0, nil
+}
+
+func (h *Handler) handleUnlock(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	// http://www.webdav.org/specs/rfc4918.html#HEADER_Lock-Token says that the
+	// Lock-Token value is a Coded-URL. We strip its angle brackets.
+	t := r.Header.Get("Lock-Token")
+	if len(t) < 2 || t[0] != '<' || t[len(t)-1] != '>' {
+		return http.StatusBadRequest, errInvalidLockToken
+	}
+	t = t[1 : len(t)-1]
+
+	switch err = h.LockSystem.Unlock(time.Now(), t); err {
+	case nil:
+		return http.StatusNoContent, err
+	case ErrForbidden:
+		return http.StatusForbidden, err
+	case ErrLocked:
+		return StatusLocked, err
+	case ErrNoSuchLock:
+		return http.StatusConflict, err
+	default:
+		return http.StatusInternalServerError, err
+	}
+}
+
+func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	reqPath, status, err := h.stripPrefix(r.URL.Path)
+	if err != nil {
+		return status, err
+	}
+	ctx := context.WithValue(r.Context(), configs.UserAgentKey, r.Header.Get("User-Agent"))
+	user := ctx.Value(configs.UserKey).(*model.User)
+	reqPath, err = user.JoinPath(reqPath)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+	fi, err := fs.Get(ctx, reqPath)
+	if err != nil {
+		if strings.Contains(err.Error(), "object not found") {
+			return http.StatusNotFound, err
+		}
+		return http.StatusMethodNotAllowed, err
+	}
+	depth := infiniteDepth
+	if hdr := r.Header.Get("Depth"); hdr != "" {
+		depth = parseDepth(hdr)
+		if depth == invalidDepth {
+			return http.StatusBadRequest, errInvalidDepth
+		}
+	}
+	pf, status, err := readPropfind(r.Body)
+	if err != nil {
+		return status, err
+	}
+
+	mw := multistatusWriter{w: w}
+
+	walkFn := func(reqPath string, info model.Obj, err error) error {
+		if err != nil {
+			return err
+		}
+		var pstats []Propstat
+		if pf.Propname != nil {
+			pnames, err := propnames(ctx, h.LockSystem, h.DeadProps, reqPath, info)
+			if err != nil {
+				return err
+			}
+			pstat := Propstat{Status: http.StatusOK}
+			for _, xmlname := range pnames {
+				pstat.Props = append(pstat.Props, Property{XMLName: xmlname})
+			}
+			pstats = append(pstats, pstat)
+		} else if pf.Allprop != nil {
+			pstats, err = allprop(ctx, h.LockSystem, h.DeadProps, reqPath, info, pf.Prop)
+		} else {
+			pstats, err = props(ctx, h.LockSystem, h.DeadProps, reqPath, info, pf.Prop)
+		}
+		if err != nil {
+			return err
+		}
+		// href是客户端看到的路径，要去掉用户的BasePath
+		href := path.Join(h.Prefix, strings.TrimPrefix(reqPath, user.BasePath))
+		if href != "/" && info.IsDir() {
+			href += "/"
+		}
+		return mw.write(makePropstatResponse(href, pstats))
+	}
+
+	walkErr := walkFS(ctx, depth, reqPath, fi, walkFn)
+	closeErr := mw.close()
+	if walkErr != nil {
+		return http.StatusInternalServerError, walkErr
+	}
+	if closeErr != nil {
+		return http.StatusInternalServerError, closeErr
+	}
+	return 0, nil
+}
+
+func (h *Handler) handleProppatch(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	reqPath, status, err := h.stripPrefix(r.URL.Path)
+	if err != nil {
+		return status, err
+	}
+	ctx := r.Context()
+	user := ctx.Value(configs.UserKey).(*model.User)
+	reqPath, err = user.JoinPath(reqPath)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+	release, status, err := h.confirmLocks(r, reqPath, "")
+	if err != nil {
+		return status, err
+	}
+	defer release()
+	if _, err := fs.Get(ctx, reqPath); err != nil {
+		if strings.Contains(err.Error(), "object not found") {
+			return http.StatusNotFound, err
+		}
+		return http.StatusMethodNotAllowed, err
+	}
+	patches, status, err := readProppatch(r.Body)
+	if err != nil {
+		return status, err
+	}
+	pstats, err := patch(ctx, h.LockSystem, h.DeadProps, reqPath, patches)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	mw := multistatusWriter{w: w}
+	writeErr := mw.write(makePropstatResponse(r.URL.Path, pstats))
+	closeErr := mw.close()
+	if writeErr != nil {
+		return http.StatusInternalServerError, writeErr
+	}
+	if closeErr != nil {
+		return http.StatusInternalServerError, closeErr
+	}
+	return 0, nil
+}
+
+func makePropstatResponse(href string, pstats []Propstat) *response {
+	resp := response{
+		Href:     []string{(&url.URL{Path: href}).EscapedPath()},
+		Propstat: make([]propstat, 0, len(pstats)),
+	}
+	for _, p := range pstats {
+		var xmlErr *xmlError
+		if p.XMLError != "" {
+			xmlErr = &xmlError{InnerXML: []byte(p.XMLError)}
+		}
+		resp.Propstat = append(resp.Propstat, propstat{
+			Status:              fmt.Sprintf("HTTP/1.1 %d %s", p.Status, StatusText(p.Status)),
+			Prop:                p.Props,
+			ResponseDescription: p.ResponseDescription,
+			Error:               xmlErr,
+		})
+	}
+	return &resp
 }
 
 const (
@@ -392,6 +961,7 @@ func parseDepth(s string) int {
 
 var (
 	errDestinationEqualsSource = errors.New("webdav: destination equals source")
+	errDestinationInsideSource = errors.New("webdav: destination is inside source")
 	errDirectoryNotEmpty       = errors.New("webdav: directory not empty")
 	errInvalidDepth            = errors.New("webdav: invalid depth")
 	errInvalidDestination      = errors.New("webdav: invalid destination")
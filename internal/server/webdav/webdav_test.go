@@ -0,0 +1,331 @@
+package webdav
+
+import (
+	"HelaList/configs"
+	_ "HelaList/drivers/memory"
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/fs"
+	"HelaList/internal/model"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// davServer 挂一个内存存储，用管理员身份发请求，和litmus一样只看状态码和内容
+type davServer struct {
+	t *testing.T
+	h *Handler
+}
+
+func newDavServer(t *testing.T, mountPath string) *davServer {
+	t.Helper()
+	drivertest.Mount(t, model.Storage{MountPath: mountPath, CacheExpiration: 30})
+	return &davServer{t: t, h: &Handler{Prefix: "/webdav", LockSystem: NewMemLS()}}
+}
+
+func (s *davServer) do(method, path string, body string, headers ...string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	r := httptest.NewRequest(method, "/webdav"+path, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	user := &model.User{Username: "admin", BasePath: "/", Identity: model.ADMIN}
+	r = r.WithContext(context.WithValue(r.Context(), configs.UserKey, user))
+	w := httptest.NewRecorder()
+	s.h.ServeHTTP(w, r)
+	return w
+}
+
+func (s *davServer) expect(want int, method, path string, body string, headers ...string) {
+	s.t.Helper()
+	if w := s.do(method, path, body, headers...); w.Code != want {
+		s.t.Fatalf("%s %s = %d, want %d: %s", method, path, w.Code, want, w.Body.String())
+	}
+}
+
+func (s *davServer) content(path string) string {
+	s.t.Helper()
+	w := s.do("GET", path, "")
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("GET %s = %d", path, w.Code)
+	}
+	data, _ := io.ReadAll(w.Body)
+	return string(data)
+}
+
+func TestCopySameDirectory(t *testing.T) {
+	s := newDavServer(t, "/dav-copy")
+	s.expect(http.StatusCreated, "MKCOL", "/dav-copy/coll", "")
+	s.expect(http.StatusCreated, "PUT", "/dav-copy/coll/src", "copy me")
+
+	// copy_simple：同一个目录里复制出新名字
+	s.expect(http.StatusCreated, "COPY", "/dav-copy/coll/src", "", "Destination", "/webdav/dav-copy/coll/dest")
+	if got := s.content("/dav-copy/coll/dest"); got != "copy me" {
+		t.Fatalf("dest = %q", got)
+	}
+	if got := s.content("/dav-copy/coll/src"); got != "copy me" {
+		t.Fatalf("src = %q", got)
+	}
+
+	// copy_overwrite：不许覆盖时412，允许时204
+	s.expect(http.StatusPreconditionFailed, "COPY", "/dav-copy/coll/src", "", "Destination", "/webdav/dav-copy/coll/dest", "Overwrite", "F")
+	s.expect(http.StatusNoContent, "PUT", "/dav-copy/coll/src", "new content")
+	s.expect(http.StatusNoContent, "COPY", "/dav-copy/coll/src", "", "Destination", "/webdav/dav-copy/coll/dest", "Overwrite", "T")
+	if got := s.content("/dav-copy/coll/dest"); got != "new content" {
+		t.Fatalf("dest after overwrite = %q", got)
+	}
+
+	// copy_nodestcoll：目标的父目录不存在
+	s.expect(http.StatusConflict, "COPY", "/dav-copy/coll/src", "", "Destination", "/webdav/dav-copy/nonesuch/dest")
+
+	// 集合也能在同一个目录里复制
+	s.expect(http.StatusCreated, "COPY", "/dav-copy/coll", "", "Destination", "/webdav/dav-copy/coll2")
+	if got := s.content("/dav-copy/coll2/dest"); got != "new content" {
+		t.Fatalf("coll2/dest = %q", got)
+	}
+
+	// 临时目录不能留下
+	objs, err := fs.List(context.Background(), "/dav-copy/coll", &fs.ListArgs{NoLog: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("coll has %d objs", len(objs))
+	}
+}
+
+// names 目录下的名字，目录以/结尾
+func (s *davServer) names(path string) string {
+	s.t.Helper()
+	objs, err := fs.List(context.Background(), path, &fs.ListArgs{NoLog: true})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	var res []string
+	for _, obj := range objs {
+		name := obj.GetName()
+		if obj.IsDir() {
+			name += "/"
+		}
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
+func TestMove(t *testing.T) {
+	s := newDavServer(t, "/dav-move")
+	s.expect(http.StatusCreated, "MKCOL", "/dav-move/a", "")
+	s.expect(http.StatusCreated, "MKCOL", "/dav-move/b", "")
+	s.expect(http.StatusCreated, "PUT", "/dav-move/a/src", "from a")
+
+	// 同一个目录里改名
+	s.expect(http.StatusCreated, "MOVE", "/dav-move/a/src", "", "Destination", "/webdav/dav-move/a/renamed")
+	if got := s.names("/dav-move/a"); got != "renamed" {
+		t.Fatalf("a = %s", got)
+	}
+	s.expect(http.StatusCreated, "MOVE", "/dav-move/a/renamed", "", "Destination", "/webdav/dav-move/a/src")
+
+	// 目录和名字都变，目标目录里有同名的src，源目录里也有叫dest的：借临时目录中转
+	s.expect(http.StatusCreated, "PUT", "/dav-move/b/src", "from b")
+	s.expect(http.StatusCreated, "PUT", "/dav-move/a/dest", "other")
+	s.expect(http.StatusCreated, "MOVE", "/dav-move/a/src", "", "Destination", "/webdav/dav-move/b/dest")
+	if got := s.content("/dav-move/b/dest"); got != "from a" {
+		t.Fatalf("b/dest = %q", got)
+	}
+	if got := s.content("/dav-move/b/src"); got != "from b" {
+		t.Fatalf("b/src = %q", got)
+	}
+	if got := s.names("/dav-move/a"); got != "dest" {
+		t.Fatalf("a = %s", got)
+	}
+	if got := s.names("/dav-move/b"); got != "dest,src" {
+		t.Fatalf("temporary folder left in b: %s", got)
+	}
+
+	// 集合也一样，目标已存在时覆盖返回204
+	s.expect(http.StatusCreated, "MKCOL", "/dav-move/a/coll", "")
+	s.expect(http.StatusCreated, "PUT", "/dav-move/a/coll/x", "x")
+	s.expect(http.StatusCreated, "MKCOL", "/dav-move/b/coll", "")
+	s.expect(http.StatusCreated, "MKCOL", "/dav-move/a/dest2", "")
+	s.expect(http.StatusCreated, "MKCOL", "/dav-move/b/dest2", "")
+	s.expect(http.StatusPreconditionFailed, "MOVE", "/dav-move/a/coll", "", "Destination", "/webdav/dav-move/b/dest2", "Overwrite", "F")
+	s.expect(http.StatusNoContent, "MOVE", "/dav-move/a/coll", "", "Destination", "/webdav/dav-move/b/dest2")
+	if got := s.content("/dav-move/b/dest2/x"); got != "x" {
+		t.Fatalf("b/dest2/x = %q", got)
+	}
+	if got := s.names("/dav-move/b"); got != "coll/,dest,dest2/,src" {
+		t.Fatalf("b = %s", got)
+	}
+	if got := s.names("/dav-move/a"); got != "dest,dest2/" {
+		t.Fatalf("a = %s", got)
+	}
+
+	// 目标的父目录不存在
+	s.expect(http.StatusConflict, "MOVE", "/dav-move/a/dest", "", "Destination", "/webdav/dav-move/nonesuch/dest")
+	s.expect(http.StatusNotFound, "MOVE", "/dav-move/a/missing", "", "Destination", "/webdav/dav-move/b/missing")
+}
+
+const lockBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`
+
+// RFC 4918 §9.10.4：锁一个不存在的地址会建出空文件并返回201，锁已有的资源返回200
+func TestLockUnmappedURL(t *testing.T) {
+	s := newDavServer(t, "/dav-lock")
+	w := s.do("LOCK", "/dav-lock/new.txt", lockBody)
+	if w.Code != http.StatusCreated || w.Header().Get("Lock-Token") == "" {
+		t.Fatalf("LOCK new.txt = %d, token %q", w.Code, w.Header().Get("Lock-Token"))
+	}
+	if got := s.content("/dav-lock/new.txt"); got != "" {
+		t.Fatalf("new.txt = %q", got)
+	}
+	// 持有锁的客户端随后PUT内容
+	s.expect(http.StatusNoContent, "PUT", "/dav-lock/new.txt", "locked", "If", "("+w.Header().Get("Lock-Token")+")")
+	if got := s.content("/dav-lock/new.txt"); got != "locked" {
+		t.Fatalf("new.txt after PUT = %q", got)
+	}
+
+	s.expect(http.StatusCreated, "PUT", "/dav-lock/old.txt", "old")
+	s.expect(http.StatusOK, "LOCK", "/dav-lock/old.txt", lockBody)
+	if got := s.content("/dav-lock/old.txt"); got != "old" {
+		t.Fatalf("old.txt = %q", got)
+	}
+
+	// 父目录不存在
+	s.expect(http.StatusConflict, "LOCK", "/dav-lock/nonesuch/a.txt", lockBody)
+}
+
+// 覆盖已有的文件返回204，请求体是chunked的也能写进去
+func TestPut(t *testing.T) {
+	s := newDavServer(t, "/dav-put")
+	s.expect(http.StatusCreated, "PUT", "/dav-put/a.txt", "first")
+	s.expect(http.StatusNoContent, "PUT", "/dav-put/a.txt", "second")
+	if got := s.content("/dav-put/a.txt"); got != "second" {
+		t.Fatalf("a.txt = %q", got)
+	}
+	s.expect(http.StatusCreated, "MKCOL", "/dav-put/coll", "")
+	s.expect(http.StatusMethodNotAllowed, "PUT", "/dav-put/coll", "x")
+
+	// 不知道长度的请求体
+	r := httptest.NewRequest("PUT", "/webdav/dav-put/chunked.txt", io.MultiReader(strings.NewReader("chunked "), strings.NewReader("body")))
+	r.ContentLength = -1
+	r.TransferEncoding = []string{"chunked"}
+	user := &model.User{Username: "admin", BasePath: "/", Identity: model.ADMIN}
+	r = r.WithContext(context.WithValue(r.Context(), configs.UserKey, user))
+	w := httptest.NewRecorder()
+	s.h.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("chunked PUT = %d: %s", w.Code, w.Body.String())
+	}
+	if got := s.content("/dav-put/chunked.txt"); got != "chunked body" {
+		t.Fatalf("chunked.txt = %q", got)
+	}
+	obj, err := fs.Get(context.Background(), "/dav-put/chunked.txt")
+	if err != nil || obj.GetSize() != int64(len("chunked body")) {
+		t.Fatalf("chunked.txt = %+v, %v", obj, err)
+	}
+}
+
+func TestGetHeadRange(t *testing.T) {
+	s := newDavServer(t, "/dav-get")
+	s.expect(http.StatusCreated, "PUT", "/dav-get/a.txt", "0123456789")
+
+	w := s.do("HEAD", "/dav-get/a.txt", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Length") != "10" || w.Header().Get("ETag") == "" || w.Body.Len() != 0 {
+		t.Fatalf("HEAD = %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+	w = s.do("GET", "/dav-get/a.txt", "", "Range", "bytes=2-5")
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" {
+		t.Fatalf("GET range = %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 2-5/10" {
+		t.Fatalf("Content-Range = %q", got)
+	}
+	w = s.do("GET", "/dav-get/a.txt", "", "Range", "bytes=7-")
+	if w.Code != http.StatusPartialContent || w.Body.String() != "789" {
+		t.Fatalf("GET open range = %d %q", w.Code, w.Body.String())
+	}
+	s.expect(http.StatusNotFound, "GET", "/dav-get/missing.txt", "")
+	s.expect(http.StatusMethodNotAllowed, "GET", "/dav-get", "")
+}
+
+// multistatus PROPFIND/PROPPATCH的返回，只取测试要看的部分
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				Inner string `xml:",innerxml"`
+			} `xml:"prop"`
+			Status string `xml:"status"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func (s *davServer) propfind(path, depth, body string) multistatus {
+	s.t.Helper()
+	w := s.do("PROPFIND", path, body, "Depth", depth)
+	if w.Code != StatusMulti {
+		s.t.Fatalf("PROPFIND %s = %d: %s", path, w.Code, w.Body.String())
+	}
+	var ms multistatus
+	if err := xml.Unmarshal(w.Body.Bytes(), &ms); err != nil {
+		s.t.Fatal(err)
+	}
+	return ms
+}
+
+func TestPropfind(t *testing.T) {
+	s := newDavServer(t, "/dav-propfind")
+	s.expect(http.StatusCreated, "MKCOL", "/dav-propfind/coll", "")
+	s.expect(http.StatusCreated, "PUT", "/dav-propfind/coll/a.txt", "hello")
+	s.expect(http.StatusCreated, "MKCOL", "/dav-propfind/coll/sub", "")
+
+	// Depth 0只有自己
+	ms := s.propfind("/dav-propfind/coll/a.txt", "0", `<?xml version="1.0"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:getcontentlength/><D:resourcetype/><D:nonesuch/></D:prop></D:propfind>`)
+	if len(ms.Responses) != 1 || ms.Responses[0].Href != "/webdav/dav-propfind/coll/a.txt" {
+		t.Fatalf("depth 0 = %+v", ms)
+	}
+	var found, missing bool
+	for _, ps := range ms.Responses[0].Propstat {
+		switch {
+		case strings.Contains(ps.Status, "200"):
+			found = strings.Contains(ps.Prop.Inner, ">5<")
+		case strings.Contains(ps.Status, "404"):
+			missing = strings.Contains(ps.Prop.Inner, "nonesuch")
+		}
+	}
+	if !found || !missing {
+		t.Fatalf("propstats = %+v", ms.Responses[0].Propstat)
+	}
+
+	// Depth 1带上直接子项，集合的href以/结尾；没有请求体相当于allprop
+	ms = s.propfind("/dav-propfind/coll", "1", "")
+	var hrefs []string
+	for _, r := range ms.Responses {
+		hrefs = append(hrefs, r.Href)
+		if inner := r.Propstat[0].Prop.Inner; !strings.Contains(inner, "getlastmodified") || !strings.Contains(inner, "resourcetype") {
+			t.Fatalf("allprop of %s = %s", r.Href, inner)
+		}
+	}
+	sort.Strings(hrefs)
+	if got := strings.Join(hrefs, ","); got != "/webdav/dav-propfind/coll/,/webdav/dav-propfind/coll/a.txt,/webdav/dav-propfind/coll/sub/" {
+		t.Fatalf("depth 1 = %s", got)
+	}
+
+	// propname只有名字没有值
+	ms = s.propfind("/dav-propfind/coll/a.txt", "0", `<?xml version="1.0"?>
+<D:propfind xmlns:D="DAV:"><D:propname/></D:propfind>`)
+	if inner := ms.Responses[0].Propstat[0].Prop.Inner; !strings.Contains(inner, "getcontentlength") || strings.Contains(inner, ">5<") {
+		t.Fatalf("propname = %s", inner)
+	}
+
+	s.expect(http.StatusNotFound, "PROPFIND", "/dav-propfind/missing", "", "Depth", "0")
+	s.expect(http.StatusBadRequest, "PROPFIND", "/dav-propfind/coll", "", "Depth", "2")
+}
@@ -28,6 +28,7 @@ type FileStream struct {
 	WebPutAsTask      bool
 	ForceStreamUpload bool
 	Exist             model.Obj
+	TrustedHash       bool // Obj里的哈希是服务端从存储拿到的，可以用来秒传
 	utils.Closers
 
 	tmpFile   model.File // 临时文件
@@ -84,6 +85,10 @@ func (f *FileStream) Close() error {
 	return errors.Join(err1, err2)
 }
 
+func (f *FileStream) IsHashTrusted() bool {
+	return f.TrustedHash
+}
+
 func (f *FileStream) GetExist() model.Obj {
 	return f.Exist
 }
@@ -236,42 +241,44 @@ type SeekableStream struct {
 	rangeReadCloser model.RangeReadCloserIF
 }
 
-// todo: 设计link操作，所以暂时搁置
-// func NewSeekableStream(fs *FileStream, link *model.Link) (*SeekableStream, error) {
-// 	if len(fs.Mimetype) == 0 {
-// 		fs.Mimetype = utils.GetMimeType(fs.Obj.GetName())
-// 	}
-
-// 	if fs.Reader != nil {
-// 		fs.Add(link)
-// 		return &SeekableStream{FileStream: fs}, nil
-// 	}
-
-// 	if link != nil {
-// 		size := link.ContentLength
-// 		if size <= 0 {
-// 			size = fs.GetSize()
-// 		}
-// 		rr, err := GetRangeReaderFromLink(size, link)
-// 		if err != nil {
-// 			return nil, err
-// 		}
-// 		rrc := &model.RangeReadCloser{
-// 			RangeReader: rr,
-// 		}
-// 		if _, ok := rr.(*model.FileRangeReader); ok {
-// 			fs.Reader, err = rrc.RangeRead(fs.Ctx, http_range.Range{Length: -1})
-// 			if err != nil {
-// 				return nil, err
-// 			}
-// 		}
-// 		fs.size = size
-// 		fs.Add(link)
-// 		fs.Add(rrc)
-// 		return &SeekableStream{FileStream: fs, rangeReadCloser: rrc}, nil
-// 	}
-// 	return nil, fmt.Errorf("illegal seekableStream")
-// }
+// NewSeekableStream 用link补上FileStream的范围读取，fs.Reader不为空时直接读它。
+// 范围读取用的是fs.Ctx，link和打开过的reader都随流一起关闭
+func NewSeekableStream(fs *FileStream, link *model.Link) (*SeekableStream, error) {
+	if len(fs.Mimetype) == 0 {
+		fs.Mimetype = utils.GetMimeType(fs.Obj.GetName())
+	}
+	if fs.Ctx == nil {
+		fs.Ctx = context.Background()
+	}
+
+	if fs.Reader != nil {
+		fs.AddIfCloser(link)
+		return &SeekableStream{FileStream: fs}, nil
+	}
+
+	if link != nil {
+		size := link.ContentLength
+		if size <= 0 {
+			size = fs.GetSize()
+		}
+		rrc := &model.RangeReadCloser{
+			RangeReader: &linkRangeReader{link: link},
+		}
+		fs.size = size
+		fs.Add(link)
+		fs.Add(rrc)
+		return &SeekableStream{FileStream: fs, rangeReadCloser: rrc}, nil
+	}
+	return nil, fmt.Errorf("illegal seekableStream")
+}
+
+type linkRangeReader struct {
+	link *model.Link
+}
+
+func (r *linkRangeReader) RangeRead(ctx context.Context, httpRange http_range.Range) (io.ReadCloser, error) {
+	return RangeReadLink(ctx, r.link, httpRange)
+}
 
 // RangeRead线程不安全，谨慎使用
 func (ss *SeekableStream) RangeRead(httpRange http_range.Range) (io.Reader, error) {
@@ -4,9 +4,13 @@ import (
 	"HelaList/internal/model"
 	"context"
 	"io"
+	"net/http"
+	"sync"
 	"time"
 
+	"github.com/OpenListTeam/OpenList/v4/pkg/http_range"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/pkg/errors"
 	"golang.org/x/time/rate"
 )
 
@@ -145,3 +149,131 @@ type ReaderWithCtx struct {
 	io.Reader
 	Ctx context.Context
 }
+
+// RangeReadLink 按MFile、RangeReader、URL的优先级读取link里的一段内容，Length小于0表示读到结尾。
+// 给需要自己解析文件内容的驱动（加密、分块、压缩包）用
+func RangeReadLink(ctx context.Context, l *model.Link, httpRange http_range.Range) (io.ReadCloser, error) {
+	if l.MFile != nil {
+		size, err := l.MFile.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		length := httpRange.Length
+		if length < 0 || httpRange.Start+length > size {
+			length = size - httpRange.Start
+		}
+		return io.NopCloser(io.NewSectionReader(l.MFile, httpRange.Start, length)), nil
+	}
+	if l.RangeReader != nil {
+		return l.RangeReader.RangeRead(ctx, httpRange)
+	}
+	if l.URL == "" {
+		return nil, errors.New("empty download url")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.URL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	for key, values := range l.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	http_range.ApplyRangeToHttpHeader(httpRange, req.Header)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to request download url")
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// 服务器不支持Range时会返回整个文件，自己跳过前面的部分
+		if httpRange.Start > 0 {
+			if _, err = io.CopyN(io.Discard, resp.Body, httpRange.Start); err != nil {
+				_ = resp.Body.Close()
+				return nil, errors.Wrap(err, "failed to skip to range start")
+			}
+		}
+	default:
+		_ = resp.Body.Close()
+		return nil, errors.Errorf("unexpected status from download url: %s", resp.Status)
+	}
+	if httpRange.Length < 0 {
+		return resp.Body, nil
+	}
+	return &limitedReadCloser{Reader: io.LimitReader(resp.Body, httpRange.Length), Closer: resp.Body}, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+const (
+	linkBlockSize    = 256 * 1024
+	linkCachedBlocks = 16
+)
+
+// linkReaderAt 用范围读取实现ReaderAt，按块读取并缓存最近的几块，
+// 解析zip目录、tar文件头时的零碎小读取不会每次都发请求。ReadAt可以并发调用，但同一时间只有一个请求在读
+type linkReaderAt struct {
+	ctx  context.Context
+	link *model.Link
+	size int64
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	order  []int64
+}
+
+func NewLinkReaderAt(ctx context.Context, link *model.Link, size int64) io.ReaderAt {
+	return &linkReaderAt{
+		ctx:    ctx,
+		link:   link,
+		size:   size,
+		blocks: make(map[int64][]byte),
+	}
+}
+
+func (r *linkReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) && off < r.size {
+		index := off / linkBlockSize
+		block, err := r.block(index)
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], block[off-index*linkBlockSize:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *linkReaderAt) block(index int64) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, ok := r.blocks[index]; ok {
+		return b, nil
+	}
+	start := index * linkBlockSize
+	rc, err := RangeReadLink(r.ctx, r.link, http_range.Range{Start: start, Length: min(linkBlockSize, r.size-start)})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b := make([]byte, min(linkBlockSize, r.size-start))
+	if _, err = io.ReadFull(rc, b); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(r.order) >= linkCachedBlocks {
+		delete(r.blocks, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.blocks[index] = b
+	r.order = append(r.order, index)
+	return b, nil
+}
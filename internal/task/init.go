@@ -0,0 +1,83 @@
+package task
+
+import (
+	"log"
+	"sync"
+
+	"HelaList/configs"
+	"HelaList/internal/repository"
+)
+
+// 任务类别，和configs.TasksConfig里的字段一一对应
+const (
+	Download         = "download"
+	Transfer         = "transfer"
+	Upload           = "upload"
+	Copy             = "copy"
+	Move             = "move"
+	Decompress       = "decompress"
+	DecompressUpload = "decompress_upload"
+	Compress         = "compress"
+)
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = make(map[string]Handler)
+
+	managersMu sync.RWMutex
+	managers   map[string]*Manager
+)
+
+// RegisterHandler 注册某一类任务的执行函数，需要在Init之前调用，一般放在init()里
+func RegisterHandler(typ string, handler Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[typ] = handler
+}
+
+// Init 按配置创建各类别的Manager，并恢复数据库里没有跑完的任务。
+// 需要在数据库迁移之后调用
+func Init() {
+	conf := configs.Conf.Tasks
+	confs := map[string]configs.TaskConfig{
+		Download:         conf.Download,
+		Transfer:         conf.Transfer,
+		Upload:           conf.Upload,
+		Copy:             conf.Copy,
+		Move:             conf.Move,
+		Decompress:       conf.Decompress,
+		DecompressUpload: conf.DecompressUpload,
+		Compress:         conf.Compress,
+	}
+	handlersMu.RLock()
+	ms := make(map[string]*Manager, len(confs))
+	for typ, c := range confs {
+		ms[typ] = newManager(typ, handlers[typ], c)
+	}
+	handlersMu.RUnlock()
+
+	managersMu.Lock()
+	managers = ms
+	managersMu.Unlock()
+
+	tasks, err := repository.GetTasks()
+	if err != nil {
+		log.Printf("failed load tasks: %+v", err)
+		return
+	}
+	for _, t := range tasks {
+		m, ok := ms[t.Type]
+		if !ok {
+			log.Printf("skip task %s with unknown type %s", t.Id, t.Type)
+			continue
+		}
+		m.restore(t)
+	}
+}
+
+// GetManager 返回某一类任务的Manager，任务系统没有初始化时返回nil，调用方应当直接同步执行
+func GetManager(typ string) *Manager {
+	managersMu.RLock()
+	defer managersMu.RUnlock()
+	return managers[typ]
+}
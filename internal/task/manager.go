@@ -0,0 +1,412 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"HelaList/configs"
+	"HelaList/internal/model"
+	"HelaList/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var (
+	errPaused   = errors.New("task paused")
+	errCanceled = errors.New("task canceled")
+
+	ErrTaskNotFound = errors.New("task not found")
+)
+
+// 第n次重试前等待 retryBaseDelay * 2^(n-1)，最多等retryMaxDelay。测试里会改小
+var (
+	retryBaseDelay = 2 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+// Manager 管理同一类别的任务，同时最多有workers个任务在运行
+type Manager struct {
+	typ        string
+	handler    Handler
+	maxRetry   int
+	persistent bool
+	sem        chan struct{}
+
+	mu    sync.RWMutex
+	tasks map[uuid.UUID]*Task
+}
+
+func newManager(typ string, handler Handler, conf configs.TaskConfig) *Manager {
+	workers := conf.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	return &Manager{
+		typ:        typ,
+		handler:    handler,
+		maxRetry:   conf.MaxRetry,
+		persistent: conf.TaskPersistant,
+		sem:        make(chan struct{}, workers),
+		tasks:      make(map[uuid.UUID]*Task),
+	}
+}
+
+func (m *Manager) Type() string {
+	return m.typ
+}
+
+// Submit 提交一个新任务，payload会被序列化成json保存，重启后交还给Handler
+func (m *Manager) Submit(ctx context.Context, name string, payload any) (*Task, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	t := &Task{
+		m: m,
+		info: model.Task{
+			Id:      uuid.Must(uuid.NewV7()),
+			Type:    m.typ,
+			Name:    name,
+			State:   model.TaskPending,
+			Payload: string(data),
+		},
+	}
+	if user, ok := ctx.Value(configs.UserKey).(*model.User); ok {
+		t.creator = user
+		t.info.Creator = user.Id
+	}
+	m.mu.Lock()
+	m.tasks[t.info.Id] = t
+	m.mu.Unlock()
+	m.persist(t)
+	m.start(t)
+	return t, nil
+}
+
+// restore 把数据库里的任务放回内存，没跑完的任务重新排队。
+// 任务要以提交它的用户身份运行，按Creator查回用户，没结束的任务查不到用户就不能再跑，直接算失败
+func (m *Manager) restore(info model.Task) {
+	t := &Task{m: m, info: info}
+	m.mu.Lock()
+	m.tasks[info.Id] = t
+	m.mu.Unlock()
+	if info.Creator != uuid.Nil {
+		user, err := repository.GetUserById(info.Creator)
+		if err != nil {
+			if !info.Done() {
+				t.update(func(info *model.Task) {
+					now := time.Now()
+					info.State = model.TaskFailed
+					info.Status = "failed"
+					info.Error = fmt.Sprintf("failed restore creator %s: %v", info.Creator, err)
+					info.EndTime = &now
+				})
+			}
+			return
+		}
+		t.creator = user
+	}
+	switch info.State {
+	case model.TaskPending, model.TaskRunning:
+		t.update(func(info *model.Task) {
+			info.State = model.TaskPending
+			info.Status = "restored after restart"
+		})
+		m.start(t)
+	}
+}
+
+func (m *Manager) start(t *Task) {
+	ctx, cancel := t.reset()
+	go func() {
+		defer cancel(nil)
+		m.run(t, ctx)
+	}()
+}
+
+// run 等待worker空出来后执行任务，失败时按退避时间重试，直到成功、重试次数用完、被暂停或取消
+func (m *Manager) run(t *Task, ctx context.Context) {
+	for {
+		select {
+		case m.sem <- struct{}{}:
+		case <-ctx.Done():
+			m.stopped(t, context.Cause(ctx))
+			return
+		}
+		t.update(func(info *model.Task) {
+			now := time.Now()
+			info.State = model.TaskRunning
+			info.Status = "running"
+			info.Error = ""
+			if info.StartTime == nil {
+				info.StartTime = &now
+			}
+		})
+		err := m.call(t)
+		<-m.sem
+
+		// Handler已经做完了，返回之后才到的暂停、取消不算数
+		if err == nil {
+			t.update(func(info *model.Task) {
+				now := time.Now()
+				info.State = model.TaskSucceeded
+				info.Status = "done"
+				info.Progress = 100
+				info.EndTime = &now
+			})
+			return
+		}
+		if ctx.Err() != nil {
+			m.stopped(t, context.Cause(ctx))
+			return
+		}
+		info := t.Info()
+		if info.Retry >= m.maxRetry {
+			t.update(func(info *model.Task) {
+				now := time.Now()
+				info.State = model.TaskFailed
+				info.Status = "failed"
+				info.Error = err.Error()
+				info.EndTime = &now
+			})
+			return
+		}
+		delay := backoff(info.Retry + 1)
+		t.update(func(info *model.Task) {
+			info.Retry++
+			info.State = model.TaskPending
+			info.Status = fmt.Sprintf("retry %d/%d in %s", info.Retry, m.maxRetry, delay)
+			info.Error = err.Error()
+		})
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			m.stopped(t, context.Cause(ctx))
+			return
+		}
+	}
+}
+
+// call 执行Handler，Handler里的panic转成错误，不能让一个任务拖垮整个进程
+func (m *Manager) call(t *Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("panic: %v", r)
+		}
+	}()
+	if m.handler == nil {
+		return errors.Errorf("no handler registered for %s tasks", m.typ)
+	}
+	return m.handler(t)
+}
+
+// stopped 处理因暂停或取消而中断的任务
+func (m *Manager) stopped(t *Task, cause error) {
+	if errors.Is(cause, errPaused) {
+		t.update(func(info *model.Task) {
+			info.State = model.TaskPaused
+			info.Status = "paused"
+		})
+		return
+	}
+	t.update(func(info *model.Task) {
+		now := time.Now()
+		info.State = model.TaskCanceled
+		info.Status = "canceled"
+		info.EndTime = &now
+	})
+}
+
+func backoff(retry int) time.Duration {
+	d := retryBaseDelay << (retry - 1)
+	if d <= 0 || d > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return d
+}
+
+func (m *Manager) persist(t *Task) {
+	if !m.persistent {
+		return
+	}
+	t.mu.Lock()
+	t.lastSave = time.Now()
+	info := t.info
+	t.mu.Unlock()
+	if err := repository.SaveTask(&info); err != nil {
+		log.Printf("failed save task %s: %+v", info.Id, err)
+	}
+}
+
+// Get 按id查找任务
+func (m *Manager) Get(id uuid.UUID) (*Task, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.tasks[id]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	return t, nil
+}
+
+// List 返回所有任务的快照，按创建时间排序
+func (m *Manager) List() []model.Task {
+	m.mu.RLock()
+	infos := make([]model.Task, 0, len(m.tasks))
+	for _, t := range m.tasks {
+		infos = append(infos, t.Info())
+	}
+	m.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Id.String() < infos[j].Id.String() // uuid v7按时间递增
+	})
+	return infos
+}
+
+// Cancel 取消排队、等待重试、暂停或运行中的任务
+func (m *Manager) Cancel(id uuid.UUID) error {
+	t, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	switch t.Info().State {
+	case model.TaskPaused:
+		m.stopped(t, errCanceled)
+	case model.TaskPending, model.TaskRunning:
+		t.stop(errCanceled)
+	default:
+		return errors.New("task already finished")
+	}
+	return nil
+}
+
+// Pause 暂停任务。运行中的任务会被中断，恢复后从头开始执行
+func (m *Manager) Pause(id uuid.UUID) error {
+	t, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	switch t.Info().State {
+	case model.TaskPending, model.TaskRunning:
+		t.stop(errPaused)
+		return nil
+	}
+	return errors.New("only pending or running tasks can be paused")
+}
+
+// Resume 让暂停的任务重新排队
+func (m *Manager) Resume(id uuid.UUID) error {
+	t, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	ok := t.transit(func(info *model.Task) bool {
+		if info.State != model.TaskPaused {
+			return false
+		}
+		info.State = model.TaskPending
+		info.Status = "resumed"
+		return true
+	})
+	if !ok {
+		return errors.New("task is not paused")
+	}
+	m.start(t)
+	return nil
+}
+
+// Retry 让失败的任务重新排队，重试次数清零
+func (m *Manager) Retry(id uuid.UUID) error {
+	t, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	var reason error
+	ok := t.transit(func(info *model.Task) bool {
+		// 重启后没能查回提交的用户，不能以别的身份重跑
+		if t.creator == nil && info.Creator != uuid.Nil {
+			reason = errors.New("the creator of the task no longer exists")
+			return false
+		}
+		switch info.State {
+		case model.TaskFailed:
+		case model.TaskCanceled:
+			if !configs.Conf.Tasks.AllowRetryCanceled {
+				reason = errors.New("retrying canceled tasks is not allowed")
+				return false
+			}
+		default:
+			reason = errors.New("only failed or canceled tasks can be retried")
+			return false
+		}
+		info.State = model.TaskPending
+		info.Status = "retrying"
+		info.Retry = 0
+		info.Progress = 0
+		info.Error = ""
+		info.EndTime = nil
+		return true
+	})
+	if !ok {
+		return reason
+	}
+	m.start(t)
+	return nil
+}
+
+// Remove 删除一个已经结束的任务
+func (m *Manager) Remove(id uuid.UUID) error {
+	t, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	info := t.Info()
+	if !info.Done() {
+		return errors.New("task is not finished")
+	}
+	return m.removeTasks([]uuid.UUID{id})
+}
+
+// Clear 删除所有满足filter的已结束任务
+func (m *Manager) Clear(filter func(info *model.Task) bool) error {
+	var ids []uuid.UUID
+	m.mu.RLock()
+	for id, t := range m.tasks {
+		info := t.Info()
+		if info.Done() && filter(&info) {
+			ids = append(ids, id)
+		}
+	}
+	m.mu.RUnlock()
+	return m.removeTasks(ids)
+}
+
+func (m *Manager) removeTasks(ids []uuid.UUID) error {
+	if m.persistent {
+		if err := repository.DeleteTasksByIds(ids); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	for _, id := range ids {
+		delete(m.tasks, id)
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// baseCtx 任务脱离了发起它的请求，用一个新的context运行。
+// 带上NoTaskKey，任务里再调用fs时不会又生成新任务
+func (m *Manager) baseCtx(user *model.User) context.Context {
+	ctx := context.WithValue(context.Background(), configs.NoTaskKey, struct{}{})
+	if user != nil {
+		ctx = context.WithValue(ctx, configs.UserKey, user)
+	}
+	return ctx
+}
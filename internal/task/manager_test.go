@@ -0,0 +1,250 @@
+package task
+
+import (
+	"HelaList/configs"
+	"HelaList/internal/driver/drivertest"
+	"HelaList/internal/model"
+	"HelaList/internal/repository"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func init() {
+	retryBaseDelay = 10 * time.Millisecond
+	retryMaxDelay = 50 * time.Millisecond
+}
+
+// newTestManager 每个测试用自己的类别，同一个库里的任务不会互相看到
+func newTestManager(t *testing.T, handler Handler, maxRetry int) *Manager {
+	t.Helper()
+	drivertest.SetupDB(t)
+	return newManager("test-"+uuid.NewString(), handler, configs.TaskConfig{Workers: 2, MaxRetry: maxRetry, TaskPersistant: true})
+}
+
+func waitState(t *testing.T, m *Manager, id uuid.UUID, state int) model.Task {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tk, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info := tk.Info()
+		if info.State == state {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("task %s: state = %d (%s), want %d", info.Name, info.State, info.Status, state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// saved 数据库里的那份，要和内存里的一致
+func saved(t *testing.T, id uuid.UUID) model.Task {
+	t.Helper()
+	tasks, err := repository.GetTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range tasks {
+		if info.Id == id {
+			return info
+		}
+	}
+	t.Fatalf("task %s not saved", id)
+	return model.Task{}
+}
+
+func TestSubmitRetry(t *testing.T) {
+	var calls atomic.Int32
+	m := newTestManager(t, func(t *Task) error {
+		var p struct{ FailTimes int32 }
+		if err := t.Decode(&p); err != nil {
+			return err
+		}
+		if calls.Add(1) <= p.FailTimes {
+			return errors.New("temporary failure")
+		}
+		return nil
+	}, 2)
+
+	tk, err := m.Submit(context.Background(), "flaky", struct{ FailTimes int32 }{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := waitState(t, m, tk.ID(), model.TaskSucceeded)
+	if info.Retry != 2 || info.Progress != 100 || info.Error != "" || calls.Load() != 3 {
+		t.Fatalf("info = %+v, calls = %d", info, calls.Load())
+	}
+	if s := saved(t, tk.ID()); s.State != model.TaskSucceeded || s.EndTime == nil {
+		t.Fatalf("saved = %+v", s)
+	}
+
+	// 重试次数用完算失败，Retry之后从头再来
+	calls.Store(0)
+	tk, err = m.Submit(context.Background(), "broken", struct{ FailTimes int32 }{4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info = waitState(t, m, tk.ID(), model.TaskFailed)
+	if info.Retry != 2 || info.Error != "temporary failure" || calls.Load() != 3 {
+		t.Fatalf("info = %+v, calls = %d", info, calls.Load())
+	}
+	if err = m.Retry(tk.ID()); err != nil {
+		t.Fatal(err)
+	}
+	info = waitState(t, m, tk.ID(), model.TaskSucceeded)
+	if info.Retry != 1 || calls.Load() != 5 {
+		t.Fatalf("info after retry = %+v, calls = %d", info, calls.Load())
+	}
+	if err = m.Retry(tk.ID()); err == nil {
+		t.Fatal("retrying a succeeded task should fail")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if backoff(1) != retryBaseDelay || backoff(2) != 2*retryBaseDelay || backoff(100) != retryMaxDelay {
+		t.Fatalf("backoff = %s %s %s", backoff(1), backoff(2), backoff(100))
+	}
+}
+
+func TestPauseResumeCancel(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{}, 10)
+	m := newTestManager(t, func(t *Task) error {
+		calls.Add(1)
+		started <- struct{}{}
+		<-t.Ctx().Done()
+		return t.Ctx().Err()
+	}, 0)
+	wait := func() {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("handler not started")
+		}
+	}
+
+	tk, err := m.Submit(context.Background(), "blocking", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait()
+	if err = m.Pause(tk.ID()); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, m, tk.ID(), model.TaskPaused)
+	if err = m.Pause(tk.ID()); err == nil {
+		t.Fatal("pausing a paused task should fail")
+	}
+
+	// 恢复之后Handler从头再跑一次
+	if err = m.Resume(tk.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Resume(tk.ID()); err == nil {
+		t.Fatal("resuming twice should fail")
+	}
+	wait()
+	if err = m.Cancel(tk.ID()); err != nil {
+		t.Fatal(err)
+	}
+	info := waitState(t, m, tk.ID(), model.TaskCanceled)
+	if info.EndTime == nil || calls.Load() != 2 {
+		t.Fatalf("info = %+v, calls = %d", info, calls.Load())
+	}
+	if err = m.Cancel(tk.ID()); err == nil {
+		t.Fatal("canceling a finished task should fail")
+	}
+	if err = m.Remove(tk.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Get(tk.ID()); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("removed task: %v", err)
+	}
+}
+
+// Handler成功返回之后才到的取消不能把任务记成取消
+func TestCancelAfterSuccess(t *testing.T) {
+	var m *Manager
+	m = newTestManager(t, func(t *Task) error {
+		_ = m.Cancel(t.ID())
+		return nil
+	}, 0)
+	tk, err := m.Submit(context.Background(), "done", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, m, tk.ID(), model.TaskSucceeded)
+}
+
+// 重启后没跑完的任务重新排队，以提交它的用户身份运行
+func TestRestore(t *testing.T) {
+	drivertest.SetupDB(t)
+	user := &model.User{Username: "task-" + uuid.NewString(), Email: uuid.NewString(), Salt: uuid.NewString(), PasswordHash: "x", BasePath: "/home", Identity: model.GENERAL}
+	if err := repository.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	ran := make(chan *model.User, 10)
+	m := newTestManager(t, func(t *Task) error {
+		ctxUser, _ := t.Ctx().Value(configs.UserKey).(*model.User)
+		if ctxUser != t.Creator() {
+			return errors.New("context user differs from creator")
+		}
+		ran <- ctxUser
+		return nil
+	}, 0)
+	infos := []model.Task{
+		{Id: uuid.Must(uuid.NewV7()), Type: m.typ, Name: "running", State: model.TaskRunning, Creator: user.Id},
+		{Id: uuid.Must(uuid.NewV7()), Type: m.typ, Name: "orphan", State: model.TaskPending, Creator: uuid.New()},
+		{Id: uuid.Must(uuid.NewV7()), Type: m.typ, Name: "paused", State: model.TaskPaused, Creator: user.Id},
+		{Id: uuid.Must(uuid.NewV7()), Type: m.typ, Name: "failed orphan", State: model.TaskFailed, Creator: uuid.New()},
+	}
+	for i := range infos {
+		if err := repository.SaveTask(&infos[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 相当于重启后的Init
+	tasks, err := repository.GetTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range tasks {
+		if info.Type == m.typ {
+			m.restore(info)
+		}
+	}
+
+	waitState(t, m, infos[0].Id, model.TaskSucceeded)
+	if got := <-ran; got == nil || got.Id != user.Id || got.BasePath != "/home" {
+		t.Fatalf("restored task ran as %+v", got)
+	}
+	// 提交的用户已经不在了
+	if info := waitState(t, m, infos[1].Id, model.TaskFailed); info.Error == "" {
+		t.Fatalf("orphan = %+v", info)
+	}
+	if s := saved(t, infos[1].Id); s.State != model.TaskFailed {
+		t.Fatalf("saved orphan = %+v", s)
+	}
+	if err = m.Retry(infos[3].Id); err == nil {
+		t.Fatal("retrying a task without its creator should fail")
+	}
+	// 暂停的不自动跑，恢复时也要带上用户
+	waitState(t, m, infos[2].Id, model.TaskPaused)
+	if err = m.Resume(infos[2].Id); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, m, infos[2].Id, model.TaskSucceeded)
+	if got := <-ran; got == nil || got.Id != user.Id {
+		t.Fatalf("resumed task ran as %+v", got)
+	}
+}
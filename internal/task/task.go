@@ -0,0 +1,128 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"HelaList/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// 本目录实现后台任务：每个类别一个Manager，Manager里是固定数量的worker，
+// 失败的任务按指数退避重试，任务状态可以选择持久化到数据库，重启后继续跑没跑完的任务。
+
+// 进度最多每隔这么久落一次库，避免驱动频繁回调进度时把数据库打满
+const progressSaveInterval = time.Second
+
+// Handler 真正执行任务的函数。t.Ctx()被取消时要尽快返回，
+// 任务被暂停后再恢复会重新调用Handler，所以Handler需要能从头再来
+type Handler func(t *Task) error
+
+// Task 是运行中的任务，model.Task是它的快照
+type Task struct {
+	mu       sync.Mutex
+	m        *Manager
+	info     model.Task
+	creator  *model.User
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	lastSave time.Time
+}
+
+func (t *Task) ID() uuid.UUID {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.info.Id
+}
+
+// Ctx 返回本次运行的context，暂停和取消都是通过它通知Handler的
+func (t *Task) Ctx() context.Context {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ctx
+}
+
+// Creator 返回提交任务的用户，重启后恢复的任务是按Creator从数据库查回来的。
+// 不是在请求里提交的任务返回nil
+func (t *Task) Creator() *model.User {
+	return t.creator
+}
+
+// Decode 把任务参数解析到v里
+func (t *Task) Decode(v any) error {
+	t.mu.Lock()
+	payload := t.info.Payload
+	t.mu.Unlock()
+	return json.Unmarshal([]byte(payload), v)
+}
+
+// SetProgress 记录进度，签名和model.UpdateProgress一致，可以直接传给驱动
+func (t *Task) SetProgress(p float64) {
+	if p < 0 {
+		p = 0
+	}
+	if p > 100 {
+		p = 100
+	}
+	t.mu.Lock()
+	t.info.Progress = p
+	save := time.Since(t.lastSave) >= progressSaveInterval
+	t.mu.Unlock()
+	if save {
+		t.m.persist(t)
+	}
+}
+
+// SetStatus 记录任务当前进行到哪一步
+func (t *Task) SetStatus(status string) {
+	t.mu.Lock()
+	t.info.Status = status
+	t.mu.Unlock()
+}
+
+// Info 返回任务当前状态的一份拷贝
+func (t *Task) Info() model.Task {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.info
+}
+
+// update 在锁内修改任务状态，随后落库
+func (t *Task) update(fn func(info *model.Task)) {
+	t.mu.Lock()
+	fn(&t.info)
+	t.mu.Unlock()
+	t.m.persist(t)
+}
+
+// transit 在锁内检查并修改任务状态，fn返回false表示不满足条件、什么都没改。
+// 用来避免两个请求同时恢复同一个任务时把它启动两次
+func (t *Task) transit(fn func(info *model.Task) bool) bool {
+	t.mu.Lock()
+	ok := fn(&t.info)
+	t.mu.Unlock()
+	if ok {
+		t.m.persist(t)
+	}
+	return ok
+}
+
+// reset 为新的一次运行准备context
+func (t *Task) reset() (context.Context, context.CancelCauseFunc) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ctx, t.cancel = context.WithCancelCause(t.m.baseCtx(t.creator))
+	return t.ctx, t.cancel
+}
+
+func (t *Task) stop(cause error) {
+	t.mu.Lock()
+	cancel := t.cancel
+	t.mu.Unlock()
+	if cancel != nil {
+		cancel(cause)
+	}
+}